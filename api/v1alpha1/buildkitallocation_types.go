@@ -0,0 +1,145 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AllocationPhase defines the lifecycle phase of a BuildKitAllocation
+// +kubebuilder:validation:Enum=Pending;Queued;Provisioning;Allocated;Expired;Failed
+type AllocationPhase string
+
+const (
+	// AllocationPhasePending indicates the allocation has not been requested yet, or is retried
+	AllocationPhasePending AllocationPhase = "Pending"
+	// AllocationPhaseQueued indicates the allocation is waiting for a worker
+	AllocationPhaseQueued AllocationPhase = "Queued"
+	// AllocationPhaseProvisioning indicates a new worker is being provisioned for the allocation
+	AllocationPhaseProvisioning AllocationPhase = "Provisioning"
+	// AllocationPhaseAllocated indicates the worker is bound and its credentials are in the Secret
+	AllocationPhaseAllocated AllocationPhase = "Allocated"
+	// AllocationPhaseExpired indicates the allocation reached its TTL or was revoked
+	AllocationPhaseExpired AllocationPhase = "Expired"
+	// AllocationPhaseFailed indicates the allocation cannot be made as specified
+	AllocationPhaseFailed AllocationPhase = "Failed"
+)
+
+// AllocationConditionReady is the condition reporting whether the worker is bound.
+const AllocationConditionReady = "Ready"
+
+// BuildKitAllocationSpec defines the desired state of BuildKitAllocation.
+type BuildKitAllocationSpec struct {
+	// PoolRef references the BuildKitPool to allocate a worker from
+	PoolRef PoolReference `json:"poolRef"`
+
+	// Platforms the worker must build for, e.g. linux/arm64
+	// +optional
+	// +kubebuilder:validation:items:Pattern=`^[a-z0-9]+/[a-z0-9_]+(/[a-z0-9]+)?$`
+	Platforms []string `json:"platforms,omitempty"`
+
+	// Size is the worker size, one of the pool's sizes. Defaults to the pool's first size
+	// +optional
+	// +kubebuilder:validation:Enum=sm;md;lg;xl
+	Size string `json:"size,omitempty"`
+
+	// TTL is how long the worker stays allocated, e.g. "30m". The controller
+	// renews the lease while the allocation exists, up to the TTL and the
+	// pool's maxTokenTTL. Defaults to 1h
+	// +optional
+	// +kubebuilder:validation:Pattern=`^([0-9]+(\.[0-9]+)?(ns|us|ms|s|m|h))+$`
+	TTL string `json:"ttl,omitempty"`
+
+	// Priority orders allocations waiting for a worker; higher goes first
+	// +optional
+	Priority int32 `json:"priority,omitempty"`
+
+	// Metadata contains optional job metadata recorded on the worker
+	// +optional
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// SecretName is the name of the Secret the client certificate, CA and
+	// gateway endpoint are written to. Defaults to the allocation name
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+}
+
+// BuildKitAllocationStatus defines the observed state of BuildKitAllocation.
+type BuildKitAllocationStatus struct {
+	// Phase is the current lifecycle phase
+	Phase AllocationPhase `json:"phase,omitempty"`
+
+	// Conditions represent the latest available observations
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// RequestID identifies the allocation request while it waits for a worker
+	// +optional
+	RequestID string `json:"requestId,omitempty"`
+
+	// AllocationID identifies the worker allocation once it is bound
+	// +optional
+	AllocationID string `json:"allocationId,omitempty"`
+
+	// PoolName is the pool the worker was allocated from
+	// +optional
+	PoolName string `json:"poolName,omitempty"`
+
+	// WorkerName is the name of the bound BuildKitWorker
+	// +optional
+	WorkerName string `json:"workerName,omitempty"`
+
+	// Platforms the bound worker builds for, native platform first
+	// +optional
+	Platforms []string `json:"platforms,omitempty"`
+
+	// SecretName is the name of the Secret holding the client credentials
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+
+	// GatewayEndpoint is the endpoint clients connect to
+	// +optional
+	GatewayEndpoint string `json:"gatewayEndpoint,omitempty"`
+
+	// AllocatedAt is when the worker was bound
+	// +optional
+	AllocatedAt *metav1.Time `json:"allocatedAt,omitempty"`
+
+	// ExpiresAt is when the allocation ends
+	// +optional
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
+
+	// Message provides additional status information
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Pool",type="string",JSONPath=".spec.poolRef.name"
+//+kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase"
+//+kubebuilder:printcolumn:name="Worker",type="string",JSONPath=".status.workerName"
+//+kubebuilder:printcolumn:name="Secret",type="string",JSONPath=".status.secretName",priority=1
+//+kubebuilder:printcolumn:name="Expires",type="date",JSONPath=".status.expiresAt",priority=1
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// BuildKitAllocation is the Schema for the buildkitallocations API.
+// Declaratively allocates a BuildKitWorker to in-cluster consumers such as
+// pipeline tasks and Jobs, which read the client credentials from a Secret.
+type BuildKitAllocation struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+
+	Spec   BuildKitAllocationSpec   `json:"spec"`
+	Status BuildKitAllocationStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// BuildKitAllocationList contains a list of BuildKitAllocation.
+type BuildKitAllocationList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+	Items           []BuildKitAllocation `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&BuildKitAllocation{}, &BuildKitAllocationList{})
+}
@@ -4,6 +4,22 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// OIDCConfigConditionReady is the condition reporting whether the issuer was
+// discovered and the client secret resolves.
+const OIDCConfigConditionReady = "Ready"
+
+// Reasons of the Ready condition of BuildKitOIDCConfigs.
+const (
+	// OIDCConfigReasonReady indicates the issuer's discovery document and keys were fetched
+	OIDCConfigReasonReady = "Ready"
+	// OIDCConfigReasonDisabled indicates the configuration is disabled
+	OIDCConfigReasonDisabled = "Disabled"
+	// OIDCConfigReasonDiscoveryFailed indicates the discovery document or keys could not be fetched
+	OIDCConfigReasonDiscoveryFailed = "DiscoveryFailed"
+	// OIDCConfigReasonSecretMissing indicates the client secret or its key does not exist
+	OIDCConfigReasonSecretMissing = "SecretMissing"
+)
+
 // BuildKitOIDCConfigSpec defines the desired state of BuildKitOIDCConfig.
 type BuildKitOIDCConfigSpec struct {
 	// Issuer is the OIDC issuer URL
@@ -48,6 +64,18 @@ type BuildKitOIDCConfigStatus struct {
 	// Message is a human-readable status message
 	Message string `json:"message,omitempty"`
 
+	// JWKSURI is the key set URL from the issuer's discovery document
+	// +optional
+	JWKSURI string `json:"jwksURI,omitempty"`
+
+	// LastRefreshTime is when the discovery document and keys were last fetched
+	// +optional
+	LastRefreshTime *metav1.Time `json:"lastRefreshTime,omitempty"`
+
+	// ObservedGeneration is the generation of the spec the status reflects
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
 	// Conditions represent the latest available observations
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
@@ -0,0 +1,5 @@
+package v1alpha1
+
+// Hub marks v1alpha1 as the version BuildKitPools are converted through. It is
+// also the storage version, so the controller keeps working with v1alpha1.
+func (*BuildKitPool) Hub() {}
@@ -46,30 +46,43 @@ const (
 
 // BuildKitPoolSpec defines the desired state of BuildKitPool.
 type BuildKitPoolSpec struct {
+	// ClassName is the name of the BuildKitPoolClass whose defaults apply to
+	// the pool. Fields the pool leaves out come from the class, and fields the
+	// class locks cannot be overridden
+	// +optional
+	ClassName string `json:"className,omitempty"`
+
 	// Scaling behavior
-	Scaling ScalingConfig `json:"scaling"`
+	// +optional
+	Scaling ScalingConfig `json:"scaling,omitempty"`
 
 	// Resource allocation
-	Resources ResourceConfig `json:"resources"`
+	// +optional
+	Resources ResourceConfig `json:"resources,omitempty"`
 
 	// BuildKit configuration (standard buildkitd.toml)
 	// If not provided, defaults will be generated
 	BuildkitConfig string `json:"buildkitConfig,omitempty"`
 
 	// Cache configuration
-	Cache CacheConfig `json:"cache"`
+	// +optional
+	Cache CacheConfig `json:"cache,omitempty"`
 
 	// TLS configuration
-	TLS TLSConfig `json:"tls"`
+	// +optional
+	TLS TLSConfig `json:"tls,omitempty"`
 
 	// Authentication
-	Auth AuthConfig `json:"auth"`
+	// +optional
+	Auth AuthConfig `json:"auth,omitempty"`
 
 	// Networking & Exposure
-	Networking NetworkingConfig `json:"networking"`
+	// +optional
+	Networking NetworkingConfig `json:"networking,omitempty"`
 
 	// Observability
-	Observability ObservabilityConfig `json:"observability"`
+	// +optional
+	Observability ObservabilityConfig `json:"observability,omitempty"`
 
 	// Gateway configuration for the pool gateway
 	// +optional
@@ -82,6 +95,129 @@ type BuildKitPoolSpec struct {
 	// GatewayImage is the gateway image to use
 	// Defaults to ghcr.io/smrt-devops/buildkit-controller/gateway:latest
 	GatewayImage string `json:"gatewayImage,omitempty"`
+
+	// Quotas limit worker allocations per identity, namespace or OIDC claim.
+	// An allocation must satisfy every quota that matches the caller.
+	// +optional
+	Quotas []AllocationQuota `json:"quotas,omitempty"`
+
+	// Platforms lists the platforms every worker of the pool builds for, e.g.
+	// linux/arm64. The first is the native platform and selects the nodes
+	// workers run on; the others are emulated. Ignored if workerGroups is set
+	// +kubebuilder:validation:items:Pattern=`^[a-z0-9]+/[a-z0-9_]+(/[a-z0-9]+)?$`
+	// +optional
+	Platforms []string `json:"platforms,omitempty"`
+
+	// WorkerGroups splits the pool's workers into groups that build for
+	// different platforms, e.g. one group on amd64 nodes and one on arm64
+	// nodes. Allocations get a worker from a group supporting the platforms
+	// they request; scaling.max applies to the pool as a whole
+	// +optional
+	WorkerGroups []WorkerGroup `json:"workerGroups,omitempty"`
+
+	// Sizes lists the worker sizes allocations may request. Allocations without
+	// a size get the first one. Without sizes every worker gets
+	// resources.buildkit, or the md size
+	// +optional
+	Sizes []WorkerSize `json:"sizes,omitempty"`
+}
+
+// WorkerSize is a worker size a pool offers, with its own limits.
+type WorkerSize struct {
+	// Name is the size profile: sm, md, lg or xl
+	// +kubebuilder:validation:Enum=sm;md;lg;xl
+	Name string `json:"name"`
+
+	// Min is the number of idle workers of this size kept warm. If any size
+	// sets min, warm workers are kept per size and scaling.min is ignored
+	// +optional
+	Min *int32 `json:"min,omitempty"`
+
+	// Max is the maximum number of workers of this size, within scaling.max
+	// +optional
+	Max *int32 `json:"max,omitempty"`
+
+	// Resources overrides the resources of the size profile
+	// +optional
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+}
+
+// WorkerGroup is a set of a pool's workers that build for the same platforms.
+type WorkerGroup struct {
+	// Name identifies the group on its workers
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	// +kubebuilder:validation:MaxLength=63
+	Name string `json:"name"`
+
+	// Platforms the group's workers build for, e.g. linux/arm64. The first is
+	// the native platform and selects the nodes workers run on through the
+	// kubernetes.io/os and kubernetes.io/arch labels; the others are emulated
+	// and need QEMU binfmt handlers on the nodes
+	// +kubebuilder:validation:MinItems=1
+	// +kubebuilder:validation:items:Pattern=`^[a-z0-9]+/[a-z0-9_]+(/[a-z0-9]+)?$`
+	Platforms []string `json:"platforms"`
+
+	// NodeSelector is added to the node selector of the native platform
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// Tolerations let the group's workers run on tainted nodes, e.g. a
+	// dedicated arm64 node pool
+	// +optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+}
+
+// QuotaScope defines what an allocation quota counts usage per.
+// +kubebuilder:validation:Enum=Identity;Namespace;Claim
+type QuotaScope string
+
+const (
+	QuotaScopeIdentity  QuotaScope = "Identity"
+	QuotaScopeNamespace QuotaScope = "Namespace"
+	QuotaScopeClaim     QuotaScope = "Claim"
+)
+
+// AllocationQuota limits the worker allocations of the callers it matches.
+// Callers are matched by users, namespaces and claims; an empty selector
+// matches every caller.
+type AllocationQuota struct {
+	// Name identifies the quota in errors and status
+	Name string `json:"name"`
+
+	// Scope is what usage is counted per: each identity, each ServiceAccount
+	// namespace or each value of the OIDC claim named by claim
+	// +kubebuilder:default=Identity
+	Scope QuotaScope `json:"scope,omitempty"`
+
+	// Claim is the OIDC claim usage is counted per when scope is Claim,
+	// e.g. repository_owner
+	// +optional
+	Claim string `json:"claim,omitempty"`
+
+	// Users is a list of identity patterns the quota applies to (supports wildcards)
+	// +optional
+	Users []string `json:"users,omitempty"`
+
+	// Namespaces is a list of namespace patterns of ServiceAccount callers the
+	// quota applies to (supports wildcards)
+	// +optional
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// Claims maps OIDC claim names to value patterns the caller's claims must match
+	// +optional
+	Claims map[string]string `json:"claims,omitempty"`
+
+	// MaxConcurrent is the maximum number of active allocations
+	// +optional
+	MaxConcurrent *int32 `json:"maxConcurrent,omitempty"`
+
+	// MaxPerHour is the maximum number of allocations in any one-hour window
+	// +optional
+	MaxPerHour *int32 `json:"maxPerHour,omitempty"`
+
+	// MaxTTL is the longest an allocation may last including renewals, e.g. "2h"
+	// +optional
+	MaxTTL string `json:"maxTTL,omitempty"`
 }
 
 // GatewayConfig defines the pool gateway configuration.
@@ -107,6 +243,12 @@ type GatewayConfig struct {
 	// Defaults to 24h
 	MaxTokenTTL string `json:"maxTokenTTL,omitempty"`
 
+	// IdleLeaseTimeout enables idle leases: allocations expire when they are
+	// not renewed within this duration, well before their TTL. Clients keep
+	// allocations alive by renewing them periodically.
+	// +optional
+	IdleLeaseTimeout string `json:"idleLeaseTimeout,omitempty"`
+
 	// ServiceType is the Kubernetes service type for the gateway
 	// Defaults to ClusterIP (suitable for Istio/Envoy sidecars, ingress controllers, etc.)
 	// Can be set to LoadBalancer for direct external access, or NodePort for node-based access
@@ -508,6 +650,21 @@ type AuthMethod struct {
 
 	// OIDC configuration (when type is oidc)
 	OIDC *OIDCConfig `json:"oidc,omitempty"`
+
+	// OIDCConfigRef references a BuildKitOIDCConfig whose tokens the pool trusts (when type is oidc).
+	// Only pools claims of tokens from the pool's own OIDC issuer or a referenced config are honored
+	// +optional
+	OIDCConfigRef *OIDCConfigReference `json:"oidcConfigRef,omitempty"`
+}
+
+// OIDCConfigReference references a BuildKitOIDCConfig.
+type OIDCConfigReference struct {
+	// Name is the name of the BuildKitOIDCConfig
+	Name string `json:"name"`
+
+	// Namespace is the namespace of the BuildKitOIDCConfig (defaults to the pool's namespace)
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
 }
 
 // MTLSConfig defines mTLS configuration.
@@ -522,8 +679,9 @@ type MTLSConfig struct {
 
 // TokenConfig defines token-based authentication.
 type TokenConfig struct {
-	// SecretRef is the name of the secret containing tokens
-	// Format: key = token, value = JSON with user and pools
+	// SecretRef is the name of the secret containing tokens, in the pool's namespace
+	// Format: key = token, value = JSON with user, pools, groups and optional expiresAt.
+	// If the value sets tokenHash (hex SHA-256 of the token), the key is only a name.
 	SecretRef string `json:"secretRef"`
 }
 
@@ -546,6 +704,9 @@ type ClaimsMapping struct {
 
 	// Pools is the claim name for pool access list
 	Pools string `json:"pools,omitempty"`
+
+	// Groups is the claim name for group membership
+	Groups string `json:"groups,omitempty"`
 }
 
 // RBACConfig defines RBAC configuration.
@@ -565,6 +726,10 @@ type RBACRule struct {
 
 	// Pools is a list of pool names (supports wildcards)
 	Pools []string `json:"pools"`
+
+	// Groups is a list of group patterns (supports wildcards)
+	// +optional
+	Groups []string `json:"groups,omitempty"`
 }
 
 // NetworkingConfig defines networking configuration.
@@ -665,6 +830,30 @@ type BuildKitPoolStatus struct {
 
 	// Connections contains connection statistics
 	Connections *ConnectionsStatus `json:"connections,omitempty"`
+
+	// Quotas reports the usage of each allocation quota per subject
+	// +optional
+	Quotas []QuotaUsage `json:"quotas,omitempty"`
+}
+
+// QuotaUsage is the usage of an allocation quota by one subject.
+type QuotaUsage struct {
+	// Name is the name of the quota
+	Name string `json:"name"`
+
+	// Subject is the identity, namespace or claim value the usage is counted for
+	Subject string `json:"subject"`
+
+	// Active is the number of active allocations
+	Active int32 `json:"active"`
+
+	// AllocationsLastHour is the number of allocations in the last hour
+	AllocationsLastHour int32 `json:"allocationsLastHour"`
+
+	// RecentAllocations are the times of the allocations in the last hour,
+	// oldest first. maxPerHour is counted from them after a controller restart
+	// +optional
+	RecentAllocations []metav1.Time `json:"recentAllocations,omitempty"`
 }
 
 // ConnectionsStatus contains connection statistics for the pool.
@@ -743,6 +932,7 @@ type CertificateInfo struct {
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:storageversion
 //+kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase"
 //+kubebuilder:printcolumn:name="Gateway",type="string",JSONPath=".status.gateway.ready",priority=1
 //+kubebuilder:printcolumn:name="Workers",type="integer",JSONPath=".status.workers.total"
@@ -0,0 +1,49 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// BuildKitPoolClassSpec defines the desired state of BuildKitPoolClass.
+type BuildKitPoolClassSpec struct {
+	// Defaults are merged under the spec of every pool referencing the class.
+	// Fields the pool sets win, unless they are locked; lists are replaced as
+	// a whole. className is ignored
+	// +optional
+	Defaults BuildKitPoolSpec `json:"defaults,omitempty"`
+
+	// LockedFields are the fields of defaults pools cannot override, as
+	// dot-separated paths in the pool spec, e.g. tls or auth.rbac. A locked
+	// field the class leaves out is cleared on the pool
+	// +optional
+	// +kubebuilder:validation:items:Pattern=`^[a-zA-Z]+(\.[a-zA-Z]+)*$`
+	LockedFields []string `json:"lockedFields,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster
+//+kubebuilder:printcolumn:name="Locked",type="string",JSONPath=".spec.lockedFields",priority=1
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// BuildKitPoolClass is the Schema for the buildkitpoolclasses API.
+// This is a cluster-scoped resource holding pool defaults shared by every
+// BuildKitPool that references it with spec.className.
+type BuildKitPoolClass struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec BuildKitPoolClassSpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// BuildKitPoolClassList contains a list of BuildKitPoolClass.
+type BuildKitPoolClassList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []BuildKitPoolClass `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&BuildKitPoolClass{}, &BuildKitPoolClassList{})
+}
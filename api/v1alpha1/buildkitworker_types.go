@@ -30,6 +30,18 @@ type BuildKitWorkerSpec struct {
 	// PoolRef references the parent BuildKitPool
 	PoolRef PoolReference `json:"poolRef"`
 
+	// WorkerGroup is the pool worker group the worker belongs to
+	// +optional
+	WorkerGroup string `json:"workerGroup,omitempty"`
+
+	// Platforms the worker builds for, native platform first
+	// +optional
+	Platforms []string `json:"platforms,omitempty"`
+
+	// Size is the pool worker size the worker was created with
+	// +optional
+	Size string `json:"size,omitempty"`
+
 	// Allocation contains job allocation information (set when allocated)
 	// +optional
 	Allocation *WorkerAllocation `json:"allocation,omitempty"`
@@ -60,13 +72,18 @@ type WorkerAllocation struct {
 	// AllocatedAt is when the worker was allocated
 	AllocatedAt metav1.Time `json:"allocatedAt"`
 
-	// ExpiresAt is when the allocation expires (optional timeout)
+	// ExpiresAt is when the allocation expires unless it is renewed (optional timeout)
 	// +optional
 	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
 
 	// Metadata contains optional job metadata
 	// +optional
 	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// Quotas maps the names of the pool quotas the allocation counts against
+	// to the subject it is counted for
+	// +optional
+	Quotas map[string]string `json:"quotas,omitempty"`
 }
 
 // BuildKitWorkerStatus defines the observed state of BuildKitWorker.
@@ -115,6 +132,8 @@ type BuildKitWorkerStatus struct {
 //+kubebuilder:printcolumn:name="Pool",type="string",JSONPath=".spec.poolRef.name"
 //+kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase"
 //+kubebuilder:printcolumn:name="Pod",type="string",JSONPath=".status.podName"
+//+kubebuilder:printcolumn:name="Platform",type="string",JSONPath=".spec.platforms[0]",priority=1
+//+kubebuilder:printcolumn:name="Size",type="string",JSONPath=".spec.size",priority=1
 //+kubebuilder:printcolumn:name="JobID",type="string",JSONPath=".spec.allocation.jobId",priority=1
 //+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
@@ -0,0 +1,585 @@
+package v1beta1
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	buildkitv1alpha1 "github.com/smrt-devops/buildkit-controller/api/v1alpha1"
+)
+
+const (
+	// v1alpha1FieldsAnnotation holds the v1alpha1 fields a v1beta1 pool has no
+	// place for, so converting a pool to v1beta1 and back restores them.
+	v1alpha1FieldsAnnotation = "buildkit.smrt-devops.net/v1alpha1-fields"
+
+	// unsetFieldsAnnotation lists the optional v1beta1 booleans a pool leaves
+	// unset, which v1alpha1 stores with their default.
+	unsetFieldsAnnotation = "buildkit.smrt-devops.net/v1beta1-unset-fields"
+)
+
+// Defaults of the v1alpha1 scaling fields v1beta1 drops.
+const (
+	defaultTargetCPUUtilization    int32 = 70
+	defaultTargetMemoryUtilization int32 = 80
+	defaultTargetActiveConnections int32 = 10
+)
+
+// v1alpha1Fields are the v1alpha1 fields v1beta1 drops or merges.
+type v1alpha1Fields struct {
+	ScalingMode             buildkitv1alpha1.ScalingMode  `json:"scalingMode,omitempty"`
+	TargetCPUUtilization    *int32                        `json:"targetCPUUtilization,omitempty"`
+	TargetMemoryUtilization *int32                        `json:"targetMemoryUtilization,omitempty"`
+	TargetActiveConnections *int32                        `json:"targetActiveConnections,omitempty"`
+	Sidecar                 *corev1.ResourceRequirements  `json:"sidecar,omitempty"`
+	NetworkingServiceType   *buildkitv1alpha1.ServiceType `json:"networkingServiceType,omitempty"`
+	NetworkingPort          *int32                        `json:"networkingPort,omitempty"`
+	GatewayPort             *int32                        `json:"gatewayPort,omitempty"`
+
+	// Durations holds the v1alpha1 value of duration fields, by path, that do
+	// not parse or are not written the way Go formats them
+	Durations map[string]string `json:"durations,omitempty"`
+}
+
+// ConvertTo converts the pool to the v1alpha1 hub version.
+func (src *BuildKitPool) ConvertTo(dstRaw conversion.Hub) error {
+	dst, ok := dstRaw.(*buildkitv1alpha1.BuildKitPool)
+	if !ok {
+		return fmt.Errorf("expected a v1alpha1 BuildKitPool but got %T", dstRaw)
+	}
+
+	lost := &v1alpha1Fields{}
+	if data, ok := src.Annotations[v1alpha1FieldsAnnotation]; ok {
+		if err := json.Unmarshal([]byte(data), lost); err != nil {
+			return fmt.Errorf("invalid %s annotation: %w", v1alpha1FieldsAnnotation, err)
+		}
+	}
+
+	in := src.DeepCopy()
+	var unset []string
+	dst.ObjectMeta = in.ObjectMeta
+	dst.Spec = convertSpecTo(&in.Spec, lost, &unset)
+	dst.Status = convertStatusTo(&in.Status)
+
+	delete(dst.Annotations, v1alpha1FieldsAnnotation)
+	if len(unset) > 0 {
+		data, err := json.Marshal(unset)
+		if err != nil {
+			return fmt.Errorf("failed to encode unset fields: %w", err)
+		}
+		setAnnotation(&dst.ObjectMeta, unsetFieldsAnnotation, string(data))
+	} else {
+		delete(dst.Annotations, unsetFieldsAnnotation)
+	}
+	if len(dst.Annotations) == 0 {
+		dst.Annotations = nil
+	}
+	return nil
+}
+
+// ConvertFrom converts the pool from the v1alpha1 hub version.
+func (dst *BuildKitPool) ConvertFrom(srcRaw conversion.Hub) error {
+	src, ok := srcRaw.(*buildkitv1alpha1.BuildKitPool)
+	if !ok {
+		return fmt.Errorf("expected a v1alpha1 BuildKitPool but got %T", srcRaw)
+	}
+
+	unset := map[string]bool{}
+	if data, ok := src.Annotations[unsetFieldsAnnotation]; ok {
+		var paths []string
+		if err := json.Unmarshal([]byte(data), &paths); err != nil {
+			return fmt.Errorf("invalid %s annotation: %w", unsetFieldsAnnotation, err)
+		}
+		for _, path := range paths {
+			unset[path] = true
+		}
+	}
+
+	in := src.DeepCopy()
+	lost := &v1alpha1Fields{}
+	dst.ObjectMeta = in.ObjectMeta
+	dst.Spec = convertSpecFrom(&in.Spec, lost, unset)
+	dst.Status = convertStatusFrom(&in.Status)
+
+	delete(dst.Annotations, unsetFieldsAnnotation)
+	if lost.isZero() {
+		delete(dst.Annotations, v1alpha1FieldsAnnotation)
+	} else {
+		data, err := json.Marshal(lost)
+		if err != nil {
+			return fmt.Errorf("failed to encode v1alpha1 fields: %w", err)
+		}
+		setAnnotation(&dst.ObjectMeta, v1alpha1FieldsAnnotation, string(data))
+	}
+	if len(dst.Annotations) == 0 {
+		dst.Annotations = nil
+	}
+	return nil
+}
+
+// convertSpecTo converts a v1beta1 spec to v1alpha1, restoring the v1alpha1
+// fields that still match it and collecting the unset booleans.
+func convertSpecTo(in *BuildKitPoolSpec, lost *v1alpha1Fields, unset *[]string) buildkitv1alpha1.BuildKitPoolSpec {
+	out := buildkitv1alpha1.BuildKitPoolSpec{
+		ClassName:      in.ClassName,
+		BuildkitConfig: in.BuildkitConfig,
+		BuildkitImage:  in.BuildkitImage,
+		GatewayImage:   in.GatewayImage,
+		Platforms:      in.Platforms,
+	}
+
+	out.Scaling = buildkitv1alpha1.ScalingConfig{
+		Mode:                    lost.ScalingMode,
+		Min:                     in.Scaling.Min,
+		Max:                     in.Scaling.Max,
+		ScaleDownDelay:          lost.durationTo(in.Scaling.ScaleDownDelay, "scaling.scaleDownDelay"),
+		TargetCPUUtilization:    lost.TargetCPUUtilization,
+		TargetMemoryUtilization: lost.TargetMemoryUtilization,
+		TargetActiveConnections: lost.TargetActiveConnections,
+		ScaleDownSchedule:       in.Scaling.ScaleDownSchedule,
+	}
+
+	out.Resources.Buildkit = in.Resources
+	if lost.Sidecar != nil {
+		out.Resources.Sidecar = *lost.Sidecar
+	}
+
+	for _, backend := range in.Cache.Backends {
+		out.Cache.Backends = append(out.Cache.Backends, buildkitv1alpha1.CacheBackend{
+			Type:     backend.Type,
+			Registry: (*buildkitv1alpha1.RegistryCacheConfig)(backend.Registry),
+			S3:       (*buildkitv1alpha1.S3CacheConfig)(backend.S3),
+			Local:    (*buildkitv1alpha1.LocalCacheConfig)(backend.Local),
+		})
+	}
+	out.Cache.GC = buildkitv1alpha1.GarbageCollectionConfig{
+		Enabled:      boolTo(in.Cache.GC.Enabled, "cache.gc.enabled", unset),
+		Schedule:     in.Cache.GC.Schedule,
+		KeepStorage:  in.Cache.GC.KeepStorage,
+		KeepDuration: lost.durationTo(in.Cache.GC.KeepDuration, "cache.gc.keepDuration"),
+	}
+
+	out.TLS = buildkitv1alpha1.TLSConfig{
+		Enabled: boolTo(in.TLS.Enabled, "tls.enabled", unset),
+		Mode:    buildkitv1alpha1.TLSMode(in.TLS.Mode),
+		Manual:  (*buildkitv1alpha1.TLSManualConfig)(in.TLS.Manual),
+	}
+	if auto := in.TLS.Auto; auto != nil {
+		out.TLS.Auto = &buildkitv1alpha1.TLSAutoConfig{
+			ServerCertDuration: lost.durationTo(auto.ServerCertDuration, "tls.auto.serverCertDuration"),
+			RotateBeforeExpiry: lost.durationTo(auto.RotateBeforeExpiry, "tls.auto.rotateBeforeExpiry"),
+			Organization:       auto.Organization,
+		}
+	}
+
+	for i, method := range in.Auth.Methods {
+		converted := buildkitv1alpha1.AuthMethod{
+			Type:          buildkitv1alpha1.AuthMethodType(method.Type),
+			Token:         (*buildkitv1alpha1.TokenConfig)(method.Token),
+			OIDCConfigRef: (*buildkitv1alpha1.OIDCConfigReference)(method.OIDCConfigRef),
+		}
+		if mtls := method.MTLS; mtls != nil {
+			converted.MTLS = &buildkitv1alpha1.MTLSConfig{
+				Required:       boolTo(mtls.Required, fmt.Sprintf("auth.methods[%d].mtls.required", i), unset),
+				ClientCASecret: mtls.ClientCASecret,
+			}
+		}
+		if oidc := method.OIDC; oidc != nil {
+			converted.OIDC = &buildkitv1alpha1.OIDCConfig{
+				Issuer:        oidc.Issuer,
+				Audience:      oidc.Audience,
+				ClaimsMapping: buildkitv1alpha1.ClaimsMapping(oidc.ClaimsMapping),
+			}
+		}
+		out.Auth.Methods = append(out.Auth.Methods, converted)
+	}
+	if rbac := in.Auth.RBAC; rbac != nil {
+		out.Auth.RBAC = &buildkitv1alpha1.RBACConfig{Enabled: boolTo(rbac.Enabled, "auth.rbac.enabled", unset)}
+		for _, rule := range rbac.Rules {
+			out.Auth.RBAC.Rules = append(out.Auth.RBAC.Rules, buildkitv1alpha1.RBACRule(rule))
+		}
+	}
+
+	// v1alpha1 splits networking between networking and gateway, and the
+	// gateway's port wins over the networking port
+	serviceType := buildkitv1alpha1.ServiceType(in.Networking.ServiceType)
+	out.Networking = buildkitv1alpha1.NetworkingConfig{
+		ServiceType:  serviceType,
+		External:     (*buildkitv1alpha1.ExternalConfig)(in.Networking.External),
+		Port:         in.Networking.Port,
+		AllowedCIDRs: in.Networking.AllowedCIDRs,
+		Annotations:  in.Networking.Annotations,
+	}
+	if lost.NetworkingServiceType != nil {
+		out.Networking.ServiceType = *lost.NetworkingServiceType
+	}
+	out.Gateway = buildkitv1alpha1.GatewayConfig{
+		Enabled:           boolTo(in.Gateway.Enabled, "gateway.enabled", unset),
+		Replicas:          in.Gateway.Replicas,
+		Resources:         (*buildkitv1alpha1.GatewayResources)(in.Gateway.Resources),
+		TokenTTL:          lost.durationTo(in.Gateway.TokenTTL, "gateway.tokenTTL"),
+		MaxTokenTTL:       lost.durationTo(in.Gateway.MaxTokenTTL, "gateway.maxTokenTTL"),
+		IdleLeaseTimeout:  lost.durationTo(in.Gateway.IdleLeaseTimeout, "gateway.idleLeaseTimeout"),
+		ServiceType:       serviceType,
+		NodePort:          in.Networking.NodePort,
+		LoadBalancerClass: in.Networking.LoadBalancerClass,
+	}
+	if lost.GatewayPort != nil && int32PtrEqual(lost.GatewayPort, in.Networking.Port) {
+		out.Networking.Port = lost.NetworkingPort
+		out.Gateway.Port = lost.GatewayPort
+	}
+	if api := in.Networking.GatewayAPI; api != nil {
+		out.Gateway.GatewayAPI = &buildkitv1alpha1.GatewayAPIConfig{
+			Enabled:          api.Enabled,
+			GatewayRef:       (*buildkitv1alpha1.GatewayAPIRef)(api.GatewayRef),
+			GatewayClassName: api.GatewayClassName,
+			GatewayName:      api.GatewayName,
+			Hostname:         api.Hostname,
+			Annotations:      api.Annotations,
+		}
+		if tls := api.TLS; tls != nil {
+			out.Gateway.GatewayAPI.TLS = &buildkitv1alpha1.GatewayAPITLSConfig{
+				Mode:            tls.Mode,
+				SecretName:      tls.SecretName,
+				SecretNamespace: tls.SecretNamespace,
+				AutoGenerate:    boolTo(tls.AutoGenerate, "networking.gatewayAPI.tls.autoGenerate", unset),
+			}
+		}
+	}
+	if ingress := in.Networking.Ingress; ingress != nil {
+		out.Gateway.Ingress = &buildkitv1alpha1.IngressConfig{
+			Enabled:          ingress.Enabled,
+			IngressClassName: ingress.IngressClassName,
+			Hostname:         ingress.Hostname,
+			TLS:              (*buildkitv1alpha1.IngressTLSConfig)(ingress.TLS),
+			Annotations:      ingress.Annotations,
+		}
+	}
+
+	out.Observability = buildkitv1alpha1.ObservabilityConfig{
+		Metrics: buildkitv1alpha1.MetricsConfig{
+			Enabled: boolTo(in.Observability.Metrics.Enabled, "observability.metrics.enabled", unset),
+			Port:    in.Observability.Metrics.Port,
+		},
+		Logging: buildkitv1alpha1.LoggingConfig(in.Observability.Logging),
+	}
+
+	for i, quota := range in.Quotas {
+		out.Quotas = append(out.Quotas, buildkitv1alpha1.AllocationQuota{
+			Name:          quota.Name,
+			Scope:         buildkitv1alpha1.QuotaScope(quota.Scope),
+			Claim:         quota.Claim,
+			Users:         quota.Users,
+			Namespaces:    quota.Namespaces,
+			Claims:        quota.Claims,
+			MaxConcurrent: quota.MaxConcurrent,
+			MaxPerHour:    quota.MaxPerHour,
+			MaxTTL:        lost.durationTo(quota.MaxTTL, fmt.Sprintf("quotas[%d].maxTTL", i)),
+		})
+	}
+	for _, group := range in.WorkerGroups {
+		out.WorkerGroups = append(out.WorkerGroups, buildkitv1alpha1.WorkerGroup(group))
+	}
+	for _, size := range in.Sizes {
+		out.Sizes = append(out.Sizes, buildkitv1alpha1.WorkerSize(size))
+	}
+	return out
+}
+
+// convertSpecFrom converts a v1alpha1 spec to v1beta1, recording the v1alpha1
+// fields it cannot represent in lost.
+func convertSpecFrom(in *buildkitv1alpha1.BuildKitPoolSpec, lost *v1alpha1Fields, unset map[string]bool) BuildKitPoolSpec {
+	out := BuildKitPoolSpec{
+		ClassName:      in.ClassName,
+		BuildkitConfig: in.BuildkitConfig,
+		BuildkitImage:  in.BuildkitImage,
+		GatewayImage:   in.GatewayImage,
+		Platforms:      in.Platforms,
+	}
+
+	out.Scaling = ScalingConfig{
+		Min:               in.Scaling.Min,
+		Max:               in.Scaling.Max,
+		ScaleDownDelay:    lost.durationFrom(in.Scaling.ScaleDownDelay, "scaling.scaleDownDelay"),
+		ScaleDownSchedule: in.Scaling.ScaleDownSchedule,
+	}
+	// Values equal to their v1alpha1 default are left out; the API server sets
+	// them again when the pool is stored
+	if in.Scaling.Mode != buildkitv1alpha1.ScalingModeAuto {
+		lost.ScalingMode = in.Scaling.Mode
+	}
+	lost.TargetCPUUtilization = nonDefault(in.Scaling.TargetCPUUtilization, defaultTargetCPUUtilization)
+	lost.TargetMemoryUtilization = nonDefault(in.Scaling.TargetMemoryUtilization, defaultTargetMemoryUtilization)
+	lost.TargetActiveConnections = nonDefault(in.Scaling.TargetActiveConnections, defaultTargetActiveConnections)
+
+	out.Resources = in.Resources.Buildkit
+	if sidecar := in.Resources.Sidecar; len(sidecar.Limits) > 0 || len(sidecar.Requests) > 0 || len(sidecar.Claims) > 0 {
+		lost.Sidecar = &sidecar
+	}
+
+	for _, backend := range in.Cache.Backends {
+		out.Cache.Backends = append(out.Cache.Backends, CacheBackend{
+			Type:     backend.Type,
+			Registry: (*RegistryCacheConfig)(backend.Registry),
+			S3:       (*S3CacheConfig)(backend.S3),
+			Local:    (*LocalCacheConfig)(backend.Local),
+		})
+	}
+	out.Cache.GC = GarbageCollectionConfig{
+		Enabled:      boolFrom(in.Cache.GC.Enabled, "cache.gc.enabled", unset),
+		Schedule:     in.Cache.GC.Schedule,
+		KeepStorage:  in.Cache.GC.KeepStorage,
+		KeepDuration: lost.durationFrom(in.Cache.GC.KeepDuration, "cache.gc.keepDuration"),
+	}
+
+	out.TLS = TLSConfig{
+		Enabled: boolFrom(in.TLS.Enabled, "tls.enabled", unset),
+		Mode:    TLSMode(in.TLS.Mode),
+		Manual:  (*TLSManualConfig)(in.TLS.Manual),
+	}
+	if auto := in.TLS.Auto; auto != nil {
+		out.TLS.Auto = &TLSAutoConfig{
+			ServerCertDuration: lost.durationFrom(auto.ServerCertDuration, "tls.auto.serverCertDuration"),
+			RotateBeforeExpiry: lost.durationFrom(auto.RotateBeforeExpiry, "tls.auto.rotateBeforeExpiry"),
+			Organization:       auto.Organization,
+		}
+	}
+
+	for i, method := range in.Auth.Methods {
+		converted := AuthMethod{
+			Type:          AuthMethodType(method.Type),
+			Token:         (*TokenConfig)(method.Token),
+			OIDCConfigRef: (*OIDCConfigReference)(method.OIDCConfigRef),
+		}
+		if mtls := method.MTLS; mtls != nil {
+			converted.MTLS = &MTLSConfig{
+				Required:       boolFrom(mtls.Required, fmt.Sprintf("auth.methods[%d].mtls.required", i), unset),
+				ClientCASecret: mtls.ClientCASecret,
+			}
+		}
+		if oidc := method.OIDC; oidc != nil {
+			converted.OIDC = &OIDCConfig{
+				Issuer:        oidc.Issuer,
+				Audience:      oidc.Audience,
+				ClaimsMapping: ClaimsMapping(oidc.ClaimsMapping),
+			}
+		}
+		out.Auth.Methods = append(out.Auth.Methods, converted)
+	}
+	if rbac := in.Auth.RBAC; rbac != nil {
+		out.Auth.RBAC = &RBACConfig{Enabled: boolFrom(rbac.Enabled, "auth.rbac.enabled", unset)}
+		for _, rule := range rbac.Rules {
+			out.Auth.RBAC.Rules = append(out.Auth.RBAC.Rules, RBACRule(rule))
+		}
+	}
+
+	// The gateway's service type and port are the ones in effect in v1alpha1
+	out.Networking = NetworkingConfig{
+		ServiceType:       ServiceType(in.Gateway.ServiceType),
+		Port:              in.Networking.Port,
+		NodePort:          in.Gateway.NodePort,
+		LoadBalancerClass: in.Gateway.LoadBalancerClass,
+		Annotations:       in.Networking.Annotations,
+		AllowedCIDRs:      in.Networking.AllowedCIDRs,
+		External:          (*ExternalConfig)(in.Networking.External),
+	}
+	if in.Networking.ServiceType != in.Gateway.ServiceType {
+		serviceType := in.Networking.ServiceType
+		lost.NetworkingServiceType = &serviceType
+	}
+	if in.Gateway.Port != nil {
+		out.Networking.Port = in.Gateway.Port
+		lost.NetworkingPort = in.Networking.Port
+		lost.GatewayPort = in.Gateway.Port
+	}
+	if api := in.Gateway.GatewayAPI; api != nil {
+		out.Networking.GatewayAPI = &GatewayAPIConfig{
+			Enabled:          api.Enabled,
+			GatewayRef:       (*GatewayAPIRef)(api.GatewayRef),
+			GatewayClassName: api.GatewayClassName,
+			GatewayName:      api.GatewayName,
+			Hostname:         api.Hostname,
+			Annotations:      api.Annotations,
+		}
+		if tls := api.TLS; tls != nil {
+			out.Networking.GatewayAPI.TLS = &GatewayAPITLSConfig{
+				Mode:            tls.Mode,
+				SecretName:      tls.SecretName,
+				SecretNamespace: tls.SecretNamespace,
+				AutoGenerate:    boolFrom(tls.AutoGenerate, "networking.gatewayAPI.tls.autoGenerate", unset),
+			}
+		}
+	}
+	if ingress := in.Gateway.Ingress; ingress != nil {
+		out.Networking.Ingress = &IngressConfig{
+			Enabled:          ingress.Enabled,
+			IngressClassName: ingress.IngressClassName,
+			Hostname:         ingress.Hostname,
+			TLS:              (*IngressTLSConfig)(ingress.TLS),
+			Annotations:      ingress.Annotations,
+		}
+	}
+
+	out.Gateway = GatewayConfig{
+		Enabled:          boolFrom(in.Gateway.Enabled, "gateway.enabled", unset),
+		Replicas:         in.Gateway.Replicas,
+		Resources:        (*GatewayResources)(in.Gateway.Resources),
+		TokenTTL:         lost.durationFrom(in.Gateway.TokenTTL, "gateway.tokenTTL"),
+		MaxTokenTTL:      lost.durationFrom(in.Gateway.MaxTokenTTL, "gateway.maxTokenTTL"),
+		IdleLeaseTimeout: lost.durationFrom(in.Gateway.IdleLeaseTimeout, "gateway.idleLeaseTimeout"),
+	}
+
+	out.Observability = ObservabilityConfig{
+		Metrics: MetricsConfig{
+			Enabled: boolFrom(in.Observability.Metrics.Enabled, "observability.metrics.enabled", unset),
+			Port:    in.Observability.Metrics.Port,
+		},
+		Logging: LoggingConfig(in.Observability.Logging),
+	}
+
+	for i, quota := range in.Quotas {
+		out.Quotas = append(out.Quotas, AllocationQuota{
+			Name:          quota.Name,
+			Scope:         QuotaScope(quota.Scope),
+			Claim:         quota.Claim,
+			Users:         quota.Users,
+			Namespaces:    quota.Namespaces,
+			Claims:        quota.Claims,
+			MaxConcurrent: quota.MaxConcurrent,
+			MaxPerHour:    quota.MaxPerHour,
+			MaxTTL:        lost.durationFrom(quota.MaxTTL, fmt.Sprintf("quotas[%d].maxTTL", i)),
+		})
+	}
+	for _, group := range in.WorkerGroups {
+		out.WorkerGroups = append(out.WorkerGroups, WorkerGroup(group))
+	}
+	for _, size := range in.Sizes {
+		out.Sizes = append(out.Sizes, WorkerSize(size))
+	}
+	return out
+}
+
+func convertStatusTo(in *BuildKitPoolStatus) buildkitv1alpha1.BuildKitPoolStatus {
+	out := buildkitv1alpha1.BuildKitPoolStatus{
+		Conditions:          in.Conditions,
+		Endpoint:            in.Endpoint,
+		Phase:               in.Phase,
+		Gateway:             (*buildkitv1alpha1.GatewayStatus)(in.Gateway),
+		Workers:             buildkitv1alpha1.WorkersStatus(in.Workers),
+		LastActivityTime:    in.LastActivityTime,
+		ServerCert:          (*buildkitv1alpha1.CertificateInfo)(in.ServerCert),
+		TLSSecretName:       in.TLSSecretName,
+		WorkerTLSSecretName: in.WorkerTLSSecretName,
+		LastScaleTime:       in.LastScaleTime,
+		Connections:         (*buildkitv1alpha1.ConnectionsStatus)(in.Connections),
+	}
+	for _, usage := range in.Quotas {
+		out.Quotas = append(out.Quotas, buildkitv1alpha1.QuotaUsage(usage))
+	}
+	return out
+}
+
+func convertStatusFrom(in *buildkitv1alpha1.BuildKitPoolStatus) BuildKitPoolStatus {
+	out := BuildKitPoolStatus{
+		Conditions:          in.Conditions,
+		Endpoint:            in.Endpoint,
+		Phase:               in.Phase,
+		Gateway:             (*GatewayStatus)(in.Gateway),
+		Workers:             WorkersStatus(in.Workers),
+		LastActivityTime:    in.LastActivityTime,
+		ServerCert:          (*CertificateInfo)(in.ServerCert),
+		TLSSecretName:       in.TLSSecretName,
+		WorkerTLSSecretName: in.WorkerTLSSecretName,
+		LastScaleTime:       in.LastScaleTime,
+		Connections:         (*ConnectionsStatus)(in.Connections),
+	}
+	for _, usage := range in.Quotas {
+		out.Quotas = append(out.Quotas, QuotaUsage(usage))
+	}
+	return out
+}
+
+// durationTo returns the v1alpha1 value of a duration field, keeping the
+// original value if it still matches.
+func (l *v1alpha1Fields) durationTo(value *metav1.Duration, path string) string {
+	if original, ok := l.Durations[path]; ok {
+		parsed, err := time.ParseDuration(original)
+		if (value == nil && err != nil) || (value != nil && err == nil && parsed == value.Duration) {
+			return original
+		}
+	}
+	if value == nil {
+		return ""
+	}
+	return value.Duration.String()
+}
+
+// durationFrom parses a v1alpha1 duration field, recording values that do not
+// parse or that Go formats differently.
+func (l *v1alpha1Fields) durationFrom(value, path string) *metav1.Duration {
+	if value == "" {
+		return nil
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed.String() != value {
+		if l.Durations == nil {
+			l.Durations = map[string]string{}
+		}
+		l.Durations[path] = value
+	}
+	if err != nil {
+		return nil
+	}
+	return &metav1.Duration{Duration: parsed}
+}
+
+func (l *v1alpha1Fields) isZero() bool {
+	return l.ScalingMode == "" && l.TargetCPUUtilization == nil && l.TargetMemoryUtilization == nil &&
+		l.TargetActiveConnections == nil && l.Sidecar == nil && l.NetworkingServiceType == nil &&
+		l.NetworkingPort == nil && l.GatewayPort == nil && len(l.Durations) == 0
+}
+
+// boolTo returns the v1alpha1 value of an optional boolean that defaults to
+// true, recording it if it is unset.
+func boolTo(value *bool, path string, unset *[]string) bool {
+	if value == nil {
+		*unset = append(*unset, path)
+		return true
+	}
+	return *value
+}
+
+// boolFrom returns the v1beta1 value of a boolean that defaults to true,
+// leaving it unset if it was unset in v1beta1 and still has its default.
+func boolFrom(value bool, path string, unset map[string]bool) *bool {
+	if value && unset[path] {
+		return nil
+	}
+	return &value
+}
+
+// nonDefault returns value unless it is set to its default.
+func nonDefault(value *int32, def int32) *int32 {
+	if value != nil && *value == def {
+		return nil
+	}
+	return value
+}
+
+func int32PtrEqual(a, b *int32) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func setAnnotation(meta *metav1.ObjectMeta, key, value string) {
+	if meta.Annotations == nil {
+		meta.Annotations = map[string]string{}
+	}
+	meta.Annotations[key] = value
+}
@@ -0,0 +1,898 @@
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TLSMode defines how TLS certificates are managed
+// +kubebuilder:validation:Enum=auto;manual
+type TLSMode string
+
+const (
+	TLSModeAuto   TLSMode = "auto"
+	TLSModeManual TLSMode = "manual"
+)
+
+// AuthMethodType defines the type of authentication method
+// +kubebuilder:validation:Enum=mtls;token;oidc
+type AuthMethodType string
+
+const (
+	AuthMethodMTLS  AuthMethodType = "mtls"
+	AuthMethodToken AuthMethodType = "token"
+	AuthMethodOIDC  AuthMethodType = "oidc"
+)
+
+// ServiceType defines the Kubernetes service type
+// +kubebuilder:validation:Enum=ClusterIP;LoadBalancer;NodePort
+type ServiceType string
+
+const (
+	ServiceTypeClusterIP    ServiceType = "ClusterIP"
+	ServiceTypeLoadBalancer ServiceType = "LoadBalancer"
+	ServiceTypeNodePort     ServiceType = "NodePort"
+)
+
+// QuotaScope defines what an allocation quota counts usage per.
+// +kubebuilder:validation:Enum=Identity;Namespace;Claim
+type QuotaScope string
+
+const (
+	QuotaScopeIdentity  QuotaScope = "Identity"
+	QuotaScopeNamespace QuotaScope = "Namespace"
+	QuotaScopeClaim     QuotaScope = "Claim"
+)
+
+// BuildKitPoolSpec defines the desired state of BuildKitPool.
+type BuildKitPoolSpec struct {
+	// ClassName is the name of the BuildKitPoolClass whose defaults apply to
+	// the pool. Fields the pool leaves out come from the class, and fields the
+	// class locks cannot be overridden
+	// +optional
+	ClassName string `json:"className,omitempty"`
+
+	// Scaling behavior
+	// +optional
+	Scaling ScalingConfig `json:"scaling,omitempty"`
+
+	// Resources of the buildkitd container of each worker. Sizes override them
+	// +optional
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// BuildKit configuration (standard buildkitd.toml)
+	// If not provided, defaults will be generated
+	// +optional
+	BuildkitConfig string `json:"buildkitConfig,omitempty"`
+
+	// BuildkitImage is the buildkit daemon image to use
+	// Defaults to moby/buildkit:master-rootless
+	// +optional
+	BuildkitImage string `json:"buildkitImage,omitempty"`
+
+	// GatewayImage is the gateway image to use
+	// Defaults to ghcr.io/smrt-devops/buildkit-controller/gateway:latest
+	// +optional
+	GatewayImage string `json:"gatewayImage,omitempty"`
+
+	// Cache configuration
+	// +optional
+	Cache CacheConfig `json:"cache,omitempty"`
+
+	// TLS configuration
+	// +optional
+	TLS TLSConfig `json:"tls,omitempty"`
+
+	// Authentication
+	// +optional
+	Auth AuthConfig `json:"auth,omitempty"`
+
+	// Networking configures how the pool gateway is exposed, inside the
+	// cluster and externally
+	// +optional
+	Networking NetworkingConfig `json:"networking,omitempty"`
+
+	// Observability
+	// +optional
+	Observability ObservabilityConfig `json:"observability,omitempty"`
+
+	// Gateway configures the pool gateway deployment and its allocation tokens
+	// +optional
+	Gateway GatewayConfig `json:"gateway,omitempty"`
+
+	// Quotas limit worker allocations per identity, namespace or OIDC claim.
+	// An allocation must satisfy every quota that matches the caller.
+	// +optional
+	Quotas []AllocationQuota `json:"quotas,omitempty"`
+
+	// Platforms lists the platforms every worker of the pool builds for, e.g.
+	// linux/arm64. The first is the native platform and selects the nodes
+	// workers run on; the others are emulated. Ignored if workerGroups is set
+	// +kubebuilder:validation:items:Pattern=`^[a-z0-9]+/[a-z0-9_]+(/[a-z0-9]+)?$`
+	// +optional
+	Platforms []string `json:"platforms,omitempty"`
+
+	// WorkerGroups splits the pool's workers into groups that build for
+	// different platforms, e.g. one group on amd64 nodes and one on arm64
+	// nodes. Allocations get a worker from a group supporting the platforms
+	// they request; scaling.max applies to the pool as a whole
+	// +optional
+	WorkerGroups []WorkerGroup `json:"workerGroups,omitempty"`
+
+	// Sizes lists the worker sizes allocations may request. Allocations without
+	// a size get the first one. Without sizes every worker gets resources, or
+	// the md size
+	// +optional
+	Sizes []WorkerSize `json:"sizes,omitempty"`
+}
+
+// WorkerSize is a worker size a pool offers, with its own limits.
+type WorkerSize struct {
+	// Name is the size profile: sm, md, lg or xl
+	// +kubebuilder:validation:Enum=sm;md;lg;xl
+	Name string `json:"name"`
+
+	// Min is the number of idle workers of this size kept warm. If any size
+	// sets min, warm workers are kept per size and scaling.min is ignored
+	// +optional
+	Min *int32 `json:"min,omitempty"`
+
+	// Max is the maximum number of workers of this size, within scaling.max
+	// +optional
+	Max *int32 `json:"max,omitempty"`
+
+	// Resources overrides the resources of the size profile
+	// +optional
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+}
+
+// WorkerGroup is a set of a pool's workers that build for the same platforms.
+type WorkerGroup struct {
+	// Name identifies the group on its workers
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	// +kubebuilder:validation:MaxLength=63
+	Name string `json:"name"`
+
+	// Platforms the group's workers build for, e.g. linux/arm64. The first is
+	// the native platform and selects the nodes workers run on through the
+	// kubernetes.io/os and kubernetes.io/arch labels; the others are emulated
+	// and need QEMU binfmt handlers on the nodes
+	// +kubebuilder:validation:MinItems=1
+	// +kubebuilder:validation:items:Pattern=`^[a-z0-9]+/[a-z0-9_]+(/[a-z0-9]+)?$`
+	Platforms []string `json:"platforms"`
+
+	// NodeSelector is added to the node selector of the native platform
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// Tolerations let the group's workers run on tainted nodes, e.g. a
+	// dedicated arm64 node pool
+	// +optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+}
+
+// AllocationQuota limits the worker allocations of the callers it matches.
+// Callers are matched by users, namespaces and claims; an empty selector
+// matches every caller.
+type AllocationQuota struct {
+	// Name identifies the quota in errors and status
+	Name string `json:"name"`
+
+	// Scope is what usage is counted per: each identity, each ServiceAccount
+	// namespace or each value of the OIDC claim named by claim
+	// +kubebuilder:default=Identity
+	Scope QuotaScope `json:"scope,omitempty"`
+
+	// Claim is the OIDC claim usage is counted per when scope is Claim,
+	// e.g. repository_owner
+	// +optional
+	Claim string `json:"claim,omitempty"`
+
+	// Users is a list of identity patterns the quota applies to (supports wildcards)
+	// +optional
+	Users []string `json:"users,omitempty"`
+
+	// Namespaces is a list of namespace patterns of ServiceAccount callers the
+	// quota applies to (supports wildcards)
+	// +optional
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// Claims maps OIDC claim names to value patterns the caller's claims must match
+	// +optional
+	Claims map[string]string `json:"claims,omitempty"`
+
+	// MaxConcurrent is the maximum number of active allocations
+	// +optional
+	MaxConcurrent *int32 `json:"maxConcurrent,omitempty"`
+
+	// MaxPerHour is the maximum number of allocations in any one-hour window
+	// +optional
+	MaxPerHour *int32 `json:"maxPerHour,omitempty"`
+
+	// MaxTTL is the longest an allocation may last including renewals, e.g. "2h"
+	// +optional
+	MaxTTL *metav1.Duration `json:"maxTTL,omitempty"`
+}
+
+// GatewayConfig defines the pool gateway deployment.
+type GatewayConfig struct {
+	// Enabled enables the gateway. Defaults to true
+	// +optional
+	Enabled *bool `json:"enabled,omitempty"`
+
+	// Replicas is the number of gateway replicas for HA
+	// +kubebuilder:default=1
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Replicas *int32 `json:"replicas,omitempty"`
+
+	// Resources for the gateway pods
+	// +optional
+	Resources *GatewayResources `json:"resources,omitempty"`
+
+	// TokenTTL is the default TTL for allocation tokens
+	// Defaults to 1h
+	// +optional
+	TokenTTL *metav1.Duration `json:"tokenTTL,omitempty"`
+
+	// MaxTokenTTL is the maximum allowed TTL for allocation tokens
+	// Defaults to 24h
+	// +optional
+	MaxTokenTTL *metav1.Duration `json:"maxTokenTTL,omitempty"`
+
+	// IdleLeaseTimeout enables idle leases: allocations expire when they are
+	// not renewed within this duration, well before their TTL. Clients keep
+	// allocations alive by renewing them periodically.
+	// +optional
+	IdleLeaseTimeout *metav1.Duration `json:"idleLeaseTimeout,omitempty"`
+}
+
+// GatewayResources defines resource limits for gateway pods.
+type GatewayResources struct {
+	// CPU limit
+	CPU string `json:"cpu,omitempty"`
+
+	// Memory limit
+	Memory string `json:"memory,omitempty"`
+}
+
+// NetworkingConfig defines how the pool gateway is exposed.
+type NetworkingConfig struct {
+	// ServiceType is the Kubernetes service type for the gateway
+	// Defaults to ClusterIP (suitable for Istio/Envoy sidecars, ingress controllers, etc.)
+	// Can be set to LoadBalancer for direct external access, or NodePort for node-based access
+	// +kubebuilder:default=ClusterIP
+	// +optional
+	ServiceType ServiceType `json:"serviceType,omitempty"`
+
+	// Port is the service port of the gateway
+	// +kubebuilder:default=1235
+	// +optional
+	Port *int32 `json:"port,omitempty"`
+
+	// NodePort is the node port for NodePort service type
+	// Only used when serviceType is NodePort
+	// +kubebuilder:validation:Minimum=30000
+	// +kubebuilder:validation:Maximum=32767
+	// +optional
+	NodePort *int32 `json:"nodePort,omitempty"`
+
+	// LoadBalancerClass is the load balancer class for LoadBalancer service type
+	// Only used when serviceType is LoadBalancer
+	// +optional
+	LoadBalancerClass *string `json:"loadBalancerClass,omitempty"`
+
+	// Annotations are annotations to add to the gateway service
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// AllowedCIDRs is a list of allowed CIDR blocks
+	// +optional
+	AllowedCIDRs []string `json:"allowedCIDRs,omitempty"`
+
+	// External configuration for external access
+	// +optional
+	External *ExternalConfig `json:"external,omitempty"`
+
+	// GatewayAPI configuration for external access via Kubernetes Gateway API
+	// +optional
+	GatewayAPI *GatewayAPIConfig `json:"gatewayAPI,omitempty"`
+
+	// Ingress configuration for external access via Kubernetes Ingress
+	// +optional
+	Ingress *IngressConfig `json:"ingress,omitempty"`
+}
+
+// ExternalConfig defines external access configuration.
+type ExternalConfig struct {
+	// Enabled enables external access
+	Enabled bool `json:"enabled,omitempty"`
+
+	// Hostname is the external hostname
+	Hostname string `json:"hostname,omitempty"`
+
+	// Annotations are annotations for external-dns, load balancer, etc.
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// GatewayAPIConfig defines Gateway API configuration for external access.
+// When GatewayRef is specified, the controller will not create Gateway resources
+// and will only create route resources that reference the existing Gateway.
+type GatewayAPIConfig struct {
+	// Enabled enables Gateway API resources for external access
+	Enabled bool `json:"enabled,omitempty"`
+
+	// GatewayRef references an existing Gateway resource to use
+	// When set, GatewayClassName, GatewayName and Annotations are ignored
+	// +optional
+	GatewayRef *GatewayAPIRef `json:"gatewayRef,omitempty"`
+
+	// GatewayClassName is the GatewayClass name to use
+	// If not specified, defaults to "envoy" (Envoy Gateway)
+	// Only used when GatewayRef is not specified
+	// +optional
+	GatewayClassName string `json:"gatewayClassName,omitempty"`
+
+	// GatewayName is the name of the Gateway resource to create
+	// If not specified, defaults to {pool-name}-gateway
+	// Only used when GatewayRef is not specified
+	// +optional
+	GatewayName string `json:"gatewayName,omitempty"`
+
+	// Hostname is the hostname for the Gateway
+	// Required when enabled - used for TLS certificate generation
+	// +optional
+	Hostname string `json:"hostname,omitempty"`
+
+	// TLS configuration for Gateway API
+	// +optional
+	TLS *GatewayAPITLSConfig `json:"tls,omitempty"`
+
+	// Annotations to add to Gateway resources
+	// Only used when GatewayRef is not specified
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// GatewayAPITLSConfig defines TLS configuration for Gateway API.
+type GatewayAPITLSConfig struct {
+	// Mode is the TLS mode (terminate, passthrough)
+	// Defaults to "passthrough", so the pool gateway can validate client certificates
+	// +kubebuilder:validation:Enum=terminate;passthrough
+	// +kubebuilder:default=passthrough
+	Mode string `json:"mode,omitempty"`
+
+	// SecretName is the name of the TLS secret for terminate mode
+	// If not specified, will be auto-generated as {pool-name}-gateway-api-tls
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+
+	// SecretNamespace is the namespace for the TLS secret
+	// If not specified, uses the pool's namespace
+	// +optional
+	SecretNamespace string `json:"secretNamespace,omitempty"`
+
+	// AutoGenerate enables automatic TLS secret generation for the Gateway API
+	// hostname. Defaults to true
+	// +optional
+	AutoGenerate *bool `json:"autoGenerate,omitempty"`
+}
+
+// GatewayAPIRef defines a reference to an existing Gateway resource.
+type GatewayAPIRef struct {
+	// Name is the name of the existing Gateway resource
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// Namespace is the namespace of the Gateway resource
+	// If not specified, uses the pool's namespace
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// IngressConfig defines Ingress configuration for external access.
+type IngressConfig struct {
+	// Enabled enables Ingress resources for external access
+	Enabled bool `json:"enabled,omitempty"`
+
+	// IngressClassName is the IngressClass name to use
+	// If not specified, uses the cluster's default IngressClass
+	// +optional
+	IngressClassName string `json:"ingressClassName,omitempty"`
+
+	// Hostname is the hostname for the Ingress
+	// Required when enabled
+	// +optional
+	Hostname string `json:"hostname,omitempty"`
+
+	// TLS configuration for Ingress
+	// +optional
+	TLS *IngressTLSConfig `json:"tls,omitempty"`
+
+	// Annotations to add to Ingress resources
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// IngressTLSConfig defines TLS configuration for Ingress.
+type IngressTLSConfig struct {
+	// Enabled enables TLS
+	Enabled bool `json:"enabled,omitempty"`
+
+	// SecretName is the name of the TLS secret
+	// Required when enabled
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+}
+
+// ScalingConfig defines scaling behavior.
+type ScalingConfig struct {
+	// Min is the minimum number of idle/available workers to maintain in the pool.
+	// When workers are allocated, the desired total becomes min + allocated workers.
+	// Set to 0 for scale-to-zero (no idle workers maintained).
+	// +kubebuilder:default=0
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	Min *int32 `json:"min,omitempty"`
+
+	// Max is the maximum number of workers
+	// +kubebuilder:default=10
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Max *int32 `json:"max,omitempty"`
+
+	// ScaleDownDelay is the delay before scaling down when idle
+	// Defaults to 15m
+	// +optional
+	ScaleDownDelay *metav1.Duration `json:"scaleDownDelay,omitempty"`
+
+	// ScaleDownSchedule is a cron expression in standard 5-field format that
+	// defines when to scale the pool to zero even if min > 0, e.g. "0 18 * * 1-5"
+	// for every weekday at 6 PM.
+	// +optional
+	ScaleDownSchedule string `json:"scaleDownSchedule,omitempty"`
+}
+
+// CacheConfig defines cache backend configuration.
+type CacheConfig struct {
+	// Backends is a list of cache backends
+	// +optional
+	Backends []CacheBackend `json:"backends,omitempty"`
+
+	// GC is garbage collection configuration
+	// +optional
+	GC GarbageCollectionConfig `json:"gc,omitempty"`
+}
+
+// CacheBackend defines a cache backend.
+type CacheBackend struct {
+	// Type is the cache backend type (registry, s3, local)
+	// +kubebuilder:validation:Enum=registry;s3;local
+	Type string `json:"type"`
+
+	// Registry configuration (when type is registry)
+	Registry *RegistryCacheConfig `json:"registry,omitempty"`
+
+	// S3 configuration (when type is s3)
+	S3 *S3CacheConfig `json:"s3,omitempty"`
+
+	// Local configuration (when type is local)
+	Local *LocalCacheConfig `json:"local,omitempty"`
+}
+
+// RegistryCacheConfig defines registry cache configuration.
+type RegistryCacheConfig struct {
+	// Endpoint is the registry endpoint
+	Endpoint string `json:"endpoint"`
+
+	// Mode is the cache mode (min, max)
+	// +kubebuilder:default=max
+	Mode string `json:"mode,omitempty"`
+
+	// Compression is the compression algorithm (zstd, gzip)
+	// +kubebuilder:default=zstd
+	Compression string `json:"compression,omitempty"`
+
+	// Insecure allows insecure registry connections
+	Insecure bool `json:"insecure,omitempty"`
+
+	// CredentialsSecret is the name of the secret containing registry credentials
+	CredentialsSecret string `json:"credentialsSecret,omitempty"`
+}
+
+// S3CacheConfig defines S3 cache configuration.
+type S3CacheConfig struct {
+	// Bucket is the S3 bucket name
+	Bucket string `json:"bucket"`
+
+	// Region is the AWS region
+	Region string `json:"region"`
+
+	// Endpoint is the S3 endpoint (defaults to s3.amazonaws.com)
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// CredentialsSecret is the name of the secret containing AWS credentials
+	CredentialsSecret string `json:"credentialsSecret,omitempty"`
+}
+
+// LocalCacheConfig defines local cache configuration.
+type LocalCacheConfig struct {
+	// StorageClass is the storage class for the PVC
+	StorageClass string `json:"storageClass"`
+
+	// Size is the size of the cache volume
+	Size string `json:"size"`
+}
+
+// GarbageCollectionConfig defines garbage collection configuration.
+type GarbageCollectionConfig struct {
+	// Enabled enables garbage collection. Defaults to true
+	// +optional
+	Enabled *bool `json:"enabled,omitempty"`
+
+	// Schedule is the cron schedule for GC (defaults to daily at 2 AM: "0 2 * * *")
+	// +optional
+	Schedule string `json:"schedule,omitempty"`
+
+	// KeepStorage is the amount of storage to keep
+	// +optional
+	KeepStorage string `json:"keepStorage,omitempty"`
+
+	// KeepDuration is how long to keep cache entries
+	// +optional
+	KeepDuration *metav1.Duration `json:"keepDuration,omitempty"`
+}
+
+// TLSConfig defines TLS configuration.
+type TLSConfig struct {
+	// Enabled enables TLS. Defaults to true
+	// +optional
+	Enabled *bool `json:"enabled,omitempty"`
+
+	// Mode is the TLS mode (auto, manual)
+	// +kubebuilder:default=auto
+	// +optional
+	Mode TLSMode `json:"mode,omitempty"`
+
+	// Auto configuration (when mode is auto)
+	// +optional
+	Auto *TLSAutoConfig `json:"auto,omitempty"`
+
+	// Manual configuration (when mode is manual)
+	// +optional
+	Manual *TLSManualConfig `json:"manual,omitempty"`
+}
+
+// TLSAutoConfig defines automatic TLS configuration.
+type TLSAutoConfig struct {
+	// ServerCertDuration is the duration for server certificates
+	// Defaults to 8760h (1 year)
+	// +optional
+	ServerCertDuration *metav1.Duration `json:"serverCertDuration,omitempty"`
+
+	// RotateBeforeExpiry is when to rotate certificates before expiry
+	// Defaults to 720h (30 days)
+	// +optional
+	RotateBeforeExpiry *metav1.Duration `json:"rotateBeforeExpiry,omitempty"`
+
+	// Organization is the organization name for certificates
+	// +optional
+	Organization string `json:"organization,omitempty"`
+}
+
+// TLSManualConfig defines manual TLS configuration.
+type TLSManualConfig struct {
+	// ServerCertSecret is the name of the secret containing server certificate
+	ServerCertSecret string `json:"serverCertSecret"`
+
+	// CASecret is the name of the secret containing CA certificate
+	CASecret string `json:"caSecret"`
+}
+
+// AuthConfig defines authentication configuration.
+type AuthConfig struct {
+	// Methods is a list of authentication methods
+	// +optional
+	Methods []AuthMethod `json:"methods,omitempty"`
+
+	// RBAC is RBAC configuration
+	// +optional
+	RBAC *RBACConfig `json:"rbac,omitempty"`
+}
+
+// AuthMethod defines an authentication method.
+type AuthMethod struct {
+	// Type is the auth method type (mtls, token, oidc)
+	Type AuthMethodType `json:"type"`
+
+	// MTLS configuration (when type is mtls)
+	MTLS *MTLSConfig `json:"mtls,omitempty"`
+
+	// Token configuration (when type is token)
+	Token *TokenConfig `json:"token,omitempty"`
+
+	// OIDC configuration (when type is oidc)
+	OIDC *OIDCConfig `json:"oidc,omitempty"`
+
+	// OIDCConfigRef references a BuildKitOIDCConfig whose tokens the pool trusts (when type is oidc).
+	// Only pools claims of tokens from the pool's own OIDC issuer or a referenced config are honored
+	// +optional
+	OIDCConfigRef *OIDCConfigReference `json:"oidcConfigRef,omitempty"`
+}
+
+// OIDCConfigReference references a BuildKitOIDCConfig.
+type OIDCConfigReference struct {
+	// Name is the name of the BuildKitOIDCConfig
+	Name string `json:"name"`
+
+	// Namespace is the namespace of the BuildKitOIDCConfig (defaults to the pool's namespace)
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// MTLSConfig defines mTLS configuration.
+type MTLSConfig struct {
+	// Required requires mTLS (client certificates). Defaults to true
+	// +optional
+	Required *bool `json:"required,omitempty"`
+
+	// ClientCASecret is the name of the secret containing client CA certificate
+	ClientCASecret string `json:"clientCASecret,omitempty"`
+}
+
+// TokenConfig defines token-based authentication.
+type TokenConfig struct {
+	// SecretRef is the name of the secret containing tokens, in the pool's namespace
+	// Format: key = token, value = JSON with user, pools, groups and optional expiresAt.
+	// If the value sets tokenHash (hex SHA-256 of the token), the key is only a name.
+	SecretRef string `json:"secretRef"`
+}
+
+// OIDCConfig defines OIDC authentication.
+type OIDCConfig struct {
+	// Issuer is the OIDC issuer URL
+	Issuer string `json:"issuer"`
+
+	// Audience is the expected audience
+	Audience string `json:"audience"`
+
+	// ClaimsMapping maps OIDC claims to user/pool information
+	ClaimsMapping ClaimsMapping `json:"claimsMapping"`
+}
+
+// ClaimsMapping maps OIDC claims.
+type ClaimsMapping struct {
+	// User is the claim name for user identity
+	User string `json:"user,omitempty"`
+
+	// Pools is the claim name for pool access list
+	Pools string `json:"pools,omitempty"`
+
+	// Groups is the claim name for group membership
+	Groups string `json:"groups,omitempty"`
+}
+
+// RBACConfig defines RBAC configuration.
+type RBACConfig struct {
+	// Enabled enables RBAC. Defaults to true
+	// +optional
+	Enabled *bool `json:"enabled,omitempty"`
+
+	// Rules are RBAC rules
+	Rules []RBACRule `json:"rules,omitempty"`
+}
+
+// RBACRule defines an RBAC rule.
+type RBACRule struct {
+	// Users is a list of user patterns (supports wildcards)
+	Users []string `json:"users"`
+
+	// Pools is a list of pool names (supports wildcards)
+	Pools []string `json:"pools"`
+
+	// Groups is a list of group patterns (supports wildcards)
+	// +optional
+	Groups []string `json:"groups,omitempty"`
+}
+
+// ObservabilityConfig defines observability configuration.
+type ObservabilityConfig struct {
+	// Metrics configuration
+	// +optional
+	Metrics MetricsConfig `json:"metrics,omitempty"`
+
+	// Logging configuration
+	// +optional
+	Logging LoggingConfig `json:"logging,omitempty"`
+}
+
+// MetricsConfig defines metrics configuration.
+type MetricsConfig struct {
+	// Enabled enables metrics. Defaults to true
+	// +optional
+	Enabled *bool `json:"enabled,omitempty"`
+
+	// Port is the metrics port
+	// +kubebuilder:default=9090
+	// +optional
+	Port *int32 `json:"port,omitempty"`
+}
+
+// LoggingConfig defines logging configuration.
+type LoggingConfig struct {
+	// Level is the log level (debug, info, warn, error)
+	// +kubebuilder:default=info
+	// +optional
+	Level string `json:"level,omitempty"`
+
+	// Format is the log format (json, text)
+	// +kubebuilder:default=json
+	// +optional
+	Format string `json:"format,omitempty"`
+}
+
+// BuildKitPoolStatus defines the observed state of BuildKitPool.
+type BuildKitPoolStatus struct {
+	// Conditions represent the latest available observations of the pool's state
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// Endpoint is the gateway endpoint for client connections
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// Phase is the current phase (Pending, Running, ScaledToZero, Failed)
+	// +kubebuilder:validation:Enum=Pending;Running;ScaledToZero;Failed
+	Phase string `json:"phase,omitempty"`
+
+	// Gateway status
+	Gateway *GatewayStatus `json:"gateway,omitempty"`
+
+	// Workers status
+	Workers WorkersStatus `json:"workers,omitempty"`
+
+	// LastActivityTime is the last time there was activity
+	LastActivityTime *metav1.Time `json:"lastActivityTime,omitempty"`
+
+	// ServerCert contains server certificate information (for gateway)
+	ServerCert *CertificateInfo `json:"serverCert,omitempty"`
+
+	// TLSSecretName is the name of the secret containing gateway TLS certificates
+	TLSSecretName string `json:"tlsSecretName,omitempty"`
+
+	// WorkerTLSSecretName is the name of the secret for worker mTLS
+	WorkerTLSSecretName string `json:"workerTLSSecretName,omitempty"`
+
+	// LastScaleTime is the last time workers were scaled
+	LastScaleTime *metav1.Time `json:"lastScaleTime,omitempty"`
+
+	// Connections contains connection statistics
+	Connections *ConnectionsStatus `json:"connections,omitempty"`
+
+	// Quotas reports the usage of each allocation quota per subject
+	// +optional
+	Quotas []QuotaUsage `json:"quotas,omitempty"`
+}
+
+// QuotaUsage is the usage of an allocation quota by one subject.
+type QuotaUsage struct {
+	// Name is the name of the quota
+	Name string `json:"name"`
+
+	// Subject is the identity, namespace or claim value the usage is counted for
+	Subject string `json:"subject"`
+
+	// Active is the number of active allocations
+	Active int32 `json:"active"`
+
+	// AllocationsLastHour is the number of allocations in the last hour
+	AllocationsLastHour int32 `json:"allocationsLastHour"`
+
+	// RecentAllocations are the times of the allocations in the last hour,
+	// oldest first. maxPerHour is counted from them after a controller restart
+	// +optional
+	RecentAllocations []metav1.Time `json:"recentAllocations,omitempty"`
+}
+
+// ConnectionsStatus contains connection statistics for the pool.
+type ConnectionsStatus struct {
+	// Active is the current number of active connections
+	Active int32 `json:"active,omitempty"`
+
+	// Total is the total number of connections since pool creation
+	Total int64 `json:"total,omitempty"`
+
+	// LastConnectionTime is when the last connection was established
+	LastConnectionTime *metav1.Time `json:"lastConnectionTime,omitempty"`
+}
+
+// GatewayStatus contains gateway deployment status.
+type GatewayStatus struct {
+	// Ready indicates if the gateway is ready
+	Ready bool `json:"ready,omitempty"`
+
+	// Replicas is the number of gateway replicas
+	Replicas int32 `json:"replicas,omitempty"`
+
+	// ReadyReplicas is the number of ready gateway replicas
+	ReadyReplicas int32 `json:"readyReplicas,omitempty"`
+
+	// DeploymentName is the name of the gateway deployment
+	DeploymentName string `json:"deploymentName,omitempty"`
+
+	// ServiceName is the name of the gateway service
+	ServiceName string `json:"serviceName,omitempty"`
+}
+
+// WorkersStatus contains aggregated worker status.
+type WorkersStatus struct {
+	// Total is the total number of workers
+	Total int32 `json:"total,omitempty"`
+
+	// Ready is the number of ready workers
+	Ready int32 `json:"ready,omitempty"`
+
+	// Idle is the number of idle (unallocated) workers
+	Idle int32 `json:"idle,omitempty"`
+
+	// Allocated is the number of allocated workers
+	Allocated int32 `json:"allocated,omitempty"`
+
+	// Provisioning is the number of workers being provisioned
+	Provisioning int32 `json:"provisioning,omitempty"`
+
+	// Failed is the number of failed workers
+	Failed int32 `json:"failed,omitempty"`
+
+	// Desired is the desired total number of workers (min idle + allocated workers)
+	Desired int32 `json:"desired,omitempty"`
+
+	// Needed is the number of additional workers needed to meet desired count
+	Needed int32 `json:"needed,omitempty"`
+}
+
+// CertificateInfo contains certificate validity information.
+type CertificateInfo struct {
+	// NotBefore is when the certificate is valid from
+	NotBefore *metav1.Time `json:"notBefore,omitempty"`
+
+	// NotAfter is when the certificate expires
+	NotAfter *metav1.Time `json:"notAfter,omitempty"`
+
+	// RenewalTime is when the certificate should be renewed
+	RenewalTime *metav1.Time `json:"renewalTime,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase"
+//+kubebuilder:printcolumn:name="Gateway",type="string",JSONPath=".status.gateway.ready",priority=1
+//+kubebuilder:printcolumn:name="Workers",type="integer",JSONPath=".status.workers.total"
+//+kubebuilder:printcolumn:name="Ready",type="integer",JSONPath=".status.workers.ready"
+//+kubebuilder:printcolumn:name="Desired",type="integer",JSONPath=".status.workers.desired",priority=1
+//+kubebuilder:printcolumn:name="Needed",type="integer",JSONPath=".status.workers.needed",priority=1
+//+kubebuilder:printcolumn:name="Idle",type="integer",JSONPath=".status.workers.idle",priority=1
+//+kubebuilder:printcolumn:name="Allocated",type="integer",JSONPath=".status.workers.allocated"
+//+kubebuilder:printcolumn:name="Connections",type="integer",JSONPath=".status.connections.active"
+//+kubebuilder:printcolumn:name="Endpoint",type="string",JSONPath=".status.endpoint",priority=1
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// BuildKitPool is the Schema for the buildkitpools API.
+type BuildKitPool struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+
+	Spec   BuildKitPoolSpec   `json:"spec"`
+	Status BuildKitPoolStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// BuildKitPoolList contains a list of BuildKitPool.
+type BuildKitPoolList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+	Items           []BuildKitPool `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&BuildKitPool{}, &BuildKitPoolList{})
+}
@@ -9,6 +9,7 @@ Usage:
 	bkctl allocate --pool <pool-name>
 	bkctl release --token <token>
 	bkctl status --pool <pool-name>
+	bkctl admin list|show|revoke|certs|revoke-cert
 */
 package main
 
@@ -22,6 +23,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	neturl "net/url"
 	"os"
 	"os/exec"
 	"os/signal"
@@ -62,6 +64,8 @@ func main() {
 		runRelease(os.Args[2:])
 	case "status":
 		runStatus(os.Args[2:])
+	case "admin":
+		runAdmin(os.Args[2:])
 	case "oidc-token":
 		runOIDCToken(os.Args[2:])
 	case "version":
@@ -79,11 +83,16 @@ func printUsage() {
 	fmt.Println(`bkctl - BuildKit Controller CLI
 
 Usage:
-  bkctl build --pool <pool-name> [--namespace <ns>] [--oidc-actor <actor>] [--oidc-repository <repo>] [--] [docker buildx build args...]
-  bkctl allocate --pool <pool-name> [--namespace <ns>] [--ttl <duration>] [--oidc-actor <actor>] [--oidc-repository <repo>]
+  bkctl build --pool <pool-name> [--namespace <ns>] [--platform <os/arch>[,<os/arch>...]] [--size sm|md|lg|xl] [--oidc-actor <actor>] [--oidc-repository <repo>] [--] [docker buildx build args...]
+  bkctl allocate --pool <pool-name>[,<fallback-pool>...] [--namespace <ns>] [--ttl <duration>] [--platform <os/arch>] [--size sm|md|lg|xl] [--oidc-actor <actor>] [--oidc-repository <repo>]
   bkctl release --token <token> [--oidc-actor <actor>] [--oidc-repository <repo>]
   bkctl status --pool <pool-name> [--namespace <ns>] [--oidc-actor <actor>] [--oidc-repository <repo>]
   bkctl oidc-token [--issuer <url>] [--actor <name>] [--repository <repo>]
+  bkctl admin list [--pool <pool-name>] [--namespace <ns>] [--identity <identity>] [--job-id <id>]
+  bkctl admin show <allocation-id>
+  bkctl admin revoke <allocation-id>
+  bkctl admin certs [--identity <identity>] [--pool <pool-name>] [--revoked]
+  bkctl admin revoke-cert <serial> [--reason <reason>]
 
 Environment Variables:
   BKCTL_ENDPOINT        Controller API endpoint (default: http://localhost:8082)
@@ -99,32 +108,53 @@ Examples:
   # Build an image using a pool (auto-generates OIDC token if BKCTL_TOKEN not set)
   bkctl build --pool prod-pool -- -t myimage:latest .
 
+  # Build a multi-platform image with one native worker per platform
+  bkctl build --pool prod-pool --platform linux/amd64,linux/arm64 -- -t myimage:latest --push .
+
   # Allocate a worker with specific OIDC identity
   bkctl allocate --pool prod-pool --oidc-actor my-user --oidc-repository my-org/my-repo
 
+  # Allocate from prod-pool, overflowing to burst-pool while prod-pool is full
+  bkctl allocate --pool prod-pool,burst-pool
+
   # Check pool status (auto-generates OIDC token)
   bkctl status --pool prod-pool
 
+  # List a pool's active allocations and revoke one (requires an admin identity or group)
+  bkctl admin list --pool prod-pool
+  bkctl admin revoke <allocation-id>
+
+  # Revoke a client certificate issued by /api/v1/certs/request
+  bkctl admin certs --identity my-user
+  bkctl admin revoke-cert <serial> --reason "key compromised"
+
   # Explicitly set token (overrides auto-generation)
   export BKCTL_TOKEN=$(bkctl oidc-token --actor my-user --repository my-org/my-repo)
   bkctl allocate --pool prod-pool`)
 }
 
 type allocateResponse struct {
-	WorkerName      string `json:"workerName"`
-	Token           string `json:"token"`
-	Endpoint        string `json:"endpoint"`
-	GatewayEndpoint string `json:"gatewayEndpoint"`
-	ExpiresAt       string `json:"expiresAt"`
-	CACert          string `json:"caCert"`
-	ClientCert      string `json:"clientCert"`
-	ClientKey       string `json:"clientKey"`
+	PoolName          string   `json:"poolName"`
+	WorkerName        string   `json:"workerName"`
+	Platforms         []string `json:"platforms"`
+	Size              string   `json:"size"`
+	Token             string   `json:"token"`
+	Endpoint          string   `json:"endpoint"`
+	GatewayEndpoint   string   `json:"gatewayEndpoint"`
+	ExpiresAt         string   `json:"expiresAt"`
+	MaxExpiresAt      string   `json:"maxExpiresAt"`
+	HeartbeatInterval string   `json:"heartbeatInterval"`
+	CACert            string   `json:"caCert"`
+	ClientCert        string   `json:"clientCert"`
+	ClientKey         string   `json:"clientKey"`
 }
 
 func runBuild(args []string) {
 	poolName := ""
 	namespace := getEnvOrDefault("BKCTL_NAMESPACE", defaultNamespace)
 	ttl := "1h"
+	var platforms []string
+	size := ""
 	var oidcCfg oidcConfig
 
 	// Parse bkctl args until we hit --
@@ -158,6 +188,18 @@ func runBuild(args []string) {
 				ttl = args[i+1]
 				i++
 			}
+		case "--size":
+			if i+1 < len(args) {
+				size = args[i+1]
+				i++
+			}
+		case "--platform":
+			// Also passed through, so buildx builds for the same platforms
+			if i+1 < len(args) {
+				platforms = strings.Split(args[i+1], ",")
+				dockerArgs = append(dockerArgs, args[i], args[i+1])
+				i++
+			}
 		case "--oidc-actor":
 			if i+1 < len(args) {
 				oidcCfg.actor = args[i+1]
@@ -184,56 +226,75 @@ func runBuild(args []string) {
 		os.Exit(1)
 	}
 
-	// Allocate a worker
-	fmt.Printf("🔄 Allocating worker from pool '%s'...\n", poolName)
-	resp, err := allocateWorker(poolName, namespace, ttl, &oidcCfg)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error allocating worker: %v\n", err)
-		os.Exit(1)
+	// Allocate one worker per platform, or a single worker for the pool's default platform
+	targets := platforms
+	if len(targets) == 0 {
+		targets = []string{""}
 	}
 
-	fmt.Printf("✓ Allocated worker: %s\n", resp.WorkerName)
-	fmt.Printf("  Token expires: %s\n", resp.ExpiresAt)
-
 	// Create temp directory for certs
-	certDir, err := os.MkdirTemp("", "bkctl-certs-*")
+	certRoot, err := os.MkdirTemp("", "bkctl-certs-*")
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error creating cert directory: %v\n", err)
-		releaseWorker(resp.Token, &oidcCfg)
 		os.Exit(1)
 	}
-	defer os.RemoveAll(certDir)
+	defer os.RemoveAll(certRoot)
 
-	// Write certificates
-	if err := writeCerts(certDir, resp); err != nil {
-		fmt.Fprintf(os.Stderr, "Error writing certificates: %v\n", err)
-		releaseWorker(resp.Token, &oidcCfg)
-		os.Exit(1)
+	var nodes []builderNode
+	release := func() {
+		for _, node := range nodes {
+			releaseWorker(node.alloc.Token, &oidcCfg)
+		}
 	}
 
-	fmt.Printf("✓ Certificates saved to %s\n", certDir)
+	for i, platform := range targets {
+		if platform != "" {
+			fmt.Printf("🔄 Allocating %s worker from pool '%s'...\n", platform, poolName)
+		} else {
+			fmt.Printf("🔄 Allocating worker from pool '%s'...\n", poolName)
+		}
+		var requested []string
+		if platform != "" {
+			requested = []string{platform}
+		}
+		resp, err := allocateWorker(poolName, namespace, ttl, requested, size, &oidcCfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error allocating worker: %v\n", err)
+			release()
+			os.Exit(1)
+		}
 
-	// Determine endpoint to use
-	// Check for local endpoint override (for development/testing)
-	endpoint := os.Getenv("BKCTL_GATEWAY_ENDPOINT")
-	if endpoint == "" {
-		endpoint = resp.GatewayEndpoint
-		if endpoint == "" {
-			endpoint = resp.Endpoint
+		fmt.Printf("✓ Allocated worker: %s (pool %s)\n", resp.WorkerName, resp.PoolName)
+		fmt.Printf("  Token expires: %s\n", resp.ExpiresAt)
+
+		certDir := filepath.Join(certRoot, fmt.Sprintf("node%d", i))
+		node := builderNode{alloc: resp, platform: platform, certDir: certDir}
+		nodes = append(nodes, node)
+
+		// Write certificates
+		if err := os.Mkdir(certDir, 0700); err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating cert directory: %v\n", err)
+			release()
+			os.Exit(1)
+		}
+		if err := writeCerts(certDir, resp); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing certificates: %v\n", err)
+			release()
+			os.Exit(1)
 		}
 	}
-	// Convert tcp:// to just host:port for docker buildx
-	// Preserve hostname for SNI matching (important for TLS passthrough via Gateway API)
-	endpoint = strings.TrimPrefix(endpoint, "tcp://")
+
+	fmt.Printf("✓ Certificates saved to %s\n", certRoot)
 
 	// Create builder name
-	builderName := fmt.Sprintf("bkctl-%s", resp.WorkerName)
+	builderName := fmt.Sprintf("bkctl-%s", nodes[0].alloc.WorkerName)
 
 	// Setup buildx builder
 	fmt.Printf("🔧 Setting up buildx builder '%s'...\n", builderName)
-	if err := setupBuilder(builderName, endpoint, certDir); err != nil {
+	if err := setupBuilder(builderName, nodes); err != nil {
 		fmt.Fprintf(os.Stderr, "Error setting up builder: %v\n", err)
-		releaseWorker(resp.Token, &oidcCfg)
+		removeBuilder(builderName)
+		release()
 		os.Exit(1)
 	}
 
@@ -241,6 +302,11 @@ func runBuild(args []string) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// Keep the allocations alive while the build runs
+	for _, node := range nodes {
+		go heartbeat(ctx, node.alloc, ttl, &oidcCfg)
+	}
+
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 
@@ -248,7 +314,7 @@ func runBuild(args []string) {
 		<-sigCh
 		fmt.Println("\n⚠️  Interrupted, cleaning up...")
 		removeBuilder(builderName)
-		releaseWorker(resp.Token, &oidcCfg)
+		release()
 		cancel()
 		os.Exit(130)
 	}()
@@ -258,7 +324,7 @@ func runBuild(args []string) {
 	if err := runDockerBuild(ctx, builderName, dockerArgs); err != nil {
 		fmt.Fprintf(os.Stderr, "Build failed: %v\n", err)
 		removeBuilder(builderName)
-		releaseWorker(resp.Token, &oidcCfg)
+		release()
 		os.Exit(1)
 	}
 
@@ -266,7 +332,7 @@ func runBuild(args []string) {
 
 	// Cleanup
 	removeBuilder(builderName)
-	releaseWorker(resp.Token, &oidcCfg)
+	release()
 }
 
 func runAllocate(args []string) {
@@ -274,6 +340,8 @@ func runAllocate(args []string) {
 	namespace := getEnvOrDefault("BKCTL_NAMESPACE", defaultNamespace)
 	ttl := "1h"
 	outputJSON := false
+	var platforms []string
+	size := ""
 	var oidcCfg oidcConfig
 
 	for i := 0; i < len(args); i++ {
@@ -293,6 +361,16 @@ func runAllocate(args []string) {
 				ttl = args[i+1]
 				i++
 			}
+		case "--size":
+			if i+1 < len(args) {
+				size = args[i+1]
+				i++
+			}
+		case "--platform":
+			if i+1 < len(args) {
+				platforms = strings.Split(args[i+1], ",")
+				i++
+			}
 		case "--json":
 			outputJSON = true
 		case "--oidc-actor":
@@ -318,7 +396,7 @@ func runAllocate(args []string) {
 		os.Exit(1)
 	}
 
-	resp, err := allocateWorker(poolName, namespace, ttl, &oidcCfg)
+	resp, err := allocateWorker(poolName, namespace, ttl, platforms, size, &oidcCfg)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error allocating worker: %v\n", err)
 		os.Exit(1)
@@ -330,7 +408,14 @@ func runAllocate(args []string) {
 		enc.Encode(resp)
 	} else {
 		fmt.Printf("Worker allocated successfully!\n\n")
+		fmt.Printf("Pool:      %s\n", resp.PoolName)
 		fmt.Printf("Worker:    %s\n", resp.WorkerName)
+		if len(resp.Platforms) > 0 {
+			fmt.Printf("Platforms: %s\n", strings.Join(resp.Platforms, ","))
+		}
+		if resp.Size != "" {
+			fmt.Printf("Size:      %s\n", resp.Size)
+		}
 		fmt.Printf("Token:     %s\n", resp.Token)
 		fmt.Printf("Endpoint:  %s\n", resp.GatewayEndpoint)
 		fmt.Printf("Expires:   %s\n", resp.ExpiresAt)
@@ -450,14 +535,167 @@ func runStatus(args []string) {
 	fmt.Println(prettyJSON.String())
 }
 
-func allocateWorker(poolName, namespace, ttl string, oidcCfg *oidcConfig) (*allocateResponse, error) {
+func runAdmin(args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "Error: admin requires a subcommand: list, show, revoke, certs or revoke-cert")
+		os.Exit(1)
+	}
+
+	subcommand := args[0]
+	args = args[1:]
+
+	var oidcCfg oidcConfig
+	var positional []string
+	filters := make(map[string]string)
+
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--pool", "-p":
+			if i+1 < len(args) {
+				filters["pool"] = args[i+1]
+				i++
+			}
+		case "--namespace", "-n":
+			if i+1 < len(args) {
+				filters["namespace"] = args[i+1]
+				i++
+			}
+		case "--identity":
+			if i+1 < len(args) {
+				filters["identity"] = args[i+1]
+				i++
+			}
+		case "--job-id":
+			if i+1 < len(args) {
+				filters["jobId"] = args[i+1]
+				i++
+			}
+		case "--revoked":
+			filters["revoked"] = "true"
+		case "--reason":
+			if i+1 < len(args) {
+				filters["reason"] = args[i+1]
+				i++
+			}
+		case "--oidc-actor":
+			if i+1 < len(args) {
+				oidcCfg.actor = args[i+1]
+				i++
+			}
+		case "--oidc-repository":
+			if i+1 < len(args) {
+				oidcCfg.repository = args[i+1]
+				i++
+			}
+		case "--oidc-subject":
+			if i+1 < len(args) {
+				oidcCfg.subject = args[i+1]
+				i++
+			}
+		default:
+			positional = append(positional, args[i])
+		}
+	}
+
+	endpoint := getEnvOrDefault("BKCTL_ENDPOINT", defaultControllerEndpoint)
+	baseURL := fmt.Sprintf("%s/api/v1/admin/allocations", endpoint)
+	certsURL := fmt.Sprintf("%s/api/v1/admin/certificates", endpoint)
+
+	query := neturl.Values{}
+	for key, value := range filters {
+		query.Set(key, value)
+	}
+
+	var method, url string
+	switch subcommand {
+	case "list", "certs":
+		method, url = http.MethodGet, baseURL
+		if subcommand == "certs" {
+			url = certsURL
+		}
+		if len(query) > 0 {
+			url += "?" + query.Encode()
+		}
+	case "show", "revoke":
+		if len(positional) != 1 {
+			fmt.Fprintf(os.Stderr, "Error: admin %s requires an allocation ID\n", subcommand)
+			os.Exit(1)
+		}
+		method, url = http.MethodGet, baseURL+"/"+neturl.PathEscape(positional[0])
+		if subcommand == "revoke" {
+			method = http.MethodDelete
+		}
+	case "revoke-cert":
+		if len(positional) != 1 {
+			fmt.Fprintln(os.Stderr, "Error: admin revoke-cert requires a certificate serial number")
+			os.Exit(1)
+		}
+		method, url = http.MethodDelete, certsURL+"/"+neturl.PathEscape(positional[0])
+		if reason := filters["reason"]; reason != "" {
+			url += "?" + neturl.Values{"reason": {reason}}.Encode()
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown admin subcommand: %s\n", subcommand)
+		os.Exit(1)
+	}
+
+	req, _ := http.NewRequest(method, url, nil)
+	if err := addAuthHeader(req, &oidcCfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	client := createHTTPClient(30 * time.Second)
+	resp, err := client.Do(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error calling admin API: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", string(body))
+		os.Exit(1)
+	}
+
+	// Pretty print the JSON
+	var prettyJSON bytes.Buffer
+	json.Indent(&prettyJSON, body, "", "  ")
+	fmt.Println(prettyJSON.String())
+}
+
+// allocationStatus is the status of an asynchronous allocation.
+type allocationStatus struct {
+	ID            string            `json:"id"`
+	State         string            `json:"state"`
+	QueuePosition int               `json:"queuePosition"`
+	Message       string            `json:"message"`
+	Allocation    *allocateResponse `json:"allocation"`
+}
+
+const (
+	allocationPollInterval = 2 * time.Second
+	allocationPollTimeout  = 10 * time.Minute
+)
+
+// allocateWorker requests an asynchronous allocation and polls it until the
+// worker is ready, so no single request has to stay open while it provisions.
+// poolName may be a comma-separated list of a primary pool and overflow pools.
+// The worker must build for every one of platforms; size may be empty for the
+// pool's default size.
+func allocateWorker(poolName, namespace, ttl string, platforms []string, size string, oidcCfg *oidcConfig) (*allocateResponse, error) {
 	endpoint := getEnvOrDefault("BKCTL_ENDPOINT", defaultControllerEndpoint)
 	url := fmt.Sprintf("%s/api/v1/workers/allocate", endpoint)
 
-	reqBody, _ := json.Marshal(map[string]string{
-		"poolName":  poolName,
+	reqBody, _ := json.Marshal(map[string]interface{}{
+		"pools":     strings.Split(poolName, ","),
+		"platforms": platforms,
+		"size":      size,
 		"namespace": namespace,
 		"ttl":       ttl,
+		"async":     true,
 	})
 
 	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(reqBody))
@@ -469,23 +707,163 @@ func allocateWorker(poolName, namespace, ttl string, oidcCfg *oidcConfig) (*allo
 		return nil, fmt.Errorf("authentication failed: %w", err)
 	}
 
-	client := createHTTPClient(5 * time.Minute) // Long timeout for scaling
+	client := createHTTPClient(30 * time.Second)
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// Servers without asynchronous allocation answer synchronously
+		var result allocateResponse
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return nil, fmt.Errorf("failed to decode response: %w", err)
+		}
+		return &result, nil
+	case http.StatusAccepted:
+	case http.StatusTooManyRequests:
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("allocation quota exceeded, retry after %ss: %s", resp.Header.Get("Retry-After"), string(body))
+	default:
 		body, _ := io.ReadAll(resp.Body)
 		return nil, fmt.Errorf("allocation failed: %s", string(body))
 	}
 
-	var result allocateResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+	var status allocationStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
+	return waitForAllocation(client, endpoint, status.ID, oidcCfg)
+}
+
+// waitForAllocation polls an asynchronous allocation until it is ready or failed.
+func waitForAllocation(client *http.Client, endpoint, id string, oidcCfg *oidcConfig) (*allocateResponse, error) {
+	url := fmt.Sprintf("%s/api/v1/allocations/%s", endpoint, id)
+	deadline := time.Now().Add(allocationPollTimeout)
+	lastState, lastPosition := "", 0
+
+	for time.Now().Before(deadline) {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		if err := addAuthHeader(req, oidcCfg); err != nil {
+			return nil, fmt.Errorf("authentication failed: %w", err)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("failed to get allocation %s: %s", id, string(body))
+		}
+
+		var status allocationStatus
+		if err := json.Unmarshal(body, &status); err != nil {
+			return nil, fmt.Errorf("failed to decode allocation status: %w", err)
+		}
+
+		switch status.State {
+		case "Ready":
+			if status.Allocation == nil {
+				return nil, fmt.Errorf("allocation %s is ready but has no credentials", id)
+			}
+			return status.Allocation, nil
+		case "Failed":
+			return nil, fmt.Errorf("allocation failed: %s", status.Message)
+		}
+
+		if status.State != lastState || status.QueuePosition != lastPosition {
+			if status.QueuePosition > 0 {
+				fmt.Fprintf(os.Stderr, "Allocation %s: %s (queue position %d)\n", id, status.State, status.QueuePosition)
+			} else {
+				fmt.Fprintf(os.Stderr, "Allocation %s: %s\n", id, status.State)
+			}
+			lastState, lastPosition = status.State, status.QueuePosition
+		}
+
+		time.Sleep(allocationPollInterval)
+	}
+
+	return nil, fmt.Errorf("timed out waiting for allocation %s", id)
+}
+
+// renewResponse is the response of a lease renewal.
+type renewResponse struct {
+	ExpiresAt         string `json:"expiresAt"`
+	HeartbeatInterval string `json:"heartbeatInterval"`
+}
+
+// heartbeat renews the allocation periodically until ctx is canceled, so builds
+// can outlive the allocation TTL and idle leases don't expire mid-build.
+func heartbeat(ctx context.Context, alloc *allocateResponse, extension string, oidcCfg *oidcConfig) {
+	interval, err := time.ParseDuration(alloc.HeartbeatInterval)
+	if err != nil || interval <= 0 {
+		// Servers without lease renewal don't report an interval
+		return
+	}
+
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		resp, err := renewWorker(alloc.Token, extension, oidcCfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to renew allocation: %v\n", err)
+		} else if next, err := time.ParseDuration(resp.HeartbeatInterval); err == nil && next > 0 {
+			interval = next
+		}
+		timer.Reset(interval)
+	}
+}
+
+func renewWorker(token, extension string, oidcCfg *oidcConfig) (*renewResponse, error) {
+	endpoint := getEnvOrDefault("BKCTL_ENDPOINT", defaultControllerEndpoint)
+	url := fmt.Sprintf("%s/api/v1/workers/renew", endpoint)
+
+	reqBody, _ := json.Marshal(map[string]string{
+		"token":     token,
+		"extension": extension,
+	})
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if err := addAuthHeader(req, oidcCfg); err != nil {
+		return nil, fmt.Errorf("authentication failed: %w", err)
+	}
+
+	client := createHTTPClient(10 * time.Second)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("renew failed: %s", string(body))
+	}
+
+	var result renewResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
 	return &result, nil
 }
 
@@ -550,7 +928,31 @@ func writeCerts(certDir string, resp *allocateResponse) error {
 	return nil
 }
 
-func setupBuilder(name, endpoint, certDir string) error {
+// builderNode is an allocated worker that becomes a node of a buildx builder.
+type builderNode struct {
+	alloc    *allocateResponse
+	platform string
+	certDir  string
+}
+
+// endpoint returns the address buildx connects to for the node.
+func (n *builderNode) endpoint() string {
+	// Check for local endpoint override (for development/testing)
+	endpoint := os.Getenv("BKCTL_GATEWAY_ENDPOINT")
+	if endpoint == "" {
+		endpoint = n.alloc.GatewayEndpoint
+		if endpoint == "" {
+			endpoint = n.alloc.Endpoint
+		}
+	}
+	// Convert tcp:// to just host:port for docker buildx
+	// Preserve hostname for SNI matching (important for TLS passthrough via Gateway API)
+	return strings.TrimPrefix(endpoint, "tcp://")
+}
+
+// setupBuilder creates a remote buildx builder with a node per allocated
+// worker; buildx sends each platform of a build to the node that declares it.
+func setupBuilder(name string, nodes []builderNode) error {
 	// Check if builder exists and remove it
 	checkCmd := exec.Command("docker", "buildx", "inspect", name)
 	if checkCmd.Run() == nil {
@@ -559,24 +961,36 @@ func setupBuilder(name, endpoint, certDir string) error {
 		rmCmd.Run()
 	}
 
-	// Create new builder with TLS certs
-	args := []string{
-		"buildx", "create",
-		"--name", name,
-		"--driver", "remote",
-		"--driver-opt", fmt.Sprintf("cacert=%s,cert=%s,key=%s",
-			filepath.Join(certDir, "ca.crt"),
-			filepath.Join(certDir, "client.crt"),
-			filepath.Join(certDir, "client.key"),
-		),
-		fmt.Sprintf("tcp://%s", endpoint),
-	}
+	for i, node := range nodes {
+		// Create new builder with TLS certs, appending every node after the first
+		args := []string{
+			"buildx", "create",
+			"--name", name,
+			"--node", fmt.Sprintf("%s-%d", name, i),
+			"--driver", "remote",
+			"--driver-opt", fmt.Sprintf("cacert=%s,cert=%s,key=%s",
+				filepath.Join(node.certDir, "ca.crt"),
+				filepath.Join(node.certDir, "client.crt"),
+				filepath.Join(node.certDir, "client.key"),
+			),
+		}
+		if i > 0 {
+			args = append(args, "--append")
+		}
+		if node.platform != "" {
+			args = append(args, "--platform", node.platform)
+		}
+		args = append(args, fmt.Sprintf("tcp://%s", node.endpoint()))
 
-	cmd := exec.Command("docker", args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+		cmd := exec.Command("docker", args...)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return err
+		}
+	}
 
-	return cmd.Run()
+	return nil
 }
 
 func removeBuilder(name string) {
@@ -4,29 +4,40 @@ import (
 	"flag"
 	"os"
 	"strings"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
 	appsv1 "k8s.io/api/apps/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
 	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	gatewayapiv1 "sigs.k8s.io/gateway-api/apis/v1"
 	gatewayapiv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
 
 	buildkitv1alpha1 "github.com/smrt-devops/buildkit-controller/api/v1alpha1"
+	buildkitv1beta1 "github.com/smrt-devops/buildkit-controller/api/v1beta1"
 	"github.com/smrt-devops/buildkit-controller/internal/api"
+	"github.com/smrt-devops/buildkit-controller/internal/auth"
 	"github.com/smrt-devops/buildkit-controller/internal/certs"
 	"github.com/smrt-devops/buildkit-controller/internal/controller"
+	"github.com/smrt-devops/buildkit-controller/internal/gateway"
 	"github.com/smrt-devops/buildkit-controller/internal/utils"
+	webhookv1alpha1 "github.com/smrt-devops/buildkit-controller/internal/webhook/v1alpha1"
+	"github.com/smrt-devops/buildkit-controller/internal/webhooks"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -49,6 +60,8 @@ func buildScheme(ingressAllowed, gatewayAPIAllowed bool) *runtime.Scheme {
 		// This prevents controller-runtime from watching Ingress
 		utilruntime.Must(corev1.AddToScheme(scheme))
 		utilruntime.Must(appsv1.AddToScheme(scheme))
+		utilruntime.Must(authenticationv1.AddToScheme(scheme))
+		utilruntime.Must(admissionregistrationv1.AddToScheme(scheme))
 		// Add metav1 types (ObjectMeta, etc.) - these are needed for all resources
 		// metav1 is included via corev1, but we need to ensure it's there
 		setupLog.Info("Added only required Kubernetes types to scheme (Ingress excluded)")
@@ -62,6 +75,9 @@ func buildScheme(ingressAllowed, gatewayAPIAllowed bool) *runtime.Scheme {
 
 	// Add our CRDs
 	utilruntime.Must(buildkitv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(buildkitv1beta1.AddToScheme(scheme))
+	// CustomResourceDefinitions, to point their conversion webhook at the controller
+	utilruntime.Must(apiextensionsv1.AddToScheme(scheme))
 
 	// Conditionally add Gateway API types only if allowed
 	if gatewayAPIAllowed {
@@ -82,6 +98,20 @@ func main() {
 	var probeAddr string
 	var apiAddr string
 	var devMode bool
+	var saTokenAudiences string
+	var apiAdmins string
+	var apiAdminGroups string
+	var allocationQueueTimeout time.Duration
+	var auditLogFile string
+	var auditLogStdout bool
+	var auditWebhookURL string
+	var webhookConfig string
+	var tokenSigningKeySecret string
+	var enableAdmissionWebhooks bool
+	var admissionWebhookPort int
+	var admissionWebhookCertDir string
+	var admissionWebhookService string
+	var admissionWebhookConfiguration string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.StringVar(&apiAddr, "api-bind-address", ":8082", "The address the API server binds to.")
@@ -90,6 +120,33 @@ func main() {
 			"Enabling this will ensure there is only one active controller manager.")
 	flag.BoolVar(&devMode, "dev-mode", false,
 		"Enable dev mode (disables API authentication). FOR LOCAL DEVELOPMENT ONLY.")
+	flag.StringVar(&saTokenAudiences, "sa-token-audiences", auth.DefaultServiceAccountAudience,
+		"Comma-separated list of audiences accepted for ServiceAccount tokens presented to the API server.")
+	flag.StringVar(&apiAdmins, "api-admins", "",
+		"Comma-separated list of identity patterns allowed to access every pool and release any allocation.")
+	flag.StringVar(&apiAdminGroups, "api-admin-groups", "",
+		"Comma-separated list of group patterns whose members are admins and may use the admin API.")
+	flag.DurationVar(&allocationQueueTimeout, "allocation-queue-timeout", api.DefaultAllocationQueueTimeout,
+		"How long a worker allocation waits in the pool's queue when the pool is at capacity.")
+	flag.StringVar(&auditLogFile, "audit-log-file", "",
+		"Path of a file to append API audit records to as JSON lines.")
+	flag.BoolVar(&auditLogStdout, "audit-log-stdout", false,
+		"Write API audit records to stdout as JSON lines.")
+	flag.StringVar(&auditWebhookURL, "audit-webhook-url", "",
+		"URL to post API audit records to in batches.")
+	flag.StringVar(&webhookConfig, "webhook-config", "",
+		"Path of a JSON file configuring webhooks that receive worker lifecycle events.")
+	flag.StringVar(&tokenSigningKeySecret, "token-signing-key-secret", gateway.DefaultSigningKeySecretName,
+		"The name of the Secret holding the allocation token signing key, in the controller's namespace.")
+	flag.BoolVar(&enableAdmissionWebhooks, "enable-admission-webhooks", false,
+		"Serve the defaulting and validating admission webhooks for the CRDs.")
+	flag.IntVar(&admissionWebhookPort, "admission-webhook-port", 9443, "The port the webhook server, serving admission webhooks and CRD conversion, binds to.")
+	flag.StringVar(&admissionWebhookCertDir, "admission-webhook-cert-dir", "/tmp/k8s-webhook-server/serving-certs",
+		"The directory the webhook serving certificate is written to.")
+	flag.StringVar(&admissionWebhookService, "admission-webhook-service", "buildkit-controller-webhook",
+		"The name of the Service in front of the webhook server, in the controller's namespace.")
+	flag.StringVar(&admissionWebhookConfiguration, "admission-webhook-configuration", "buildkit-controller",
+		"The name of the mutating and validating webhook configurations to inject the CA into.")
 	// Configure logger - allow flags to override environment variables
 	loggerConfig := utils.LoadLoggerConfigFromEnv()
 	opts := zap.Options{
@@ -103,17 +160,7 @@ func main() {
 
 	// Parse allowed ingress types from environment (needed before manager setup)
 	// Format: comma-separated list, e.g., "ingress,gatewayapi" or "gatewayapi" or ""
-	allowedIngressTypesEnv := os.Getenv("ALLOWED_INGRESS_TYPES")
-	var allowedIngressTypes []string
-	if allowedIngressTypesEnv != "" {
-		types := strings.Split(allowedIngressTypesEnv, ",")
-		for _, t := range types {
-			trimmed := strings.TrimSpace(t)
-			if trimmed != "" {
-				allowedIngressTypes = append(allowedIngressTypes, trimmed)
-			}
-		}
-	}
+	allowedIngressTypes := splitList(os.Getenv("ALLOWED_INGRESS_TYPES"))
 	// If not specified, default to allowing both (backward compatibility)
 	// In production, this should be explicitly set via Helm values
 	if len(allowedIngressTypes) == 0 {
@@ -147,7 +194,15 @@ func main() {
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
 		LeaderElectionID:       "buildkit-controller.smrt-devops.net",
+		// Pools are also read as unstructured to merge their class by field presence
+		Client: client.Options{Cache: &client.CacheOptions{Unstructured: true}},
 	}
+	// The webhook server always runs: the API server converts BuildKitPools
+	// through it, even with the admission webhooks disabled
+	managerOpts.WebhookServer = webhook.NewServer(webhook.Options{
+		Port:    admissionWebhookPort,
+		CertDir: admissionWebhookCertDir,
+	})
 
 	// No need to configure cache exclusions - types not in the scheme won't be watched
 
@@ -157,6 +212,12 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Namespace the controller runs in, holding its signing key and webhook certificate
+	namespace := os.Getenv("POD_NAMESPACE")
+	if namespace == "" {
+		namespace = certs.DefaultCANamespace
+	}
+
 	// Load certificate configuration
 	certConfig := certs.LoadConfig()
 
@@ -171,6 +232,50 @@ func main() {
 	if devMode {
 		apiOpts = append(apiOpts, api.WithDevMode(true))
 	}
+	apiOpts = append(apiOpts,
+		api.WithServiceAccountAudiences(splitList(saTokenAudiences)),
+		api.WithAdminIdentities(splitList(apiAdmins)),
+		api.WithAdminGroups(splitList(apiAdminGroups)),
+		api.WithAdminOIDCNamespace(namespace),
+		api.WithAllocationQueueTimeout(allocationQueueTimeout),
+		api.WithCache(mgr.GetCache()),
+		api.WithSigningKeySecret(tokenSigningKeySecret, namespace),
+		api.WithTokenStore(gateway.NewWorkerTokenStore(mgr.GetClient())),
+		api.WithRevocationStore(gateway.NewConfigMapRevocationStore(mgr.GetClient(), gateway.DefaultRevocationsConfigMapName, namespace)),
+	)
+
+	var auditSinks []api.AuditSink
+	if auditLogFile != "" {
+		sink, err := api.NewFileAuditSink(auditLogFile)
+		if err != nil {
+			setupLog.Error(err, "unable to open audit log")
+			os.Exit(1)
+		}
+		auditSinks = append(auditSinks, sink)
+	}
+	if auditLogStdout {
+		auditSinks = append(auditSinks, api.NewStdoutAuditSink())
+	}
+	if auditWebhookURL != "" {
+		auditSinks = append(auditSinks, api.NewWebhookAuditSink(auditWebhookURL, setupLog))
+	}
+	apiOpts = append(apiOpts, api.WithAuditSinks(auditSinks...))
+
+	// Worker lifecycle webhooks; events are delivered while this instance is the leader
+	var webhookDispatcher *webhooks.Dispatcher
+	if webhookConfig != "" {
+		cfg, err := webhooks.LoadConfig(webhookConfig)
+		if err != nil {
+			setupLog.Error(err, "unable to load webhook config")
+			os.Exit(1)
+		}
+		webhookDispatcher = webhooks.NewDispatcher(cfg, ctrl.Log.WithName("webhooks"))
+		if err := mgr.Add(webhookDispatcher); err != nil {
+			setupLog.Error(err, "unable to add webhook dispatcher")
+			os.Exit(1)
+		}
+		apiOpts = append(apiOpts, api.WithWebhooks(webhookDispatcher))
+	}
 	apiServer := api.NewServer(mgr.GetClient(), certManager, caManager, setupLog, 8082, certConfig, apiOpts...)
 	// Use the manager's context for proper lifecycle management
 	managerCtx := ctrl.SetupSignalHandler()
@@ -179,6 +284,11 @@ func main() {
 		if enableLeaderElection {
 			<-mgr.Elected()
 		}
+		// The API server restores allocation tokens on start, which needs the cache
+		if !mgr.GetCache().WaitForCacheSync(managerCtx) {
+			setupLog.Error(nil, "cache did not sync, not starting API server")
+			return
+		}
 		if startErr := apiServer.Start(managerCtx); startErr != nil {
 			setupLog.Error(startErr, "unable to start API server")
 		}
@@ -206,15 +316,81 @@ func main() {
 
 	// Register BuildKitWorker controller
 	if err = (&controller.BuildKitWorkerReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-		Log:    ctrl.Log.WithName("controller").WithName("BuildKitWorker"),
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Log:      ctrl.Log.WithName("controller").WithName("BuildKitWorker"),
+		Webhooks: webhookDispatcher,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "BuildKitWorker")
 		os.Exit(1)
 	}
+	if err = (&controller.BuildKitAllocationReconciler{
+		Client:    mgr.GetClient(),
+		Scheme:    mgr.GetScheme(),
+		Log:       ctrl.Log.WithName("controller").WithName("BuildKitAllocation"),
+		Allocator: apiServer,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "BuildKitAllocation")
+		os.Exit(1)
+	}
+	if err = (&controller.BuildKitOIDCConfigReconciler{
+		Client:    mgr.GetClient(),
+		Scheme:    mgr.GetScheme(),
+		Log:       ctrl.Log.WithName("controller").WithName("BuildKitOIDCConfig"),
+		Verifiers: apiServer,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "BuildKitOIDCConfig")
+		os.Exit(1)
+	}
 	//+kubebuilder:scaffold:builder
 
+	if enableAdmissionWebhooks {
+		if err = webhookv1alpha1.SetupBuildKitPoolWebhookWithManager(mgr, allowedIngressTypes); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "BuildKitPool")
+			os.Exit(1)
+		}
+		if err = webhookv1alpha1.SetupBuildKitWorkerWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "BuildKitWorker")
+			os.Exit(1)
+		}
+		if err = webhookv1alpha1.SetupBuildKitOIDCConfigWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "BuildKitOIDCConfig")
+			os.Exit(1)
+		}
+	} else if err = webhookv1alpha1.SetupBuildKitPoolConversionWebhookWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create webhook", "webhook", "BuildKitPool conversion")
+		os.Exit(1)
+	}
+
+	// The webhook server needs its certificate before the manager starts, when
+	// the cache is not running yet, so the certificate is issued with a direct client
+	setupClient, err := client.New(mgr.GetConfig(), client.Options{Scheme: scheme})
+	if err != nil {
+		setupLog.Error(err, "unable to create client")
+		os.Exit(1)
+	}
+	webhookCertConfig := certs.WebhookCertConfig{
+		CertDir:        admissionWebhookCertDir,
+		ServiceName:    admissionWebhookService,
+		Namespace:      namespace,
+		ConversionCRDs: []string{"buildkitpools.buildkit.smrt-devops.net"},
+	}
+	if enableAdmissionWebhooks {
+		webhookCertConfig.ConfigurationName = admissionWebhookConfiguration
+	}
+	setupCAManager := certs.NewCAManager(setupClient, "", "", setupLog)
+	webhookCerts := certs.NewWebhookCertManager(setupClient,
+		certs.NewCertificateManager(setupClient, setupCAManager, setupLog, certConfig), setupCAManager,
+		webhookCertConfig, ctrl.Log.WithName("webhook-certs"))
+	if err := webhookCerts.Ensure(managerCtx); err != nil {
+		setupLog.Error(err, "unable to issue webhook serving certificate")
+		os.Exit(1)
+	}
+	if err := mgr.Add(webhookCerts); err != nil {
+		setupLog.Error(err, "unable to add webhook certificate manager")
+		os.Exit(1)
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
@@ -223,6 +399,10 @@ func main() {
 		setupLog.Error(err, "unable to set up ready check")
 		os.Exit(1)
 	}
+	if err := mgr.AddReadyzCheck("webhook", mgr.GetWebhookServer().StartedChecker()); err != nil {
+		setupLog.Error(err, "unable to set up webhook ready check")
+		os.Exit(1)
+	}
 
 	setupLog.Info("starting manager")
 	if err := mgr.Start(managerCtx); err != nil {
@@ -230,3 +410,14 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// splitList splits a comma-separated list, dropping empty entries.
+func splitList(value string) []string {
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		if trimmed := strings.TrimSpace(item); trimmed != "" {
+			result = append(result, trimmed)
+		}
+	}
+	return result
+}
@@ -3,7 +3,7 @@ Gateway is the BuildKit pool gateway that handles TLS termination and routing.
 
 The gateway:
 1. Terminates TLS connections from clients
-2. Validates allocation tokens from client certificates
+2. Validates allocation tokens from client certificates (locally or via controller lookup)
 3. Routes connections to the appropriate worker via mTLS
 */
 package main
@@ -20,6 +20,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -36,9 +37,15 @@ func main() {
 		listenAddr         = flag.String("listen-addr", "0.0.0.0:1235", "Gateway listen address")
 		metricsAddr        = flag.String("metrics-addr", "0.0.0.0:9090", "Metrics server address")
 		controllerEndpoint = flag.String("controller-endpoint", "http://buildkit-controller.buildkit-system.svc:8082", "Controller API endpoint")
+		controllerToken    = flag.String("controller-token-file", "/var/run/secrets/buildkit-controller/token", "Projected ServiceAccount token used to authenticate to the controller API")
 		serverCertPath     = flag.String("server-cert", "/etc/gateway/tls/tls.crt", "Server certificate path")
 		serverKeyPath      = flag.String("server-key", "/etc/gateway/tls/tls.key", "Server key path")
 		caCertPath         = flag.String("ca-cert", "/etc/gateway/tls/ca.crt", "CA certificate path")
+		crlPath            = flag.String("crl-file", "/etc/gateway/crl/crl.pem", "Client certificate revocation list published by the controller")
+		crlReloadInterval  = flag.Duration("crl-reload-interval", gateway.DefaultCRLReloadInterval, "How often to reload the CRL file")
+		tokenVerification  = flag.String("token-verification", "local", "Token verification mode: local (verify signed tokens in the gateway) or remote (controller lookup per connection)")
+		tokenSyncInterval  = flag.Duration("token-sync-interval", gateway.DefaultVerifierSyncInterval, "How often to sync token keys and the deny list in local verification mode")
+		revalidateInterval = flag.Duration("connection-revalidate-interval", gateway.DefaultVerifierSyncInterval, "How often to re-check the tokens of active connections and close revoked ones (0 disables)")
 	)
 	flag.Parse()
 
@@ -56,12 +63,19 @@ func main() {
 		"controllerEndpoint", *controllerEndpoint,
 	)
 
+	// Reject revoked client certificates during the TLS handshake
+	crlChecker := gateway.NewCRLChecker(*crlPath, *caCertPath, log)
+	if err := crlChecker.Load(); err != nil {
+		log.Error(err, "Failed to load CRL, retrying in the background")
+	}
+
 	// Load server TLS config
 	serverTLS, err := loadServerTLS(*serverCertPath, *serverKeyPath, *caCertPath)
 	if err != nil {
 		log.Error(err, "Failed to load server TLS config")
 		os.Exit(1)
 	}
+	serverTLS.VerifyPeerCertificate = crlChecker.VerifyPeerCertificate
 
 	workerTLS, err := loadWorkerTLS()
 	if err != nil {
@@ -73,8 +87,32 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Create worker lookup function that calls controller API
-	workerLookup := createWorkerLookup(*controllerEndpoint)
+	// Handle shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go crlChecker.Run(ctx, *crlReloadInterval)
+
+	var workerLookup gateway.WorkerLookup
+	switch *tokenVerification {
+	case "local":
+		// Verify signed tokens locally so routing keeps working while the controller is down
+		verifier := gateway.NewTokenVerifier(gateway.TokenVerifierConfig{
+			ControllerEndpoint: *controllerEndpoint,
+			PoolName:           *poolName,
+			PoolNamespace:      *poolNamespace,
+			SyncInterval:       *tokenSyncInterval,
+			Logger:             log,
+		})
+		go verifier.Run(ctx)
+		workerLookup = verifier.Lookup
+	case "remote":
+		// Create worker lookup function that calls controller API
+		workerLookup = createWorkerLookup(*controllerEndpoint, *controllerToken)
+	default:
+		log.Error(nil, "Invalid token-verification mode", "mode", *tokenVerification)
+		os.Exit(1)
+	}
 
 	// Create gateway
 	gw := gateway.New(gateway.Config{
@@ -84,11 +122,9 @@ func main() {
 		WorkerTLS:    workerTLS,
 		WorkerLookup: workerLookup,
 		Logger:       log,
-	})
 
-	// Handle shutdown
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+		RevalidateInterval: *revalidateInterval,
+	})
 
 	// Start metrics server
 	metricsServer := &http.Server{
@@ -217,7 +253,7 @@ func loadWorkerTLS() (*tls.Config, error) {
 	}, nil
 }
 
-func createWorkerLookup(controllerEndpoint string) gateway.WorkerLookup {
+func createWorkerLookup(controllerEndpoint, tokenFile string) gateway.WorkerLookup {
 	client := &http.Client{
 		Timeout: 10 * time.Second,
 	}
@@ -236,12 +272,22 @@ func createWorkerLookup(controllerEndpoint string) gateway.WorkerLookup {
 		}
 		req.Header.Set("Content-Type", "application/json")
 
+		// Read the token on every call, the kubelet rotates projected tokens
+		gatewayToken, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read controller token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(gatewayToken)))
+
 		resp, err := client.Do(req)
 		if err != nil {
 			return "", fmt.Errorf("failed to lookup worker: %w", err)
 		}
 		defer resp.Body.Close()
 
+		if resp.StatusCode == http.StatusNotFound {
+			return "", gateway.ErrTokenNotFound
+		}
 		if resp.StatusCode != http.StatusOK {
 			body, _ := io.ReadAll(resp.Body)
 			return "", fmt.Errorf("worker lookup failed: status %d, body: %s", resp.StatusCode, string(body))
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	buildkitv1alpha1 "github.com/smrt-devops/buildkit-controller/api/v1alpha1"
+	"github.com/smrt-devops/buildkit-controller/internal/gateway"
+	"github.com/smrt-devops/buildkit-controller/internal/webhooks"
+)
+
+// AllocationInfo describes an active allocation for admins.
+// It identifies the allocation by its token ID and never includes the token itself.
+type AllocationInfo struct {
+	ID           string            `json:"id"`
+	PoolName     string            `json:"poolName"`
+	Namespace    string            `json:"namespace"`
+	WorkerName   string            `json:"workerName"`
+	JobID        string            `json:"jobId,omitempty"`
+	RequestedBy  string            `json:"requestedBy,omitempty"`
+	IssuedAt     time.Time         `json:"issuedAt"`
+	ExpiresAt    time.Time         `json:"expiresAt"`
+	MaxExpiresAt time.Time         `json:"maxExpiresAt"`
+	Age          string            `json:"age"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+	// Worker details, only set when inspecting a single allocation.
+	WorkerPhase    buildkitv1alpha1.WorkerPhase `json:"workerPhase,omitempty"`
+	WorkerEndpoint string                       `json:"workerEndpoint,omitempty"`
+	WorkerPod      string                       `json:"workerPod,omitempty"`
+}
+
+// AllocationListResponse is the list of active allocations.
+type AllocationListResponse struct {
+	Allocations []AllocationInfo `json:"allocations"`
+}
+
+func newAllocationInfo(data *gateway.TokenData) AllocationInfo {
+	return AllocationInfo{
+		ID:           data.ID,
+		PoolName:     data.PoolName,
+		Namespace:    data.Namespace,
+		WorkerName:   data.WorkerName,
+		JobID:        data.JobID,
+		RequestedBy:  data.RequestedBy,
+		IssuedAt:     data.IssuedAt,
+		ExpiresAt:    data.ExpiresAt,
+		MaxExpiresAt: data.MaxExpiresAt,
+		Age:          time.Since(data.IssuedAt).Round(time.Second).String(),
+		Metadata:     data.Metadata,
+	}
+}
+
+// handleAdminAllocations serves the admin allocation API:
+//   - GET /api/v1/admin/allocations lists active allocations, filtered by the
+//     pool, namespace, identity and jobId query parameters
+//   - GET /api/v1/admin/allocations/{id} shows one allocation and its worker
+//   - DELETE /api/v1/admin/allocations/{id} revokes an allocation and tears down its worker.
+func (s *Server) handleAdminAllocations(w http.ResponseWriter, r *http.Request) {
+	principal, ok := s.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	if !s.authorized(w, r, principal, ActionAdmin, AuditRecord{}, s.authorizer.AuthorizeAdmin(principal)) {
+		return
+	}
+
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/admin/allocations"), "/")
+	if id == "" {
+		if !s.requireMethod(w, r, http.MethodGet) {
+			return
+		}
+		s.listAllocations(w, r)
+		return
+	}
+
+	tokenData, found := s.tokenManager.GetTokenByID(id)
+	if !found {
+		http.Error(w, "Allocation not found", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.encodeJSON(w, s.inspectAllocation(r, tokenData))
+	case http.MethodDelete:
+		s.teardownAllocation(r.Context(), tokenData.Token, tokenData)
+		audit := allocationAudit(tokenData)
+		audit.Event, audit.Decision = AuditAllocationRevoked, AuditAllow
+		s.audit.record(r, principal, audit)
+		s.webhooks.Emit(allocationEvent(webhooks.EventWorkerReleased, tokenData, "Revoked by admin"))
+		s.log.Info("Allocation revoked by admin", "allocation", id, "worker", tokenData.WorkerName, "pool", tokenData.PoolName, "identity", principal.Identity)
+		s.encodeJSON(w, map[string]string{"status": "revoked"})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// listAllocations writes the active allocations matching the query filters.
+func (s *Server) listAllocations(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	pool := query.Get("pool")
+	namespace := query.Get("namespace")
+	identity := query.Get("identity")
+	jobID := query.Get("jobId")
+
+	now := time.Now()
+	allocations := []AllocationInfo{}
+	for _, data := range s.tokenManager.ListTokens() {
+		if now.After(data.ExpiresAt) ||
+			(pool != "" && data.PoolName != pool) ||
+			(namespace != "" && data.Namespace != namespace) ||
+			(identity != "" && data.RequestedBy != identity) ||
+			(jobID != "" && data.JobID != jobID) {
+			continue
+		}
+		allocations = append(allocations, newAllocationInfo(data))
+	}
+
+	sort.Slice(allocations, func(i, j int) bool {
+		return allocations[i].IssuedAt.Before(allocations[j].IssuedAt)
+	})
+
+	s.encodeJSON(w, AllocationListResponse{Allocations: allocations})
+}
+
+// inspectAllocation returns an allocation together with the state of its worker.
+func (s *Server) inspectAllocation(r *http.Request, tokenData *gateway.TokenData) AllocationInfo {
+	info := newAllocationInfo(tokenData)
+
+	worker := &buildkitv1alpha1.BuildKitWorker{}
+	if err := s.client.Get(r.Context(), types.NamespacedName{Name: tokenData.WorkerName, Namespace: tokenData.Namespace}, worker); err != nil {
+		s.log.V(1).Info("Failed to get allocated worker", "worker", tokenData.WorkerName, "error", err)
+		return info
+	}
+
+	info.WorkerPhase = worker.Status.Phase
+	info.WorkerEndpoint = worker.Status.Endpoint
+	info.WorkerPod = worker.Status.PodName
+	return info
+}
@@ -0,0 +1,224 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	buildkitv1alpha1 "github.com/smrt-devops/buildkit-controller/api/v1alpha1"
+	"github.com/smrt-devops/buildkit-controller/internal/auth"
+)
+
+const (
+	testAdminNamespace = "buildkit-system"
+	testAudience       = "buildkit"
+	testAdmin          = "root@example.com"
+)
+
+// testIssuer is an OIDC issuer serving its discovery document and key set.
+type testIssuer struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	issuer := &testIssuer{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                issuer.URL,
+			"jwks_uri":                              issuer.URL + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: &key.PublicKey, KeyID: "test", Algorithm: "RS256", Use: "sig"},
+		}})
+	})
+	issuer.Server = httptest.NewServer(mux)
+	t.Cleanup(issuer.Close)
+	return issuer
+}
+
+// token issues an ID token for the subject and groups.
+func (i *testIssuer) token(t *testing.T, subject string, groups ...string) string {
+	t.Helper()
+
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: i.key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", "test"))
+	if err != nil {
+		t.Fatalf("failed to create signer: %v", err)
+	}
+	claims := map[string]interface{}{
+		"iss":    i.URL,
+		"sub":    subject,
+		"aud":    testAudience,
+		"iat":    time.Now().Unix(),
+		"exp":    time.Now().Add(time.Hour).Unix(),
+		"groups": groups,
+	}
+	token, err := jwt.Signed(signer).Claims(claims).Serialize()
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return token
+}
+
+func newAdminTestServer(t *testing.T, objects ...client.Object) *Server {
+	t.Helper()
+
+	scheme := runtime.NewScheme()
+	if err := buildkitv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+	k8sClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+
+	return NewServer(k8sClient, nil, nil, logr.Discard(), 0, nil,
+		WithAdminIdentities([]string{testAdmin}),
+		WithAdminGroups([]string{"admins"}),
+		WithAdminOIDCNamespace(testAdminNamespace),
+	)
+}
+
+// tenantPool is a pool whose owner configured its own OIDC issuer.
+func tenantPool(issuer string) *buildkitv1alpha1.BuildKitPool {
+	return &buildkitv1alpha1.BuildKitPool{
+		ObjectMeta: metav1.ObjectMeta{Name: "tenant-pool", Namespace: "tenant"},
+		Spec: buildkitv1alpha1.BuildKitPoolSpec{
+			Auth: buildkitv1alpha1.AuthConfig{
+				Methods: []buildkitv1alpha1.AuthMethod{{
+					Type: buildkitv1alpha1.AuthMethodOIDC,
+					OIDC: &buildkitv1alpha1.OIDCConfig{
+						Issuer:        issuer,
+						Audience:      testAudience,
+						ClaimsMapping: buildkitv1alpha1.ClaimsMapping{Groups: "groups"},
+					},
+				}},
+			},
+		},
+	}
+}
+
+// oidcConfig is a BuildKitOIDCConfig for the issuer in the namespace.
+func oidcConfig(namespace, issuer string) *buildkitv1alpha1.BuildKitOIDCConfig {
+	return &buildkitv1alpha1.BuildKitOIDCConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "sso", Namespace: namespace},
+		Spec: buildkitv1alpha1.BuildKitOIDCConfigSpec{
+			Enabled:       true,
+			Issuer:        issuer,
+			Audience:      testAudience,
+			ClaimsMapping: buildkitv1alpha1.ClaimsMapping{Groups: "groups"},
+		},
+	}
+}
+
+func TestAdminAPIRejectsTenantDefinedIssuers(t *testing.T) {
+	issuer := newTestIssuer(t)
+
+	tests := []struct {
+		name    string
+		objects []client.Object
+	}{
+		{name: "pool oidc settings", objects: []client.Object{tenantPool(issuer.URL)}},
+		{name: "oidc config outside the admin namespace", objects: []client.Object{oidcConfig("tenant", issuer.URL)}},
+	}
+
+	paths := []string{
+		"/api/v1/admin/allocations",
+		"/api/v1/admin/allocations/some-id",
+		"/api/v1/admin/certificates",
+		"/api/v1/admin/certificates/0a1b",
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newAdminTestServer(t, tt.objects...)
+
+			tokens := map[string]string{
+				"admin identity": issuer.token(t, testAdmin),
+				"admin group":    issuer.token(t, "tenant-user", "admins"),
+			}
+			for kind, token := range tokens {
+				principal, err := s.authenticateRequest(authorizedRequest(http.MethodGet, "/", token))
+				if err != nil {
+					t.Fatalf("%s: token was not authenticated: %v", kind, err)
+				}
+				if s.authorizer.IsAdmin(principal) {
+					t.Errorf("%s: principal verified with %s is an admin", kind, tt.name)
+				}
+
+				for _, path := range paths {
+					for _, method := range []string{http.MethodGet, http.MethodDelete} {
+						rec := httptest.NewRecorder()
+						req := authorizedRequest(method, path, token)
+						if strings.HasPrefix(path, "/api/v1/admin/certificates") {
+							s.handleAdminCertificates(rec, req)
+						} else {
+							s.handleAdminAllocations(rec, req)
+						}
+						if rec.Code != http.StatusForbidden {
+							t.Errorf("%s: %s %s returned %d, want %d", kind, method, path, rec.Code, http.StatusForbidden)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestAdminOIDCConfigInAdminNamespace(t *testing.T) {
+	issuer := newTestIssuer(t)
+	s := newAdminTestServer(t, oidcConfig(testAdminNamespace, issuer.URL), tenantPool(issuer.URL))
+
+	principal, err := s.authenticateRequest(authorizedRequest(http.MethodGet, "/", issuer.token(t, testAdmin)))
+	if err != nil {
+		t.Fatalf("token was not authenticated: %v", err)
+	}
+	if principal.OIDCConfig != testAdminNamespace+"/sso" {
+		t.Fatalf("token verified with %q, want the admin namespace's config", principal.OIDCConfig)
+	}
+	if !s.authorizer.IsAdmin(principal) {
+		t.Error("principal verified with an OIDC config in the admin namespace is not an admin")
+	}
+}
+
+func TestStaticTokensAreNeverAdmins(t *testing.T) {
+	authorizer := NewAuthorizer([]string{"*"}, []string{"*"}, testAdminNamespace)
+	principal := &auth.Principal{
+		Identity:   "token:" + testAdminNamespace + ":ci",
+		Method:     auth.MethodToken,
+		Namespace:  testAdminNamespace,
+		Groups:     []string{"admins"},
+		OIDCConfig: testAdminNamespace + "/sso",
+	}
+	if authorizer.IsAdmin(principal) {
+		t.Error("static token principal is an admin")
+	}
+}
+
+func authorizedRequest(method, path, token string) *http.Request {
+	req := httptest.NewRequest(method, path, http.NoBody)
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
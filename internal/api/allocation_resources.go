@@ -0,0 +1,241 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	buildkitv1alpha1 "github.com/smrt-devops/buildkit-controller/api/v1alpha1"
+	"github.com/smrt-devops/buildkit-controller/internal/auth"
+	"github.com/smrt-devops/buildkit-controller/internal/gateway"
+	"github.com/smrt-devops/buildkit-controller/internal/webhooks"
+)
+
+var (
+	// ErrNotReady is returned while the server is starting and cannot allocate workers yet.
+	ErrNotReady = errors.New("API server is not ready")
+	// ErrAllocationNotFound is returned for allocations that ended or are unknown.
+	ErrAllocationNotFound = errors.New("allocation not found")
+	// ErrInvalidAllocation is returned for allocations that cannot be made as specified.
+	ErrInvalidAllocation = errors.New("invalid allocation")
+)
+
+// resourceIdentityPrefix is the prefix of the identity BuildKitAllocations
+// allocate as, followed by their namespace.
+const resourceIdentityPrefix = "system:buildkitallocations:"
+
+// resourceGroup is the group of every BuildKitAllocation principal.
+const resourceGroup = "system:buildkitallocations"
+
+// ResourceLease is the lease of a worker allocated for a BuildKitAllocation.
+type ResourceLease struct {
+	// ExpiresAt is when the lease ends unless it is renewed.
+	ExpiresAt time.Time
+	// MaxExpiresAt is when the allocation ends.
+	MaxExpiresAt time.Time
+	// RenewAfter is how long until the lease should be renewed again.
+	RenewAfter time.Duration
+}
+
+// isReady reports whether the server has started and can allocate workers.
+func (s *Server) isReady() bool {
+	select {
+	case <-s.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+// resourcePrincipal returns the identity a BuildKitAllocation allocates as. It
+// stands for the allocation's namespace rather than any ServiceAccount in it, as
+// anyone who can create BuildKitAllocations there can use it, so the pool's RBAC
+// rules and quotas have to grant access to the namespace's allocations explicitly.
+func resourcePrincipal(allocation *buildkitv1alpha1.BuildKitAllocation) *auth.Principal {
+	return &auth.Principal{
+		Identity:  resourceIdentityPrefix + allocation.Namespace,
+		Method:    auth.MethodResource,
+		Namespace: allocation.Namespace,
+		Groups:    []string{resourceGroup},
+	}
+}
+
+// resourceRequestID returns the ID a BuildKitAllocation's request is tracked
+// under. It is derived from the resource's UID, so the controller finds an
+// allocation in progress again if it could not record it.
+func resourceRequestID(allocation *buildkitv1alpha1.BuildKitAllocation) string {
+	return "resource-" + string(allocation.UID)
+}
+
+// StartResourceAllocation starts allocating a worker for a BuildKitAllocation
+// and returns the request ID to follow it with ResourceAllocationStatus. Like the
+// worker allocation API, it checks that the allocation's namespace may use
+// the pool and reserves its quotas. Starting an allocation that is in progress
+// or done returns its request ID again.
+func (s *Server) StartResourceAllocation(ctx context.Context, allocation *buildkitv1alpha1.BuildKitAllocation) (string, error) {
+	if !s.isReady() {
+		return "", ErrNotReady
+	}
+
+	id := resourceRequestID(allocation)
+	if status, _, _, found := s.allocations.get(id); found && status.State != AllocationFailed {
+		return id, nil
+	}
+
+	ttl := defaultAllocationTTL
+	if allocation.Spec.TTL != "" {
+		parsed, err := time.ParseDuration(allocation.Spec.TTL)
+		if err != nil || parsed <= 0 {
+			return "", fmt.Errorf("%w: invalid ttl %q", ErrInvalidAllocation, allocation.Spec.TTL)
+		}
+		ttl = parsed
+	}
+
+	namespace := allocation.Spec.PoolRef.Namespace
+	if namespace == "" {
+		namespace = allocation.Namespace
+	}
+	candidates, _, err := s.candidatePools(ctx, namespace, []string{allocation.Spec.PoolRef.Name}, nil)
+	if err != nil {
+		return "", err
+	}
+	pool := candidates[0]
+
+	principal := resourcePrincipal(allocation)
+	jobID := fmt.Sprintf("%s/%s", allocation.Namespace, allocation.Name)
+	audit := poolAudit(pool)
+	audit.JobID, audit.Identity, audit.AuthMethod = jobID, principal.Identity, principal.Method
+
+	authz := audit
+	authz.Event, authz.Action, authz.Decision = AuditAuthorization, ActionAllocate, AuditAllow
+	if err := s.authorizer.AuthorizePool(principal, ActionAllocate, pool); err != nil {
+		authz.Decision, authz.Reason = AuditDeny, err.Error()
+		s.audit.write(authz)
+		return "", err
+	}
+	s.audit.write(authz)
+
+	requirements := workerRequirements{platforms: allocation.Spec.Platforms, size: allocation.Spec.Size}
+	if !requirements.supportedBy(pool) {
+		return "", fmt.Errorf("%w: pool %s offers no workers with %s", ErrInvalidAllocation, pool.Name, requirements)
+	}
+
+	// The controller renews the lease for as long as the resource exists, up to its TTL
+	policy := poolLeasePolicy(pool)
+	maxTTL := ttl
+	if policy.maxTTL > 0 && policy.maxTTL < maxTTL {
+		maxTTL = policy.maxTTL
+	}
+	claim := workerClaim{
+		jobID:        jobID,
+		requestedBy:  principal.Identity,
+		priority:     allocation.Spec.Priority,
+		ttl:          policy.lease(maxTTL),
+		maxTTL:       maxTTL,
+		metadata:     allocation.Spec.Metadata,
+		requirements: requirements,
+		audit:        audit,
+	}
+
+	quotas := matchQuotas(pool, principal)
+	limitTTL(quotas, &claim)
+	reservation, err := s.quotas.reserve(types.NamespacedName{Name: pool.Name, Namespace: pool.Namespace}, quotas, s.tokenManager.ListTokens())
+	if err != nil {
+		var quotaErr *QuotaExceededError
+		if errors.As(err, &quotaErr) {
+			audit.Event, audit.Decision, audit.Reason = AuditWorkerAllocated, AuditDeny, err.Error()
+			s.audit.write(audit)
+		}
+		return "", err
+	}
+	claim.quota = reservation
+
+	s.startAsyncAllocation(id, pool, claim)
+	s.log.Info("Started worker allocation for BuildKitAllocation", "allocation", jobID, "pool", pool.Name, "identity", principal.Identity)
+	return id, nil
+}
+
+// ResourceAllocationStatus returns the status of a BuildKitAllocation's request.
+// Requests are only tracked in memory, so ErrAllocationNotFound means the
+// request was lost, e.g. to a restart, and has to be started again.
+func (s *Server) ResourceAllocationStatus(requestID string) (AllocationStatus, error) {
+	if !s.isReady() {
+		return AllocationStatus{}, ErrNotReady
+	}
+	status, _, _, found := s.allocations.get(requestID)
+	if !found {
+		return AllocationStatus{}, ErrAllocationNotFound
+	}
+	return s.withQueuePosition(status), nil
+}
+
+// RenewResourceAllocation renews the lease of a BuildKitAllocation's worker up
+// to the end of the allocation. It returns ErrAllocationNotFound once the
+// allocation expired or was revoked.
+func (s *Server) RenewResourceAllocation(ctx context.Context, allocationID string) (*ResourceLease, error) {
+	if !s.isReady() {
+		return nil, ErrNotReady
+	}
+	tokenData, ok := s.tokenManager.GetTokenByID(allocationID)
+	if !ok || !time.Now().Before(tokenData.ExpiresAt) {
+		return nil, ErrAllocationNotFound
+	}
+
+	// Leases that already run until the end of the allocation need no renewal
+	if !tokenData.ExpiresAt.Before(tokenData.MaxExpiresAt) {
+		return &ResourceLease{
+			ExpiresAt:    tokenData.ExpiresAt,
+			MaxExpiresAt: tokenData.MaxExpiresAt,
+			RenewAfter:   time.Until(tokenData.MaxExpiresAt),
+		}, nil
+	}
+
+	extension := time.Until(tokenData.MaxExpiresAt)
+	if pool := s.allocationPool(ctx, tokenData); pool != nil {
+		extension = poolLeasePolicy(pool).lease(extension)
+	}
+	renewed, err := s.tokenManager.RefreshToken(ctx, tokenData.Token, extension)
+	if err != nil {
+		return nil, fmt.Errorf("failed to renew allocation: %w", err)
+	}
+	return &ResourceLease{
+		ExpiresAt:    renewed.ExpiresAt,
+		MaxExpiresAt: renewed.MaxExpiresAt,
+		RenewAfter:   heartbeatInterval(extension),
+	}, nil
+}
+
+// ReleaseResourceAllocation releases the worker of a deleted BuildKitAllocation,
+// given its request ID and, once bound, its allocation ID. A request still
+// waiting for a worker is canceled.
+func (s *Server) ReleaseResourceAllocation(ctx context.Context, requestID, allocationID string) error {
+	if !s.isReady() {
+		return ErrNotReady
+	}
+
+	var tokenData *gateway.TokenData
+	if allocationID != "" {
+		tokenData, _ = s.tokenManager.GetTokenByID(allocationID)
+	} else if requestID != "" {
+		s.allocations.cancel(requestID)
+		if status, _, _, found := s.allocations.get(requestID); found && status.Allocation != nil {
+			tokenData, _ = s.tokenManager.ValidateToken(ctx, status.Allocation.Token)
+		}
+	}
+	if tokenData == nil {
+		return nil
+	}
+
+	s.teardownAllocation(ctx, tokenData.Token, tokenData)
+	audit := allocationAudit(tokenData)
+	audit.Event, audit.Decision = AuditWorkerReleased, AuditAllow
+	audit.Identity, audit.AuthMethod = tokenData.RequestedBy, auth.MethodResource
+	s.audit.write(audit)
+	s.webhooks.Emit(allocationEvent(webhooks.EventWorkerReleased, tokenData, "BuildKitAllocation deleted"))
+
+	s.log.Info("Worker released", "worker", tokenData.WorkerName, "pool", tokenData.PoolName, "allocation", tokenData.JobID)
+	return nil
+}
@@ -0,0 +1,355 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	buildkitv1alpha1 "github.com/smrt-devops/buildkit-controller/api/v1alpha1"
+	"github.com/smrt-devops/buildkit-controller/internal/auth"
+	"github.com/smrt-devops/buildkit-controller/internal/webhooks"
+)
+
+const (
+	// allocationRetention is how long finished asynchronous allocations stay available.
+	allocationRetention = 15 * time.Minute
+
+	// allocationStreamInterval is how often the event stream re-sends the status,
+	// which keeps the connection alive and reports queue position changes.
+	allocationStreamInterval = 2 * time.Second
+)
+
+// AllocationState is the state of an asynchronous allocation.
+type AllocationState string
+
+const (
+	// AllocationQueued means the allocation is waiting for a worker.
+	AllocationQueued AllocationState = "Queued"
+	// AllocationProvisioning means a new worker is being provisioned for the allocation.
+	AllocationProvisioning AllocationState = "Provisioning"
+	// AllocationReady means the worker is allocated and credentials are available.
+	AllocationReady AllocationState = "Ready"
+	// AllocationFailed means the allocation failed.
+	AllocationFailed AllocationState = "Failed"
+)
+
+// AllocationStatus is the status of an asynchronous allocation.
+type AllocationStatus struct {
+	ID        string          `json:"id"`
+	State     AllocationState `json:"state"`
+	PoolName  string          `json:"poolName"`
+	Namespace string          `json:"namespace"`
+	JobID     string          `json:"jobId"`
+	// QueuePosition is the 1-based position in the pool's queue while Queued.
+	QueuePosition int       `json:"queuePosition,omitempty"`
+	Message       string    `json:"message,omitempty"`
+	CreatedAt     time.Time `json:"createdAt"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+	// Allocation holds the worker and credentials once Ready.
+	Allocation *WorkerAllocateResponse `json:"allocation,omitempty"`
+}
+
+// finished reports whether the allocation reached a terminal state.
+func (a *AllocationStatus) finished() bool {
+	return a.State == AllocationReady || a.State == AllocationFailed
+}
+
+// allocationFailure is an allocation error together with the HTTP status it maps to.
+type allocationFailure struct {
+	status  int
+	message string
+	err     error
+}
+
+func (e *allocationFailure) Error() string {
+	return fmt.Sprintf("%s: %v", e.message, e.err)
+}
+
+func (e *allocationFailure) Unwrap() error {
+	return e.err
+}
+
+// trackedAllocation is an asynchronous allocation and the identity that requested it.
+type trackedAllocation struct {
+	status      AllocationStatus
+	requestedBy string
+	// changed is closed and replaced whenever the status changes.
+	changed chan struct{}
+	// cancel stops the allocation while it waits for a worker.
+	cancel context.CancelFunc
+}
+
+// allocationTracker keeps the state of asynchronous allocations in memory.
+type allocationTracker struct {
+	mu          sync.Mutex
+	allocations map[string]*trackedAllocation
+}
+
+func newAllocationTracker() *allocationTracker {
+	return &allocationTracker{
+		allocations: make(map[string]*trackedAllocation),
+	}
+}
+
+// create starts tracking a new allocation in the Queued state, replacing a
+// previous allocation with the same ID.
+func (t *allocationTracker) create(id, poolName, namespace, jobID, requestedBy string, cancel context.CancelFunc) AllocationStatus {
+	now := time.Now()
+	alloc := &trackedAllocation{
+		status: AllocationStatus{
+			ID:        id,
+			State:     AllocationQueued,
+			PoolName:  poolName,
+			Namespace: namespace,
+			JobID:     jobID,
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+		requestedBy: requestedBy,
+		changed:     make(chan struct{}),
+		cancel:      cancel,
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.allocations[alloc.status.ID] = alloc
+	return alloc.status
+}
+
+// update changes the status of an allocation and wakes its watchers.
+func (t *allocationTracker) update(id string, fn func(status *AllocationStatus)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	alloc, ok := t.allocations[id]
+	if !ok || alloc.status.finished() {
+		return
+	}
+	fn(&alloc.status)
+	alloc.status.UpdatedAt = time.Now()
+	close(alloc.changed)
+	alloc.changed = make(chan struct{})
+}
+
+// get returns the status of an allocation, the identity that requested it and a
+// channel that is closed on the next change.
+func (t *allocationTracker) get(id string) (AllocationStatus, string, <-chan struct{}, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	alloc, ok := t.allocations[id]
+	if !ok {
+		return AllocationStatus{}, "", nil, false
+	}
+	return alloc.status, alloc.requestedBy, alloc.changed, true
+}
+
+// cancel stops an allocation that has not finished yet.
+func (t *allocationTracker) cancel(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if alloc, ok := t.allocations[id]; ok && !alloc.status.finished() {
+		alloc.cancel()
+	}
+}
+
+// cleanup drops allocations that finished more than the retention period ago.
+func (t *allocationTracker) cleanup(retention time.Duration) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	removed := 0
+	cutoff := time.Now().Add(-retention)
+	for id, alloc := range t.allocations {
+		if alloc.status.finished() && alloc.status.UpdatedAt.Before(cutoff) {
+			delete(t.allocations, id)
+			removed++
+		}
+	}
+	return removed
+}
+
+// startAsyncAllocation tracks a new allocation under the given ID and runs it
+// in the background. An allocation canceled after it got a worker is torn down.
+func (s *Server) startAsyncAllocation(id string, pool *buildkitv1alpha1.BuildKitPool, claim workerClaim) AllocationStatus {
+	ctx, cancel := context.WithCancel(s.baseCtx)
+	status := s.allocations.create(id, pool.Name, pool.Namespace, claim.jobID, claim.requestedBy, cancel)
+
+	claim.progress = func(state AllocationState) {
+		s.allocations.update(status.ID, func(st *AllocationStatus) {
+			st.State = state
+		})
+	}
+
+	go func() {
+		defer cancel()
+		response, err := s.allocateWorker(ctx, pool, claim)
+		if err == nil && ctx.Err() != nil {
+			s.cancelAllocation(response)
+			err = ctx.Err()
+		}
+		s.allocations.update(status.ID, func(st *AllocationStatus) {
+			if err != nil {
+				st.State = AllocationFailed
+				st.Message = err.Error()
+				return
+			}
+			st.State = AllocationReady
+			st.Allocation = response
+		})
+	}()
+
+	return status
+}
+
+// cancelAllocation tears down an allocation that was canceled while it was
+// being made.
+func (s *Server) cancelAllocation(response *WorkerAllocateResponse) {
+	ctx := context.WithoutCancel(s.baseCtx)
+	tokenData, err := s.tokenManager.ValidateToken(ctx, response.Token)
+	if err != nil {
+		s.log.V(1).Info("Canceled allocation already ended", "worker", response.WorkerName, "error", err)
+		return
+	}
+	s.teardownAllocation(ctx, response.Token, tokenData)
+	s.webhooks.Emit(allocationEvent(webhooks.EventWorkerReleased, tokenData, "Allocation canceled"))
+}
+
+// handleAllocationStatus reports the status of an asynchronous allocation.
+// Clients that accept text/event-stream receive updates as server-sent events
+// until the allocation is Ready or Failed.
+func (s *Server) handleAllocationStatus(w http.ResponseWriter, r *http.Request) {
+	if !s.requireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	principal, ok := s.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/allocations/"), "/")
+	if id == "" {
+		http.Error(w, "Allocation ID required", http.StatusBadRequest)
+		return
+	}
+
+	status, requestedBy, _, found := s.allocations.get(id)
+	if !found {
+		http.Error(w, "Allocation not found", http.StatusNotFound)
+		return
+	}
+	var err error
+	if requestedBy != principal.Identity && !s.authorizer.IsAdmin(principal) {
+		err = fmt.Errorf("%w: allocation %s belongs to another identity", ErrForbidden, id)
+	}
+	target := AuditRecord{Pool: status.PoolName, Namespace: status.Namespace, JobID: status.JobID}
+	if !s.authorized(w, r, principal, ActionViewAllocation, target, err) {
+		return
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		s.streamAllocation(w, r, id)
+		return
+	}
+
+	status, _, _, _ = s.allocations.get(id)
+	s.encodeJSON(w, s.withQueuePosition(status))
+}
+
+// streamAllocation sends allocation status updates as server-sent events.
+func (s *Server) streamAllocation(w http.ResponseWriter, r *http.Request, id string) {
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		s.log.V(1).Info("Failed to clear write deadline", "error", err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	ticker := time.NewTicker(allocationStreamInterval)
+	defer ticker.Stop()
+
+	for {
+		status, _, changed, found := s.allocations.get(id)
+		if !found {
+			return
+		}
+
+		data, err := json.Marshal(s.withQueuePosition(status))
+		if err != nil {
+			s.log.Error(err, "Failed to encode allocation status")
+			return
+		}
+		if _, err := fmt.Fprintf(w, "event: status\ndata: %s\n\n", data); err != nil {
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+
+		if status.finished() {
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-changed:
+		case <-ticker.C:
+		}
+	}
+}
+
+// withQueuePosition fills in the live queue position of a queued allocation.
+func (s *Server) withQueuePosition(status AllocationStatus) AllocationStatus {
+	if status.State == AllocationQueued {
+		status.QueuePosition = s.queue.Position(types.NamespacedName{Name: status.PoolName, Namespace: status.Namespace}, status.JobID)
+	}
+	return status
+}
+
+// cleanupAllocations periodically drops finished asynchronous allocations.
+func (s *Server) cleanupAllocations(ctx context.Context) {
+	ticker := time.NewTicker(allocationRetention / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if removed := s.allocations.cleanup(allocationRetention); removed > 0 {
+				s.log.V(1).Info("Cleaned up finished allocations", "count", removed)
+			}
+		}
+	}
+}
+
+// writeAllocationError writes the response for a failed synchronous allocation.
+func (s *Server) writeAllocationError(w http.ResponseWriter, principal *auth.Principal, err error) {
+	var queueErr *QueueTimeoutError
+	if errors.As(err, &queueErr) {
+		s.queueTimeoutResponse(w, queueErr)
+		return
+	}
+
+	var failure *allocationFailure
+	if errors.As(err, &failure) {
+		s.log.Info("Worker allocation failed", "identity", principal.Identity)
+		s.errorResponse(w, failure.status, failure.message, failure.err)
+		return
+	}
+
+	s.errorResponse(w, http.StatusInternalServerError, "Failed to allocate worker", err)
+}
@@ -0,0 +1,339 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	buildkitv1alpha1 "github.com/smrt-devops/buildkit-controller/api/v1alpha1"
+	"github.com/smrt-devops/buildkit-controller/internal/auth"
+	"github.com/smrt-devops/buildkit-controller/internal/gateway"
+	"github.com/smrt-devops/buildkit-controller/internal/utils"
+)
+
+// AuditEvent is the kind of decision or action an audit record describes.
+type AuditEvent string
+
+const (
+	// AuditAuthentication is an authentication decision.
+	AuditAuthentication AuditEvent = "authentication"
+	// AuditAuthorization is an authorization decision.
+	AuditAuthorization AuditEvent = "authorization"
+	// AuditCertificateIssued is the issuance of a client certificate.
+	AuditCertificateIssued AuditEvent = "certificate.issued"
+	// AuditWorkerAllocated is a worker allocation, or its rejection by a quota.
+	AuditWorkerAllocated AuditEvent = "worker.allocated"
+	// AuditWorkerReleased is the release of a worker by its owner.
+	AuditWorkerReleased AuditEvent = "worker.released"
+	// AuditAllocationRevoked is the revocation of an allocation by an admin.
+	AuditAllocationRevoked AuditEvent = "allocation.revoked"
+	// AuditCertificateRevoked is the revocation of a client certificate by an admin.
+	AuditCertificateRevoked AuditEvent = "certificate.revoked"
+)
+
+// AuditDecision is the outcome of an audited decision.
+type AuditDecision string
+
+const (
+	AuditAllow AuditDecision = "allow"
+	AuditDeny  AuditDecision = "deny"
+)
+
+// AuditRecord is a structured audit log entry.
+type AuditRecord struct {
+	Time     time.Time     `json:"time"`
+	Event    AuditEvent    `json:"event"`
+	Decision AuditDecision `json:"decision"`
+	Reason   string        `json:"reason,omitempty"`
+	// Action is the action that was authorized, e.g. allocate.
+	Action     Action `json:"action,omitempty"`
+	Identity   string `json:"identity,omitempty"`
+	AuthMethod string `json:"authMethod,omitempty"`
+	Issuer     string `json:"issuer,omitempty"`
+	// SourceIP is the address of the direct peer. ForwardedFor is the
+	// X-Forwarded-For header as sent, which is only trustworthy behind a proxy
+	// that sets it.
+	SourceIP     string `json:"sourceIP,omitempty"`
+	ForwardedFor string `json:"forwardedFor,omitempty"`
+	Path         string `json:"path,omitempty"`
+	Pool         string `json:"pool,omitempty"`
+	Namespace    string `json:"namespace,omitempty"`
+	JobID        string `json:"jobId,omitempty"`
+	Worker       string `json:"worker,omitempty"`
+	AllocationID string `json:"allocationId,omitempty"`
+	CertSerial   string `json:"certSerial,omitempty"`
+}
+
+// AuditSink receives audit records. Write must not block for long, as it is
+// called while requests are served.
+type AuditSink interface {
+	Write(record *AuditRecord) error
+}
+
+// auditor sends audit records to the configured sinks.
+type auditor struct {
+	sinks []AuditSink
+	log   utils.Logger
+}
+
+// withRequest fills in the caller and the source of the request. principal may
+// be nil if the caller is not authenticated.
+func (record AuditRecord) withRequest(r *http.Request, principal *auth.Principal) AuditRecord {
+	record.SourceIP = sourceIP(r)
+	record.ForwardedFor = r.Header.Get("X-Forwarded-For")
+	record.Path = r.URL.Path
+	if principal != nil {
+		record.Identity = principal.Identity
+		record.AuthMethod = principal.Method
+		record.Issuer = principal.Issuer
+	}
+	return record
+}
+
+// record writes an audit record about a request.
+func (a *auditor) record(r *http.Request, principal *auth.Principal, record AuditRecord) {
+	a.write(record.withRequest(r, principal))
+}
+
+// write timestamps an audit record and writes it to every sink.
+func (a *auditor) write(record AuditRecord) {
+	if len(a.sinks) == 0 {
+		return
+	}
+
+	record.Time = time.Now().UTC()
+	for _, sink := range a.sinks {
+		if err := sink.Write(&record); err != nil {
+			a.log.Error(err, "Failed to write audit record", "event", record.Event, "identity", record.Identity)
+		}
+	}
+}
+
+// close closes the sinks that hold resources.
+func (a *auditor) close() {
+	for _, sink := range a.sinks {
+		if closer, ok := sink.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				a.log.Error(err, "Failed to close audit sink")
+			}
+		}
+	}
+}
+
+// sourceIP returns the IP address of the request's direct peer.
+func sourceIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// poolAudit returns an audit record about a pool.
+func poolAudit(pool *buildkitv1alpha1.BuildKitPool) AuditRecord {
+	return AuditRecord{Pool: pool.Name, Namespace: pool.Namespace}
+}
+
+// allocationAudit returns an audit record about an allocation.
+func allocationAudit(data *gateway.TokenData) AuditRecord {
+	return AuditRecord{
+		Pool:         data.PoolName,
+		Namespace:    data.Namespace,
+		JobID:        data.JobID,
+		Worker:       data.WorkerName,
+		AllocationID: data.ID,
+	}
+}
+
+// JSONLinesAuditSink writes audit records as JSON lines, e.g. to a file or stdout.
+type JSONLinesAuditSink struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+}
+
+// NewStdoutAuditSink creates a sink that writes JSON lines to stdout.
+func NewStdoutAuditSink() *JSONLinesAuditSink {
+	return &JSONLinesAuditSink{w: os.Stdout}
+}
+
+// NewFileAuditSink creates a sink that appends JSON lines to a file.
+func NewFileAuditSink(path string) (*JSONLinesAuditSink, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log %s: %w", path, err)
+	}
+	return &JSONLinesAuditSink{w: f, closer: f}, nil
+}
+
+// Write writes the record as one line.
+func (s *JSONLinesAuditSink) Write(record *AuditRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit record: %w", err)
+	}
+	data = append(data, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(data)
+	return err
+}
+
+// Close closes the underlying file, if any.
+func (s *JSONLinesAuditSink) Close() error {
+	if s.closer == nil {
+		return nil
+	}
+	return s.closer.Close()
+}
+
+const (
+	// webhookAuditBufferSize is how many records may wait to be sent before new
+	// records are dropped.
+	webhookAuditBufferSize = 1024
+	// webhookAuditBatchSize is the most records sent in one request.
+	webhookAuditBatchSize = 100
+	// webhookAuditFlushInterval is how long records wait for a batch to fill.
+	webhookAuditFlushInterval = 1 * time.Second
+	// webhookAuditAttempts is how often a batch is sent before it is dropped.
+	webhookAuditAttempts = 3
+)
+
+// errAuditBufferFull is returned when the webhook sink cannot keep up.
+var errAuditBufferFull = errors.New("audit webhook buffer is full, record dropped")
+
+// WebhookAuditSink posts audit records to a webhook as JSON arrays. Records are
+// buffered and sent in batches in the background, so slow webhooks do not slow
+// down requests.
+type WebhookAuditSink struct {
+	url     string
+	client  *http.Client
+	log     utils.Logger
+	mu      sync.RWMutex
+	closed  bool
+	records chan *AuditRecord
+	done    chan struct{}
+}
+
+// NewWebhookAuditSink creates a webhook sink and starts sending records.
+func NewWebhookAuditSink(url string, log utils.Logger) *WebhookAuditSink {
+	s := &WebhookAuditSink{
+		url:     url,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		log:     log,
+		records: make(chan *AuditRecord, webhookAuditBufferSize),
+		done:    make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Write queues the record to be sent.
+func (s *WebhookAuditSink) Write(record *AuditRecord) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return errors.New("audit webhook sink is closed")
+	}
+
+	copied := *record
+	select {
+	case s.records <- &copied:
+		return nil
+	default:
+		return errAuditBufferFull
+	}
+}
+
+// Close sends the buffered records and stops the sink.
+func (s *WebhookAuditSink) Close() error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.records)
+	}
+	s.mu.Unlock()
+
+	<-s.done
+	return nil
+}
+
+func (s *WebhookAuditSink) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(webhookAuditFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*AuditRecord, 0, webhookAuditBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := s.send(batch); err != nil {
+			s.log.Error(err, "Failed to send audit records to webhook", "count", len(batch))
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case record, ok := <-s.records:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, record)
+			if len(batch) >= webhookAuditBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// send posts a batch of records, retrying failed attempts with backoff.
+func (s *WebhookAuditSink) send(batch []*AuditRecord) error {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit records: %w", err)
+	}
+
+	backoff := time.Second
+	for attempt := 1; ; attempt++ {
+		err = s.post(body)
+		if err == nil || attempt == webhookAuditAttempts {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (s *WebhookAuditSink) post(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("audit webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	buildkitv1alpha1 "github.com/smrt-devops/buildkit-controller/api/v1alpha1"
+	"github.com/smrt-devops/buildkit-controller/internal/auth"
+	"github.com/smrt-devops/buildkit-controller/internal/gateway"
+)
+
+// Action is an operation a caller performs against a pool.
+type Action string
+
+const (
+	// ActionList lists the pools a caller can access.
+	ActionList Action = "list"
+	// ActionRequestCerts requests client certificates for pools.
+	ActionRequestCerts Action = "request-certs"
+	// ActionAllocate allocates a pool or a worker from a pool.
+	ActionAllocate Action = "allocate"
+	// ActionWake wakes a pool that is scaled to zero.
+	ActionWake Action = "wake"
+	// ActionRelease releases an allocated worker.
+	ActionRelease Action = "release"
+	// ActionRenew renews the lease of an allocated worker.
+	ActionRenew Action = "renew"
+	// ActionViewAllocation reads the status of an asynchronous allocation.
+	ActionViewAllocation Action = "view-allocation"
+	// ActionAdmin uses the admin API.
+	ActionAdmin Action = "admin"
+)
+
+// ErrForbidden is returned when a caller is not allowed to perform an action.
+var ErrForbidden = errors.New("forbidden")
+
+// Authorizer is the single authorization layer all API handlers go through.
+// It enforces the pool's RBAC rules and ownership of allocations.
+type Authorizer struct {
+	rbac        *RBACChecker
+	admins      []string
+	adminGroups []string
+	adminOIDCNs string
+}
+
+// NewAuthorizer creates a new authorizer. Admin identity and group patterns use
+// the same syntax as RBAC rule users and groups, and grant access to every pool
+// and allocation as well as the admin API. They only apply to ServiceAccounts
+// and to OIDC principals verified with a BuildKitOIDCConfig in adminOIDCNamespace.
+func NewAuthorizer(admins, adminGroups []string, adminOIDCNamespace string) *Authorizer {
+	return &Authorizer{
+		rbac:        NewRBACChecker(),
+		admins:      admins,
+		adminGroups: adminGroups,
+		adminOIDCNs: adminOIDCNamespace,
+	}
+}
+
+// IsAdmin reports whether the principal is an admin.
+func (a *Authorizer) IsAdmin(principal *auth.Principal) bool {
+	if !a.mayBeAdmin(principal) {
+		return false
+	}
+	return a.rbac.MatchesAny(principal.Identity, a.admins) ||
+		a.rbac.MatchesAnyGroup(principal.Groups, a.adminGroups)
+}
+
+// mayBeAdmin reports whether admin patterns apply to the principal. Issuers,
+// claims mappings and static tokens defined by pool owners are controlled by
+// tenants, so principals verified with them are never admins.
+func (a *Authorizer) mayBeAdmin(principal *auth.Principal) bool {
+	switch principal.Method {
+	case auth.MethodServiceAccount, auth.MethodDev:
+		return true
+	case auth.MethodOIDC:
+		namespace, _, ok := strings.Cut(principal.OIDCConfig, "/")
+		return ok && a.adminOIDCNs != "" && namespace == a.adminOIDCNs
+	default:
+		return false
+	}
+}
+
+// AuthorizeAdmin checks that the principal may use the admin API.
+func (a *Authorizer) AuthorizeAdmin(principal *auth.Principal) error {
+	if !a.IsAdmin(principal) {
+		return fmt.Errorf("%w: %s is not an admin", ErrForbidden, principal.Identity)
+	}
+	return nil
+}
+
+// AuthorizePool checks that the principal may perform the action on a pool.
+func (a *Authorizer) AuthorizePool(principal *auth.Principal, action Action, pool *buildkitv1alpha1.BuildKitPool) error {
+	if a.IsAdmin(principal) {
+		return nil
+	}
+	if !inScope(principal, pool) {
+		return fmt.Errorf("%w: %s on pool %s/%s: %s is limited to other pools", ErrForbidden, action, pool.Namespace, pool.Name, principal.Identity)
+	}
+	if err := a.rbac.CheckAccess(principal, pool); err != nil {
+		return fmt.Errorf("%w: %s on pool %s/%s: %w", ErrForbidden, action, pool.Namespace, pool.Name, err)
+	}
+	return nil
+}
+
+// AuthorizePools checks that the principal may perform the action on all named pools.
+func (a *Authorizer) AuthorizePools(principal *auth.Principal, action Action, poolNames []string, pools map[string]*buildkitv1alpha1.BuildKitPool) error {
+	if a.IsAdmin(principal) {
+		return nil
+	}
+	for _, poolName := range poolNames {
+		if pool, ok := pools[poolName]; ok && !inScope(principal, pool) {
+			return fmt.Errorf("%w: %s on pool %s/%s: %s is limited to other pools", ErrForbidden, action, pool.Namespace, pool.Name, principal.Identity)
+		}
+	}
+	if err := a.rbac.CheckPoolAccess(principal, poolNames, pools); err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrForbidden, action, err)
+	}
+	return nil
+}
+
+// AuthorizeAllocation checks that the principal may act on an allocation, e.g.
+// release or renew it. Only the identity that requested the allocation or an
+// admin may do so, and the requester must still have access to the pool if it exists.
+func (a *Authorizer) AuthorizeAllocation(principal *auth.Principal, action Action, tokenData *gateway.TokenData, pool *buildkitv1alpha1.BuildKitPool) error {
+	if a.IsAdmin(principal) {
+		return nil
+	}
+	if tokenData.RequestedBy != principal.Identity {
+		return fmt.Errorf("%w: allocation %s belongs to another identity", ErrForbidden, tokenData.ID)
+	}
+	if pool == nil {
+		return nil
+	}
+	return a.AuthorizePool(principal, action, pool)
+}
+
+// inScope reports whether the pool is within the scope of the principal.
+func inScope(principal *auth.Principal, pool *buildkitv1alpha1.BuildKitPool) bool {
+	if principal.Scope == nil {
+		return true
+	}
+	return slices.Contains(principal.Scope, pool.Namespace+"/"+pool.Name)
+}
+
+// authorized records an authorization decision in the audit log and writes a
+// 403 response if err denied the request. target names the resource the
+// decision was about.
+func (s *Server) authorized(w http.ResponseWriter, r *http.Request, principal *auth.Principal, action Action, target AuditRecord, err error) bool {
+	target.Event = AuditAuthorization
+	target.Action = action
+	target.Decision = AuditAllow
+	if err != nil {
+		target.Decision = AuditDeny
+		target.Reason = err.Error()
+	}
+	s.audit.record(r, principal, target)
+
+	if err != nil {
+		s.forbidden(w, principal, err)
+		return false
+	}
+	return true
+}
+
+// forbidden writes a 403 response for an authorization error.
+func (s *Server) forbidden(w http.ResponseWriter, principal *auth.Principal, err error) {
+	s.log.Info("Authorization denied", "identity", principal.Identity, "method", principal.Method, "reason", err.Error())
+	http.Error(w, err.Error(), http.StatusForbidden)
+}
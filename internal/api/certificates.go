@@ -0,0 +1,153 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/smrt-devops/buildkit-controller/internal/auth"
+	"github.com/smrt-devops/buildkit-controller/internal/certs"
+	"github.com/smrt-devops/buildkit-controller/internal/resources"
+	"github.com/smrt-devops/buildkit-controller/internal/utils"
+)
+
+// CertificateListResponse is the list of issued client certificates.
+type CertificateListResponse struct {
+	Certificates []certs.IssuedCertificate `json:"certificates"`
+}
+
+// recordCertificate adds a client certificate issued to the caller to the
+// inventory, so admins can find and revoke it.
+func (s *Server) recordCertificate(ctx context.Context, principal *auth.Principal, pools []string, info *certs.CertificateInfo) error {
+	return s.certManager.RecordCertificate(ctx, certs.IssuedCertificate{
+		SerialNumber: info.SerialNumber,
+		CommonName:   principal.Identity,
+		Pools:        pools,
+		NotBefore:    info.NotBefore,
+		NotAfter:     info.NotAfter,
+	})
+}
+
+// handleAdminCertificates serves the admin certificate API:
+//   - GET /api/v1/admin/certificates lists issued client certificates, filtered
+//     by the identity and pool query parameters, and revoked=true|false
+//   - DELETE /api/v1/admin/certificates/{serial} revokes a certificate, with an
+//     optional reason query parameter.
+func (s *Server) handleAdminCertificates(w http.ResponseWriter, r *http.Request) {
+	principal, ok := s.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	if !s.authorized(w, r, principal, ActionAdmin, AuditRecord{}, s.authorizer.AuthorizeAdmin(principal)) {
+		return
+	}
+
+	serial := strings.ToLower(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/admin/certificates"), "/"))
+	if serial == "" {
+		if !s.requireMethod(w, r, http.MethodGet) {
+			return
+		}
+		s.listCertificates(w, r)
+		return
+	}
+
+	if !s.requireMethod(w, r, http.MethodDelete) {
+		return
+	}
+
+	reason := r.URL.Query().Get("reason")
+	cert, err := s.certManager.RevokeCertificate(r.Context(), serial, principal.Identity, reason)
+	if errors.Is(err, certs.ErrCertificateNotFound) {
+		http.Error(w, "Certificate not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to revoke certificate", err)
+		return
+	}
+
+	s.audit.record(r, principal, AuditRecord{
+		Event:      AuditCertificateRevoked,
+		Decision:   AuditAllow,
+		Reason:     reason,
+		Pool:       strings.Join(cert.Pools, ","),
+		CertSerial: cert.SerialNumber,
+	})
+	s.log.Info("Certificate revoked by admin", "serial", serial, "commonName", cert.CommonName, "identity", principal.Identity)
+
+	// Publish right away rather than on the next pool reconcile
+	s.publishCRL(r.Context())
+
+	s.encodeJSON(w, cert)
+}
+
+// listCertificates writes the issued certificates matching the query filters.
+func (s *Server) listCertificates(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	identity := query.Get("identity")
+	pool := query.Get("pool")
+	revoked := query.Get("revoked")
+
+	issued, err := s.certManager.ListCertificates(r.Context())
+	if err != nil {
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to list certificates", err)
+		return
+	}
+
+	result := []certs.IssuedCertificate{}
+	for _, cert := range issued {
+		if (identity != "" && cert.CommonName != identity) ||
+			(pool != "" && !slices.Contains(cert.Pools, pool)) ||
+			(revoked == "true" && !cert.Revoked()) ||
+			(revoked == "false" && cert.Revoked()) {
+			continue
+		}
+		result = append(result, cert)
+	}
+
+	s.encodeJSON(w, CertificateListResponse{Certificates: result})
+}
+
+// publishCRL publishes the current CRL for the gateway of every pool with TLS.
+// Failures are logged; the pool controller publishes the CRL again on its next
+// reconcile.
+func (s *Server) publishCRL(ctx context.Context) {
+	pools, err := s.listPools(ctx)
+	if err != nil {
+		s.log.Error(err, "Failed to list pools to publish CRL")
+		return
+	}
+
+	for i := range pools.Items {
+		pool := &pools.Items[i]
+		if !pool.Spec.TLS.Enabled {
+			continue
+		}
+		name := resources.GetCRLConfigMapName(pool.Name)
+		if err := s.certManager.PublishCRL(ctx, name, pool.Namespace, utils.DefaultLabels("crl", pool.Name)); err != nil {
+			s.log.Error(err, "Failed to publish CRL", "pool", pool.Name, "namespace", pool.Namespace)
+		}
+	}
+}
+
+// handleCRL serves the PEM-encoded client certificate revocation list. It needs
+// no authentication, the CRL is signed by the CA.
+func (s *Server) handleCRL(w http.ResponseWriter, r *http.Request) {
+	if !s.requireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	crlPEM, err := s.certManager.CreateCRL(r.Context())
+	if err != nil {
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to create CRL", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	if _, err := w.Write(crlPEM); err != nil {
+		s.log.V(1).Info("Failed to write CRL", "error", err)
+	}
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	buildkitv1alpha1 "github.com/smrt-devops/buildkit-controller/api/v1alpha1"
+	"github.com/smrt-devops/buildkit-controller/internal/gateway"
+)
+
+// defaultAllocationTTL is the lease of a worker allocation when the request sets no TTL.
+const defaultAllocationTTL = 1 * time.Hour
+
+// leasePolicy is a pool's policy for allocation leases.
+type leasePolicy struct {
+	// maxTTL is how long after allocation a lease can be renewed to. Zero uses
+	// the token manager's maximum.
+	maxTTL time.Duration
+	// idleTimeout, if set, is the longest lease granted at once, so allocations
+	// that stop renewing expire after it.
+	idleTimeout time.Duration
+}
+
+// poolLeasePolicy reads the lease policy from a pool's gateway settings.
+// Invalid durations are ignored.
+func poolLeasePolicy(pool *buildkitv1alpha1.BuildKitPool) leasePolicy {
+	var policy leasePolicy
+	if d, err := time.ParseDuration(pool.Spec.Gateway.MaxTokenTTL); err == nil && d > 0 {
+		policy.maxTTL = d
+	}
+	if d, err := time.ParseDuration(pool.Spec.Gateway.IdleLeaseTimeout); err == nil && d > 0 {
+		policy.idleTimeout = d
+	}
+	return policy
+}
+
+// lease returns the lease to grant for a requested duration.
+func (p leasePolicy) lease(requested time.Duration) time.Duration {
+	if p.idleTimeout > 0 && (requested <= 0 || requested > p.idleTimeout) {
+		return p.idleTimeout
+	}
+	return requested
+}
+
+// heartbeatInterval is how often clients should renew a lease, leaving room
+// for a couple of failed renewals before it lapses.
+func heartbeatInterval(lease time.Duration) time.Duration {
+	return lease / 3
+}
+
+// WorkerRenewRequest represents a request to renew a worker allocation.
+type WorkerRenewRequest struct {
+	Token string `json:"token"`
+	// Extension is how long from now the allocation should last, e.g. "30m".
+	// It defaults to one hour and is limited by the pool's idle lease timeout.
+	Extension string `json:"extension,omitempty"`
+}
+
+// WorkerRenewResponse represents a renewed worker allocation.
+type WorkerRenewResponse struct {
+	WorkerName string `json:"workerName"`
+	// ExpiresAt is when the allocation expires unless it is renewed again.
+	ExpiresAt string `json:"expiresAt"`
+	// MaxExpiresAt is the limit the allocation can be renewed to, set by the
+	// pool's maxTokenTTL.
+	MaxExpiresAt string `json:"maxExpiresAt"`
+	// HeartbeatInterval is how often clients should renew the allocation.
+	HeartbeatInterval string `json:"heartbeatInterval"`
+}
+
+// handleWorkerRenew extends the lease of a worker allocation. The token and the
+// worker's allocation are extended together, up to the pool's maxTokenTTL.
+func (s *Server) handleWorkerRenew(w http.ResponseWriter, r *http.Request) {
+	if !s.requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	principal, ok := s.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	var req WorkerRenewRequest
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+
+	if req.Token == "" {
+		http.Error(w, "token is required", http.StatusBadRequest)
+		return
+	}
+
+	extension := defaultAllocationTTL
+	if req.Extension != "" {
+		parsed, err := time.ParseDuration(req.Extension)
+		if err != nil || parsed <= 0 {
+			http.Error(w, fmt.Sprintf("invalid extension %q", req.Extension), http.StatusBadRequest)
+			return
+		}
+		extension = parsed
+	}
+
+	tokenData, err := s.tokenManager.ValidateToken(r.Context(), req.Token)
+	if err != nil {
+		http.Error(w, "Token not found or expired", http.StatusNotFound)
+		return
+	}
+
+	pool := s.allocationPool(r.Context(), tokenData)
+	if !s.authorized(w, r, principal, ActionRenew, allocationAudit(tokenData), s.authorizer.AuthorizeAllocation(principal, ActionRenew, tokenData, pool)) {
+		return
+	}
+
+	if pool != nil {
+		extension = poolLeasePolicy(pool).lease(extension)
+	}
+
+	renewed, err := s.tokenManager.RefreshToken(r.Context(), req.Token, extension)
+	if err != nil {
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to renew allocation", err)
+		return
+	}
+
+	s.log.V(1).Info("Worker allocation renewed", "worker", renewed.WorkerName, "pool", renewed.PoolName, "expiresAt", renewed.ExpiresAt, "identity", principal.Identity)
+	s.encodeJSON(w, WorkerRenewResponse{
+		WorkerName:        renewed.WorkerName,
+		ExpiresAt:         renewed.ExpiresAt.Format(time.RFC3339),
+		MaxExpiresAt:      renewed.MaxExpiresAt.Format(time.RFC3339),
+		HeartbeatInterval: heartbeatInterval(extension).String(),
+	})
+}
+
+// allocationPool returns the pool of an allocation, or nil if the pool is gone,
+// in which case only ownership of the allocation is checked.
+func (s *Server) allocationPool(ctx context.Context, tokenData *gateway.TokenData) *buildkitv1alpha1.BuildKitPool {
+	pool, err := s.getPool(ctx, types.NamespacedName{Name: tokenData.PoolName, Namespace: tokenData.Namespace})
+	if err != nil {
+		return nil
+	}
+	return pool
+}
@@ -0,0 +1,266 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	buildkitv1alpha1 "github.com/smrt-devops/buildkit-controller/api/v1alpha1"
+	"github.com/smrt-devops/buildkit-controller/internal/auth"
+	"github.com/smrt-devops/buildkit-controller/internal/controller/shared"
+	"github.com/smrt-devops/buildkit-controller/internal/resources"
+)
+
+// errNoPoolMatched is returned when a pool selector matches no pool.
+var errNoPoolMatched = errors.New("no pools found matching selector")
+
+// poolLoad is a snapshot of how busy a candidate pool is.
+type poolLoad struct {
+	pool *buildkitv1alpha1.BuildKitPool
+	// idle is the number of claimable workers.
+	idle int
+	// workers is the number of workers, counted against the pool's max.
+	workers int
+	max     int
+	// queued is the number of allocations waiting for a worker.
+	queued int
+}
+
+// available reports whether an allocation can get a worker without queueing.
+func (l *poolLoad) available() bool {
+	return l.queued == 0 && (l.idle > 0 || l.workers < l.max)
+}
+
+// utilization is the share of the pool's capacity that is in use.
+func (l *poolLoad) utilization() float64 {
+	if l.max <= 0 {
+		return 1
+	}
+	return float64(l.workers-l.idle) / float64(l.max)
+}
+
+// poolMaxWorkers returns the number of workers a pool may run.
+func poolMaxWorkers(pool *buildkitv1alpha1.BuildKitPool) int32 {
+	if pool.Spec.Scaling.Max != nil {
+		return *pool.Spec.Scaling.Max
+	}
+	return shared.DefaultMaxWorkers
+}
+
+// candidatePools resolves the pools an allocation may use, in order of
+// preference: an ordered list of pool names, or every pool matching a label
+// selector sorted by name. ordered reports whether the order is the caller's.
+func (s *Server) candidatePools(ctx context.Context, namespace string, names []string, selector map[string]string) (pools []*buildkitv1alpha1.BuildKitPool, ordered bool, err error) {
+	if len(names) > 0 {
+		for _, name := range names {
+			pool, err := s.getPool(ctx, types.NamespacedName{Name: name, Namespace: namespace})
+			if err != nil {
+				return nil, false, fmt.Errorf("pool %s: %w", name, err)
+			}
+			pools = append(pools, pool)
+		}
+		return pools, true, nil
+	}
+
+	poolList, err := s.listPools(ctx, client.InNamespace(namespace), client.MatchingLabelsSelector{Selector: labels.SelectorFromSet(selector)})
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to list pools: %w", err)
+	}
+	if len(poolList.Items) == 0 {
+		return nil, false, errNoPoolMatched
+	}
+	sort.Slice(poolList.Items, func(i, j int) bool {
+		return poolList.Items[i].Name < poolList.Items[j].Name
+	})
+	for i := range poolList.Items {
+		pools = append(pools, &poolList.Items[i])
+	}
+	return pools, false, nil
+}
+
+// authorizedPools returns the candidate pools the caller may allocate from. If
+// there are none, it returns the first candidate with the authorization error.
+func (s *Server) authorizedPools(principal *auth.Principal, candidates []*buildkitv1alpha1.BuildKitPool) ([]*buildkitv1alpha1.BuildKitPool, *buildkitv1alpha1.BuildKitPool, error) {
+	var allowed []*buildkitv1alpha1.BuildKitPool
+	var firstErr error
+	for _, pool := range candidates {
+		err := s.authorizer.AuthorizePool(principal, ActionAllocate, pool)
+		if err == nil {
+			allowed = append(allowed, pool)
+		} else if firstErr == nil {
+			firstErr = err
+		}
+	}
+	if len(allowed) == 0 {
+		return nil, candidates[0], firstErr
+	}
+	return allowed, nil, nil
+}
+
+// workerRequirements are what an allocation needs of its worker.
+type workerRequirements struct {
+	// platforms the worker must build for.
+	platforms []string
+	// size is the requested worker size; empty selects the pool's default size.
+	size string
+}
+
+// String describes the requirements for error messages.
+func (q workerRequirements) String() string {
+	var parts []string
+	if len(q.platforms) > 0 {
+		parts = append(parts, "platforms "+strings.Join(q.platforms, ", "))
+	}
+	if q.size != "" {
+		parts = append(parts, "size "+q.size)
+	}
+	return strings.Join(parts, " and ")
+}
+
+// supportedBy reports whether a pool can provide a worker meeting the requirements.
+func (q workerRequirements) supportedBy(pool *buildkitv1alpha1.BuildKitPool) bool {
+	_, groupOK := resources.FindWorkerGroup(pool, q.platforms)
+	_, sizeOK := resources.FindWorkerSize(pool, q.size)
+	return groupOK && sizeOK
+}
+
+// matches reports whether a worker of the pool meets the requirements.
+func (q workerRequirements) matches(pool *buildkitv1alpha1.BuildKitPool, worker *buildkitv1alpha1.BuildKitWorker) bool {
+	size, _ := resources.FindWorkerSize(pool, q.size)
+	return worker.Spec.Size == resources.WorkerSizeName(size) &&
+		resources.SupportsPlatforms(worker.Spec.Platforms, q.platforms)
+}
+
+// supportingPools returns the pools that can provide a worker meeting the requirements.
+func supportingPools(pools []*buildkitv1alpha1.BuildKitPool, requirements workerRequirements) []*buildkitv1alpha1.BuildKitPool {
+	var supporting []*buildkitv1alpha1.BuildKitPool
+	for _, pool := range pools {
+		if requirements.supportedBy(pool) {
+			supporting = append(supporting, pool)
+		}
+	}
+	return supporting
+}
+
+// loadOf takes a snapshot of a pool's workers and allocation queue. Only idle
+// workers meeting the requirements count as idle.
+func (s *Server) loadOf(ctx context.Context, pool *buildkitv1alpha1.BuildKitPool, requirements workerRequirements) (*poolLoad, error) {
+	workerList := &buildkitv1alpha1.BuildKitWorkerList{}
+	if err := s.client.List(ctx, workerList,
+		client.InNamespace(pool.Namespace),
+		client.MatchingLabels{"buildkit.smrt-devops.net/pool": pool.Name}); err != nil {
+		return nil, fmt.Errorf("failed to list workers of pool %s: %w", pool.Name, err)
+	}
+
+	return &poolLoad{
+		pool:    pool,
+		idle:    len(claimableWorkers(pool, workerList, requirements)),
+		workers: len(workerList.Items),
+		max:     int(poolMaxWorkers(pool)),
+		queued:  s.queue.Len(types.NamespacedName{Name: pool.Name, Namespace: pool.Namespace}),
+	}, nil
+}
+
+// selectPool picks the pool to allocate from. An ordered list is a primary pool
+// followed by overflow pools: the first pool that can hand out a worker without
+// queueing is used. Pools matched by a selector are interchangeable, so the
+// least loaded one is used: idle workers first, then the most room to scale.
+// When every pool is at capacity, the allocation queues on the pool with the
+// shortest queue, preferring earlier pools on a tie.
+func (s *Server) selectPool(ctx context.Context, pools []*buildkitv1alpha1.BuildKitPool, ordered bool, requirements workerRequirements) (*buildkitv1alpha1.BuildKitPool, error) {
+	if len(pools) == 1 {
+		return pools[0], nil
+	}
+
+	loads := make([]*poolLoad, 0, len(pools))
+	for _, pool := range pools {
+		load, err := s.loadOf(ctx, pool, requirements)
+		if err != nil {
+			return nil, err
+		}
+		loads = append(loads, load)
+	}
+
+	var best *poolLoad
+	for _, load := range loads {
+		if !load.available() {
+			continue
+		}
+		if ordered {
+			best = load
+			break
+		}
+		if best == nil || lessLoaded(load, best) {
+			best = load
+		}
+	}
+
+	if best == nil {
+		for _, load := range loads {
+			if best == nil || load.queued < best.queued {
+				best = load
+			}
+		}
+	}
+
+	s.log.V(1).Info("Selected pool for allocation", "pool", best.pool.Name, "candidates", len(pools),
+		"idle", best.idle, "workers", best.workers, "queued", best.queued)
+	return best.pool, nil
+}
+
+// lessLoaded reports whether a is a better place for an allocation than b.
+func lessLoaded(a, b *poolLoad) bool {
+	if (a.idle > 0) != (b.idle > 0) {
+		return a.idle > 0
+	}
+	return a.utilization() < b.utilization()
+}
+
+// resolvePool resolves the candidate pools of an allocation request, checks the
+// caller may allocate from them and selects one that can provide a worker
+// meeting the requirements. It writes the error response and returns false if
+// no pool can be used.
+func (s *Server) resolvePool(w http.ResponseWriter, r *http.Request, principal *auth.Principal, namespace string, names []string, selector map[string]string, requirements workerRequirements) (*buildkitv1alpha1.BuildKitPool, bool) {
+	candidates, ordered, err := s.candidatePools(r.Context(), namespace, names, selector)
+	if errors.Is(err, errNoPoolMatched) {
+		http.Error(w, "No pools found matching selector", http.StatusNotFound)
+		return nil, false
+	}
+	if apierrors.IsNotFound(err) {
+		s.errorResponse(w, http.StatusNotFound, "Pool not found", err)
+		return nil, false
+	}
+	if err != nil {
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to get pools", err)
+		return nil, false
+	}
+
+	allowed, denied, err := s.authorizedPools(principal, candidates)
+	if err != nil {
+		s.authorized(w, r, principal, ActionAllocate, poolAudit(denied), err)
+		return nil, false
+	}
+
+	allowed = supportingPools(allowed, requirements)
+	if len(allowed) == 0 {
+		http.Error(w, fmt.Sprintf("No pool offers workers with %s", requirements), http.StatusBadRequest)
+		return nil, false
+	}
+
+	pool, err := s.selectPool(r.Context(), allowed, ordered, requirements)
+	if err != nil {
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to select pool", err)
+		return nil, false
+	}
+
+	// Record the authorization for the pool actually used
+	return pool, s.authorized(w, r, principal, ActionAllocate, poolAudit(pool), nil)
+}
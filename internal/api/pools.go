@@ -0,0 +1,44 @@
+package api
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	buildkitv1alpha1 "github.com/smrt-devops/buildkit-controller/api/v1alpha1"
+	"github.com/smrt-devops/buildkit-controller/internal/controller/shared"
+)
+
+// getPool gets a pool with the defaults of its BuildKitPoolClass applied, so
+// auth, quotas and leases follow the class like the pool reconciler does.
+func (s *Server) getPool(ctx context.Context, key types.NamespacedName) (*buildkitv1alpha1.BuildKitPool, error) {
+	pool := &buildkitv1alpha1.BuildKitPool{}
+	if err := s.client.Get(ctx, key, pool); err != nil {
+		return nil, err
+	}
+	if _, err := shared.ApplyPoolClass(ctx, s.client, pool); err != nil {
+		return nil, err
+	}
+	return pool, nil
+}
+
+// listPools lists pools with the defaults of their BuildKitPoolClass applied.
+// Pools whose class cannot be applied are left out.
+func (s *Server) listPools(ctx context.Context, opts ...client.ListOption) (*buildkitv1alpha1.BuildKitPoolList, error) {
+	pools := &buildkitv1alpha1.BuildKitPoolList{}
+	if err := s.client.List(ctx, pools, opts...); err != nil {
+		return nil, err
+	}
+
+	items := pools.Items[:0]
+	for i := range pools.Items {
+		if _, err := shared.ApplyPoolClass(ctx, s.client, &pools.Items[i]); err != nil {
+			s.log.V(1).Info("Skipping pool", "pool", pools.Items[i].Name, "namespace", pools.Items[i].Namespace, "error", err)
+			continue
+		}
+		items = append(items, pools.Items[i])
+	}
+	pools.Items = items
+	return pools, nil
+}
@@ -0,0 +1,352 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	toolscache "k8s.io/client-go/tools/cache"
+
+	buildkitv1alpha1 "github.com/smrt-devops/buildkit-controller/api/v1alpha1"
+	"github.com/smrt-devops/buildkit-controller/internal/metrics"
+)
+
+const (
+	// DefaultAllocationQueueTimeout is how long an allocation waits in a pool's queue.
+	DefaultAllocationQueueTimeout = 2 * time.Minute
+
+	// queueRecheckInterval is how often queued allocations re-check for free
+	// workers when no worker event arrives.
+	queueRecheckInterval = 10 * time.Second
+)
+
+// AllocationQueue orders worker allocations per pool while the pool is at its
+// maximum size. Waiters are served by priority, highest first, and in FIFO order
+// within a priority. A waiter only takes a worker that no waiter ahead of it can
+// use, so a freed worker goes to the longest waiting request of the highest
+// priority that needs it, and a waiter for a maxed out size or an unavailable
+// platform does not hold up waiters behind it.
+type AllocationQueue struct {
+	mu    sync.Mutex
+	pools map[types.NamespacedName][]*QueueTicket
+}
+
+// QueueTicket is a place in a pool's allocation queue.
+type QueueTicket struct {
+	queue        *AllocationQueue
+	pool         types.NamespacedName
+	jobID        string
+	priority     int32
+	requirements workerRequirements
+	enqueuedAt   time.Time
+	turn         chan struct{}
+	left         bool
+	provisioning bool
+}
+
+// QueueTimeoutError is returned when an allocation times out in the queue.
+type QueueTimeoutError struct {
+	Position int
+	Depth    int
+	Waited   time.Duration
+}
+
+func (e *QueueTimeoutError) Error() string {
+	return fmt.Sprintf("timed out after %s waiting for a worker at queue position %d of %d",
+		e.Waited.Round(time.Second), e.Position, e.Depth)
+}
+
+// NewAllocationQueue creates a new allocation queue.
+func NewAllocationQueue() *AllocationQueue {
+	return &AllocationQueue{
+		pools: make(map[types.NamespacedName][]*QueueTicket),
+	}
+}
+
+// Enqueue adds an allocation to a pool's queue.
+func (q *AllocationQueue) Enqueue(pool types.NamespacedName, jobID string, priority int32, requirements workerRequirements) *QueueTicket {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	ticket := &QueueTicket{
+		queue:        q,
+		pool:         pool,
+		jobID:        jobID,
+		priority:     priority,
+		requirements: requirements,
+		enqueuedAt:   time.Now(),
+		turn:         make(chan struct{}, 1),
+	}
+
+	waiters := q.pools[pool]
+	// Insert after every waiter with the same or a higher priority
+	idx := sort.Search(len(waiters), func(i int) bool {
+		return waiters[i].priority < priority
+	})
+	waiters = append(waiters, nil)
+	copy(waiters[idx+1:], waiters[idx:])
+	waiters[idx] = ticket
+	q.pools[pool] = waiters
+
+	metrics.AllocationQueueDepth.WithLabelValues(pool.Name, pool.Namespace).Set(float64(len(waiters)))
+	ticket.signal()
+	return ticket
+}
+
+// Len returns the number of allocations waiting for a pool.
+func (q *AllocationQueue) Len(pool types.NamespacedName) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pools[pool])
+}
+
+// Position returns the 1-based queue position of a job, or 0 if it is not queued.
+func (q *AllocationQueue) Position(pool types.NamespacedName, jobID string) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, waiter := range q.pools[pool] {
+		if waiter.jobID == jobID {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// Notify wakes the waiters of a pool's queue, e.g. when a worker became free.
+func (q *AllocationQueue) Notify(pool types.NamespacedName) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	signalAll(q.pools[pool])
+}
+
+// Turn is signaled when a worker the ticket can use may be free.
+func (t *QueueTicket) Turn() <-chan struct{} {
+	return t.turn
+}
+
+// Position returns the 1-based position of the ticket, or 0 once it has left.
+func (t *QueueTicket) Position() int {
+	t.queue.mu.Lock()
+	defer t.queue.mu.Unlock()
+	for i, waiter := range t.queue.pools[t.pool] {
+		if waiter == t {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// Ahead returns the requirements of the waiters ahead of the ticket. Waiters
+// creating a worker of their own are left out, so they do not hold up the
+// waiters behind them.
+func (t *QueueTicket) Ahead() []workerRequirements {
+	t.queue.mu.Lock()
+	defer t.queue.mu.Unlock()
+	var ahead []workerRequirements
+	for _, waiter := range t.queue.pools[t.pool] {
+		if waiter == t {
+			break
+		}
+		if !waiter.provisioning {
+			ahead = append(ahead, waiter.requirements)
+		}
+	}
+	return ahead
+}
+
+// SetProvisioning records whether the ticket is creating a worker of its own.
+// The ticket keeps its place until it leaves, but the waiters behind it stop
+// yielding to it while it provisions.
+func (t *QueueTicket) SetProvisioning(provisioning bool) {
+	q := t.queue
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if t.left || t.provisioning == provisioning {
+		return
+	}
+	t.provisioning = provisioning
+	if !provisioning {
+		return
+	}
+	waiters := q.pools[t.pool]
+	for i, waiter := range waiters {
+		if waiter == t {
+			// Waiters behind it may now be able to take a worker right away
+			signalAll(waiters[i+1:])
+			break
+		}
+	}
+}
+
+// Waited returns how long the ticket has been queued.
+func (t *QueueTicket) Waited() time.Duration {
+	return time.Since(t.enqueuedAt)
+}
+
+// Leave removes the ticket from the queue and records its wait time with the
+// given result. Leaving more than once is a no-op.
+func (t *QueueTicket) Leave(result string) {
+	q := t.queue
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if t.left {
+		return
+	}
+	t.left = true
+
+	waiters := q.pools[t.pool]
+	for i, waiter := range waiters {
+		if waiter != t {
+			continue
+		}
+		waiters = append(waiters[:i], waiters[i+1:]...)
+		// Waiters behind it may now be able to take a worker right away
+		signalAll(waiters[i:])
+		break
+	}
+	if len(waiters) == 0 {
+		delete(q.pools, t.pool)
+	} else {
+		q.pools[t.pool] = waiters
+	}
+
+	metrics.AllocationQueueDepth.WithLabelValues(t.pool.Name, t.pool.Namespace).Set(float64(len(waiters)))
+	metrics.AllocationQueueWait.WithLabelValues(t.pool.Name, t.pool.Namespace, result).Observe(time.Since(t.enqueuedAt).Seconds())
+}
+
+// signalAll wakes every waiter.
+func signalAll(waiters []*QueueTicket) {
+	for _, waiter := range waiters {
+		waiter.signal()
+	}
+}
+
+func (t *QueueTicket) signal() {
+	select {
+	case t.turn <- struct{}{}:
+	default:
+	}
+}
+
+// QueueStatusResponse represents the state of a pool's allocation queue.
+type QueueStatusResponse struct {
+	PoolName  string `json:"poolName"`
+	Namespace string `json:"namespace"`
+	Depth     int    `json:"depth"`
+	// Position is the 1-based position of the requested job, or 0 if it is not queued.
+	Position int `json:"position,omitempty"`
+}
+
+// QueueTimeoutResponse is returned when an allocation times out in the queue.
+type QueueTimeoutResponse struct {
+	Error         string `json:"error"`
+	QueuePosition int    `json:"queuePosition"`
+	QueueDepth    int    `json:"queueDepth"`
+	Waited        string `json:"waited"`
+}
+
+// handlePoolSubresource routes requests for /api/v1/pools/{name}/{subresource}.
+func (s *Server) handlePoolSubresource(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(strings.TrimSuffix(r.URL.Path, "/"), "/queue") {
+		s.handlePoolQueue(w, r)
+		return
+	}
+	s.handleWakePool(w, r)
+}
+
+// handlePoolQueue reports the depth of a pool's allocation queue and, if a jobId
+// is given, the position of that job in it.
+func (s *Server) handlePoolQueue(w http.ResponseWriter, r *http.Request) {
+	if !s.requireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	principal, ok := s.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	path := strings.TrimPrefix(strings.TrimSuffix(r.URL.Path, "/"), "/api/v1/pools/")
+	poolName := strings.TrimSuffix(path, "/queue")
+	if poolName == "" {
+		http.Error(w, "Pool name required", http.StatusBadRequest)
+		return
+	}
+
+	namespace := resolveNamespace(r.URL.Query().Get("namespace"))
+
+	pool, err := s.getPool(r.Context(), types.NamespacedName{Name: poolName, Namespace: namespace})
+	if err != nil {
+		s.errorResponse(w, http.StatusNotFound, "Pool not found", err)
+		return
+	}
+
+	if !s.authorized(w, r, principal, ActionAllocate, poolAudit(pool), s.authorizer.AuthorizePool(principal, ActionAllocate, pool)) {
+		return
+	}
+
+	key := types.NamespacedName{Name: poolName, Namespace: namespace}
+	response := QueueStatusResponse{
+		PoolName:  poolName,
+		Namespace: namespace,
+		Depth:     s.queue.Len(key),
+	}
+	if jobID := r.URL.Query().Get("jobId"); jobID != "" {
+		response.Position = s.queue.Position(key, jobID)
+	}
+
+	s.encodeJSON(w, response)
+}
+
+// queueTimeoutResponse writes a 503 for an allocation that timed out in the queue.
+func (s *Server) queueTimeoutResponse(w http.ResponseWriter, err *QueueTimeoutError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", strconv.Itoa(int(queueRecheckInterval.Seconds())))
+	w.WriteHeader(http.StatusServiceUnavailable)
+	s.encodeJSON(w, QueueTimeoutResponse{
+		Error:         err.Error(),
+		QueuePosition: err.Position,
+		QueueDepth:    err.Depth,
+		Waited:        err.Waited.Round(time.Second).String(),
+	})
+}
+
+// watchWorkers wakes queued allocations when a worker of their pool becomes
+// claimable or is deleted. Without a cache, queues fall back to periodic rechecks.
+func (s *Server) watchWorkers(ctx context.Context) error {
+	if s.cache == nil {
+		return nil
+	}
+
+	informer, err := s.cache.GetInformer(ctx, &buildkitv1alpha1.BuildKitWorker{})
+	if err != nil {
+		return fmt.Errorf("failed to get worker informer: %w", err)
+	}
+
+	notify := func(obj interface{}, freed bool) {
+		if tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		worker, ok := obj.(*buildkitv1alpha1.BuildKitWorker)
+		if !ok || (!freed && !isClaimable(worker)) {
+			return
+		}
+		s.queue.Notify(types.NamespacedName{Name: worker.Spec.PoolRef.Name, Namespace: worker.Namespace})
+	}
+
+	if _, err := informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(_, newObj interface{}) { notify(newObj, false) },
+		DeleteFunc: func(obj interface{}) { notify(obj, true) },
+	}); err != nil {
+		return fmt.Errorf("failed to watch workers: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,473 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	buildkitv1alpha1 "github.com/smrt-devops/buildkit-controller/api/v1alpha1"
+	"github.com/smrt-devops/buildkit-controller/internal/auth"
+	"github.com/smrt-devops/buildkit-controller/internal/gateway"
+)
+
+const (
+	// quotaWindow is the window MaxPerHour is counted over.
+	quotaWindow = time.Hour
+
+	// quotaStatusInterval is how often quota usage is written to the pool status.
+	quotaStatusInterval = 30 * time.Second
+
+	// quotaRetryAfter is the Retry-After for concurrency quotas when no active
+	// allocation has a known expiry, e.g. while other allocations are in progress.
+	quotaRetryAfter = 30 * time.Second
+)
+
+// QuotaExceededError is returned when an allocation would exceed a pool quota.
+type QuotaExceededError struct {
+	Quota   string
+	Subject string
+	// Limit describes the limit that was reached, e.g. "5 concurrent allocations".
+	Limit string
+	// RetryAfter is when the quota is expected to allow another allocation.
+	RetryAfter time.Duration
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("quota %s exceeded for %s: limit of %s reached", e.Quota, e.Subject, e.Limit)
+}
+
+// QuotaExceededResponse is returned with 429 Too Many Requests when an allocation
+// would exceed a pool quota.
+type QuotaExceededResponse struct {
+	Error      string `json:"error"`
+	Quota      string `json:"quota"`
+	Subject    string `json:"subject"`
+	RetryAfter string `json:"retryAfter"`
+}
+
+// appliedQuota is a pool quota that matches a caller, together with the subject
+// the caller's usage is counted for.
+type appliedQuota struct {
+	quota   *buildkitv1alpha1.AllocationQuota
+	subject string
+}
+
+// matchQuotas returns the pool's quotas that apply to the principal.
+func matchQuotas(pool *buildkitv1alpha1.BuildKitPool, principal *auth.Principal) []appliedQuota {
+	rbac := NewRBACChecker()
+
+	var applied []appliedQuota
+	for i := range pool.Spec.Quotas {
+		quota := &pool.Spec.Quotas[i]
+		if len(quota.Users) > 0 && !rbac.MatchesAny(principal.Identity, quota.Users) {
+			continue
+		}
+		if len(quota.Namespaces) > 0 && (principal.Namespace == "" || !rbac.MatchesAny(principal.Namespace, quota.Namespaces)) {
+			continue
+		}
+		if !matchesClaims(rbac, principal, quota.Claims) {
+			continue
+		}
+
+		subject, ok := quotaSubject(quota, principal)
+		if !ok {
+			continue
+		}
+		applied = append(applied, appliedQuota{quota: quota, subject: subject})
+	}
+	return applied
+}
+
+// matchesClaims reports whether the principal's claims match every claim pattern.
+func matchesClaims(rbac *RBACChecker, principal *auth.Principal, patterns map[string]string) bool {
+	for claim, pattern := range patterns {
+		value, ok := claimValue(principal, claim)
+		if !ok || !rbac.MatchesAny(value, []string{pattern}) {
+			return false
+		}
+	}
+	return true
+}
+
+// quotaSubject returns what the principal's usage of a quota is counted for.
+// Callers without a namespace or the claim are not subject to the quota.
+func quotaSubject(quota *buildkitv1alpha1.AllocationQuota, principal *auth.Principal) (string, bool) {
+	switch quota.Scope {
+	case buildkitv1alpha1.QuotaScopeNamespace:
+		return principal.Namespace, principal.Namespace != ""
+	case buildkitv1alpha1.QuotaScopeClaim:
+		return claimValue(principal, quota.Claim)
+	default:
+		return principal.Identity, true
+	}
+}
+
+// claimValue returns a scalar claim of the principal as a string.
+func claimValue(principal *auth.Principal, claim string) (string, bool) {
+	if claim == "" {
+		return "", false
+	}
+	switch value := principal.Claims[claim].(type) {
+	case string:
+		return value, value != ""
+	case bool, float64:
+		return fmt.Sprint(value), true
+	default:
+		return "", false
+	}
+}
+
+// limitTTL shortens an allocation's lease and renewal limit to the quotas' maxTTL.
+func limitTTL(applied []appliedQuota, claim *workerClaim) {
+	for _, a := range applied {
+		maxTTL, err := time.ParseDuration(a.quota.MaxTTL)
+		if err != nil || maxTTL <= 0 {
+			continue
+		}
+		if claim.maxTTL == 0 || claim.maxTTL > maxTTL {
+			claim.maxTTL = maxTTL
+		}
+		if claim.ttl > maxTTL {
+			claim.ttl = maxTTL
+		}
+	}
+}
+
+// quotaKey identifies the usage of a quota by one subject.
+type quotaKey struct {
+	pool    types.NamespacedName
+	quota   string
+	subject string
+}
+
+// quotaTracker counts allocations against pool quotas. Active allocations are
+// counted from the allocation tokens, which are persisted on the workers; the
+// allocations of the last hour are persisted in the pool status and restored
+// from it on start.
+type quotaTracker struct {
+	mu sync.Mutex
+	// reserved counts allocations that passed the quota check and are in progress.
+	reserved map[quotaKey]int
+	// history holds the times of recent allocations, oldest first.
+	history map[quotaKey][]time.Time
+	// recorded is signaled when an allocation is added to the history.
+	recorded chan struct{}
+}
+
+func newQuotaTracker() *quotaTracker {
+	return &quotaTracker{
+		reserved: make(map[quotaKey]int),
+		history:  make(map[quotaKey][]time.Time),
+		recorded: make(chan struct{}, 1),
+	}
+}
+
+// restore seeds the history of a pool's quotas from the allocation times in
+// its status, so maxPerHour holds across restarts and leader changes.
+func (t *quotaTracker) restore(pool *buildkitv1alpha1.BuildKitPool) {
+	poolKey := types.NamespacedName{Name: pool.Name, Namespace: pool.Namespace}
+	cutoff := time.Now().Add(-quotaWindow)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, usage := range pool.Status.Quotas {
+		key := quotaKey{pool: poolKey, quota: usage.Name, subject: usage.Subject}
+		if _, tracked := t.history[key]; tracked {
+			continue
+		}
+		var recent []time.Time
+		for _, allocated := range usage.RecentAllocations {
+			if allocated.After(cutoff) {
+				recent = append(recent, allocated.Time)
+			}
+		}
+		if len(recent) > 0 {
+			sort.Slice(recent, func(i, j int) bool { return recent[i].Before(recent[j]) })
+			t.history[key] = recent
+		}
+	}
+}
+
+// quotaReservation holds an allocation's place in its quotas while it is in progress.
+type quotaReservation struct {
+	tracker  *quotaTracker
+	keys     []quotaKey
+	subjects map[string]string
+	once     sync.Once
+}
+
+// quotaSubjects returns the quota names and subjects the allocation counts against.
+func (r *quotaReservation) quotaSubjects() map[string]string {
+	if r == nil {
+		return nil
+	}
+	return r.subjects
+}
+
+// release ends the reservation. Successful allocations are recorded for the
+// hourly limits; from then on they are counted through their token.
+func (r *quotaReservation) release(allocated bool) {
+	if r == nil {
+		return
+	}
+	r.once.Do(func() {
+		t := r.tracker
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		// The status keeps whole seconds, so the history does too
+		now := time.Now().Truncate(time.Second)
+		for _, key := range r.keys {
+			if t.reserved[key]--; t.reserved[key] <= 0 {
+				delete(t.reserved, key)
+			}
+			if allocated {
+				t.history[key] = append(t.history[key], now)
+			}
+		}
+		if allocated {
+			select {
+			case t.recorded <- struct{}{}:
+			default:
+			}
+		}
+	})
+}
+
+// reserve checks the applied quotas against the pool's active allocation tokens
+// and reserves a place in each of them, or returns a QuotaExceededError.
+func (t *quotaTracker) reserve(pool types.NamespacedName, applied []appliedQuota, tokens []*gateway.TokenData) (*quotaReservation, error) {
+	if len(applied) == 0 {
+		return nil, nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	reservation := &quotaReservation{tracker: t, subjects: make(map[string]string, len(applied))}
+	for _, a := range applied {
+		key := quotaKey{pool: pool, quota: a.quota.Name, subject: a.subject}
+
+		if limit := a.quota.MaxConcurrent; limit != nil {
+			active, nextExpiry := activeAllocations(key, tokens, now)
+			if active+t.reserved[key] >= int(*limit) {
+				retryAfter := quotaRetryAfter
+				if !nextExpiry.IsZero() {
+					retryAfter = nextExpiry.Sub(now)
+				}
+				return nil, &QuotaExceededError{
+					Quota:      key.quota,
+					Subject:    key.subject,
+					Limit:      fmt.Sprintf("%d concurrent allocations", *limit),
+					RetryAfter: retryAfter,
+				}
+			}
+		}
+
+		if limit := a.quota.MaxPerHour; limit != nil {
+			recent := t.prune(key, now)
+			if len(recent)+t.reserved[key] >= int(*limit) {
+				retryAfter := quotaRetryAfter
+				if len(recent) > 0 {
+					retryAfter = recent[0].Add(quotaWindow).Sub(now)
+				}
+				return nil, &QuotaExceededError{
+					Quota:      key.quota,
+					Subject:    key.subject,
+					Limit:      fmt.Sprintf("%d allocations per hour", *limit),
+					RetryAfter: retryAfter,
+				}
+			}
+		}
+
+		reservation.keys = append(reservation.keys, key)
+		reservation.subjects[key.quota] = key.subject
+	}
+
+	for _, key := range reservation.keys {
+		t.reserved[key]++
+	}
+	return reservation, nil
+}
+
+// prune drops allocations older than the quota window and returns the rest.
+// The caller must hold the lock.
+func (t *quotaTracker) prune(key quotaKey, now time.Time) []time.Time {
+	recent := t.history[key]
+	cutoff := now.Add(-quotaWindow)
+	for len(recent) > 0 && !recent[0].After(cutoff) {
+		recent = recent[1:]
+	}
+	if len(recent) == 0 {
+		delete(t.history, key)
+		return nil
+	}
+	t.history[key] = recent
+	return recent
+}
+
+// usage returns the usage of the pool's quotas by every subject with active or
+// recent allocations, sorted by quota and subject.
+func (t *quotaTracker) usage(pool *buildkitv1alpha1.BuildKitPool, tokens []*gateway.TokenData) []buildkitv1alpha1.QuotaUsage {
+	poolKey := types.NamespacedName{Name: pool.Name, Namespace: pool.Namespace}
+	quotas := make(map[string]bool, len(pool.Spec.Quotas))
+	for i := range pool.Spec.Quotas {
+		quotas[pool.Spec.Quotas[i].Name] = true
+	}
+
+	now := time.Now()
+	counts := make(map[quotaKey]*buildkitv1alpha1.QuotaUsage)
+	entry := func(key quotaKey) *buildkitv1alpha1.QuotaUsage {
+		if counts[key] == nil {
+			counts[key] = &buildkitv1alpha1.QuotaUsage{Name: key.quota, Subject: key.subject}
+		}
+		return counts[key]
+	}
+
+	for _, data := range tokens {
+		if data.PoolName != pool.Name || data.Namespace != pool.Namespace || !now.Before(data.ExpiresAt) {
+			continue
+		}
+		for quota, subject := range data.Quotas {
+			if quotas[quota] {
+				entry(quotaKey{pool: poolKey, quota: quota, subject: subject}).Active++
+			}
+		}
+	}
+
+	t.mu.Lock()
+	for key := range t.history {
+		if key.pool != poolKey || !quotas[key.quota] {
+			continue
+		}
+		if recent := t.prune(key, now); len(recent) > 0 {
+			u := entry(key)
+			u.AllocationsLastHour = int32(len(recent))
+			u.RecentAllocations = make([]metav1.Time, 0, len(recent))
+			for _, allocated := range recent {
+				u.RecentAllocations = append(u.RecentAllocations, metav1.NewTime(allocated))
+			}
+		}
+	}
+	t.mu.Unlock()
+
+	usage := make([]buildkitv1alpha1.QuotaUsage, 0, len(counts))
+	for _, u := range counts {
+		usage = append(usage, *u)
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		if usage[i].Name != usage[j].Name {
+			return usage[i].Name < usage[j].Name
+		}
+		return usage[i].Subject < usage[j].Subject
+	})
+	return usage
+}
+
+// activeAllocations counts the unexpired allocations of a quota subject and
+// returns when the first of them expires.
+func activeAllocations(key quotaKey, tokens []*gateway.TokenData, now time.Time) (int, time.Time) {
+	active := 0
+	var nextExpiry time.Time
+	for _, data := range tokens {
+		if data.PoolName != key.pool.Name || data.Namespace != key.pool.Namespace ||
+			data.Quotas[key.quota] != key.subject || !now.Before(data.ExpiresAt) {
+			continue
+		}
+		active++
+		if nextExpiry.IsZero() || data.ExpiresAt.Before(nextExpiry) {
+			nextExpiry = data.ExpiresAt
+		}
+	}
+	return active, nextExpiry
+}
+
+// quotaExceededResponse writes a 429 response for an exceeded quota.
+func (s *Server) quotaExceededResponse(w http.ResponseWriter, principal *auth.Principal, err *QuotaExceededError) {
+	retryAfter := max(int(math.Ceil(err.RetryAfter.Seconds())), 1)
+
+	s.log.Info("Allocation quota exceeded", "quota", err.Quota, "subject", err.Subject, "identity", principal.Identity, "retryAfter", retryAfter)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	w.WriteHeader(http.StatusTooManyRequests)
+	s.encodeJSON(w, QuotaExceededResponse{
+		Error:      err.Error(),
+		Quota:      err.Quota,
+		Subject:    err.Subject,
+		RetryAfter: (time.Duration(retryAfter) * time.Second).String(),
+	})
+}
+
+// restoreQuotas restores the recent allocations of every pool's quotas from
+// the pool status.
+func (s *Server) restoreQuotas(ctx context.Context) error {
+	pools, err := s.listPools(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list pools: %w", err)
+	}
+	for i := range pools.Items {
+		s.quotas.restore(&pools.Items[i])
+	}
+	return nil
+}
+
+// reportQuotaUsage writes the usage of each pool's quotas to its status
+// periodically and right after allocations, which persists the history
+// maxPerHour is counted from.
+func (s *Server) reportQuotaUsage(ctx context.Context) {
+	ticker := time.NewTicker(quotaStatusInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.quotas.recorded:
+		}
+		if err := s.updateQuotaStatus(ctx); err != nil {
+			s.log.V(1).Info("Failed to update quota usage", "error", err)
+		}
+	}
+}
+
+// updateQuotaStatus patches status.quotas of pools whose quota usage changed.
+// The pool reconciler never writes this field, so a merge patch is enough.
+func (s *Server) updateQuotaStatus(ctx context.Context) error {
+	pools, err := s.listPools(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list pools: %w", err)
+	}
+
+	tokens := s.tokenManager.ListTokens()
+	for i := range pools.Items {
+		pool := &pools.Items[i]
+		if len(pool.Spec.Quotas) == 0 && len(pool.Status.Quotas) == 0 {
+			continue
+		}
+
+		usage := s.quotas.usage(pool, tokens)
+		if equality.Semantic.DeepEqual(usage, pool.Status.Quotas) ||
+			(len(usage) == 0 && len(pool.Status.Quotas) == 0) {
+			continue
+		}
+
+		patch := client.MergeFrom(pool.DeepCopy())
+		pool.Status.Quotas = usage
+		if err := s.client.Status().Patch(ctx, pool, patch); err != nil {
+			s.log.V(1).Info("Failed to patch quota usage", "pool", pool.Name, "namespace", pool.Namespace, "error", err)
+		}
+	}
+	return nil
+}
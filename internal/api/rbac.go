@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	buildkitv1alpha1 "github.com/smrt-devops/buildkit-controller/api/v1alpha1"
+	"github.com/smrt-devops/buildkit-controller/internal/auth"
 )
 
 // RBACChecker checks if a user has access to pools based on RBAC rules.
@@ -15,36 +16,99 @@ func NewRBACChecker() *RBACChecker {
 	return &RBACChecker{}
 }
 
-// CheckPoolAccess checks if the given identity has access to the specified pools.
+// CheckPoolAccess checks if the given principal has access to the specified pools.
 // It checks against the pool's RBAC configuration.
-func (c *RBACChecker) CheckPoolAccess(identity string, poolNames []string, pools map[string]*buildkitv1alpha1.BuildKitPool) error {
+func (c *RBACChecker) CheckPoolAccess(principal *auth.Principal, poolNames []string, pools map[string]*buildkitv1alpha1.BuildKitPool) error {
 	for _, poolName := range poolNames {
 		pool, exists := pools[poolName]
 		if !exists {
 			return fmt.Errorf("pool %s not found", poolName)
 		}
 
-		// Check if RBAC is enabled for this pool
-		if pool.Spec.Auth.RBAC == nil || !pool.Spec.Auth.RBAC.Enabled {
-			// RBAC not enabled, allow access
-			continue
+		if err := c.checkAccess(principal, poolName, pool); err != nil {
+			return err
 		}
+	}
 
-		// Check RBAC rules
-		hasAccess := false
-		for _, rule := range pool.Spec.Auth.RBAC.Rules {
-			if c.matchesUser(identity, rule.Users) && c.matchesPool(poolName, rule.Pools) {
-				hasAccess = true
-				break
-			}
+	return nil
+}
+
+// CheckAccess checks if the given principal has access to a single pool.
+func (c *RBACChecker) CheckAccess(principal *auth.Principal, pool *buildkitv1alpha1.BuildKitPool) error {
+	return c.checkAccess(principal, pool.Name, pool)
+}
+
+// checkAccess grants access if RBAC is disabled for the pool, or if a rule matches
+// the principal's identity or groups and either matches the pool itself or the
+// pool is granted by the pools claim of an OIDC issuer the pool trusts.
+func (c *RBACChecker) checkAccess(principal *auth.Principal, poolName string, pool *buildkitv1alpha1.BuildKitPool) error {
+	// Check if RBAC is enabled for this pool
+	if pool.Spec.Auth.RBAC == nil || !pool.Spec.Auth.RBAC.Enabled {
+		// RBAC not enabled, allow access
+		return nil
+	}
+
+	// Pools granted by a trusted identity provider stand in for the rules' pools
+	claimed := c.claimsPool(principal, poolName, pool)
+
+	// Check RBAC rules
+	for _, rule := range pool.Spec.Auth.RBAC.Rules {
+		if !claimed && !c.matchesPool(poolName, rule.Pools) {
+			continue
+		}
+		if c.matchesUser(principal.Identity, rule.Users) || c.matchesGroups(principal.Groups, rule.Groups) {
+			return nil
 		}
+	}
+
+	return fmt.Errorf("access denied: user %s does not have access to pool %s", principal.Identity, poolName)
+}
+
+// claimsPool checks if the principal's pools claim covers the pool, either by
+// name or by namespace/name. Only claims of OIDC tokens from an issuer the pool
+// trusts are honored.
+func (c *RBACChecker) claimsPool(principal *auth.Principal, poolName string, pool *buildkitv1alpha1.BuildKitPool) bool {
+	if len(principal.Pools) == 0 || !c.trustsIssuer(principal, pool) {
+		return false
+	}
+	return c.matchesPool(poolName, principal.Pools) ||
+		c.matchesPool(pool.Namespace+"/"+pool.Name, principal.Pools)
+}
 
-		if !hasAccess {
-			return fmt.Errorf("access denied: user %s does not have access to pool %s", identity, poolName)
+// trustsIssuer checks if an OIDC principal was verified with the pool's own OIDC
+// settings or with a BuildKitOIDCConfig the pool references.
+func (c *RBACChecker) trustsIssuer(principal *auth.Principal, pool *buildkitv1alpha1.BuildKitPool) bool {
+	if principal.Method != auth.MethodOIDC {
+		return false
+	}
+	for _, method := range pool.Spec.Auth.Methods {
+		if method.Type != buildkitv1alpha1.AuthMethodOIDC {
+			continue
+		}
+		if oidc := method.OIDC; oidc != nil && oidc.Issuer == principal.Issuer && oidc.Audience == principal.Audience {
+			return true
+		}
+		if ref := method.OIDCConfigRef; ref != nil && principal.OIDCConfig != "" {
+			namespace := ref.Namespace
+			if namespace == "" {
+				namespace = pool.Namespace
+			}
+			if principal.OIDCConfig == namespace+"/"+ref.Name {
+				return true
+			}
 		}
 	}
+	return false
+}
 
-	return nil
+// MatchesAny reports whether the identity matches any of the patterns.
+func (c *RBACChecker) MatchesAny(identity string, patterns []string) bool {
+	return c.matchesUser(identity, patterns)
+}
+
+// MatchesAnyGroup reports whether any of the groups matches any of the patterns.
+func (c *RBACChecker) MatchesAnyGroup(groups, patterns []string) bool {
+	return c.matchesGroups(groups, patterns)
 }
 
 // matchesUser checks if the identity matches any of the user patterns.
@@ -57,6 +121,16 @@ func (c *RBACChecker) matchesUser(identity string, patterns []string) bool {
 	return false
 }
 
+// matchesGroups checks if any of the groups matches any of the group patterns.
+func (c *RBACChecker) matchesGroups(groups, patterns []string) bool {
+	for _, group := range groups {
+		if c.matchesUser(group, patterns) {
+			return true
+		}
+	}
+	return false
+}
+
 // matchesPool checks if the pool name matches any of the pool patterns.
 func (c *RBACChecker) matchesPool(poolName string, patterns []string) bool {
 	for _, pattern := range patterns {
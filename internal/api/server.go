@@ -7,6 +7,9 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"os"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -14,18 +17,33 @@ import (
 	"github.com/google/uuid"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	buildkitv1alpha1 "github.com/smrt-devops/buildkit-controller/api/v1alpha1"
 	"github.com/smrt-devops/buildkit-controller/internal/auth"
 	"github.com/smrt-devops/buildkit-controller/internal/certs"
 	"github.com/smrt-devops/buildkit-controller/internal/gateway"
+	"github.com/smrt-devops/buildkit-controller/internal/metrics"
+	"github.com/smrt-devops/buildkit-controller/internal/resources"
 	"github.com/smrt-devops/buildkit-controller/internal/utils"
+	"github.com/smrt-devops/buildkit-controller/internal/webhooks"
 )
 
+// maxClaimAttempts bounds how often worker allocation retries after losing races.
+const maxClaimAttempts = 5
+
+// oidcVerifierKey identifies an OIDC verifier. Configs sharing an issuer but
+// differing in audience or claims mapping get verifiers of their own.
+type oidcVerifierKey struct {
+	issuer        string
+	audience      string
+	claimsMapping buildkitv1alpha1.ClaimsMapping
+}
+
 // oidcVerifierEntry tracks an OIDC verifier and its last usage time.
 type oidcVerifierEntry struct {
 	verifier *auth.OIDCVerifier
@@ -40,12 +58,32 @@ type Server struct {
 	log             utils.Logger
 	port            int
 	oidcVerifiersMu sync.RWMutex
-	oidcVerifiers   map[string]*oidcVerifierEntry // keyed by issuer
+	oidcVerifiers   map[oidcVerifierKey]*oidcVerifierEntry
 	certConfig      *certs.Config
-	rbacChecker     *RBACChecker
+	authorizer      *Authorizer
+	adminIdentities []string
+	adminGroups     []string
+	adminOIDCNs     string // Namespace of the BuildKitOIDCConfigs admins may be verified with
 	saTokenVerifier *auth.ServiceAccountTokenVerifier
+	staticTokens    *auth.StaticTokenVerifier
+	saAudiences     []string
+	gatewayVerifier *auth.ServiceAccountTokenVerifier
 	tokenManager    *gateway.TokenManager
-	devMode         bool // If true, skip authentication (for local development only)
+	tokenStore      gateway.TokenStore
+	revocations     gateway.RevocationStore
+	signingKeyRef   types.NamespacedName // Secret holding the token signing key
+	devMode         bool                 // If true, skip authentication (for local development only)
+	queue           *AllocationQueue
+	queueTimeout    time.Duration
+	cache           cache.Cache
+	allocations     *allocationTracker
+	quotas          *quotaTracker
+	auditSinks      []AuditSink
+	audit           *auditor
+	webhooks        *webhooks.Dispatcher
+	baseCtx         context.Context
+	// ready is closed once the server has loaded its tokens and can allocate workers.
+	ready chan struct{}
 }
 
 // ServerOption is a functional option for configuring the Server.
@@ -58,25 +96,116 @@ func WithDevMode(enabled bool) ServerOption {
 	}
 }
 
+// WithTokenStore overrides the store used to persist allocation tokens.
+// By default tokens are persisted on BuildKitWorker.Spec.Allocation.
+func WithTokenStore(store gateway.TokenStore) ServerOption {
+	return func(s *Server) {
+		s.tokenStore = store
+	}
+}
+
+// WithRevocationStore overrides the store used to persist the token deny list.
+// By default it is persisted in a ConfigMap next to the signing key secret.
+func WithRevocationStore(store gateway.RevocationStore) ServerOption {
+	return func(s *Server) {
+		s.revocations = store
+	}
+}
+
+// WithSigningKeySecret sets the secret the allocation token signing key is loaded from.
+func WithSigningKeySecret(name, namespace string) ServerOption {
+	return func(s *Server) {
+		s.signingKeyRef = types.NamespacedName{Name: name, Namespace: namespace}
+	}
+}
+
+// WithAllocationQueueTimeout sets how long a worker allocation waits in the pool's
+// queue when the pool is at capacity.
+func WithAllocationQueueTimeout(timeout time.Duration) ServerOption {
+	return func(s *Server) {
+		s.queueTimeout = timeout
+	}
+}
+
+// WithCache sets the informer cache used to watch workers, so queued allocations
+// are woken as soon as a worker becomes free.
+func WithCache(c cache.Cache) ServerOption {
+	return func(s *Server) {
+		s.cache = c
+	}
+}
+
+// WithAdminIdentities sets the identity patterns that may access every pool and
+// release any allocation.
+func WithAdminIdentities(identities []string) ServerOption {
+	return func(s *Server) {
+		s.adminIdentities = identities
+	}
+}
+
+// WithAdminGroups sets the group patterns whose members are admins and may use
+// the admin API.
+func WithAdminGroups(groups []string) ServerOption {
+	return func(s *Server) {
+		s.adminGroups = groups
+	}
+}
+
+// WithAdminOIDCNamespace sets the namespace of the BuildKitOIDCConfigs whose
+// principals admin patterns apply to. It defaults to POD_NAMESPACE, like the
+// token signing key. Configs in
+// other namespaces and OIDC settings of pools never make an admin.
+func WithAdminOIDCNamespace(namespace string) ServerOption {
+	return func(s *Server) {
+		s.adminOIDCNs = namespace
+	}
+}
+
+// WithAuditSinks adds sinks that receive the audit log of authentication and
+// authorization decisions and of issued certificates and allocations.
+func WithAuditSinks(sinks ...AuditSink) ServerOption {
+	return func(s *Server) {
+		s.auditSinks = append(s.auditSinks, sinks...)
+	}
+}
+
+// WithWebhooks sets the dispatcher that sends allocation and release events to
+// webhooks.
+func WithWebhooks(dispatcher *webhooks.Dispatcher) ServerOption {
+	return func(s *Server) {
+		s.webhooks = dispatcher
+	}
+}
+
+// WithServiceAccountAudiences sets the audiences ServiceAccount tokens must be bound to.
+func WithServiceAccountAudiences(audiences []string) ServerOption {
+	return func(s *Server) {
+		s.saAudiences = audiences
+	}
+}
+
+//+kubebuilder:rbac:groups=authentication.k8s.io,resources=tokenreviews,verbs=create
+
 // NewServer creates a new API server.
 func NewServer(k8sClient client.Client, certManager *certs.CertificateManager, caManager *certs.CAManager, log utils.Logger, port int, certConfig *certs.Config, opts ...ServerOption) *Server {
 	if certConfig == nil {
 		certConfig = certs.LoadConfig()
 	}
 	s := &Server{
-		client:          k8sClient,
-		certManager:     certManager,
-		caManager:       caManager,
-		log:             log,
-		port:            port,
-		oidcVerifiers:   make(map[string]*oidcVerifierEntry),
-		certConfig:      certConfig,
-		rbacChecker:     NewRBACChecker(),
-		saTokenVerifier: auth.NewServiceAccountTokenVerifier(k8sClient, log),
-		tokenManager: gateway.NewTokenManager(gateway.TokenManagerConfig{
-			DefaultTTL: 1 * time.Hour,
-			MaxTTL:     24 * time.Hour,
-		}),
+		client:        k8sClient,
+		certManager:   certManager,
+		caManager:     caManager,
+		log:           log,
+		port:          port,
+		oidcVerifiers: make(map[oidcVerifierKey]*oidcVerifierEntry),
+		certConfig:    certConfig,
+		tokenStore:    gateway.NewWorkerTokenStore(k8sClient),
+		queue:         NewAllocationQueue(),
+		queueTimeout:  DefaultAllocationQueueTimeout,
+		allocations:   newAllocationTracker(),
+		quotas:        newQuotaTracker(),
+		baseCtx:       context.Background(),
+		ready:         make(chan struct{}),
 	}
 
 	// Apply options
@@ -84,6 +213,25 @@ func NewServer(k8sClient client.Client, certManager *certs.CertificateManager, c
 		opt(s)
 	}
 
+	if s.adminOIDCNs == "" {
+		s.adminOIDCNs = os.Getenv("POD_NAMESPACE")
+	}
+	if s.adminOIDCNs == "" {
+		s.adminOIDCNs = gateway.DefaultSigningKeyNamespace
+	}
+	s.authorizer = NewAuthorizer(s.adminIdentities, s.adminGroups, s.adminOIDCNs)
+	s.audit = &auditor{sinks: s.auditSinks, log: log}
+	if slices.Contains(s.saAudiences, resources.GatewayControllerTokenAudience) {
+		log.Info("WARNING: ignoring the gateway audience in the ServiceAccount token audiences", "audience", resources.GatewayControllerTokenAudience)
+	}
+	// Gateway tokens are never client tokens, even if the gateway audience is configured
+	s.saTokenVerifier = auth.NewServiceAccountTokenVerifier(k8sClient, log, s.saAudiences,
+		[]string{resources.GatewayControllerTokenAudience})
+	s.staticTokens = auth.NewStaticTokenVerifier(k8sClient, log)
+	// Gateways use an audience of their own, and client tokens are never gateway tokens
+	s.gatewayVerifier = auth.NewServiceAccountTokenVerifier(k8sClient, log, []string{resources.GatewayControllerTokenAudience},
+		clientAudiences(s.saAudiences))
+
 	if s.devMode {
 		log.Info("WARNING: Dev mode enabled - authentication is disabled!")
 	}
@@ -99,14 +247,16 @@ func (s *Server) requireMethod(w http.ResponseWriter, r *http.Request, method st
 	return true
 }
 
-func (s *Server) authenticate(w http.ResponseWriter, r *http.Request) (string, bool) {
-	identity, err := s.authenticateRequest(r)
+func (s *Server) authenticate(w http.ResponseWriter, r *http.Request) (*auth.Principal, bool) {
+	principal, err := s.authenticateRequest(r)
 	if err != nil {
+		s.audit.record(r, nil, AuditRecord{Event: AuditAuthentication, Decision: AuditDeny, Reason: err.Error()})
 		s.log.Error(err, "Authentication failed")
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return "", false
+		return nil, false
 	}
-	return identity, true
+	s.audit.record(r, principal, AuditRecord{Event: AuditAuthentication, Decision: AuditAllow})
+	return principal, true
 }
 
 func (s *Server) decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
@@ -153,33 +303,100 @@ func buildPoolMap(poolList *buildkitv1alpha1.BuildKitPoolList) map[string]*build
 	return poolMap
 }
 
+// initTokens loads the shared signing key and restores the deny list and persisted
+// allocation tokens, so allocations made before a restart or by a previous leader
+// keep working and revoked ones stay denied.
+func (s *Server) initTokens(ctx context.Context) error {
+	key, err := gateway.EnsureSigningKey(ctx, s.client, s.signingKeyRef.Name, s.signingKeyRef.Namespace)
+	if err != nil {
+		return fmt.Errorf("failed to load token signing key: %w", err)
+	}
+
+	if s.revocations == nil {
+		s.revocations = gateway.NewConfigMapRevocationStore(s.client, "", s.signingKeyRef.Namespace)
+	}
+	s.tokenManager, err = gateway.NewTokenManager(gateway.TokenManagerConfig{
+		SigningKey:  key,
+		DefaultTTL:  1 * time.Hour,
+		MaxTTL:      24 * time.Hour,
+		Store:       s.tokenStore,
+		Revocations: s.revocations,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create token manager: %w", err)
+	}
+
+	restored, err := s.tokenManager.Restore(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to restore allocation tokens: %w", err)
+	}
+	s.log.Info("Restored allocation tokens", "count", restored)
+	return nil
+}
+
 // Start starts the HTTP server.
 func (s *Server) Start(ctx context.Context) error {
+	// Asynchronous allocations outlive their request and stop with the server
+	s.baseCtx = ctx
+
+	if err := s.initTokens(ctx); err != nil {
+		return err
+	}
+	if err := s.restoreQuotas(ctx); err != nil {
+		return fmt.Errorf("failed to restore quota usage: %w", err)
+	}
+
+	if err := s.watchWorkers(ctx); err != nil {
+		return err
+	}
+	close(s.ready)
+
 	mux := http.NewServeMux()
 
 	// Certificate request endpoint (OIDC/ServiceAccount token)
-	mux.HandleFunc("/api/v1/certs/request", s.handleCertRequest)
+	mux.HandleFunc("/api/v1/certs/request", instrument("/api/v1/certs/request", s.handleCertRequest))
 
 	// List available pools
-	mux.HandleFunc("/api/v1/pools", s.handleListPools)
+	mux.HandleFunc("/api/v1/pools", instrument("/api/v1/pools", s.handleListPools))
 
-	// Wake up a pool (ensure it's ready) - handles /api/v1/pools/{name}/wake
-	mux.HandleFunc("/api/v1/pools/", s.handleWakePool)
+	// Pool subresources - handles /api/v1/pools/{name}/wake and /api/v1/pools/{name}/queue
+	mux.HandleFunc("/api/v1/pools/", instrument("/api/v1/pools/{name}/{action}", s.handlePoolSubresource))
 
 	// Allocate a pool (with optional cert issuance)
-	mux.HandleFunc("/api/v1/allocate", s.handleAllocate)
+	mux.HandleFunc("/api/v1/allocate", instrument("/api/v1/allocate", s.handleAllocate))
 
 	// Worker allocation (new architecture - allocate a specific worker)
-	mux.HandleFunc("/api/v1/workers/allocate", s.handleWorkerAllocate)
+	mux.HandleFunc("/api/v1/workers/allocate", instrument("/api/v1/workers/allocate", s.handleWorkerAllocate))
+
+	// Asynchronous allocation status - handles /api/v1/allocations/{id}
+	mux.HandleFunc("/api/v1/allocations/", instrument("/api/v1/allocations/{id}", s.handleAllocationStatus))
 
 	// Worker lookup by token (for gateway)
-	mux.HandleFunc("/api/v1/workers/lookup", s.handleWorkerLookup)
+	mux.HandleFunc("/api/v1/workers/lookup", instrument("/api/v1/workers/lookup", s.handleWorkerLookup))
 
 	// Release a worker
-	mux.HandleFunc("/api/v1/workers/release", s.handleWorkerRelease)
+	mux.HandleFunc("/api/v1/workers/release", instrument("/api/v1/workers/release", s.handleWorkerRelease))
+
+	// Renew a worker allocation (heartbeat)
+	mux.HandleFunc("/api/v1/workers/renew", instrument("/api/v1/workers/renew", s.handleWorkerRenew))
+
+	// Admin allocation API - handles /api/v1/admin/allocations and /api/v1/admin/allocations/{id}
+	mux.HandleFunc("/api/v1/admin/allocations", instrument("/api/v1/admin/allocations", s.handleAdminAllocations))
+	mux.HandleFunc("/api/v1/admin/allocations/", instrument("/api/v1/admin/allocations/{id}", s.handleAdminAllocations))
+
+	// Admin certificate API - handles /api/v1/admin/certificates and /api/v1/admin/certificates/{serial}
+	mux.HandleFunc("/api/v1/admin/certificates", instrument("/api/v1/admin/certificates", s.handleAdminCertificates))
+	mux.HandleFunc("/api/v1/admin/certificates/", instrument("/api/v1/admin/certificates/{serial}", s.handleAdminCertificates))
+
+	// Client certificate revocation list
+	mux.HandleFunc("/api/v1/crl", instrument("/api/v1/crl", s.handleCRL))
+
+	// Token verification keys and deny list (for gateways)
+	mux.HandleFunc("/api/v1/tokens/jwks", instrument("/api/v1/tokens/jwks", s.handleTokenKeys))
+	mux.HandleFunc("/api/v1/tokens/revoked", instrument("/api/v1/tokens/revoked", s.handleRevokedTokens))
 
 	// Health check
-	mux.HandleFunc("/api/v1/health", s.handleHealth)
+	mux.HandleFunc("/api/v1/health", instrument("/api/v1/health", s.handleHealth))
 
 	server := &http.Server{
 		Addr:         fmt.Sprintf(":%d", s.port),
@@ -194,6 +411,15 @@ func (s *Server) Start(ctx context.Context) error {
 	// Start cleanup goroutine for stale OIDC verifiers
 	go s.cleanupStaleVerifiers(ctx)
 
+	// Start cleanup goroutine for finished asynchronous allocations
+	go s.cleanupAllocations(ctx)
+
+	// Start cleanup goroutine for expired tokens and deny list entries
+	go s.cleanupExpiredTokens(ctx)
+
+	// Start reporting quota usage in pool status
+	go s.reportQuotaUsage(ctx)
+
 	go func() {
 		<-ctx.Done()
 		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -201,6 +427,7 @@ func (s *Server) Start(ctx context.Context) error {
 		if err := server.Shutdown(shutdownCtx); err != nil {
 			s.log.Error(err, "Failed to shutdown server gracefully")
 		}
+		s.audit.close()
 	}()
 
 	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
@@ -222,6 +449,8 @@ type CertResponse struct {
 	ClientCert string            `json:"clientCert"`
 	ClientKey  string            `json:"clientKey"`
 	Endpoints  map[string]string `json:"endpoints"`
+	// SerialNumber identifies the certificate for revocation.
+	SerialNumber string `json:"serialNumber"`
 }
 
 // PoolInfo represents pool information.
@@ -258,6 +487,8 @@ type AllocationResponse struct {
 	CACert     string `json:"caCert,omitempty"`
 	ClientCert string `json:"clientCert,omitempty"`
 	ClientKey  string `json:"clientKey,omitempty"`
+	// SerialNumber identifies the client certificate for revocation.
+	SerialNumber string `json:"serialNumber,omitempty"`
 	// Pool information
 	PoolName string `json:"poolName"`
 	Ready    bool   `json:"ready"`
@@ -278,7 +509,7 @@ func (s *Server) handleCertRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	identity, ok := s.authenticate(w, r)
+	principal, ok := s.authenticate(w, r)
 	if !ok {
 		return
 	}
@@ -295,17 +526,15 @@ func (s *Server) handleCertRequest(w http.ResponseWriter, r *http.Request) {
 
 	// Validate pools exist and user has access
 	// Batch fetch pools from all namespaces to reduce API calls
-	poolList := &buildkitv1alpha1.BuildKitPoolList{}
-	if err := s.client.List(r.Context(), poolList); err != nil {
+	poolList, err := s.listPools(r.Context())
+	if err != nil {
 		s.errorResponse(w, http.StatusInternalServerError, "Failed to list pools", err)
 		return
 	}
 
 	poolMap := buildPoolMap(poolList)
 
-	if err := s.rbacChecker.CheckPoolAccess(identity, req.Pools, poolMap); err != nil {
-		s.log.Error(err, "RBAC check failed", "identity", identity, "pools", req.Pools)
-		http.Error(w, err.Error(), http.StatusForbidden)
+	if !s.authorized(w, r, principal, ActionRequestCerts, AuditRecord{Pool: strings.Join(req.Pools, ",")}, s.authorizer.AuthorizePools(principal, ActionRequestCerts, req.Pools, poolMap)) {
 		return
 	}
 
@@ -316,8 +545,8 @@ func (s *Server) handleCertRequest(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	certPEM, keyPEM, _, err := s.certManager.IssueCertificate(r.Context(), &certs.CertificateRequest{
-		CommonName:   identity,
+	certPEM, keyPEM, certInfo, err := s.certManager.IssueCertificate(r.Context(), &certs.CertificateRequest{
+		CommonName:   principal.Identity,
 		Organization: "BuildKit Client",
 		Duration:     duration,
 		IsClient:     true,
@@ -326,6 +555,16 @@ func (s *Server) handleCertRequest(w http.ResponseWriter, r *http.Request) {
 		s.errorResponse(w, http.StatusInternalServerError, "Failed to issue certificate", err)
 		return
 	}
+	if err := s.recordCertificate(r.Context(), principal, req.Pools, certInfo); err != nil {
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to record certificate", err)
+		return
+	}
+	s.audit.record(r, principal, AuditRecord{
+		Event:      AuditCertificateIssued,
+		Decision:   AuditAllow,
+		Pool:       strings.Join(req.Pools, ","),
+		CertSerial: certInfo.SerialNumber,
+	})
 
 	caCertPEM, err := s.caManager.GetCACertPEM(r.Context())
 	if err != nil {
@@ -341,10 +580,11 @@ func (s *Server) handleCertRequest(w http.ResponseWriter, r *http.Request) {
 	}
 
 	response := CertResponse{
-		CACert:     string(caCertPEM),
-		ClientCert: string(certPEM),
-		ClientKey:  string(keyPEM),
-		Endpoints:  endpoints,
+		CACert:       string(caCertPEM),
+		ClientCert:   string(certPEM),
+		ClientKey:    string(keyPEM),
+		Endpoints:    endpoints,
+		SerialNumber: certInfo.SerialNumber,
 	}
 
 	s.encodeJSON(w, response)
@@ -355,19 +595,24 @@ func (s *Server) handleListPools(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if _, ok := s.authenticate(w, r); !ok {
+	principal, ok := s.authenticate(w, r)
+	if !ok {
 		return
 	}
 
-	poolList := &buildkitv1alpha1.BuildKitPoolList{}
-	if err := s.client.List(r.Context(), poolList); err != nil {
+	poolList, err := s.listPools(r.Context())
+	if err != nil {
 		s.errorResponse(w, http.StatusInternalServerError, "Failed to list pools", err)
 		return
 	}
 
+	// Only pools the caller may access are listed
 	pools := make([]PoolInfo, 0, len(poolList.Items))
 	for i := range poolList.Items {
 		pool := &poolList.Items[i]
+		if s.authorizer.AuthorizePool(principal, ActionList, pool) != nil {
+			continue
+		}
 		status := "Unknown"
 		if pool.Status.Phase != "" {
 			status = pool.Status.Phase
@@ -391,41 +636,47 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 // authenticateRequest authenticates the incoming request.
 // Supports:
 // 1. OIDC token (Bearer token)
-// 2. Kubernetes ServiceAccount token.
+// 2. Kubernetes ServiceAccount token
+// 3. Static token from a pool's token secret.
 // In dev mode, authentication is skipped.
-func (s *Server) authenticateRequest(r *http.Request) (string, error) {
+func (s *Server) authenticateRequest(r *http.Request) (*auth.Principal, error) {
 	// In dev mode, skip authentication
 	if s.devMode {
-		return "dev-user", nil
+		return &auth.Principal{Identity: "dev-user", Method: auth.MethodDev}, nil
 	}
 
 	authHeader := r.Header.Get("Authorization")
 	if authHeader == "" {
-		return "", fmt.Errorf("no authorization header")
+		return nil, fmt.Errorf("no authorization header")
 	}
 
 	parts := strings.SplitN(authHeader, " ", 2)
 	if len(parts) != 2 || parts[0] != "Bearer" {
-		return "", fmt.Errorf("invalid authorization header format")
+		return nil, fmt.Errorf("invalid authorization header format")
 	}
 
 	token := parts[1]
 
 	// Try OIDC token first
-	if identity, err := s.verifyOIDCToken(r.Context(), token); err == nil {
-		return identity, nil
+	if principal, err := s.verifyOIDCToken(r.Context(), token); err == nil {
+		return principal, nil
 	}
 
 	// Try ServiceAccount token
-	if identity, err := s.verifyServiceAccountToken(r.Context(), token); err == nil {
-		return identity, nil
+	if principal, err := s.verifyServiceAccountToken(r.Context(), token); err == nil {
+		return principal, nil
+	}
+
+	// Try static tokens from pool token secrets
+	if principal, err := s.verifyStaticToken(r.Context(), token); err == nil {
+		return principal, nil
 	}
 
-	return "", fmt.Errorf("token verification failed")
+	return nil, fmt.Errorf("token verification failed")
 }
 
 // verifyOIDCToken verifies an OIDC token.
-func (s *Server) verifyOIDCToken(ctx context.Context, token string) (string, error) {
+func (s *Server) verifyOIDCToken(ctx context.Context, token string) (*auth.Principal, error) {
 	// First, try to find OIDC configuration from BuildKitOIDCConfig CRDs
 	oidcConfigList := &buildkitv1alpha1.BuildKitOIDCConfigList{}
 	if err := s.client.List(ctx, oidcConfigList); err == nil {
@@ -448,14 +699,15 @@ func (s *Server) verifyOIDCToken(ctx context.Context, token string) (string, err
 				continue
 			}
 
-			// Return user identity
-			return claims.User, nil
+			// Return the principal with its full claims and the config that verified it
+			principal := claims.Principal()
+			principal.OIDCConfig = oidcConfig.Namespace + "/" + oidcConfig.Name
+			return principal, nil
 		}
 	}
 
 	// Fallback: Try to find OIDC configuration from pools (for backward compatibility)
-	poolList := &buildkitv1alpha1.BuildKitPoolList{}
-	if err := s.client.List(ctx, poolList); err == nil {
+	if poolList, err := s.listPools(ctx); err == nil {
 		for i := range poolList.Items {
 			pool := &poolList.Items[i]
 			for _, method := range pool.Spec.Auth.Methods {
@@ -477,20 +729,23 @@ func (s *Server) verifyOIDCToken(ctx context.Context, token string) (string, err
 					continue
 				}
 
-				// Return user identity
-				return claims.User, nil
+				// Return the principal with its full claims
+				return claims.Principal(), nil
 			}
 		}
 	}
 
-	return "", fmt.Errorf("no valid OIDC configuration found or token verification failed")
+	return nil, fmt.Errorf("no valid OIDC configuration found or token verification failed")
 }
 
-// getOrCreateVerifier gets or creates an OIDC verifier for the given issuer.
+// getOrCreateVerifier gets or creates an OIDC verifier for the given issuer,
+// audience and claims mapping.
 func (s *Server) getOrCreateVerifier(ctx context.Context, issuer, audience string, claimsMapping buildkitv1alpha1.ClaimsMapping) (*auth.OIDCVerifier, error) {
-	// Get or create verifier for this issuer
+	key := oidcVerifierKey{issuer: issuer, audience: audience, claimsMapping: claimsMapping}
+
+	// Get or create verifier for this configuration
 	s.oidcVerifiersMu.RLock()
-	entry, exists := s.oidcVerifiers[issuer]
+	entry, exists := s.oidcVerifiers[key]
 	s.oidcVerifiersMu.RUnlock()
 
 	if exists {
@@ -507,6 +762,7 @@ func (s *Server) getOrCreateVerifier(ctx context.Context, issuer, audience strin
 		userClaim = "sub"
 	}
 	poolsClaim := claimsMapping.Pools
+	groupsClaim := claimsMapping.Groups
 
 	verifier, err := auth.NewOIDCVerifier(
 		ctx,
@@ -514,6 +770,7 @@ func (s *Server) getOrCreateVerifier(ctx context.Context, issuer, audience strin
 		audience,
 		userClaim,
 		poolsClaim,
+		groupsClaim,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create OIDC verifier: %w", err)
@@ -521,7 +778,7 @@ func (s *Server) getOrCreateVerifier(ctx context.Context, issuer, audience strin
 
 	// Store verifier with timestamp
 	s.oidcVerifiersMu.Lock()
-	s.oidcVerifiers[issuer] = &oidcVerifierEntry{
+	s.oidcVerifiers[key] = &oidcVerifierEntry{
 		verifier: verifier,
 		lastUsed: time.Now(),
 	}
@@ -530,6 +787,21 @@ func (s *Server) getOrCreateVerifier(ctx context.Context, issuer, audience strin
 	return verifier, nil
 }
 
+// InvalidateOIDCVerifiers drops the cached verifiers of the given issuers, so
+// the next token is verified with the current configuration and keys.
+func (s *Server) InvalidateOIDCVerifiers(issuers ...string) {
+	s.oidcVerifiersMu.Lock()
+	defer s.oidcVerifiersMu.Unlock()
+	for _, issuer := range issuers {
+		for key := range s.oidcVerifiers {
+			if key.issuer == issuer {
+				delete(s.oidcVerifiers, key)
+				s.log.V(1).Info("Invalidated OIDC verifier", "issuer", issuer, "audience", key.audience)
+			}
+		}
+	}
+}
+
 // cleanupStaleVerifiers periodically removes OIDC verifiers that haven't been used recently.
 func (s *Server) cleanupStaleVerifiers(ctx context.Context) {
 	ticker := time.NewTicker(1 * time.Hour)
@@ -542,11 +814,11 @@ func (s *Server) cleanupStaleVerifiers(ctx context.Context) {
 		case <-ticker.C:
 			s.oidcVerifiersMu.Lock()
 			now := time.Now()
-			for issuer, entry := range s.oidcVerifiers {
+			for key, entry := range s.oidcVerifiers {
 				// Remove verifiers not used in the last 24 hours
 				if now.Sub(entry.lastUsed) > 24*time.Hour {
-					delete(s.oidcVerifiers, issuer)
-					s.log.V(1).Info("Cleaned up stale OIDC verifier", "issuer", issuer)
+					delete(s.oidcVerifiers, key)
+					s.log.V(1).Info("Cleaned up stale OIDC verifier", "issuer", key.issuer, "audience", key.audience)
 				}
 			}
 			s.oidcVerifiersMu.Unlock()
@@ -554,14 +826,93 @@ func (s *Server) cleanupStaleVerifiers(ctx context.Context) {
 	}
 }
 
+// clientAudiences returns the audiences client ServiceAccount tokens are
+// accepted with, which never include the gateway audience.
+func clientAudiences(configured []string) []string {
+	if len(configured) == 0 {
+		configured = []string{auth.DefaultServiceAccountAudience}
+	}
+	return slices.DeleteFunc(slices.Clone(configured), func(audience string) bool {
+		return audience == resources.GatewayControllerTokenAudience
+	})
+}
+
+// authenticateGateway authenticates a pool gateway by its ServiceAccount token.
+// In dev mode, authentication is skipped.
+func (s *Server) authenticateGateway(r *http.Request) (string, error) {
+	if s.devMode {
+		return "dev-gateway", nil
+	}
+
+	authHeader := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		return "", fmt.Errorf("missing bearer token")
+	}
+
+	identity, err := s.gatewayVerifier.VerifyToken(r.Context(), strings.TrimPrefix(authHeader, "Bearer "))
+	if err != nil {
+		return "", fmt.Errorf("failed to verify gateway token: %w", err)
+	}
+	return identity, nil
+}
+
+// verifyStaticToken verifies a static bearer token against the secrets referenced
+// by pools using the token auth method. The principal is scoped to the pools in
+// the secret's namespace that reference the secret, narrowed by the pools of the
+// token entry if it lists any.
+func (s *Server) verifyStaticToken(ctx context.Context, token string) (*auth.Principal, error) {
+	poolList, err := s.listPools(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pools: %w", err)
+	}
+
+	var refs []types.NamespacedName
+	poolsByRef := make(map[types.NamespacedName][]string)
+	for i := range poolList.Items {
+		pool := &poolList.Items[i]
+		for _, method := range pool.Spec.Auth.Methods {
+			if method.Type != buildkitv1alpha1.AuthMethodToken || method.Token == nil || method.Token.SecretRef == "" {
+				continue
+			}
+			ref := types.NamespacedName{Name: method.Token.SecretRef, Namespace: pool.Namespace}
+			if _, ok := poolsByRef[ref]; !ok {
+				refs = append(refs, ref)
+			}
+			poolsByRef[ref] = append(poolsByRef[ref], pool.Name)
+		}
+	}
+
+	rbac := NewRBACChecker()
+	for _, ref := range refs {
+		principal, err := s.staticTokens.VerifyToken(ctx, ref, token)
+		if err != nil {
+			if !errors.Is(err, auth.ErrStaticTokenNotFound) {
+				s.log.V(1).Info("Static token verification failed", "secret", ref.String(), "error", err)
+			}
+			continue
+		}
+
+		principal.Scope = []string{}
+		for _, poolName := range poolsByRef[ref] {
+			if len(principal.Pools) > 0 && !rbac.MatchesAny(poolName, principal.Pools) {
+				continue
+			}
+			principal.Scope = append(principal.Scope, ref.Namespace+"/"+poolName)
+		}
+		return principal, nil
+	}
+
+	return nil, fmt.Errorf("no matching static token found")
+}
+
 // verifyServiceAccountToken verifies a Kubernetes ServiceAccount token.
-func (s *Server) verifyServiceAccountToken(ctx context.Context, token string) (string, error) {
+func (s *Server) verifyServiceAccountToken(ctx context.Context, token string) (*auth.Principal, error) {
 	// Use the ServiceAccount token verifier
-	identity, err := s.saTokenVerifier.VerifyToken(ctx, token)
+	principal, err := s.saTokenVerifier.VerifyPrincipal(ctx, token)
 	if err != nil {
-		return "", fmt.Errorf("failed to verify ServiceAccount token: %w", err)
+		return nil, fmt.Errorf("failed to verify ServiceAccount token: %w", err)
 	}
-	return identity, nil
+	return principal, nil
 }
 
 // handleWakePool handles waking up a pool (ensuring it's ready).
@@ -577,7 +928,8 @@ func (s *Server) handleWakePool(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if _, ok := s.authenticate(w, r); !ok {
+	principal, ok := s.authenticate(w, r)
+	if !ok {
 		return
 	}
 
@@ -591,12 +943,16 @@ func (s *Server) handleWakePool(w http.ResponseWriter, r *http.Request) {
 
 	namespace := resolveNamespace(r.URL.Query().Get("namespace"))
 
-	pool := &buildkitv1alpha1.BuildKitPool{}
-	if err := s.client.Get(r.Context(), types.NamespacedName{Name: poolName, Namespace: namespace}, pool); err != nil {
+	pool, err := s.getPool(r.Context(), types.NamespacedName{Name: poolName, Namespace: namespace})
+	if err != nil {
 		s.errorResponse(w, http.StatusNotFound, "Pool not found", err)
 		return
 	}
 
+	if !s.authorized(w, r, principal, ActionWake, poolAudit(pool), s.authorizer.AuthorizePool(principal, ActionWake, pool)) {
+		return
+	}
+
 	// Wait for pool to be ready (with timeout)
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Minute)
 	defer cancel()
@@ -620,7 +976,7 @@ func (s *Server) handleAllocate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	identity, ok := s.authenticate(w, r)
+	principal, ok := s.authenticate(w, r)
 	if !ok {
 		return
 	}
@@ -632,30 +988,19 @@ func (s *Server) handleAllocate(w http.ResponseWriter, r *http.Request) {
 
 	namespace := resolveNamespace(req.Namespace)
 
-	var pool *buildkitv1alpha1.BuildKitPool
+	var names []string
 	if req.PoolName != "" {
-		pool = &buildkitv1alpha1.BuildKitPool{}
-		if err := s.client.Get(r.Context(), types.NamespacedName{Name: req.PoolName, Namespace: namespace}, pool); err != nil {
-			s.errorResponse(w, http.StatusNotFound, "Pool not found", err)
-			return
-		}
-	} else if len(req.PoolSelector) > 0 {
-		poolList := &buildkitv1alpha1.BuildKitPoolList{}
-		selector := labels.SelectorFromSet(req.PoolSelector)
-		if err := s.client.List(r.Context(), poolList, client.InNamespace(namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
-			s.errorResponse(w, http.StatusInternalServerError, "Failed to list pools", err)
-			return
-		}
-		if len(poolList.Items) == 0 {
-			http.Error(w, "No pools found matching selector", http.StatusNotFound)
-			return
-		}
-		pool = &poolList.Items[0]
-	} else {
+		names = []string{req.PoolName}
+	} else if len(req.PoolSelector) == 0 {
 		http.Error(w, "Either poolName or poolSelector must be specified", http.StatusBadRequest)
 		return
 	}
 
+	pool, ok := s.resolvePool(w, r, principal, namespace, names, req.PoolSelector, workerRequirements{})
+	if !ok {
+		return
+	}
+
 	// Wait for pool to be ready (with timeout)
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Minute)
 	defer cancel()
@@ -680,8 +1025,8 @@ func (s *Server) handleAllocate(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 
-		certPEM, keyPEM, _, err := s.certManager.IssueCertificate(r.Context(), &certs.CertificateRequest{
-			CommonName:   identity,
+		certPEM, keyPEM, certInfo, err := s.certManager.IssueCertificate(r.Context(), &certs.CertificateRequest{
+			CommonName:   principal.Identity,
 			Organization: "BuildKit Client",
 			Duration:     duration,
 			IsClient:     true,
@@ -690,6 +1035,13 @@ func (s *Server) handleAllocate(w http.ResponseWriter, r *http.Request) {
 			s.errorResponse(w, http.StatusInternalServerError, "Failed to issue certificate", err)
 			return
 		}
+		if err := s.recordCertificate(r.Context(), principal, []string{pool.Name}, certInfo); err != nil {
+			s.errorResponse(w, http.StatusInternalServerError, "Failed to record certificate", err)
+			return
+		}
+		audit := poolAudit(pool)
+		audit.Event, audit.Decision, audit.CertSerial = AuditCertificateIssued, AuditAllow, certInfo.SerialNumber
+		s.audit.record(r, principal, audit)
 
 		caCertPEM, err := s.caManager.GetCACertPEM(r.Context())
 		if err != nil {
@@ -701,6 +1053,7 @@ func (s *Server) handleAllocate(w http.ResponseWriter, r *http.Request) {
 		response.CACert = base64.StdEncoding.EncodeToString(caCertPEM)
 		response.ClientCert = base64.StdEncoding.EncodeToString(certPEM)
 		response.ClientKey = base64.StdEncoding.EncodeToString(keyPEM)
+		response.SerialNumber = certInfo.SerialNumber
 	} else if req.CertSecretName != "" {
 		// Use existing cert secret
 		secret := &corev1.Secret{}
@@ -749,8 +1102,8 @@ func (s *Server) waitForPoolReady(ctx context.Context, poolName, namespace strin
 		case <-ctx.Done():
 			return false, "", fmt.Errorf("timeout waiting for pool to be ready")
 		case <-ticker.C:
-			pool := &buildkitv1alpha1.BuildKitPool{}
-			if err := s.client.Get(ctx, types.NamespacedName{Name: poolName, Namespace: namespace}, pool); err != nil {
+			pool, err := s.getPool(ctx, types.NamespacedName{Name: poolName, Namespace: namespace})
+			if err != nil {
 				continue
 			}
 
@@ -791,20 +1144,51 @@ func (s *Server) waitForPoolReady(ctx context.Context, poolName, namespace strin
 
 // WorkerAllocateRequest represents a worker allocation request.
 type WorkerAllocateRequest struct {
-	PoolName  string            `json:"poolName"`
+	PoolName string `json:"poolName,omitempty"`
+	// Pools is an ordered list of pools to allocate from: the first pool that
+	// can provide a worker without queueing is used, so later pools act as
+	// overflow for earlier ones. PoolName, if also set, goes first.
+	Pools []string `json:"pools,omitempty"`
+	// PoolSelector selects the pools to allocate from by labels; the least
+	// loaded matching pool is used. Ignored if PoolName or Pools is set.
+	PoolSelector map[string]string `json:"poolSelector,omitempty"`
+	// Platforms the worker must build for, e.g. linux/arm64. Only pools with
+	// a worker group supporting every platform are used.
+	Platforms []string `json:"platforms,omitempty"`
+	// Size is the worker size, one of the pool's sizes (sm, md, lg or xl).
+	// Defaults to the pool's first size.
+	Size      string            `json:"size,omitempty"`
 	Namespace string            `json:"namespace,omitempty"`
 	JobID     string            `json:"jobId,omitempty"`
 	TTL       string            `json:"ttl,omitempty"`
 	Metadata  map[string]string `json:"metadata,omitempty"`
+	// Priority orders requests waiting for a worker; higher goes first.
+	Priority int32 `json:"priority,omitempty"`
+	// Async returns 202 with an allocation ID right away instead of waiting for
+	// the worker. The allocation is then polled at /api/v1/allocations/{id}.
+	Async bool `json:"async,omitempty"`
 }
 
 // WorkerAllocateResponse represents a worker allocation response.
 type WorkerAllocateResponse struct {
-	WorkerName      string `json:"workerName"`
+	// AllocationID identifies the allocation, e.g. in the admin API.
+	AllocationID string `json:"allocationId"`
+	// PoolName is the pool the worker was allocated from.
+	PoolName   string `json:"poolName"`
+	WorkerName string `json:"workerName"`
+	// Platforms the worker builds for, native platform first.
+	Platforms []string `json:"platforms,omitempty"`
+	// Size is the worker size, if the pool offers sizes.
+	Size            string `json:"size,omitempty"`
 	Token           string `json:"token"`
 	Endpoint        string `json:"endpoint"`
 	GatewayEndpoint string `json:"gatewayEndpoint"`
-	ExpiresAt       string `json:"expiresAt"`
+	// ExpiresAt is when the allocation expires unless it is renewed.
+	ExpiresAt string `json:"expiresAt"`
+	// MaxExpiresAt is the limit the allocation can be renewed to.
+	MaxExpiresAt string `json:"maxExpiresAt,omitempty"`
+	// HeartbeatInterval is how often clients should renew the allocation.
+	HeartbeatInterval string `json:"heartbeatInterval,omitempty"`
 	// Certificates for client auth
 	CACert     string `json:"caCert,omitempty"`
 	ClientCert string `json:"clientCert,omitempty"`
@@ -830,11 +1214,8 @@ func (s *Server) handleWorkerAllocate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Authenticate request
-	identity, err := s.authenticateRequest(r)
-	if err != nil {
-		s.log.Error(err, "Authentication failed")
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	principal, ok := s.authenticate(w, r)
+	if !ok {
 		return
 	}
 
@@ -845,27 +1226,30 @@ func (s *Server) handleWorkerAllocate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.PoolName == "" {
-		http.Error(w, "poolName is required", http.StatusBadRequest)
+	names := req.Pools
+	if req.PoolName != "" {
+		names = append([]string{req.PoolName}, names...)
+	}
+	if len(names) == 0 && len(req.PoolSelector) == 0 {
+		http.Error(w, "poolName, pools or poolSelector is required", http.StatusBadRequest)
 		return
 	}
 
+	for _, platform := range req.Platforms {
+		if err := resources.ValidatePlatform(platform); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
 	namespace := req.Namespace
 	if namespace == "" {
 		namespace = "default"
 	}
 
-	// Get the pool
-	pool := &buildkitv1alpha1.BuildKitPool{}
-	if err := s.client.Get(r.Context(), types.NamespacedName{Name: req.PoolName, Namespace: namespace}, pool); err != nil {
-		s.log.Error(err, "Failed to get pool", "pool", req.PoolName)
-		http.Error(w, fmt.Sprintf("Pool not found: %v", err), http.StatusNotFound)
-		return
-	}
-
-	worker, err := s.findOrCreateWorker(r.Context(), pool)
-	if err != nil {
-		s.errorResponse(w, http.StatusServiceUnavailable, "Failed to allocate worker", err)
+	requirements := workerRequirements{platforms: req.Platforms, size: req.Size}
+	pool, ok := s.resolvePool(w, r, principal, namespace, names, req.PoolSelector, requirements)
+	if !ok {
 		return
 	}
 
@@ -874,40 +1258,94 @@ func (s *Server) handleWorkerAllocate(w http.ResponseWriter, r *http.Request) {
 		jobID = uuid.New().String()
 	}
 
-	ttl := 1 * time.Hour
+	ttl := defaultAllocationTTL
 	if req.TTL != "" {
 		if parsed, err := time.ParseDuration(req.TTL); err == nil {
 			ttl = parsed
 		}
 	}
 
-	tokenData, err := s.tokenManager.IssueToken(
-		pool.Name,
-		namespace,
-		worker.Name,
-		worker.Status.Endpoint,
-		jobID,
-		identity,
-		ttl,
-		req.Metadata,
-	)
+	// In idle lease mode the allocation has to be renewed before the idle timeout
+	policy := poolLeasePolicy(pool)
+	ttl = policy.lease(ttl)
+
+	claim := workerClaim{
+		jobID:        jobID,
+		requestedBy:  principal.Identity,
+		priority:     req.Priority,
+		ttl:          ttl,
+		maxTTL:       policy.maxTTL,
+		metadata:     req.Metadata,
+		requirements: requirements,
+	}
+
+	// Enforce the pool's quotas for the caller; the reservation is released once
+	// the allocation completes
+	quotas := matchQuotas(pool, principal)
+	limitTTL(quotas, &claim)
+	reservation, err := s.quotas.reserve(types.NamespacedName{Name: pool.Name, Namespace: pool.Namespace}, quotas, s.tokenManager.ListTokens())
 	if err != nil {
-		s.errorResponse(w, http.StatusInternalServerError, "Failed to issue allocation token", err)
+		var quotaErr *QuotaExceededError
+		if errors.As(err, &quotaErr) {
+			audit := poolAudit(pool)
+			audit.Event, audit.Decision, audit.Reason, audit.JobID = AuditWorkerAllocated, AuditDeny, err.Error(), jobID
+			s.audit.record(r, principal, audit)
+			s.quotaExceededResponse(w, principal, quotaErr)
+			return
+		}
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to check quotas", err)
+		return
+	}
+	claim.quota = reservation
+
+	audit := poolAudit(pool)
+	audit.JobID = jobID
+	claim.audit = audit.withRequest(r, principal)
+
+	if req.Async {
+		status := s.startAsyncAllocation(uuid.New().String(), pool, claim)
+		s.log.Info("Accepted asynchronous worker allocation", "allocation", status.ID, "pool", pool.Name, "identity", principal.Identity)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", "/api/v1/allocations/"+status.ID)
+		w.WriteHeader(http.StatusAccepted)
+		s.encodeJSON(w, status)
 		return
 	}
 
-	// Update worker with allocation
-	worker.Spec.Allocation = &buildkitv1alpha1.WorkerAllocation{
-		JobID:       jobID,
-		Token:       tokenData.Token,
-		RequestedBy: identity,
-		AllocatedAt: metav1.Now(),
-		ExpiresAt:   &metav1.Time{Time: tokenData.ExpiresAt},
-		Metadata:    req.Metadata,
+	// Allocations may wait in the queue for longer than the server's write timeout
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		s.log.V(1).Info("Failed to clear write deadline", "error", err)
 	}
-	if err := s.client.Update(r.Context(), worker); err != nil {
-		s.log.Error(err, "Failed to update worker allocation")
-		// Don't fail the request, token is still valid
+
+	response, err := s.allocateWorker(r.Context(), pool, claim)
+	if err != nil {
+		s.writeAllocationError(w, principal, err)
+		return
+	}
+
+	s.log.Info("Worker allocated", "worker", response.WorkerName, "pool", pool.Name, "identity", principal.Identity)
+	s.encodeJSON(w, response)
+}
+
+// allocateWorker claims a worker for the pool and issues the client credentials for it.
+func (s *Server) allocateWorker(ctx context.Context, pool *buildkitv1alpha1.BuildKitPool, claim workerClaim) (response *WorkerAllocateResponse, err error) {
+	defer func() {
+		claim.quota.release(err == nil)
+		if err != nil {
+			audit := claim.audit
+			audit.Event, audit.Decision, audit.Reason = AuditWorkerAllocated, AuditDeny, err.Error()
+			s.audit.write(audit)
+		}
+	}()
+
+	worker, tokenData, err := s.claimWorker(ctx, pool, claim)
+	if err != nil {
+		var queueErr *QueueTimeoutError
+		if errors.As(err, &queueErr) {
+			return nil, err
+		}
+		return nil, &allocationFailure{status: http.StatusServiceUnavailable, message: "Failed to allocate worker", err: err}
 	}
 
 	// Get gateway endpoint
@@ -917,72 +1355,347 @@ func (s *Server) handleWorkerAllocate(w http.ResponseWriter, r *http.Request) {
 		if pool.Spec.Networking.Port != nil {
 			port = *pool.Spec.Networking.Port
 		}
-		gatewayEndpoint = fmt.Sprintf("tcp://%s.%s.svc:%d", pool.Name, namespace, port)
+		gatewayEndpoint = fmt.Sprintf("tcp://%s.%s.svc:%d", pool.Name, pool.Namespace, port)
 	}
 
-	// Issue client certificate with token embedded in CN
-	certPEM, keyPEM, _, issueErr := s.certManager.IssueCertificate(r.Context(), &certs.CertificateRequest{
-		CommonName:   fmt.Sprintf("alloc:%s", tokenData.Token),
+	// Issue client certificate with the token embedded in a URI SAN and its ID in the CN
+	certPEM, keyPEM, certInfo, err := s.certManager.IssueCertificate(ctx, &certs.CertificateRequest{
+		CommonName:   fmt.Sprintf("alloc:%s", tokenData.ID),
+		URIs:         []*url.URL{{Scheme: "buildkit", Host: "allocation", Path: "/" + tokenData.Token}},
 		Organization: "BuildKit Client",
-		Duration:     ttl,
+		Duration:     time.Until(tokenData.MaxExpiresAt),
 		IsClient:     true,
 	})
-	if issueErr != nil {
-		s.log.Error(issueErr, "Failed to issue certificate")
-		http.Error(w, "Failed to issue certificate", http.StatusInternalServerError)
-		return
+	if err != nil {
+		s.releaseClaim(ctx, tokenData)
+		return nil, &allocationFailure{status: http.StatusInternalServerError, message: "Failed to issue certificate", err: err}
 	}
 
-	caCertPEM, err := s.caManager.GetCACertPEM(r.Context())
+	caCertPEM, err := s.caManager.GetCACertPEM(ctx)
 	if err != nil {
-		s.errorResponse(w, http.StatusInternalServerError, "Failed to get CA certificate", err)
-		return
+		s.releaseClaim(ctx, tokenData)
+		return nil, &allocationFailure{status: http.StatusInternalServerError, message: "Failed to get CA certificate", err: err}
+	}
+
+	audit := claim.audit
+	audit.Worker, audit.AllocationID, audit.CertSerial = worker.Name, tokenData.ID, certInfo.SerialNumber
+	audit.Event, audit.Decision = AuditCertificateIssued, AuditAllow
+	s.audit.write(audit)
+	audit.Event = AuditWorkerAllocated
+	s.audit.write(audit)
+	s.webhooks.Emit(allocationEvent(webhooks.EventWorkerAllocated, tokenData, ""))
+
+	return &WorkerAllocateResponse{
+		AllocationID:      tokenData.ID,
+		PoolName:          pool.Name,
+		WorkerName:        worker.Name,
+		Platforms:         worker.Spec.Platforms,
+		Size:              worker.Spec.Size,
+		Token:             tokenData.Token,
+		Endpoint:          worker.Status.Endpoint,
+		GatewayEndpoint:   gatewayEndpoint,
+		ExpiresAt:         tokenData.ExpiresAt.Format(time.RFC3339),
+		MaxExpiresAt:      tokenData.MaxExpiresAt.Format(time.RFC3339),
+		HeartbeatInterval: heartbeatInterval(claim.ttl).String(),
+		CACert:            base64.StdEncoding.EncodeToString(caCertPEM),
+		ClientCert:        base64.StdEncoding.EncodeToString(certPEM),
+		ClientKey:         base64.StdEncoding.EncodeToString(keyPEM),
+	}, nil
+}
+
+// errNoWorkerAvailable is returned when a pool is at capacity with no idle worker.
+var errNoWorkerAvailable = errors.New("no worker available")
+
+// workerClaim describes the allocation a worker is claimed for.
+type workerClaim struct {
+	jobID       string
+	requestedBy string
+	priority    int32
+	ttl         time.Duration
+	maxTTL      time.Duration
+	metadata    map[string]string
+	// requirements are the platforms and size the worker must have.
+	requirements workerRequirements
+	// quota, if set, holds the allocation's place in the pool quotas until it completes.
+	quota *quotaReservation
+	// audit is the base audit record of the allocation, with the caller and request source.
+	audit AuditRecord
+	// progress, if set, is told when the allocation is queued or starts provisioning.
+	progress func(AllocationState)
+}
+
+// report tells the claim's progress hook about a state change.
+func (c *workerClaim) report(state AllocationState) {
+	if c.progress != nil {
+		c.progress(state)
 	}
+}
 
-	response := WorkerAllocateResponse{
-		WorkerName:      worker.Name,
-		Token:           tokenData.Token,
-		Endpoint:        worker.Status.Endpoint,
-		GatewayEndpoint: gatewayEndpoint,
-		ExpiresAt:       tokenData.ExpiresAt.Format(time.RFC3339),
-		CACert:          base64.StdEncoding.EncodeToString(caCertPEM),
-		ClientCert:      base64.StdEncoding.EncodeToString(certPEM),
-		ClientKey:       base64.StdEncoding.EncodeToString(keyPEM),
+// claimWorker finds a worker for the pool and claims it by issuing an allocation token.
+// The token is recorded on the worker with a conditional update before it is
+// returned, so a worker is never handed to two jobs. When the pool is at capacity
+// the request waits in the pool's allocation queue until a worker is free.
+func (s *Server) claimWorker(ctx context.Context, pool *buildkitv1alpha1.BuildKitPool, claim workerClaim) (*buildkitv1alpha1.BuildKitWorker, *gateway.TokenData, error) {
+	key := types.NamespacedName{Name: pool.Name, Namespace: pool.Namespace}
+
+	// Go straight for a worker unless others are already waiting
+	if s.queue.Len(key) == 0 {
+		worker, tokenData, err := s.tryClaimWorker(ctx, pool, claim, nil)
+		if !errors.Is(err, errNoWorkerAvailable) {
+			return worker, tokenData, err
+		}
 	}
 
-	s.log.Info("Worker allocated", "worker", worker.Name, "pool", pool.Name, "identity", identity)
-	s.encodeJSON(w, response)
+	ticket := s.queue.Enqueue(key, claim.jobID, claim.priority, claim.requirements)
+	claim.report(AllocationQueued)
+	s.log.V(1).Info("Pool at capacity, queued allocation", "pool", pool.Name, "job", claim.jobID, "position", ticket.Position())
+
+	timeout := time.NewTimer(s.queueTimeout)
+	defer timeout.Stop()
+	recheck := time.NewTicker(queueRecheckInterval)
+	defer recheck.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			ticket.Leave("canceled")
+			return nil, nil, ctx.Err()
+		case <-timeout.C:
+			err := &QueueTimeoutError{Position: ticket.Position(), Depth: s.queue.Len(key), Waited: ticket.Waited()}
+			ticket.Leave("timeout")
+			return nil, nil, err
+		case <-ticket.Turn():
+		case <-recheck.C:
+		}
+
+		worker, tokenData, err := s.tryClaimWorker(ctx, pool, claim, ticket)
+		if errors.Is(err, errNoWorkerAvailable) {
+			continue
+		}
+		if err != nil {
+			ticket.Leave("error")
+			return nil, nil, err
+		}
+		ticket.Leave("allocated")
+		return worker, tokenData, nil
+	}
+}
+
+// tryClaimWorker claims an idle worker, or creates a new one if the pool has room.
+// It returns errNoWorkerAvailable if the pool is at capacity and every idle worker
+// was taken by a concurrent allocation. A queued request skips workers a waiter
+// ahead of it can use, and only creates a worker when every waiter ahead of it
+// is stuck, e.g. on a size at its max. It keeps its place in the queue while it
+// creates a worker, so a lost claim is retried from there, but the waiters
+// behind it can proceed meanwhile.
+func (s *Server) tryClaimWorker(ctx context.Context, pool *buildkitv1alpha1.BuildKitPool, claim workerClaim, ticket *QueueTicket) (*buildkitv1alpha1.BuildKitWorker, *gateway.TokenData, error) {
+	for attempt := 1; attempt <= maxClaimAttempts; attempt++ {
+		workerList := &buildkitv1alpha1.BuildKitWorkerList{}
+		if err := s.client.List(ctx, workerList,
+			client.InNamespace(pool.Namespace),
+			client.MatchingLabels{"buildkit.smrt-devops.net/pool": pool.Name}); err != nil {
+			return nil, nil, fmt.Errorf("failed to list workers: %w", err)
+		}
+
+		var ahead []workerRequirements
+		if ticket != nil {
+			ahead = ticket.Ahead()
+		}
+
+		for _, worker := range claimableWorkers(pool, workerList, claim.requirements) {
+			if wantedByAny(pool, worker, ahead) {
+				continue
+			}
+			tokenData, err := s.issueClaim(ctx, pool, worker, claim)
+			if err == nil {
+				return worker, tokenData, nil
+			}
+			if !isLostClaim(err) {
+				return nil, nil, fmt.Errorf("failed to claim worker %s: %w", worker.Name, err)
+			}
+			s.log.V(1).Info("Lost race for worker, trying next candidate", "worker", worker.Name, "pool", pool.Name)
+		}
+
+		// Check if we can create a new worker (respect pool max)
+		if !allStuck(pool, workerList, ahead) || !s.hasRoomFor(ctx, pool, workerList, claim.requirements) {
+			return nil, nil, errNoWorkerAvailable
+		}
+
+		if ticket != nil {
+			ticket.SetProvisioning(true)
+		}
+		claim.report(AllocationProvisioning)
+
+		worker, err := s.createWorker(ctx, pool, claim.requirements)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		tokenData, err := s.issueClaim(ctx, pool, worker, claim)
+		if err == nil {
+			return worker, tokenData, nil
+		}
+		if !isLostClaim(err) {
+			s.discardWorker(ctx, worker)
+			return nil, nil, fmt.Errorf("failed to claim worker %s: %w", worker.Name, err)
+		}
+		s.log.V(1).Info("New worker was claimed by another allocation, retrying", "worker", worker.Name, "pool", pool.Name, "attempt", attempt)
+		if ticket != nil {
+			ticket.SetProvisioning(false)
+		}
+	}
+
+	return nil, nil, fmt.Errorf("failed to claim a worker in pool %s after %d attempts", pool.Name, maxClaimAttempts)
+}
+
+// issueClaim issues an allocation token for a worker, which records the claim on it.
+func (s *Server) issueClaim(ctx context.Context, pool *buildkitv1alpha1.BuildKitPool, worker *buildkitv1alpha1.BuildKitWorker, claim workerClaim) (*gateway.TokenData, error) {
+	return s.tokenManager.IssueToken(
+		ctx,
+		pool.Name,
+		pool.Namespace,
+		worker.Name,
+		worker.Status.Endpoint,
+		claim.jobID,
+		claim.requestedBy,
+		claim.ttl,
+		claim.maxTTL,
+		claim.metadata,
+		claim.quota.quotaSubjects(),
+	)
+}
+
+// isLostClaim reports whether a claim failed because another allocation got the worker first.
+func isLostClaim(err error) bool {
+	return errors.Is(err, gateway.ErrWorkerUnavailable) || apierrors.IsConflict(err) || apierrors.IsNotFound(err)
 }
 
-// findOrCreateWorker finds an idle worker or creates a new one.
-func (s *Server) findOrCreateWorker(ctx context.Context, pool *buildkitv1alpha1.BuildKitPool) (*buildkitv1alpha1.BuildKitWorker, error) {
-	// List workers for this pool
-	workerList := &buildkitv1alpha1.BuildKitWorkerList{}
-	if err := s.client.List(ctx, workerList,
-		client.InNamespace(pool.Namespace),
-		client.MatchingLabels{"buildkit.smrt-devops.net/pool": pool.Name}); err != nil {
-		return nil, fmt.Errorf("failed to list workers: %w", err)
+// releaseClaim revokes an allocation that could not be handed to the client,
+// so the worker does not stay claimed by a token nobody holds.
+func (s *Server) releaseClaim(ctx context.Context, tokenData *gateway.TokenData) {
+	if err := s.tokenManager.RevokeToken(ctx, tokenData.Token); err != nil {
+		s.log.Error(err, "Failed to release worker claim", "worker", tokenData.WorkerName)
 	}
+	s.queue.Notify(types.NamespacedName{Name: tokenData.PoolName, Namespace: tokenData.Namespace})
+}
+
+// isClaimable reports whether a worker is idle and not allocated.
+func isClaimable(worker *buildkitv1alpha1.BuildKitWorker) bool {
+	return worker.Status.Phase == buildkitv1alpha1.WorkerPhaseIdle &&
+		worker.Spec.Allocation == nil &&
+		worker.DeletionTimestamp.IsZero()
+}
 
-	// Find an idle worker
+// claimableWorkers returns the claimable workers of a pool that meet the requirements.
+func claimableWorkers(pool *buildkitv1alpha1.BuildKitPool, workerList *buildkitv1alpha1.BuildKitWorkerList, requirements workerRequirements) []*buildkitv1alpha1.BuildKitWorker {
+	var candidates []*buildkitv1alpha1.BuildKitWorker
 	for i := range workerList.Items {
 		worker := &workerList.Items[i]
-		if worker.Status.Phase == buildkitv1alpha1.WorkerPhaseIdle {
-			return worker, nil
+		if isClaimable(worker) && requirements.matches(pool, worker) {
+			candidates = append(candidates, &workerList.Items[i])
+		}
+	}
+	return candidates
+}
+
+// wantedByAny reports whether a worker meets any of the requirements.
+func wantedByAny(pool *buildkitv1alpha1.BuildKitPool, worker *buildkitv1alpha1.BuildKitWorker, requirements []workerRequirements) bool {
+	for _, required := range requirements {
+		if required.matches(pool, worker) {
+			return true
+		}
+	}
+	return false
+}
+
+// allStuck reports whether no allocation with any of the requirements can get
+// a worker: none is idle for it and none may be created for it.
+func allStuck(pool *buildkitv1alpha1.BuildKitPool, workerList *buildkitv1alpha1.BuildKitWorkerList, requirements []workerRequirements) bool {
+	for _, required := range requirements {
+		if len(claimableWorkers(pool, workerList, required)) > 0 || roomFor(pool, workerList, required) {
+			return false
 		}
 	}
+	return true
+}
 
-	// Check if we can create a new worker (respect pool max)
-	maxWorkers := int32(10)
-	if pool.Spec.Scaling.Max != nil {
-		maxWorkers = *pool.Spec.Scaling.Max
+// roomFor reports whether a worker meeting the requirements could be created,
+// possibly by retiring an idle worker that does not meet them, without doing so.
+func roomFor(pool *buildkitv1alpha1.BuildKitPool, workerList *buildkitv1alpha1.BuildKitWorkerList, requirements workerRequirements) bool {
+	if !sizeHasRoom(pool, workerList, requirements) {
+		return false
 	}
-	if int32(len(workerList.Items)) >= maxWorkers {
-		// Wait for an idle worker
-		return s.waitForIdleWorker(ctx, pool)
+	if int32(len(workerList.Items)) < poolMaxWorkers(pool) {
+		return true
+	}
+	for i := range workerList.Items {
+		if isClaimable(&workerList.Items[i]) && !requirements.matches(pool, &workerList.Items[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// sizeHasRoom reports whether the requested size is below its max.
+func sizeHasRoom(pool *buildkitv1alpha1.BuildKitPool, workerList *buildkitv1alpha1.BuildKitWorkerList, requirements workerRequirements) bool {
+	size, _ := resources.FindWorkerSize(pool, requirements.size)
+	if size == nil || size.Max == nil {
+		return true
+	}
+	count := int32(0)
+	for i := range workerList.Items {
+		if workerList.Items[i].Spec.Size == size.Name {
+			count++
+		}
+	}
+	return count < *size.Max
+}
+
+// hasRoomFor reports whether a worker meeting the requirements may be created:
+// its size must be below the size's max, and the pool below scaling.max. When
+// the pool is at its max, an idle worker that does not meet the requirements
+// is retired to make room.
+func (s *Server) hasRoomFor(ctx context.Context, pool *buildkitv1alpha1.BuildKitPool, workerList *buildkitv1alpha1.BuildKitWorkerList, requirements workerRequirements) bool {
+	if !sizeHasRoom(pool, workerList, requirements) {
+		return false
+	}
+
+	if int32(len(workerList.Items)) < poolMaxWorkers(pool) {
+		return true
+	}
+	return s.retireIdleWorker(ctx, pool, workerList, requirements)
+}
+
+// retireIdleWorker deletes an idle worker that does not meet the requirements,
+// e.g. of another platform or size, to make room below the pool's max for one
+// that does. The deletion is conditional on the worker being unchanged, so a
+// worker claimed in the meantime is kept. It reports whether a worker was deleted.
+func (s *Server) retireIdleWorker(ctx context.Context, pool *buildkitv1alpha1.BuildKitPool, workerList *buildkitv1alpha1.BuildKitWorkerList, requirements workerRequirements) bool {
+	for i := range workerList.Items {
+		worker := &workerList.Items[i]
+		if !isClaimable(worker) || requirements.matches(pool, worker) {
+			continue
+		}
+		resourceVersion := worker.ResourceVersion
+		if err := s.client.Delete(ctx, worker, client.Preconditions{ResourceVersion: &resourceVersion}); err != nil {
+			s.log.V(1).Info("Failed to retire idle worker", "worker", worker.Name, "error", err.Error())
+			continue
+		}
+		s.log.Info("Retired idle worker to make room for a different worker", "worker", worker.Name, "pool", pool.Name, "requirements", requirements.String())
+		return true
+	}
+	return false
+}
+
+// createWorker creates a new worker for the pool meeting the requirements and
+// waits for it to be ready.
+func (s *Server) createWorker(ctx context.Context, pool *buildkitv1alpha1.BuildKitPool, requirements workerRequirements) (*buildkitv1alpha1.BuildKitWorker, error) {
+	group, groupOK := resources.FindWorkerGroup(pool, requirements.platforms)
+	size, sizeOK := resources.FindWorkerSize(pool, requirements.size)
+	if !groupOK || !sizeOK {
+		return nil, fmt.Errorf("pool %s offers no workers with %s", pool.Name, requirements)
 	}
 
-	// Create a new worker
 	worker := &buildkitv1alpha1.BuildKitWorker{
 		ObjectMeta: metav1.ObjectMeta{
 			GenerateName: fmt.Sprintf("%s-worker-", pool.Name),
@@ -999,44 +1712,52 @@ func (s *Server) findOrCreateWorker(ctx context.Context, pool *buildkitv1alpha1.
 			},
 		},
 	}
+	resources.ApplyWorkerGroup(worker, group)
+	resources.ApplyWorkerSize(worker, size)
 
 	if err := s.client.Create(ctx, worker); err != nil {
 		return nil, fmt.Errorf("failed to create worker: %w", err)
 	}
+	metrics.ScaleOperationsTotal.WithLabelValues(pool.Name, "allocate").Inc()
 
 	// Wait for worker to be ready
-	return s.waitForWorkerReady(ctx, worker.Name, pool.Namespace)
+	ready, err := s.waitForWorkerReady(ctx, worker.Name, pool.Namespace)
+	if err != nil {
+		s.discardWorker(ctx, worker)
+		return nil, err
+	}
+	return ready, nil
 }
 
-// waitForIdleWorker waits for an idle worker to become available.
-func (s *Server) waitForIdleWorker(ctx context.Context, pool *buildkitv1alpha1.BuildKitPool) (*buildkitv1alpha1.BuildKitWorker, error) {
-	ticker := time.NewTicker(2 * time.Second)
-	defer ticker.Stop()
-
-	timeout := time.After(2 * time.Minute)
-
-	for {
-		select {
-		case <-ctx.Done():
-			return nil, ctx.Err()
-		case <-timeout:
-			return nil, fmt.Errorf("timeout waiting for idle worker")
-		case <-ticker.C:
-			workerList := &buildkitv1alpha1.BuildKitWorkerList{}
-			if err := s.client.List(ctx, workerList,
-				client.InNamespace(pool.Namespace),
-				client.MatchingLabels{"buildkit.smrt-devops.net/pool": pool.Name}); err != nil {
-				continue
-			}
-
-			for i := range workerList.Items {
-				worker := &workerList.Items[i]
-				if worker.Status.Phase == buildkitv1alpha1.WorkerPhaseIdle {
-					return worker, nil
-				}
-			}
+// discardWorker deletes a worker created for an allocation that failed, so it
+// does not linger in the pool. A worker another allocation claimed meanwhile
+// is left alone.
+func (s *Server) discardWorker(ctx context.Context, worker *buildkitv1alpha1.BuildKitWorker) {
+	// The allocation may have failed because its request was canceled
+	ctx = context.WithoutCancel(ctx)
+
+	current := &buildkitv1alpha1.BuildKitWorker{}
+	if err := s.client.Get(ctx, client.ObjectKeyFromObject(worker), current); err != nil {
+		if !apierrors.IsNotFound(err) {
+			s.log.Error(err, "Failed to get worker of failed allocation", "worker", worker.Name, "namespace", worker.Namespace)
 		}
+		return
+	}
+	if current.Spec.Allocation != nil {
+		return
+	}
+
+	// The preconditions keep a claim made after the read from being deleted
+	err := s.client.Delete(ctx, current, client.Preconditions{UID: &current.UID, ResourceVersion: &current.ResourceVersion})
+	if apierrors.IsConflict(err) || apierrors.IsNotFound(err) {
+		s.log.V(1).Info("Worker of failed allocation changed, leaving it", "worker", current.Name, "namespace", current.Namespace)
+		return
+	}
+	if err != nil {
+		s.log.Error(err, "Failed to delete worker of failed allocation", "worker", current.Name, "namespace", current.Namespace)
+		return
 	}
+	s.log.Info("Deleted worker of failed allocation", "worker", current.Name, "namespace", current.Namespace)
 }
 
 // waitForWorkerReady waits for a worker to become ready.
@@ -1076,9 +1797,15 @@ func (s *Server) handleWorkerLookup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// This endpoint is called by the gateway internally, so we use a different auth
-	// For now, require a special gateway token or internal call
-	// In production, this should be protected by network policy
+	// This endpoint is called by pool gateways, which authenticate with a projected
+	// ServiceAccount token bound to their own per-pool ServiceAccount
+	gatewayIdentity, err := s.authenticateGateway(r)
+	if err != nil {
+		s.audit.record(r, nil, AuditRecord{Event: AuditAuthentication, Decision: AuditDeny, AuthMethod: auth.MethodServiceAccount, Reason: err.Error()})
+		s.log.Info("Gateway authentication failed", "error", err.Error())
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
 
 	var req WorkerLookupRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -1092,13 +1819,25 @@ func (s *Server) handleWorkerLookup(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Look up the token
-	tokenData, err := s.tokenManager.ValidateToken(req.Token)
+	tokenData, err := s.tokenManager.ValidateToken(r.Context(), req.Token)
 	if err != nil {
 		s.log.V(1).Info("Token lookup failed", "error", err)
 		http.Error(w, "Token not found or expired", http.StatusNotFound)
 		return
 	}
 
+	// A gateway may only resolve tokens for its own pool
+	if !s.devMode && gatewayIdentity != resources.GetGatewayServiceAccountUsername(tokenData.PoolName, tokenData.Namespace) {
+		audit := allocationAudit(tokenData)
+		audit.Event, audit.Decision, audit.Identity, audit.AuthMethod = AuditAuthorization, AuditDeny, gatewayIdentity, auth.MethodServiceAccount
+		audit.Reason = "token does not belong to this gateway's pool"
+		s.audit.record(r, nil, audit)
+		s.log.Info("Gateway attempted lookup of token for another pool",
+			"gateway", gatewayIdentity, "pool", tokenData.PoolName, "namespace", tokenData.Namespace)
+		http.Error(w, "Token does not belong to this gateway's pool", http.StatusForbidden)
+		return
+	}
+
 	response := WorkerLookupResponse{
 		WorkerEndpoint: tokenData.WorkerEndpoint,
 		WorkerName:     tokenData.WorkerName,
@@ -1113,7 +1852,8 @@ func (s *Server) handleWorkerRelease(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if _, ok := s.authenticate(w, r); !ok {
+	principal, ok := s.authenticate(w, r)
+	if !ok {
 		return
 	}
 
@@ -1130,20 +1870,37 @@ func (s *Server) handleWorkerRelease(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get token data before revoking
-	tokenData, err := s.tokenManager.ValidateToken(req.Token)
+	tokenData, err := s.tokenManager.ValidateToken(r.Context(), req.Token)
 	if err != nil {
 		http.Error(w, "Token not found or expired", http.StatusNotFound)
 		return
 	}
 
+	if !s.authorized(w, r, principal, ActionRelease, allocationAudit(tokenData), s.authorizer.AuthorizeAllocation(principal, ActionRelease, tokenData, s.allocationPool(r.Context(), tokenData))) {
+		return
+	}
+
+	s.teardownAllocation(r.Context(), req.Token, tokenData)
+	audit := allocationAudit(tokenData)
+	audit.Event, audit.Decision = AuditWorkerReleased, AuditAllow
+	s.audit.record(r, principal, audit)
+	s.webhooks.Emit(allocationEvent(webhooks.EventWorkerReleased, tokenData, "Released by owner"))
+
+	s.log.Info("Worker released", "worker", tokenData.WorkerName, "pool", tokenData.PoolName, "identity", principal.Identity)
+	s.encodeJSON(w, map[string]string{"status": "released"})
+}
+
+// teardownAllocation deletes the worker of an allocation and revokes its token.
+// Revocation puts the token on the deny list, so gateways close its connections.
+func (s *Server) teardownAllocation(ctx context.Context, token string, tokenData *gateway.TokenData) {
 	// Delete the worker (ephemeral workers are cleaned up after use)
 	worker := &buildkitv1alpha1.BuildKitWorker{}
 	workerNamespace := tokenData.Namespace
 	if workerNamespace == "" {
 		workerNamespace = "buildkit-system" // Default namespace fallback
 	}
-	if err := s.client.Get(r.Context(), types.NamespacedName{Name: tokenData.WorkerName, Namespace: workerNamespace}, worker); err == nil {
-		if deleteErr := s.client.Delete(r.Context(), worker); deleteErr != nil {
+	if err := s.client.Get(ctx, types.NamespacedName{Name: tokenData.WorkerName, Namespace: workerNamespace}, worker); err == nil {
+		if deleteErr := s.client.Delete(ctx, worker); deleteErr != nil {
 			s.log.Error(deleteErr, "Failed to delete worker", "worker", worker.Name, "namespace", workerNamespace)
 		} else {
 			s.log.Info("Worker deleted", "worker", worker.Name, "namespace", workerNamespace)
@@ -1153,8 +1910,24 @@ func (s *Server) handleWorkerRelease(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Revoke the token
-	s.tokenManager.RevokeToken(req.Token)
+	if err := s.tokenManager.RevokeToken(ctx, token); err != nil {
+		s.log.Error(err, "Failed to revoke token", "worker", tokenData.WorkerName)
+	}
 
-	s.log.Info("Worker released", "worker", tokenData.WorkerName, "pool", tokenData.PoolName)
-	s.encodeJSON(w, map[string]string{"status": "released"})
+	// A queued allocation may now be able to create a worker in its place
+	s.queue.Notify(types.NamespacedName{Name: tokenData.PoolName, Namespace: tokenData.Namespace})
+}
+
+// allocationEvent returns a lifecycle event about an allocation.
+func allocationEvent(eventType webhooks.EventType, tokenData *gateway.TokenData, message string) webhooks.Event {
+	return webhooks.Event{
+		Type:         eventType,
+		Pool:         tokenData.PoolName,
+		Namespace:    tokenData.Namespace,
+		Worker:       tokenData.WorkerName,
+		JobID:        tokenData.JobID,
+		AllocationID: tokenData.ID,
+		RequestedBy:  tokenData.RequestedBy,
+		Message:      message,
+	}
 }
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/smrt-devops/buildkit-controller/internal/gateway"
+)
+
+// tokenCleanupInterval is how often expired tokens and deny list entries are dropped.
+const tokenCleanupInterval = 5 * time.Minute
+
+// handleTokenKeys publishes the public keys used to verify allocation tokens.
+func (s *Server) handleTokenKeys(w http.ResponseWriter, r *http.Request) {
+	if !s.requireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	w.Header().Set("Cache-Control", "max-age=60")
+	s.encodeJSON(w, s.tokenManager.KeySet())
+}
+
+// handleRevokedTokens publishes the deny list of revoked, unexpired allocation tokens.
+func (s *Server) handleRevokedTokens(w http.ResponseWriter, r *http.Request) {
+	if !s.requireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	s.encodeJSON(w, gateway.RevocationList{
+		Revoked:     s.tokenManager.RevokedTokens(),
+		GeneratedAt: time.Now(),
+	})
+}
+
+// cleanupExpiredTokens periodically drops expired tokens from memory, and
+// persists the deny list whenever leases lapse.
+func (s *Server) cleanupExpiredTokens(ctx context.Context) {
+	ticker := time.NewTicker(tokenCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.tokenManager.Lapsed():
+			s.persistRevocations(ctx)
+		case <-ticker.C:
+			if expired := s.tokenManager.CleanupExpired(); expired > 0 {
+				s.log.V(1).Info("Cleaned up expired allocation tokens", "count", expired)
+				s.persistRevocations(ctx)
+			}
+		}
+	}
+}
+
+// persistRevocations writes the deny list to its store. Failures are retried
+// with the next lapse or cleanup.
+func (s *Server) persistRevocations(ctx context.Context) {
+	if err := s.tokenManager.PersistRevocations(ctx); err != nil {
+		s.log.Error(err, "Failed to persist allocation token deny list")
+	}
+}
@@ -3,132 +3,224 @@ package auth
 import (
 	"context"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"encoding/pem"
 	"fmt"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
-	corev1 "k8s.io/api/core/v1"
+	"github.com/go-jose/go-jose/v4/jwt"
+	authenticationv1 "k8s.io/api/authentication/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/smrt-devops/buildkit-controller/internal/utils"
 )
 
+const (
+	// DefaultServiceAccountAudience is the default audience ServiceAccount tokens must be bound to.
+	DefaultServiceAccountAudience = "buildkit-controller"
+
+	// serviceAccountUsernamePrefix is the username prefix of ServiceAccount identities.
+	serviceAccountUsernamePrefix = "system:serviceaccount:"
+	// saTokenCacheTTL is how long reviews of tokens without an expiry are cached.
+	saTokenCacheTTL = 5 * time.Minute
+)
+
 // ServiceAccountTokenVerifier verifies Kubernetes ServiceAccount JWT tokens.
 type ServiceAccountTokenVerifier struct {
-	client client.Client
-	log    utils.Logger
+	client    client.Client
+	log       utils.Logger
+	audiences []string
+	excluded  []string
+
+	cacheMu sync.Mutex
+	cache   map[string]*cachedTokenReview // keyed by SHA-256 of the token
+}
+
+// cachedTokenReview is a successful token review, valid until the token expires.
+type cachedTokenReview struct {
+	principal *Principal
+	expiresAt time.Time
 }
 
 // NewServiceAccountTokenVerifier creates a new ServiceAccount token verifier.
-func NewServiceAccountTokenVerifier(k8sClient client.Client, log utils.Logger) *ServiceAccountTokenVerifier {
+// Tokens must be bound to at least one of the given audiences; if none are
+// given, DefaultServiceAccountAudience is used. Tokens also bound to any of the
+// excluded audiences are rejected, so tokens meant for another purpose, such as
+// gateway tokens, are never accepted.
+func NewServiceAccountTokenVerifier(k8sClient client.Client, log utils.Logger, audiences, excluded []string) *ServiceAccountTokenVerifier {
+	if len(audiences) == 0 {
+		audiences = []string{DefaultServiceAccountAudience}
+	}
+	audiences = slices.DeleteFunc(slices.Clone(audiences), func(audience string) bool {
+		return slices.Contains(excluded, audience)
+	})
 	return &ServiceAccountTokenVerifier{
-		client: k8sClient,
-		log:    log,
+		client:    k8sClient,
+		log:       log,
+		audiences: audiences,
+		excluded:  excluded,
+		cache:     make(map[string]*cachedTokenReview),
 	}
 }
 
 // ServiceAccountClaims represents the claims in a Kubernetes ServiceAccount token.
 type ServiceAccountClaims struct {
 	// Standard JWT claims
-	Issuer    string `json:"iss"`
-	Subject   string `json:"sub"`
-	Audience  string `json:"aud"`
-	Expiry    int64  `json:"exp"`
-	IssuedAt  int64  `json:"iat"`
-	NotBefore int64  `json:"nbf"`
-
-	// Kubernetes-specific claims
-	Namespace      string `json:"kubernetes.io/serviceaccount/namespace"`
-	ServiceAccount string `json:"kubernetes.io/serviceaccount/service-account.name"`
-	SecretName     string `json:"kubernetes.io/serviceaccount/service-account.uid"`
+	Issuer    string       `json:"iss"`
+	Subject   string       `json:"sub"`
+	Audience  jwt.Audience `json:"aud"`
+	Expiry    int64        `json:"exp"`
+	IssuedAt  int64        `json:"iat"`
+	NotBefore int64        `json:"nbf"`
 }
 
 // VerifyToken verifies a Kubernetes ServiceAccount token and extracts the identity.
-// For Kubernetes 1.21+, tokens are projected and signed by the API server.
-// We verify the token by:
-// 1. Parsing the JWT without verification (to get claims)
-// 2. Extracting the ServiceAccount identity from claims
-// 3. Optionally verifying signature against API server public keys (complex, skipped for now)
-//
-// Note: Full signature verification requires fetching public keys from the API server's
-// /openid/v1/jwks endpoint, which is complex. For now, we validate the token structure
-// and extract identity, which is acceptable for internal cluster communication.
 func (v *ServiceAccountTokenVerifier) VerifyToken(ctx context.Context, token string) (string, error) {
-	// Parse JWT token (without signature verification for now)
-	// Format: header.payload.signature
-	parts := strings.Split(token, ".")
-	if len(parts) != 3 {
-		return "", fmt.Errorf("invalid token format: expected 3 parts, got %d", len(parts))
+	principal, err := v.VerifyPrincipal(ctx, token)
+	if err != nil {
+		return "", err
 	}
+	return principal.Identity, nil
+}
 
-	// Decode payload (second part)
-	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+// VerifyPrincipal verifies a Kubernetes ServiceAccount token and returns the principal.
+// The token is verified by the API server through the TokenReview API, which checks
+// the signature, expiry, audience binding and that the bound ServiceAccount (and pod,
+// for projected tokens) still exists. Successful reviews are cached until the token expires.
+func (v *ServiceAccountTokenVerifier) VerifyPrincipal(ctx context.Context, token string) (*Principal, error) {
+	claims, err := parseUnverifiedClaims(token)
 	if err != nil {
-		return "", fmt.Errorf("failed to decode token payload: %w", err)
+		return nil, err
+	}
+	if !strings.HasPrefix(claims.Subject, serviceAccountUsernamePrefix) {
+		return nil, fmt.Errorf("token subject is not a ServiceAccount")
+	}
+	if len(v.audiences) == 0 {
+		return nil, fmt.Errorf("no audiences accepted")
+	}
+	for _, audience := range claims.Audience {
+		if slices.Contains(v.excluded, audience) {
+			return nil, fmt.Errorf("tokens with audience %q are not accepted", audience)
+		}
 	}
 
-	var claims ServiceAccountClaims
-	if err := json.Unmarshal(payload, &claims); err != nil {
-		return "", fmt.Errorf("failed to parse token claims: %w", err)
+	sum := sha256.Sum256([]byte(token))
+	cacheKey := hex.EncodeToString(sum[:])
+	if principal, ok := v.cachedPrincipal(cacheKey); ok {
+		return principal, nil
 	}
 
-	// Validate token structure
-	if claims.Issuer == "" {
-		return "", fmt.Errorf("missing issuer in token")
+	review := &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{
+			Token:     token,
+			Audiences: v.audiences,
+		},
 	}
-	if claims.Subject == "" {
-		return "", fmt.Errorf("missing subject in token")
+	if err := v.client.Create(ctx, review); err != nil {
+		return nil, fmt.Errorf("token review failed: %w", err)
 	}
 
-	// Check expiration
-	if claims.Expiry > 0 {
-		expiry := time.Unix(claims.Expiry, 0)
-		if time.Now().After(expiry) {
-			return "", fmt.Errorf("token expired at %v", expiry)
-		}
+	if !review.Status.Authenticated {
+		return nil, fmt.Errorf("token not authenticated: %s", review.Status.Error)
 	}
 
-	// Check not before
-	if claims.NotBefore > 0 {
-		notBefore := time.Unix(claims.NotBefore, 0)
-		if time.Now().Before(notBefore) {
-			return "", fmt.Errorf("token not valid until %v", notBefore)
+	identity := review.Status.User.Username
+	if !strings.HasPrefix(identity, serviceAccountUsernamePrefix) {
+		return nil, fmt.Errorf("token does not belong to a ServiceAccount")
+	}
+	for _, audience := range review.Status.Audiences {
+		if slices.Contains(v.excluded, audience) {
+			return nil, fmt.Errorf("tokens with audience %q are not accepted", audience)
 		}
 	}
 
-	// Extract ServiceAccount identity
-	// Format: system:serviceaccount:<namespace>:<serviceaccount>
-	identity := claims.Subject
+	principal := &Principal{
+		Identity:  identity,
+		Method:    MethodServiceAccount,
+		Issuer:    claims.Issuer,
+		Namespace: serviceAccountNamespace(identity),
+		Groups:    review.Status.User.Groups,
+	}
 
-	// Validate ServiceAccount exists
-	if claims.Namespace != "" && claims.ServiceAccount != "" {
-		sa := &corev1.ServiceAccount{}
-		key := client.ObjectKey{
-			Namespace: claims.Namespace,
-			Name:      claims.ServiceAccount,
-		}
-		if err := v.client.Get(ctx, key, sa); err != nil {
-			v.log.V(1).Info("ServiceAccount not found, but token structure is valid", "namespace", claims.Namespace, "name", claims.ServiceAccount)
-			// Continue anyway - token structure is valid
+	expiresAt := time.Now().Add(saTokenCacheTTL)
+	if claims.Expiry > 0 {
+		expiresAt = time.Unix(claims.Expiry, 0)
+	}
+	v.storePrincipal(cacheKey, principal, expiresAt)
+
+	v.log.V(1).Info("Verified ServiceAccount token", "identity", identity, "audiences", review.Status.Audiences)
+	return principal, nil
+}
+
+func (v *ServiceAccountTokenVerifier) cachedPrincipal(key string) (*Principal, bool) {
+	v.cacheMu.Lock()
+	defer v.cacheMu.Unlock()
+
+	entry, ok := v.cache[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(v.cache, key)
+		return nil, false
+	}
+	return entry.principal, true
+}
+
+func (v *ServiceAccountTokenVerifier) storePrincipal(key string, principal *Principal, expiresAt time.Time) {
+	v.cacheMu.Lock()
+	defer v.cacheMu.Unlock()
+
+	// Drop expired entries so the cache doesn't grow without bound
+	now := time.Now()
+	for k, entry := range v.cache {
+		if now.After(entry.expiresAt) {
+			delete(v.cache, k)
 		}
 	}
 
-	return identity, nil
+	v.cache[key] = &cachedTokenReview{principal: principal, expiresAt: expiresAt}
 }
 
-// GetPublicKeyFromSecret extracts RSA public key from a Kubernetes secret.
-// This is used for verifying tokens signed by service account secrets (legacy tokens).
-func GetPublicKeyFromSecret(secret *corev1.Secret) (*rsa.PublicKey, error) {
-	// Legacy tokens use the service account's secret
-	// The public key is typically in the secret's data
-	// For projected tokens (1.21+), we'd need to fetch from API server's JWKS endpoint
+// parseUnverifiedClaims decodes the token payload without verifying it.
+// The claims are only used to skip obviously invalid tokens and to bound the
+// cache lifetime; the TokenReview is what actually authenticates the token.
+func parseUnverifiedClaims(token string) (*ServiceAccountClaims, error) {
+	// Format: header.payload.signature
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid token format: expected 3 parts, got %d", len(parts))
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode token payload: %w", err)
+	}
+
+	var claims ServiceAccountClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("failed to parse token claims: %w", err)
+	}
+
+	if claims.Expiry > 0 && time.Now().After(time.Unix(claims.Expiry, 0)) {
+		return nil, fmt.Errorf("token expired at %v", time.Unix(claims.Expiry, 0))
+	}
+
+	return &claims, nil
+}
 
-	// For now, return error as we're focusing on token structure validation
-	return nil, fmt.Errorf("public key extraction from secret not implemented - using token structure validation only")
+// serviceAccountNamespace returns the namespace of a ServiceAccount username,
+// which has the form system:serviceaccount:<namespace>:<name>.
+func serviceAccountNamespace(identity string) string {
+	namespace, _, _ := strings.Cut(strings.TrimPrefix(identity, serviceAccountUsernamePrefix), ":")
+	return namespace
 }
 
 // ParseRSAPublicKey parses an RSA public key from PEM format.
@@ -5,24 +5,31 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"time"
 
 	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/go-jose/go-jose/v4"
 	"golang.org/x/oauth2"
+
+	"github.com/smrt-devops/buildkit-controller/internal/metrics"
 )
 
 // OIDCVerifier handles OIDC token verification.
 type OIDCVerifier struct {
-	provider   *oidc.Provider
-	verifier   *oidc.IDTokenVerifier
-	audience   string
-	userClaim  string
-	poolsClaim string
+	provider    *oidc.Provider
+	verifier    *oidc.IDTokenVerifier
+	issuer      string
+	audience    string
+	userClaim   string
+	poolsClaim  string
+	groupsClaim string
 }
 
 // NewOIDCVerifier creates a new OIDC verifier.
-func NewOIDCVerifier(ctx context.Context, issuer, audience, userClaim, poolsClaim string) (*OIDCVerifier, error) {
+func NewOIDCVerifier(ctx context.Context, issuer, audience, userClaim, poolsClaim, groupsClaim string) (*OIDCVerifier, error) {
 	provider, err := oidc.NewProvider(ctx, issuer)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create OIDC provider: %w", err)
@@ -33,29 +40,86 @@ func NewOIDCVerifier(ctx context.Context, issuer, audience, userClaim, poolsClai
 	})
 
 	return &OIDCVerifier{
-		provider:   provider,
-		verifier:   verifier,
-		audience:   audience,
-		userClaim:  userClaim,
-		poolsClaim: poolsClaim,
+		provider:    provider,
+		verifier:    verifier,
+		issuer:      issuer,
+		audience:    audience,
+		userClaim:   userClaim,
+		poolsClaim:  poolsClaim,
+		groupsClaim: groupsClaim,
 	}, nil
 }
 
+// OIDCDiscovery is the result of discovering an OIDC issuer.
+type OIDCDiscovery struct {
+	// JWKSURI is the URL of the issuer's key set.
+	JWKSURI string
+	// Keys is the number of keys in the key set.
+	Keys int
+}
+
+// DiscoverOIDC fetches the discovery document and key set of an issuer, so
+// misconfigured issuers are noticed before the first token is verified.
+func DiscoverOIDC(ctx context.Context, issuer string) (*OIDCDiscovery, error) {
+	provider, err := oidc.NewProvider(ctx, issuer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch discovery document: %w", err)
+	}
+
+	var metadata struct {
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := provider.Claims(&metadata); err != nil {
+		return nil, fmt.Errorf("failed to parse discovery document: %w", err)
+	}
+	if metadata.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery document has no jwks_uri")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metadata.JWKSURI, http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create key set request: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch key set: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch key set: %s", resp.Status)
+	}
+
+	var keySet jose.JSONWebKeySet
+	if err := json.NewDecoder(resp.Body).Decode(&keySet); err != nil {
+		return nil, fmt.Errorf("failed to parse key set: %w", err)
+	}
+	if len(keySet.Keys) == 0 {
+		return nil, fmt.Errorf("key set %s has no keys", metadata.JWKSURI)
+	}
+
+	return &OIDCDiscovery{JWKSURI: metadata.JWKSURI, Keys: len(keySet.Keys)}, nil
+}
+
 // VerifyToken verifies an OIDC token and extracts claims.
 func (v *OIDCVerifier) VerifyToken(ctx context.Context, token string) (*OIDCClaims, error) {
 	idToken, err := v.verifier.Verify(ctx, token)
 	if err != nil {
+		metrics.OIDCVerificationsTotal.WithLabelValues(v.issuer, "failure").Inc()
 		return nil, fmt.Errorf("failed to verify token: %w", err)
 	}
 
 	var claims map[string]interface{}
 	if err := idToken.Claims(&claims); err != nil {
+		metrics.OIDCVerificationsTotal.WithLabelValues(v.issuer, "failure").Inc()
 		return nil, fmt.Errorf("failed to extract claims: %w", err)
 	}
+	metrics.OIDCVerificationsTotal.WithLabelValues(v.issuer, "success").Inc()
 
 	result := &OIDCClaims{
-		Subject: idToken.Subject,
-		Claims:  claims,
+		Issuer:   idToken.Issuer,
+		Audience: v.audience,
+		Subject:  idToken.Subject,
+		Claims:   claims,
 	}
 
 	// Extract user identity
@@ -73,30 +137,63 @@ func (v *OIDCVerifier) VerifyToken(ctx context.Context, token string) (*OIDCClai
 	// Extract pools access
 	if v.poolsClaim != "" {
 		if pools, ok := claims[v.poolsClaim]; ok {
-			switch v := pools.(type) {
-			case string:
-				result.Pools = []string{v}
-			case []interface{}:
-				for _, p := range v {
-					if pool, ok := p.(string); ok {
-						result.Pools = append(result.Pools, pool)
-					}
-				}
-			case []string:
-				result.Pools = v
-			}
+			result.Pools = stringList(pools)
+		}
+	}
+
+	// Extract group membership
+	if v.groupsClaim != "" {
+		if groups, ok := claims[v.groupsClaim]; ok {
+			result.Groups = stringList(groups)
 		}
 	}
 
 	return result, nil
 }
 
+// stringList converts a string or list claim into a string slice.
+// The result is non-nil for any recognized claim type, even if it is empty.
+func stringList(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	case []string:
+		return v
+	}
+	return nil
+}
+
 // OIDCClaims contains extracted OIDC claims.
 type OIDCClaims struct {
-	Subject string
-	User    string
-	Pools   []string
-	Claims  map[string]interface{}
+	Issuer string
+	// Audience is the audience the token was verified for.
+	Audience string
+	Subject  string
+	User     string
+	Pools    []string
+	Groups   []string
+	Claims   map[string]interface{}
+}
+
+// Principal returns the authenticated principal for the claims.
+func (c *OIDCClaims) Principal() *Principal {
+	return &Principal{
+		Identity: c.User,
+		Method:   MethodOIDC,
+		Issuer:   c.Issuer,
+		Audience: c.Audience,
+		Groups:   c.Groups,
+		Pools:    c.Pools,
+		Claims:   c.Claims,
+	}
 }
 
 // GeneratePKCE generates PKCE code verifier and challenge.
@@ -0,0 +1,46 @@
+package auth
+
+// Authentication methods a principal can be authenticated with.
+const (
+	MethodOIDC           = "oidc"
+	MethodServiceAccount = "serviceaccount"
+	MethodDev            = "dev"
+	MethodResource       = "resource"
+)
+
+// Principal is an authenticated caller together with the claims it presented.
+type Principal struct {
+	// Identity is the user identity, e.g. the mapped OIDC user claim or the
+	// ServiceAccount username.
+	Identity string
+	// Method is the authentication method used.
+	Method string
+	// Issuer is the token issuer, if known.
+	Issuer string
+	// Audience is the audience an OIDC token was verified for.
+	Audience string
+	// OIDCConfig is the namespace/name of the BuildKitOIDCConfig an OIDC token
+	// was verified with, or empty if it was verified with a pool's OIDC settings.
+	OIDCConfig string
+	// Namespace is the namespace of a ServiceAccount caller, or of the Secret
+	// holding a static token.
+	Namespace string
+	// Groups are the groups the caller belongs to.
+	Groups []string
+	// Pools are the pools the identity provider grants access to. It is nil
+	// when the token carries no pools claim.
+	Pools []string
+	// Scope limits the principal to the pools listed as namespace/name. It is
+	// nil when the principal is not limited to specific pools.
+	Scope []string
+	// Claims are the raw token claims, if available.
+	Claims map[string]interface{}
+}
+
+// String returns the identity of the principal.
+func (p *Principal) String() string {
+	if p == nil {
+		return ""
+	}
+	return p.Identity
+}
@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/smrt-devops/buildkit-controller/internal/utils"
+)
+
+// MethodToken is the authentication method of static bearer tokens.
+const MethodToken = "token"
+
+// ErrStaticTokenNotFound is returned when a token is not defined in a token secret.
+var ErrStaticTokenNotFound = errors.New("static token not found")
+
+// StaticTokenEntry is the value of an entry in a token secret.
+// The entry key is the token itself, unless TokenHash is set, in which case the
+// key is only a name and the secret never holds the plaintext token.
+type StaticTokenEntry struct {
+	// User is the name the token authenticates as. The identity of the token is
+	// token:<namespace>:<user>, so it never matches callers of other methods.
+	User string `json:"user"`
+	// Pools narrows the pools of the Secret's namespace the token grants access to.
+	Pools []string `json:"pools,omitempty"`
+	// Groups are the groups the identity belongs to.
+	Groups []string `json:"groups,omitempty"`
+	// ExpiresAt is when the token stops being accepted. Tokens without it never expire.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	// TokenHash is the hex encoded SHA-256 hash of the token.
+	TokenHash string `json:"tokenHash,omitempty"`
+}
+
+// StaticTokenVerifier verifies static bearer tokens defined in Secrets.
+// Secrets are parsed once per resource version and only token hashes are kept
+// in memory, so changes to a Secret take effect on the next request.
+type StaticTokenVerifier struct {
+	client client.Client
+	log    utils.Logger
+
+	mu      sync.Mutex
+	secrets map[types.NamespacedName]*tokenSecret
+}
+
+// tokenSecret is the parsed content of a token secret at a resource version.
+type tokenSecret struct {
+	resourceVersion string
+	tokens          []hashedToken
+}
+
+// hashedToken is a token entry keyed by the SHA-256 hash of the token.
+type hashedToken struct {
+	name  string
+	hash  []byte
+	entry StaticTokenEntry
+}
+
+// NewStaticTokenVerifier creates a new static token verifier.
+func NewStaticTokenVerifier(k8sClient client.Client, log utils.Logger) *StaticTokenVerifier {
+	return &StaticTokenVerifier{
+		client:  k8sClient,
+		log:     log,
+		secrets: make(map[types.NamespacedName]*tokenSecret),
+	}
+}
+
+// VerifyToken checks a token against the tokens defined in a secret and returns
+// the principal. The principal is scoped to the namespace of the secret; callers
+// set its Scope to the pools that accept the secret.
+func (v *StaticTokenVerifier) VerifyToken(ctx context.Context, secretRef types.NamespacedName, token string) (*Principal, error) {
+	tokens, err := v.load(ctx, secretRef)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256([]byte(token))
+
+	// Compare against every entry so timing doesn't reveal which one matched
+	var match *hashedToken
+	for i := range tokens {
+		if subtle.ConstantTimeCompare(sum[:], tokens[i].hash) == 1 && match == nil {
+			match = &tokens[i]
+		}
+	}
+	if match == nil {
+		return nil, ErrStaticTokenNotFound
+	}
+
+	if match.entry.ExpiresAt != nil && time.Now().After(*match.entry.ExpiresAt) {
+		return nil, fmt.Errorf("static token %s expired at %v", match.name, *match.entry.ExpiresAt)
+	}
+
+	return &Principal{
+		Identity:  fmt.Sprintf("%s:%s:%s", MethodToken, secretRef.Namespace, match.entry.User),
+		Method:    MethodToken,
+		Namespace: secretRef.Namespace,
+		Groups:    match.entry.Groups,
+		Pools:     match.entry.Pools,
+	}, nil
+}
+
+// load returns the tokens of a secret, re-parsing it when its resource version changed.
+func (v *StaticTokenVerifier) load(ctx context.Context, secretRef types.NamespacedName) ([]hashedToken, error) {
+	secret := &corev1.Secret{}
+	if err := v.client.Get(ctx, secretRef, secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			v.mu.Lock()
+			delete(v.secrets, secretRef)
+			v.mu.Unlock()
+		}
+		return nil, fmt.Errorf("failed to get token secret %s: %w", secretRef, err)
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if cached, ok := v.secrets[secretRef]; ok && cached.resourceVersion == secret.ResourceVersion {
+		return cached.tokens, nil
+	}
+
+	tokens := make([]hashedToken, 0, len(secret.Data))
+	for key, value := range secret.Data {
+		token, err := parseStaticToken(key, value)
+		if err != nil {
+			v.log.Info("Ignoring invalid static token entry", "secret", secretRef.String(), "error", err.Error())
+			continue
+		}
+		tokens = append(tokens, token)
+	}
+
+	v.secrets[secretRef] = &tokenSecret{
+		resourceVersion: secret.ResourceVersion,
+		tokens:          tokens,
+	}
+	v.log.V(1).Info("Loaded static tokens", "secret", secretRef.String(), "count", len(tokens))
+
+	return tokens, nil
+}
+
+func parseStaticToken(key string, value []byte) (hashedToken, error) {
+	var entry StaticTokenEntry
+	if err := json.Unmarshal(value, &entry); err != nil {
+		return hashedToken{}, fmt.Errorf("failed to parse entry: %w", err)
+	}
+	if entry.User == "" {
+		return hashedToken{}, fmt.Errorf("entry has no user")
+	}
+
+	if entry.TokenHash != "" {
+		hash, err := hex.DecodeString(entry.TokenHash)
+		if err != nil || len(hash) != sha256.Size {
+			return hashedToken{}, fmt.Errorf("tokenHash is not a hex encoded SHA-256 hash")
+		}
+		return hashedToken{name: key, hash: hash, entry: entry}, nil
+	}
+
+	// The key is the plaintext token, so only its hash is kept and used as the name
+	sum := sha256.Sum256([]byte(key))
+	return hashedToken{name: "sha256:" + hex.EncodeToString(sum[:4]), hash: sum[:], entry: entry}, nil
+}
@@ -9,7 +9,6 @@ import (
 	"crypto/x509/pkix"
 	"encoding/pem"
 	"fmt"
-	"math/big"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
@@ -69,6 +68,18 @@ func (m *CAManager) EnsureCA(ctx context.Context) (*CA, error) {
 		ca, parseErr := parseCAFromSecret(secret)
 		if parseErr != nil {
 			m.log.Info("Failed to parse existing CA, regenerating", "error", parseErr)
+		} else if ca.Cert.KeyUsage&x509.KeyUsageCRLSign == 0 {
+			// CAs created before CRL support cannot sign CRLs; re-sign the CA
+			// certificate with the same key and subject so issued certificates stay valid
+			m.log.Info("Adding CRL signing to existing CA", "secret", m.caName)
+			upgraded, upgradeErr := m.upgradeCA(ca)
+			if upgradeErr != nil {
+				return nil, fmt.Errorf("failed to upgrade CA: %w", upgradeErr)
+			}
+			if err := m.storeCA(ctx, upgraded); err != nil {
+				return nil, fmt.Errorf("failed to store CA: %w", err)
+			}
+			return upgraded, nil
 		} else {
 			m.log.Info("Using existing CA", "secret", m.caName)
 			return ca, nil
@@ -128,9 +139,14 @@ func (m *CAManager) generateCA() (*CA, error) {
 		return nil, fmt.Errorf("failed to generate ECDSA CA key: %w", err)
 	}
 
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+
 	// Create CA certificate template
 	caTemplate := &x509.Certificate{
-		SerialNumber: big.NewInt(1),
+		SerialNumber: serial,
 		Subject: pkix.Name{
 			Organization:  []string{"BuildKit Controller"},
 			CommonName:    "BuildKit CA",
@@ -144,11 +160,39 @@ func (m *CAManager) generateCA() (*CA, error) {
 		NotAfter:              time.Now().Add(CADuration),
 		IsCA:                  true,
 		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
-		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
 		BasicConstraintsValid: true,
 	}
 
-	// Create CA certificate
+	return signCA(caTemplate, caKey)
+}
+
+// upgradeCA re-signs an existing CA certificate with CRL signing added to its
+// key usage. The key, subject and validity are unchanged, so certificates issued
+// by the old CA certificate verify against the new one and vice versa.
+func (m *CAManager) upgradeCA(ca *CA) (*CA, error) {
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+
+	caTemplate := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               ca.Cert.Subject,
+		NotBefore:             ca.Cert.NotBefore,
+		NotAfter:              ca.Cert.NotAfter,
+		IsCA:                  true,
+		ExtKeyUsage:           ca.Cert.ExtKeyUsage,
+		KeyUsage:              ca.Cert.KeyUsage | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		SubjectKeyId:          ca.Cert.SubjectKeyId,
+	}
+
+	return signCA(caTemplate, ca.Key)
+}
+
+// signCA self-signs a CA certificate template.
+func signCA(caTemplate *x509.Certificate, caKey *ecdsa.PrivateKey) (*CA, error) {
 	caCertDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
 	if err != nil {
 		return nil, err
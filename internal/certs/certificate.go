@@ -12,20 +12,24 @@ import (
 	"fmt"
 	"math/big"
 	"net"
+	"net/url"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
+	"github.com/smrt-devops/buildkit-controller/internal/metrics"
 	"github.com/smrt-devops/buildkit-controller/internal/utils"
 )
 
 // CertificateInfo contains certificate validity information.
 type CertificateInfo struct {
-	NotBefore   time.Time
-	NotAfter    time.Time
-	RenewalTime time.Time
+	// SerialNumber is the certificate serial in hex.
+	SerialNumber string
+	NotBefore    time.Time
+	NotAfter     time.Time
+	RenewalTime  time.Time
 }
 
 // CertificateRequest defines a certificate request.
@@ -33,6 +37,7 @@ type CertificateRequest struct {
 	CommonName   string
 	DNSNames     []string
 	IPAddresses  []net.IP
+	URIs         []*url.URL
 	Organization string
 	Duration     time.Duration
 	IsServer     bool
@@ -86,9 +91,14 @@ func (m *CertificateManager) IssueCertificate(ctx context.Context, req *Certific
 		}
 	}
 
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
 	// Create certificate template
 	template := &x509.Certificate{
-		SerialNumber: big.NewInt(time.Now().Unix()),
+		SerialNumber: serial,
 		Subject: pkix.Name{
 			CommonName:   req.CommonName,
 			Organization: []string{req.Organization},
@@ -97,6 +107,7 @@ func (m *CertificateManager) IssueCertificate(ctx context.Context, req *Certific
 		NotAfter:              time.Now().Add(duration),
 		DNSNames:              req.DNSNames,
 		IPAddresses:           req.IPAddresses,
+		URIs:                  req.URIs,
 		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
 		ExtKeyUsage:           []x509.ExtKeyUsage{},
 		BasicConstraintsValid: true,
@@ -120,6 +131,7 @@ func (m *CertificateManager) IssueCertificate(ctx context.Context, req *Certific
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("failed to parse certificate: %w", err)
 	}
+	metrics.CertificatesIssued.WithLabelValues(certificateType(req)).Inc()
 
 	// Encode to PEM
 	certPEM = pem.EncodeToMemory(&pem.Block{
@@ -146,23 +158,47 @@ func (m *CertificateManager) IssueCertificate(ctx context.Context, req *Certific
 		// For short-lived certificates, renew at 80% of duration
 		renewalTime := cert.NotAfter.Add(-certDuration * 80 / 100)
 		info = &CertificateInfo{
-			NotBefore:   cert.NotBefore,
-			NotAfter:    cert.NotAfter,
-			RenewalTime: renewalTime,
+			SerialNumber: cert.SerialNumber.Text(16),
+			NotBefore:    cert.NotBefore,
+			NotAfter:     cert.NotAfter,
+			RenewalTime:  renewalTime,
 		}
 	} else {
 		// For long-lived certificates, use the default renewal window
 		renewalTime := cert.NotAfter.Add(-defaultRenewalWindow)
 		info = &CertificateInfo{
-			NotBefore:   cert.NotBefore,
-			NotAfter:    cert.NotAfter,
-			RenewalTime: renewalTime,
+			SerialNumber: cert.SerialNumber.Text(16),
+			NotBefore:    cert.NotBefore,
+			NotAfter:     cert.NotAfter,
+			RenewalTime:  renewalTime,
 		}
 	}
 
 	return certPEM, keyPEM, info, nil
 }
 
+// randomSerial returns a random 128-bit certificate serial number, so serials
+// never collide and cannot be guessed.
+func randomSerial() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+	return serial, nil
+}
+
+// certificateType returns the metrics label for the kind of certificate requested.
+func certificateType(req *CertificateRequest) string {
+	switch {
+	case req.IsServer && req.IsClient:
+		return "server-client"
+	case req.IsServer:
+		return "server"
+	default:
+		return "client"
+	}
+}
+
 // ShouldRotateCertificate checks if a certificate should be rotated.
 func (m *CertificateManager) ShouldRotateCertificate(certInfo *CertificateInfo, rotateBefore time.Duration) bool {
 	if certInfo == nil {
@@ -228,9 +264,10 @@ func (m *CertificateManager) ParseCertificateFromSecret(ctx context.Context, sec
 	}
 
 	return &CertificateInfo{
-		NotBefore:   cert.NotBefore,
-		NotAfter:    cert.NotAfter,
-		RenewalTime: renewalTime,
+		SerialNumber: cert.SerialNumber.Text(16),
+		NotBefore:    cert.NotBefore,
+		NotAfter:     cert.NotAfter,
+		RenewalTime:  renewalTime,
 	}, nil
 }
 
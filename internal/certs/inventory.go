@@ -0,0 +1,326 @@
+package certs
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// CRLKey is the key of the PEM-encoded CRL in published CRL ConfigMaps.
+	CRLKey = "crl.pem"
+	// CRLValidity is how long a published CRL is valid. CRLs are republished
+	// when a certificate is revoked and once half of their validity has passed.
+	CRLValidity = 24 * time.Hour
+
+	// inventoryKey is the key of the certificate list in the inventory secret.
+	inventoryKey = "certificates.json"
+)
+
+// ErrCertificateNotFound is returned when a serial number is not in the inventory.
+var ErrCertificateNotFound = errors.New("certificate not found")
+
+// IssuedCertificate is an entry in the inventory of issued client certificates.
+type IssuedCertificate struct {
+	// SerialNumber is the certificate serial in hex.
+	SerialNumber string    `json:"serialNumber"`
+	CommonName   string    `json:"commonName"`
+	Pools        []string  `json:"pools,omitempty"`
+	NotBefore    time.Time `json:"notBefore"`
+	NotAfter     time.Time `json:"notAfter"`
+	// RevokedAt is set once the certificate is revoked.
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+	RevokedBy string     `json:"revokedBy,omitempty"`
+	Reason    string     `json:"reason,omitempty"`
+}
+
+// Revoked reports whether the certificate has been revoked.
+func (c *IssuedCertificate) Revoked() bool {
+	return c.RevokedAt != nil
+}
+
+// RecordCertificate adds an issued certificate to the inventory, so it can be
+// listed and revoked.
+func (m *CertificateManager) RecordCertificate(ctx context.Context, cert IssuedCertificate) error {
+	return m.updateInventory(ctx, func(certs []IssuedCertificate) ([]IssuedCertificate, error) {
+		return append(certs, cert), nil
+	})
+}
+
+// ListCertificates returns the issued certificates that have not expired,
+// oldest first.
+func (m *CertificateManager) ListCertificates(ctx context.Context) ([]IssuedCertificate, error) {
+	secret, err := m.getInventory(ctx)
+	if err != nil {
+		return nil, err
+	}
+	certs, err := decodeInventory(secret)
+	if err != nil {
+		return nil, err
+	}
+	return pruneExpired(certs, time.Now()), nil
+}
+
+// RevokeCertificate marks a certificate in the inventory as revoked. Revoking a
+// revoked certificate returns it unchanged.
+func (m *CertificateManager) RevokeCertificate(ctx context.Context, serial, revokedBy, reason string) (*IssuedCertificate, error) {
+	var revoked *IssuedCertificate
+	err := m.updateInventory(ctx, func(certs []IssuedCertificate) ([]IssuedCertificate, error) {
+		for i := range certs {
+			if certs[i].SerialNumber != serial {
+				continue
+			}
+			if !certs[i].Revoked() {
+				now := time.Now().UTC()
+				certs[i].RevokedAt = &now
+				certs[i].RevokedBy = revokedBy
+				certs[i].Reason = reason
+			}
+			revoked = &certs[i]
+			return certs, nil
+		}
+		return nil, fmt.Errorf("%w: %s", ErrCertificateNotFound, serial)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return revoked, nil
+}
+
+// CreateCRL creates a PEM-encoded CRL, signed by the CA, listing the revoked
+// certificates that have not expired yet.
+func (m *CertificateManager) CreateCRL(ctx context.Context) ([]byte, error) {
+	certs, err := m.ListCertificates(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ca, err := m.caManager.GetCA(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get CA: %w", err)
+	}
+
+	var entries []x509.RevocationListEntry
+	for _, cert := range certs {
+		if !cert.Revoked() {
+			continue
+		}
+		serial, ok := new(big.Int).SetString(cert.SerialNumber, 16)
+		if !ok {
+			m.log.Info("Skipping certificate with invalid serial number", "serial", cert.SerialNumber)
+			continue
+		}
+		entries = append(entries, x509.RevocationListEntry{
+			SerialNumber:   serial,
+			RevocationTime: *cert.RevokedAt,
+		})
+	}
+
+	now := time.Now()
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		// The CRL number must increase with every CRL the CA issues
+		Number:                    big.NewInt(now.UnixNano()),
+		ThisUpdate:                now,
+		NextUpdate:                now.Add(CRLValidity),
+		RevokedCertificateEntries: entries,
+	}, ca.Cert, ca.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CRL: %w", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}), nil
+}
+
+// PublishCRL writes the current CRL to a ConfigMap, e.g. for a pool's gateway
+// to mount. The ConfigMap is only updated when the revoked certificates have
+// changed or half of the published CRL's validity has passed, so reconciling
+// often does not restart the kubelet's volume sync.
+func (m *CertificateManager) PublishCRL(ctx context.Context, name, namespace string, labels map[string]string) error {
+	crlPEM, err := m.CreateCRL(ctx)
+	if err != nil {
+		return err
+	}
+
+	configMap := &corev1.ConfigMap{}
+	err = m.client.Get(ctx, client.ObjectKey{Name: name, Namespace: namespace}, configMap)
+	if apierrors.IsNotFound(err) {
+		configMap = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+				Labels:    labels,
+			},
+			Data: map[string]string{CRLKey: string(crlPEM)},
+		}
+		if err := m.client.Create(ctx, configMap); err != nil {
+			return fmt.Errorf("failed to create CRL configmap: %w", err)
+		}
+		m.log.Info("Published CRL", "configmap", name, "namespace", namespace)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get CRL configmap: %w", err)
+	}
+
+	if crlCurrent([]byte(configMap.Data[CRLKey]), crlPEM) {
+		return nil
+	}
+
+	patch := client.MergeFrom(configMap.DeepCopy())
+	if configMap.Data == nil {
+		configMap.Data = make(map[string]string)
+	}
+	configMap.Data[CRLKey] = string(crlPEM)
+	if err := m.client.Patch(ctx, configMap, patch); err != nil {
+		return fmt.Errorf("failed to update CRL configmap: %w", err)
+	}
+	m.log.Info("Published CRL", "configmap", name, "namespace", namespace)
+	return nil
+}
+
+// crlCurrent reports whether a published CRL revokes the same certificates as
+// a new one and is not yet halfway to its next update.
+func crlCurrent(publishedPEM, newPEM []byte) bool {
+	published, err := parseCRL(publishedPEM)
+	if err != nil {
+		return false
+	}
+	latest, err := parseCRL(newPEM)
+	if err != nil {
+		return false
+	}
+
+	if time.Until(published.NextUpdate) < CRLValidity/2 {
+		return false
+	}
+	if !bytes.Equal(published.AuthorityKeyId, latest.AuthorityKeyId) ||
+		len(published.RevokedCertificateEntries) != len(latest.RevokedCertificateEntries) {
+		return false
+	}
+	for i := range latest.RevokedCertificateEntries {
+		if published.RevokedCertificateEntries[i].SerialNumber.Cmp(latest.RevokedCertificateEntries[i].SerialNumber) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// parseCRL parses a PEM-encoded CRL.
+func parseCRL(crlPEM []byte) (*x509.RevocationList, error) {
+	block, _ := pem.Decode(crlPEM)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode CRL PEM")
+	}
+	return x509.ParseRevocationList(block.Bytes)
+}
+
+// inventoryName returns the name of the secret holding the certificate
+// inventory, next to the CA secret.
+func (m *CertificateManager) inventoryName() string {
+	return m.caManager.caName + "-issued"
+}
+
+func (m *CertificateManager) getInventory(ctx context.Context) (*corev1.Secret, error) {
+	secret := &corev1.Secret{}
+	err := m.client.Get(ctx, client.ObjectKey{Name: m.inventoryName(), Namespace: m.caManager.namespace}, secret)
+	if apierrors.IsNotFound(err) {
+		return &corev1.Secret{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get certificate inventory: %w", err)
+	}
+	return secret, nil
+}
+
+// updateInventory applies a change to the inventory, dropping expired
+// certificates. Concurrent updates are retried.
+func (m *CertificateManager) updateInventory(ctx context.Context, update func([]IssuedCertificate) ([]IssuedCertificate, error)) error {
+	retriable := func(err error) bool {
+		return apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err)
+	}
+
+	return retry.OnError(retry.DefaultRetry, retriable, func() error {
+		secret, err := m.getInventory(ctx)
+		if err != nil {
+			return err
+		}
+		certs, err := decodeInventory(secret)
+		if err != nil {
+			return err
+		}
+
+		certs, err = update(pruneExpired(certs, time.Now()))
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(certs)
+		if err != nil {
+			return fmt.Errorf("failed to encode certificate inventory: %w", err)
+		}
+
+		if secret.Name == "" {
+			secret = &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      m.inventoryName(),
+					Namespace: m.caManager.namespace,
+					Labels: map[string]string{
+						"app.kubernetes.io/name":       "buildkit-controller",
+						"app.kubernetes.io/component":  "certificate-inventory",
+						"app.kubernetes.io/managed-by": "buildkit-controller",
+					},
+				},
+				Type: corev1.SecretTypeOpaque,
+				Data: map[string][]byte{inventoryKey: data},
+			}
+			return m.client.Create(ctx, secret)
+		}
+
+		if secret.Data == nil {
+			secret.Data = make(map[string][]byte)
+		}
+		secret.Data[inventoryKey] = data
+		return m.client.Update(ctx, secret)
+	})
+}
+
+// decodeInventory reads the certificate list from the inventory secret.
+func decodeInventory(secret *corev1.Secret) ([]IssuedCertificate, error) {
+	data := secret.Data[inventoryKey]
+	if len(data) == 0 {
+		return nil, nil
+	}
+	var certs []IssuedCertificate
+	if err := json.Unmarshal(data, &certs); err != nil {
+		return nil, fmt.Errorf("failed to decode certificate inventory: %w", err)
+	}
+	return certs, nil
+}
+
+// pruneExpired drops expired certificates, which no longer need to be revoked,
+// and sorts the rest by issue time.
+func pruneExpired(certs []IssuedCertificate, now time.Time) []IssuedCertificate {
+	current := certs[:0]
+	for _, cert := range certs {
+		if now.Before(cert.NotAfter) {
+			current = append(current, cert)
+		}
+	}
+	sort.SliceStable(current, func(i, j int) bool {
+		return current[i].NotBefore.Before(current[j].NotBefore)
+	})
+	return current
+}
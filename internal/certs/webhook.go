@@ -0,0 +1,235 @@
+package certs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/smrt-devops/buildkit-controller/internal/utils"
+)
+
+const (
+	// WebhookCertFile is the serving certificate file in the webhook cert dir.
+	WebhookCertFile = "tls.crt"
+	// WebhookKeyFile is the serving key file in the webhook cert dir.
+	WebhookKeyFile = "tls.key"
+
+	// webhookRetryInterval is how long to wait before retrying a failed renewal.
+	webhookRetryInterval = time.Minute
+	// webhookServicePort is the port of the Service in front of the webhook server.
+	webhookServicePort = 443
+	// conversionPath is the path the webhook server serves CRD conversions on.
+	conversionPath = "/convert"
+)
+
+// WebhookCertConfig configures the serving certificate of the webhook server.
+type WebhookCertConfig struct {
+	// CertDir is the directory the webhook server reads its certificate from.
+	CertDir string
+	// ServiceName is the name of the Service in front of the webhook server.
+	ServiceName string
+	// Namespace is the namespace of the Service.
+	Namespace string
+	// ConfigurationName is the name of the mutating and validating webhook
+	// configurations the CA bundle is injected into. It is empty when the
+	// admission webhooks are disabled and only conversion is served.
+	ConfigurationName string
+	// ConversionCRDs are the names of the CRDs whose conversion webhook is
+	// pointed at the Service, with the CA bundle injected.
+	ConversionCRDs []string
+}
+
+//+kubebuilder:rbac:groups=admissionregistration.k8s.io,resources=mutatingwebhookconfigurations;validatingwebhookconfigurations,verbs=get;patch
+//+kubebuilder:rbac:groups=apiextensions.k8s.io,resources=customresourcedefinitions,resourceNames=buildkitpools.buildkit.smrt-devops.net,verbs=get;patch
+
+// WebhookCertManager issues the serving certificate of the webhook server from
+// the controller's CA and injects the CA into the webhook configurations and
+// conversion CRDs, so the webhooks need no external certificate tooling.
+type WebhookCertManager struct {
+	client      client.Client
+	certManager *CertificateManager
+	caManager   *CAManager
+	config      WebhookCertConfig
+	log         utils.Logger
+
+	renewalTime time.Time
+}
+
+// NewWebhookCertManager creates a new webhook certificate manager.
+func NewWebhookCertManager(k8sClient client.Client, certManager *CertificateManager, caManager *CAManager, config WebhookCertConfig, log utils.Logger) *WebhookCertManager {
+	return &WebhookCertManager{
+		client:      k8sClient,
+		certManager: certManager,
+		caManager:   caManager,
+		config:      config,
+		log:         log,
+	}
+}
+
+// Ensure issues a serving certificate into the cert dir and injects the CA into
+// the webhook configurations. It must succeed before the webhook server starts.
+func (m *WebhookCertManager) Ensure(ctx context.Context) error {
+	if _, err := m.caManager.EnsureCA(ctx); err != nil {
+		return fmt.Errorf("failed to ensure CA: %w", err)
+	}
+
+	service := fmt.Sprintf("%s.%s.svc", m.config.ServiceName, m.config.Namespace)
+	certPEM, keyPEM, info, err := m.certManager.IssueCertificate(ctx, &CertificateRequest{
+		CommonName: service,
+		DNSNames: []string{
+			m.config.ServiceName,
+			fmt.Sprintf("%s.%s", m.config.ServiceName, m.config.Namespace),
+			service,
+			service + ".cluster.local",
+		},
+		Organization: "BuildKit Controller",
+		IsServer:     true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to issue webhook serving certificate: %w", err)
+	}
+
+	if err := os.MkdirAll(m.config.CertDir, 0o700); err != nil {
+		return fmt.Errorf("failed to create webhook cert dir: %w", err)
+	}
+	// Write the key first; the webhook server reloads the pair when the certificate changes
+	if err := writeFileAtomic(filepath.Join(m.config.CertDir, WebhookKeyFile), keyPEM); err != nil {
+		return fmt.Errorf("failed to write webhook serving key: %w", err)
+	}
+	if err := writeFileAtomic(filepath.Join(m.config.CertDir, WebhookCertFile), certPEM); err != nil {
+		return fmt.Errorf("failed to write webhook serving certificate: %w", err)
+	}
+
+	caCertPEM, err := m.caManager.GetCACertPEM(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get CA cert: %w", err)
+	}
+	if err := m.injectCABundle(ctx, caCertPEM); err != nil {
+		return err
+	}
+	if err := m.injectConversion(ctx, caCertPEM); err != nil {
+		return err
+	}
+
+	m.renewalTime = info.RenewalTime
+	m.log.Info("Issued webhook serving certificate", "service", service, "expires", info.NotAfter)
+	return nil
+}
+
+// injectCABundle sets the CA bundle of every webhook in the mutating and
+// validating webhook configurations.
+func (m *WebhookCertManager) injectCABundle(ctx context.Context, caCertPEM []byte) error {
+	if m.config.ConfigurationName == "" {
+		return nil
+	}
+	key := client.ObjectKey{Name: m.config.ConfigurationName}
+
+	mutating := &admissionregistrationv1.MutatingWebhookConfiguration{}
+	if err := m.client.Get(ctx, key, mutating); err != nil {
+		return fmt.Errorf("failed to get mutating webhook configuration: %w", err)
+	}
+	patch := client.MergeFrom(mutating.DeepCopy())
+	for i := range mutating.Webhooks {
+		mutating.Webhooks[i].ClientConfig.CABundle = caCertPEM
+	}
+	if err := m.client.Patch(ctx, mutating, patch); err != nil {
+		return fmt.Errorf("failed to inject CA into mutating webhook configuration: %w", err)
+	}
+
+	validating := &admissionregistrationv1.ValidatingWebhookConfiguration{}
+	if err := m.client.Get(ctx, key, validating); err != nil {
+		return fmt.Errorf("failed to get validating webhook configuration: %w", err)
+	}
+	patch = client.MergeFrom(validating.DeepCopy())
+	for i := range validating.Webhooks {
+		validating.Webhooks[i].ClientConfig.CABundle = caCertPEM
+	}
+	if err := m.client.Patch(ctx, validating, patch); err != nil {
+		return fmt.Errorf("failed to inject CA into validating webhook configuration: %w", err)
+	}
+	return nil
+}
+
+// injectConversion points the conversion webhook of the conversion CRDs at
+// the Service and sets its CA bundle. The CRDs ship with the default Service,
+// so this also covers installs under another name or namespace.
+func (m *WebhookCertManager) injectConversion(ctx context.Context, caCertPEM []byte) error {
+	for _, name := range m.config.ConversionCRDs {
+		crd := &apiextensionsv1.CustomResourceDefinition{}
+		if err := m.client.Get(ctx, client.ObjectKey{Name: name}, crd); err != nil {
+			return fmt.Errorf("failed to get CRD %s: %w", name, err)
+		}
+
+		patch := client.MergeFrom(crd.DeepCopy())
+		path := conversionPath
+		port := int32(webhookServicePort)
+		crd.Spec.Conversion = &apiextensionsv1.CustomResourceConversion{
+			Strategy: apiextensionsv1.WebhookConverter,
+			Webhook: &apiextensionsv1.WebhookConversion{
+				ClientConfig: &apiextensionsv1.WebhookClientConfig{
+					Service: &apiextensionsv1.ServiceReference{
+						Namespace: m.config.Namespace,
+						Name:      m.config.ServiceName,
+						Path:      &path,
+						Port:      &port,
+					},
+					CABundle: caCertPEM,
+				},
+				ConversionReviewVersions: []string{"v1"},
+			},
+		}
+		if err := m.client.Patch(ctx, crd, patch); err != nil {
+			return fmt.Errorf("failed to inject CA into conversion webhook of CRD %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Start renews the serving certificate before it expires until the context is
+// canceled. It implements manager.Runnable.
+func (m *WebhookCertManager) Start(ctx context.Context) error {
+	for {
+		wait := time.Until(m.renewalTime)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+
+		if err := m.Ensure(ctx); err != nil {
+			m.log.Error(err, "Failed to renew webhook serving certificate")
+			m.renewalTime = time.Now().Add(webhookRetryInterval)
+		}
+	}
+}
+
+// NeedLeaderElection reports that every replica serves webhooks and renews its
+// own certificate. It implements manager.LeaderElectionRunnable.
+func (m *WebhookCertManager) NeedLeaderElection() bool {
+	return false
+}
+
+// writeFileAtomic replaces a file by renaming a temporary file over it, so
+// readers never see a partial file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
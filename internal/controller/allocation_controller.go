@@ -0,0 +1,353 @@
+package controller
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	buildkitv1alpha1 "github.com/smrt-devops/buildkit-controller/api/v1alpha1"
+	"github.com/smrt-devops/buildkit-controller/internal/api"
+	"github.com/smrt-devops/buildkit-controller/internal/metrics"
+	"github.com/smrt-devops/buildkit-controller/internal/utils"
+)
+
+const (
+	allocationFinalizer = "buildkit.smrt-devops.net/allocation-finalizer"
+
+	// allocationPollInterval is how often an allocation waiting for a worker is checked.
+	allocationPollInterval = 2 * time.Second
+	// allocationRetryInterval is the wait before a failed allocation is retried.
+	allocationRetryInterval = 30 * time.Second
+	// allocatorStartupInterval is the wait for the API server to start.
+	allocatorStartupInterval = 5 * time.Second
+)
+
+// Keys of the allocation Secret, matching the client certificate Secrets of pools.
+const (
+	AllocationSecretCACert     = "ca.crt"
+	AllocationSecretClientCert = "client.crt"
+	AllocationSecretClientKey  = "client.key"
+	AllocationSecretEndpoint   = "endpoint"
+)
+
+// Allocator allocates workers for BuildKitAllocations. It is implemented by the
+// API server, so allocations made through resources share the pool queues,
+// RBAC rules and quotas with allocations made through the API.
+type Allocator interface {
+	StartResourceAllocation(ctx context.Context, allocation *buildkitv1alpha1.BuildKitAllocation) (string, error)
+	ResourceAllocationStatus(requestID string) (api.AllocationStatus, error)
+	RenewResourceAllocation(ctx context.Context, allocationID string) (*api.ResourceLease, error)
+	ReleaseResourceAllocation(ctx context.Context, requestID, allocationID string) error
+}
+
+// BuildKitAllocationReconciler binds BuildKitAllocations to workers and writes
+// the client credentials into a Secret owned by the allocation.
+type BuildKitAllocationReconciler struct {
+	client.Client
+	Scheme    *runtime.Scheme
+	Log       utils.Logger
+	Allocator Allocator
+}
+
+//+kubebuilder:rbac:groups=buildkit.smrt-devops.net,resources=buildkitallocations,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=buildkit.smrt-devops.net,resources=buildkitallocations/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=buildkit.smrt-devops.net,resources=buildkitallocations/finalizers,verbs=update
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
+
+func (r *BuildKitAllocationReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
+	start := time.Now()
+	defer func() { metrics.ObserveReconcile("buildkitallocation", start, result, err) }()
+
+	log := r.Log.WithValues("allocation", req.NamespacedName)
+
+	allocation := &buildkitv1alpha1.BuildKitAllocation{}
+	if err := r.Get(ctx, req.NamespacedName, allocation); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	if !allocation.DeletionTimestamp.IsZero() {
+		return r.reconcileDelete(ctx, allocation, log)
+	}
+
+	if !controllerutil.ContainsFinalizer(allocation, allocationFinalizer) {
+		controllerutil.AddFinalizer(allocation, allocationFinalizer)
+		if err := r.Update(ctx, allocation); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{Requeue: true}, nil
+	}
+
+	switch allocation.Status.Phase {
+	case "", buildkitv1alpha1.AllocationPhasePending:
+		return r.reconcilePending(ctx, allocation, log)
+	case buildkitv1alpha1.AllocationPhaseQueued, buildkitv1alpha1.AllocationPhaseProvisioning:
+		return r.reconcileWaiting(ctx, allocation, log)
+	case buildkitv1alpha1.AllocationPhaseAllocated:
+		return r.reconcileAllocated(ctx, allocation, log)
+	default:
+		// Expired and Failed allocations are final; delete and recreate them to allocate again
+		return ctrl.Result{}, nil
+	}
+}
+
+func (r *BuildKitAllocationReconciler) reconcilePending(ctx context.Context, allocation *buildkitv1alpha1.BuildKitAllocation, log utils.Logger) (ctrl.Result, error) {
+	requestID, err := r.Allocator.StartResourceAllocation(ctx, allocation)
+	if errors.Is(err, api.ErrNotReady) {
+		return ctrl.Result{RequeueAfter: allocatorStartupInterval}, nil
+	}
+	if errors.Is(err, api.ErrInvalidAllocation) || errors.Is(err, api.ErrForbidden) {
+		log.Info("Worker allocation rejected", "reason", err.Error())
+		return r.updateStatus(ctx, allocation, buildkitv1alpha1.AllocationPhaseFailed, err.Error(), 0)
+	}
+	if err != nil {
+		log.Info("Failed to start worker allocation, retrying", "error", err.Error())
+		return r.updateStatus(ctx, allocation, buildkitv1alpha1.AllocationPhasePending, err.Error(), allocationRetryInterval)
+	}
+
+	log.Info("Requested worker", "pool", allocation.Spec.PoolRef.Name)
+	allocation.Status.RequestID = requestID
+	return r.updateStatus(ctx, allocation, buildkitv1alpha1.AllocationPhaseQueued, "Waiting for a worker", allocationPollInterval)
+}
+
+func (r *BuildKitAllocationReconciler) reconcileWaiting(ctx context.Context, allocation *buildkitv1alpha1.BuildKitAllocation, log utils.Logger) (ctrl.Result, error) {
+	status, err := r.Allocator.ResourceAllocationStatus(allocation.Status.RequestID)
+	if errors.Is(err, api.ErrNotReady) {
+		return ctrl.Result{RequeueAfter: allocatorStartupInterval}, nil
+	}
+	if errors.Is(err, api.ErrAllocationNotFound) {
+		log.Info("Worker allocation was interrupted, requesting again")
+		return r.updateStatus(ctx, allocation, buildkitv1alpha1.AllocationPhasePending, "Allocation was interrupted, retrying", 0)
+	}
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	switch status.State {
+	case api.AllocationQueued:
+		message := "Waiting for a worker"
+		if status.QueuePosition > 0 {
+			message = fmt.Sprintf("Waiting for a worker, position %d in queue", status.QueuePosition)
+		}
+		return r.updateStatus(ctx, allocation, buildkitv1alpha1.AllocationPhaseQueued, message, allocationPollInterval)
+	case api.AllocationProvisioning:
+		return r.updateStatus(ctx, allocation, buildkitv1alpha1.AllocationPhaseProvisioning, "Provisioning a worker", allocationPollInterval)
+	case api.AllocationFailed:
+		log.Info("Worker allocation failed, retrying", "reason", status.Message)
+		return r.updateStatus(ctx, allocation, buildkitv1alpha1.AllocationPhasePending, status.Message, allocationRetryInterval)
+	}
+
+	return r.bind(ctx, allocation, status.Allocation, log)
+}
+
+// bind writes the credentials of an allocated worker into the allocation's
+// Secret and records the worker in its status.
+func (r *BuildKitAllocationReconciler) bind(ctx context.Context, allocation *buildkitv1alpha1.BuildKitAllocation, response *api.WorkerAllocateResponse, log utils.Logger) (ctrl.Result, error) {
+	secret, err := allocationSecret(allocation, response)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := utils.SetControllerReference(allocation, secret, r.Scheme); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.writeSecret(ctx, allocation, secret); err != nil {
+		log.Error(err, "Failed to write allocation secret", "secret", secret.Name)
+		return r.updateStatus(ctx, allocation, allocation.Status.Phase, err.Error(), allocationRetryInterval)
+	}
+
+	now := metav1.Now()
+	allocation.Status.PoolName = response.PoolName
+	allocation.Status.WorkerName = response.WorkerName
+	allocation.Status.Platforms = response.Platforms
+	allocation.Status.SecretName = secret.Name
+	allocation.Status.GatewayEndpoint = response.GatewayEndpoint
+	allocation.Status.AllocatedAt = &now
+	if expiresAt, err := time.Parse(time.RFC3339, response.MaxExpiresAt); err == nil {
+		allocation.Status.ExpiresAt = &metav1.Time{Time: expiresAt}
+	}
+	allocation.Status.AllocationID = response.AllocationID
+
+	log.Info("Worker allocated", "worker", response.WorkerName, "pool", response.PoolName, "secret", secret.Name)
+	return r.updateStatus(ctx, allocation, buildkitv1alpha1.AllocationPhaseAllocated, "Worker allocated", heartbeatOf(response))
+}
+
+func (r *BuildKitAllocationReconciler) reconcileAllocated(ctx context.Context, allocation *buildkitv1alpha1.BuildKitAllocation, log utils.Logger) (ctrl.Result, error) {
+	lease, err := r.Allocator.RenewResourceAllocation(ctx, allocation.Status.AllocationID)
+	if errors.Is(err, api.ErrNotReady) {
+		return ctrl.Result{RequeueAfter: allocatorStartupInterval}, nil
+	}
+	if errors.Is(err, api.ErrAllocationNotFound) {
+		log.Info("Worker allocation ended", "worker", allocation.Status.WorkerName)
+		if err := r.deleteSecret(ctx, allocation); err != nil {
+			return ctrl.Result{}, err
+		}
+		return r.updateStatus(ctx, allocation, buildkitv1alpha1.AllocationPhaseExpired, "Allocation expired or was revoked", 0)
+	}
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	log.V(1).Info("Worker allocation renewed", "worker", allocation.Status.WorkerName, "expiresAt", lease.ExpiresAt)
+	return ctrl.Result{RequeueAfter: lease.RenewAfter + time.Second}, nil
+}
+
+func (r *BuildKitAllocationReconciler) reconcileDelete(ctx context.Context, allocation *buildkitv1alpha1.BuildKitAllocation, log utils.Logger) (ctrl.Result, error) {
+	if !controllerutil.ContainsFinalizer(allocation, allocationFinalizer) {
+		return ctrl.Result{}, nil
+	}
+
+	if allocation.Status.Phase != buildkitv1alpha1.AllocationPhaseExpired && allocation.Status.Phase != buildkitv1alpha1.AllocationPhaseFailed {
+		log.Info("Releasing worker", "worker", allocation.Status.WorkerName)
+		err := r.Allocator.ReleaseResourceAllocation(ctx, allocation.Status.RequestID, allocation.Status.AllocationID)
+		if errors.Is(err, api.ErrNotReady) {
+			return ctrl.Result{RequeueAfter: allocatorStartupInterval}, nil
+		}
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	controllerutil.RemoveFinalizer(allocation, allocationFinalizer)
+	if err := r.Update(ctx, allocation); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// writeSecret creates the allocation's Secret, or updates it if the allocation
+// already owns it. A Secret of the same name owned by anything else is left alone.
+func (r *BuildKitAllocationReconciler) writeSecret(ctx context.Context, allocation *buildkitv1alpha1.BuildKitAllocation, secret *corev1.Secret) error {
+	err := r.Create(ctx, secret)
+	if !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	existing := &corev1.Secret{}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(secret), existing); err != nil {
+		return err
+	}
+	if !metav1.IsControlledBy(existing, allocation) {
+		return fmt.Errorf("secret %s already exists and is not owned by the allocation", secret.Name)
+	}
+	existing.Labels = secret.Labels
+	existing.Data = secret.Data
+	return r.Update(ctx, existing)
+}
+
+// deleteSecret deletes the Secret of an allocation whose credentials are no
+// longer valid.
+func (r *BuildKitAllocationReconciler) deleteSecret(ctx context.Context, allocation *buildkitv1alpha1.BuildKitAllocation) error {
+	if allocation.Status.SecretName == "" {
+		return nil
+	}
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: allocation.Status.SecretName, Namespace: allocation.Namespace}, secret); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if !metav1.IsControlledBy(secret, allocation) {
+		return nil
+	}
+	return client.IgnoreNotFound(r.Delete(ctx, secret))
+}
+
+// updateStatus sets the phase and Ready condition of an allocation and requeues
+// it after requeueAfter, or right away if zero. Polls that change nothing skip
+// the update.
+func (r *BuildKitAllocationReconciler) updateStatus(ctx context.Context, allocation *buildkitv1alpha1.BuildKitAllocation, phase buildkitv1alpha1.AllocationPhase, message string, requeueAfter time.Duration) (ctrl.Result, error) {
+	result := ctrl.Result{RequeueAfter: requeueAfter}
+	if requeueAfter == 0 {
+		result = ctrl.Result{Requeue: true}
+	}
+	if allocation.Status.Phase == phase && allocation.Status.Message == message {
+		return result, nil
+	}
+
+	allocation.Status.Phase = phase
+	allocation.Status.Message = message
+
+	condition := metav1.Condition{
+		Type:               buildkitv1alpha1.AllocationConditionReady,
+		Status:             metav1.ConditionFalse,
+		Reason:             string(phase),
+		Message:            message,
+		ObservedGeneration: allocation.Generation,
+		LastTransitionTime: metav1.Now(),
+	}
+	if phase == buildkitv1alpha1.AllocationPhaseAllocated {
+		condition.Status = metav1.ConditionTrue
+	}
+	allocation.Status.Conditions = utils.UpdateCondition(allocation.Status.Conditions, condition)
+
+	if err := r.Status().Update(ctx, allocation); err != nil {
+		return ctrl.Result{}, err
+	}
+	return result, nil
+}
+
+// allocationSecret returns the Secret with the client credentials of an allocated worker.
+func allocationSecret(allocation *buildkitv1alpha1.BuildKitAllocation, response *api.WorkerAllocateResponse) (*corev1.Secret, error) {
+	data := map[string][]byte{
+		AllocationSecretEndpoint: []byte(response.GatewayEndpoint),
+	}
+	for key, encoded := range map[string]string{
+		AllocationSecretCACert:     response.CACert,
+		AllocationSecretClientCert: response.ClientCert,
+		AllocationSecretClientKey:  response.ClientKey,
+	} {
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", key, err)
+		}
+		data[key] = decoded
+	}
+
+	name := allocation.Spec.SecretName
+	if name == "" {
+		name = allocation.Name
+	}
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: allocation.Namespace,
+			Labels: utils.MergeLabels(
+				utils.DefaultLabels("allocation", response.PoolName),
+				map[string]string{"buildkit.smrt-devops.net/worker": response.WorkerName},
+			),
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: data,
+	}, nil
+}
+
+// heartbeatOf returns how long until an allocation's lease should be renewed.
+func heartbeatOf(response *api.WorkerAllocateResponse) time.Duration {
+	interval, err := time.ParseDuration(response.HeartbeatInterval)
+	if err != nil || interval <= 0 {
+		return allocationRetryInterval
+	}
+	return interval
+}
+
+func (r *BuildKitAllocationReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&buildkitv1alpha1.BuildKitAllocation{}).
+		Owns(&corev1.Secret{}).
+		Complete(r)
+}
@@ -166,6 +166,11 @@ func (r *Manager) cleanupResource(ctx context.Context, obj client.Object, resour
 func (r *Manager) reconcileGatewayDeploymentAndService(ctx context.Context, pool *buildkitv1alpha1.BuildKitPool, namespace string) (*appsv1.Deployment, *corev1.Service, error) {
 	gatewayImage := resources.GetGatewayImage(pool, r.defaultGatewayImage)
 
+	serviceAccount := resources.NewGatewayServiceAccount(pool)
+	if err := r.reconcileResource(ctx, serviceAccount, "gateway service account", pool); err != nil {
+		return nil, nil, err
+	}
+
 	deployment := resources.NewGatewayDeployment(pool, gatewayImage, r.controllerEndpoint)
 	if err := r.reconcileResource(ctx, deployment, "gateway deployment", pool); err != nil {
 		return nil, nil, err
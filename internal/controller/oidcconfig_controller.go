@@ -0,0 +1,257 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	buildkitv1alpha1 "github.com/smrt-devops/buildkit-controller/api/v1alpha1"
+	"github.com/smrt-devops/buildkit-controller/internal/auth"
+	"github.com/smrt-devops/buildkit-controller/internal/metrics"
+	"github.com/smrt-devops/buildkit-controller/internal/utils"
+)
+
+const (
+	// oidcRefreshInterval is how often the discovery document and keys of a ready issuer are fetched again.
+	oidcRefreshInterval = 10 * time.Minute
+	// oidcRetryInterval is the wait before a failed discovery or missing secret is checked again.
+	oidcRetryInterval = 30 * time.Second
+	// oidcDiscoveryTimeout bounds fetching the discovery document and keys of an issuer.
+	oidcDiscoveryTimeout = 10 * time.Second
+	// defaultOIDCClientSecretKey is the key of the client secret when clientSecretRef.key is unset.
+	defaultOIDCClientSecretKey = "client-secret"
+)
+
+// OIDCVerifierCache caches the verifiers of OIDC issuers. It is implemented by
+// the API server, so tokens are verified with the current configuration once
+// a BuildKitOIDCConfig changes.
+type OIDCVerifierCache interface {
+	InvalidateOIDCVerifiers(issuers ...string)
+}
+
+// observedOIDCConfig is the issuer and generation a BuildKitOIDCConfig was last reconciled with.
+type observedOIDCConfig struct {
+	issuer     string
+	generation int64
+}
+
+// BuildKitOIDCConfigReconciler checks that the issuers of BuildKitOIDCConfigs
+// can be discovered and their client secrets resolve, and invalidates the cached
+// verifiers of configs that change.
+type BuildKitOIDCConfigReconciler struct {
+	client.Client
+	Scheme    *runtime.Scheme
+	Log       utils.Logger
+	Verifiers OIDCVerifierCache
+
+	mu       sync.Mutex
+	observed map[types.NamespacedName]observedOIDCConfig
+}
+
+//+kubebuilder:rbac:groups=buildkit.smrt-devops.net,resources=buildkitoidcconfigs,verbs=get;list;watch
+//+kubebuilder:rbac:groups=buildkit.smrt-devops.net,resources=buildkitoidcconfigs/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+
+func (r *BuildKitOIDCConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
+	start := time.Now()
+	defer func() { metrics.ObserveReconcile("buildkitoidcconfig", start, result, err) }()
+
+	log := r.Log.WithValues("oidcConfig", req.NamespacedName)
+
+	config := &buildkitv1alpha1.BuildKitOIDCConfig{}
+	if err := r.Get(ctx, req.NamespacedName, config); err != nil {
+		if apierrors.IsNotFound(err) {
+			r.forget(req.NamespacedName, log)
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	r.invalidateIfChanged(req.NamespacedName, config, log)
+
+	if !config.Spec.Enabled {
+		return r.updateStatus(ctx, config, nil, buildkitv1alpha1.OIDCConfigReasonDisabled, "OIDC configuration is disabled", 0)
+	}
+
+	discoveryCtx, cancel := context.WithTimeout(ctx, oidcDiscoveryTimeout)
+	defer cancel()
+	discovery, err := auth.DiscoverOIDC(discoveryCtx, config.Spec.Issuer)
+	if err != nil {
+		log.Info("OIDC discovery failed", "issuer", config.Spec.Issuer, "error", err.Error())
+		return r.updateStatus(ctx, config, nil, buildkitv1alpha1.OIDCConfigReasonDiscoveryFailed, err.Error(), oidcRetryInterval)
+	}
+
+	missing, err := r.checkClientSecret(ctx, config)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if missing != "" {
+		log.Info("OIDC client secret is missing", "reason", missing)
+		return r.updateStatus(ctx, config, discovery, buildkitv1alpha1.OIDCConfigReasonSecretMissing, missing, oidcRetryInterval)
+	}
+
+	message := fmt.Sprintf("Discovered issuer with %d signing keys", discovery.Keys)
+	return r.updateStatus(ctx, config, discovery, buildkitv1alpha1.OIDCConfigReasonReady, message, oidcRefreshInterval)
+}
+
+// invalidateIfChanged invalidates the cached verifiers of a config whose spec
+// changed since it was last reconciled, including those of its previous issuer.
+func (r *BuildKitOIDCConfigReconciler) invalidateIfChanged(key types.NamespacedName, config *buildkitv1alpha1.BuildKitOIDCConfig, log utils.Logger) {
+	r.mu.Lock()
+	previous, seen := r.observed[key]
+	r.observed[key] = observedOIDCConfig{issuer: config.Spec.Issuer, generation: config.Generation}
+	r.mu.Unlock()
+
+	// Configs not seen since the controller started are compared with their status
+	changed := config.Status.ObservedGeneration != config.Generation
+	if seen {
+		changed = previous.generation != config.Generation
+	}
+	if !changed || r.Verifiers == nil {
+		return
+	}
+
+	issuers := []string{config.Spec.Issuer}
+	if seen && previous.issuer != config.Spec.Issuer {
+		issuers = append(issuers, previous.issuer)
+	}
+	log.Info("OIDC configuration changed, invalidating cached verifiers", "issuers", issuers)
+	r.Verifiers.InvalidateOIDCVerifiers(issuers...)
+}
+
+// forget invalidates the cached verifiers of a deleted config.
+func (r *BuildKitOIDCConfigReconciler) forget(key types.NamespacedName, log utils.Logger) {
+	r.mu.Lock()
+	previous, seen := r.observed[key]
+	delete(r.observed, key)
+	r.mu.Unlock()
+
+	if !seen || r.Verifiers == nil {
+		return
+	}
+	log.Info("OIDC configuration deleted, invalidating cached verifiers", "issuer", previous.issuer)
+	r.Verifiers.InvalidateOIDCVerifiers(previous.issuer)
+}
+
+// checkClientSecret returns why the client secret of a config does not
+// resolve, or an empty string if it does or none is set.
+func (r *BuildKitOIDCConfigReconciler) checkClientSecret(ctx context.Context, config *buildkitv1alpha1.BuildKitOIDCConfig) (string, error) {
+	ref := config.Spec.ClientSecretRef
+	if ref == nil {
+		return "", nil
+	}
+
+	key := types.NamespacedName{Name: ref.Name, Namespace: ref.Namespace}
+	if key.Namespace == "" {
+		key.Namespace = config.Namespace
+	}
+	dataKey := ref.Key
+	if dataKey == "" {
+		dataKey = defaultOIDCClientSecretKey
+	}
+
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, key, secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			return fmt.Sprintf("Client secret %s not found", key), nil
+		}
+		return "", err
+	}
+	if len(secret.Data[dataKey]) == 0 {
+		return fmt.Sprintf("Client secret %s has no key %q", key, dataKey), nil
+	}
+	return "", nil
+}
+
+// updateStatus sets the Ready condition of a config, and its key set and refresh
+// time if it was discovered, and requeues it after requeueAfter, or not at all if
+// zero. Reconciles that change nothing skip the update.
+func (r *BuildKitOIDCConfigReconciler) updateStatus(ctx context.Context, config *buildkitv1alpha1.BuildKitOIDCConfig, discovery *auth.OIDCDiscovery, reason, message string, requeueAfter time.Duration) (ctrl.Result, error) {
+	result := ctrl.Result{RequeueAfter: requeueAfter}
+	previous := config.Status.DeepCopy()
+
+	config.Status.Ready = reason == buildkitv1alpha1.OIDCConfigReasonReady
+	config.Status.Message = message
+	config.Status.ObservedGeneration = config.Generation
+	if discovery != nil {
+		now := metav1.Now()
+		config.Status.JWKSURI = discovery.JWKSURI
+		config.Status.LastRefreshTime = &now
+	}
+
+	condition := metav1.Condition{
+		Type:               buildkitv1alpha1.OIDCConfigConditionReady,
+		Status:             metav1.ConditionFalse,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: config.Generation,
+		LastTransitionTime: metav1.Now(),
+	}
+	if config.Status.Ready {
+		condition.Status = metav1.ConditionTrue
+	}
+	config.Status.Conditions = utils.UpdateCondition(config.Status.Conditions, condition)
+
+	if apiequality.Semantic.DeepEqual(previous, &config.Status) {
+		return result, nil
+	}
+	if err := r.Status().Update(ctx, config); err != nil {
+		return ctrl.Result{}, err
+	}
+	return result, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *BuildKitOIDCConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.observed = make(map[types.NamespacedName]observedOIDCConfig)
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&buildkitv1alpha1.BuildKitOIDCConfig{}).
+		Watches(
+			&corev1.Secret{},
+			handler.EnqueueRequestsFromMapFunc(r.secretToConfigsMapper),
+		).
+		Complete(r)
+}
+
+// secretToConfigsMapper maps a Secret to the BuildKitOIDCConfigs using it as their client secret.
+func (r *BuildKitOIDCConfigReconciler) secretToConfigsMapper(ctx context.Context, obj client.Object) []reconcile.Request {
+	configs := &buildkitv1alpha1.BuildKitOIDCConfigList{}
+	if err := r.List(ctx, configs); err != nil {
+		r.Log.Error(err, "Failed to list OIDC configs for secret", "secret", client.ObjectKeyFromObject(obj))
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for i := range configs.Items {
+		ref := configs.Items[i].Spec.ClientSecretRef
+		if ref == nil || ref.Name != obj.GetName() {
+			continue
+		}
+		namespace := ref.Namespace
+		if namespace == "" {
+			namespace = configs.Items[i].Namespace
+		}
+		if namespace != obj.GetNamespace() {
+			continue
+		}
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      configs.Items[i].Name,
+				Namespace: configs.Items[i].Namespace,
+			},
+		})
+	}
+	return requests
+}
@@ -3,9 +3,12 @@ package controller
 import (
 	"context"
 	"fmt"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -21,6 +24,7 @@ import (
 	statusupdater "github.com/smrt-devops/buildkit-controller/internal/controller/status"
 	tlsmanager "github.com/smrt-devops/buildkit-controller/internal/controller/tls"
 	workermanager "github.com/smrt-devops/buildkit-controller/internal/controller/worker"
+	"github.com/smrt-devops/buildkit-controller/internal/metrics"
 	"github.com/smrt-devops/buildkit-controller/internal/utils"
 )
 
@@ -47,24 +51,40 @@ type BuildKitPoolReconciler struct {
 //+kubebuilder:rbac:groups=buildkit.smrt-devops.net,resources=buildkitpools/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=buildkit.smrt-devops.net,resources=buildkitpools/finalizers,verbs=update
 //+kubebuilder:rbac:groups=buildkit.smrt-devops.net,resources=buildkitworkers,verbs=get;list;watch
+//+kubebuilder:rbac:groups=buildkit.smrt-devops.net,resources=buildkitpoolclasses,verbs=get;list;watch
 //+kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=serviceaccounts,verbs=get;list;watch;create;update;patch;delete
 
 // Reconcile is part of the main kubernetes reconciliation loop.
-func (r *BuildKitPoolReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+func (r *BuildKitPoolReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
+	start := time.Now()
+	defer func() { metrics.ObserveReconcile("buildkitpool", start, result, err) }()
+
 	log := r.Log.WithValues("buildkitpool", req.NamespacedName)
 
 	// Fetch the BuildKitPool instance
 	pool := &buildkitv1alpha1.BuildKitPool{}
 	if err := r.Get(ctx, req.NamespacedName, pool); err != nil {
+		if apierrors.IsNotFound(err) {
+			// Stop reporting workers of deleted pools
+			metrics.WorkersTotal.DeletePartialMatch(prometheus.Labels{"pool": req.Name, "namespace": req.Namespace})
+		}
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
 	// Set defaults on a copy to avoid modifying the original object
 	// This prevents conflicts when updating status
 	poolWithDefaults := pool.DeepCopy()
+	overridden, err := shared.ApplyPoolClass(ctx, r.Client, poolWithDefaults)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if len(overridden) > 0 {
+		log.Info("Pool overrides fields locked by its class, using the class values", "class", pool.Spec.ClassName, "fields", overridden)
+	}
 	r.setDefaults(poolWithDefaults)
 
 	// Initialize domain managers if not already done
@@ -145,6 +165,8 @@ func (r *BuildKitPoolReconciler) setDefaults(pool *buildkitv1alpha1.BuildKitPool
 
 	// Set gateway defaults
 	// Gateway.Enabled defaults to true per the API definition (+kubebuilder:default=true)
+	// The defaulting webhook persists it along with gateway.replicas, so this only
+	// applies to pools admitted without webhooks or defaulted by a pool class
 	// Since bool zero value is false, we need to check if gateway config was provided
 	// If any gateway field is set (other than Enabled), we assume the user provided gateway config
 	// Otherwise, we default Enabled to true
@@ -152,6 +174,7 @@ func (r *BuildKitPoolReconciler) setDefaults(pool *buildkitv1alpha1.BuildKitPool
 		pool.Spec.Gateway.Resources != nil ||
 		pool.Spec.Gateway.TokenTTL != "" ||
 		pool.Spec.Gateway.MaxTokenTTL != "" ||
+		pool.Spec.Gateway.IdleLeaseTimeout != "" ||
 		pool.Spec.Gateway.ServiceType != "" ||
 		pool.Spec.Gateway.Port != nil ||
 		pool.Spec.Gateway.NodePort != nil ||
@@ -196,9 +219,36 @@ func (r *BuildKitPoolReconciler) SetupWithManager(mgr ctrl.Manager) error {
 			&buildkitv1alpha1.BuildKitWorker{},
 			handler.EnqueueRequestsFromMapFunc(r.workerToPoolMapper),
 		).
+		Watches(
+			&buildkitv1alpha1.BuildKitPoolClass{},
+			handler.EnqueueRequestsFromMapFunc(r.classToPoolsMapper),
+		).
 		Complete(r)
 }
 
+// classToPoolsMapper maps a BuildKitPoolClass to the BuildKitPools referencing it for reconciliation.
+func (r *BuildKitPoolReconciler) classToPoolsMapper(ctx context.Context, obj client.Object) []reconcile.Request {
+	pools := &buildkitv1alpha1.BuildKitPoolList{}
+	if err := r.List(ctx, pools); err != nil {
+		r.Log.Error(err, "Failed to list pools for pool class", "class", obj.GetName())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for i := range pools.Items {
+		if pools.Items[i].Spec.ClassName != obj.GetName() {
+			continue
+		}
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      pools.Items[i].Name,
+				Namespace: pools.Items[i].Namespace,
+			},
+		})
+	}
+	return requests
+}
+
 // workerToPoolMapper maps a BuildKitWorker to its parent BuildKitPool for reconciliation.
 func (r *BuildKitPoolReconciler) workerToPoolMapper(ctx context.Context, obj client.Object) []reconcile.Request {
 	worker, ok := obj.(*buildkitv1alpha1.BuildKitWorker)
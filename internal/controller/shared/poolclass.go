@@ -0,0 +1,145 @@
+package shared
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	buildkitv1alpha1 "github.com/smrt-devops/buildkit-controller/api/v1alpha1"
+)
+
+// ApplyPoolClass merges the defaults of the BuildKitPoolClass the pool references
+// under its spec. Fields the pool sets keep their value, except for fields the
+// class locks, which always take the class's value. Which fields the pool sets
+// is read from the pool as stored in the API server, fetched as unstructured, so
+// a pool can set false, 0 or "" over a class default. It returns the locked fields
+// the pool tried to override. Pools without a class are left unchanged.
+func ApplyPoolClass(ctx context.Context, c client.Reader, pool *buildkitv1alpha1.BuildKitPool) ([]string, error) {
+	if pool.Spec.ClassName == "" {
+		return nil, nil
+	}
+
+	stored := &unstructured.Unstructured{}
+	stored.SetGroupVersionKind(buildkitv1alpha1.GroupVersion.WithKind("BuildKitPool"))
+	if err := c.Get(ctx, client.ObjectKeyFromObject(pool), stored); err != nil {
+		return nil, fmt.Errorf("failed to get pool %s/%s: %w", pool.Namespace, pool.Name, err)
+	}
+	spec, _, err := unstructured.NestedMap(stored.Object, "spec")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spec of pool %s/%s: %w", pool.Namespace, pool.Name, err)
+	}
+	return ApplyPoolClassToSpec(ctx, c, pool, spec)
+}
+
+// ApplyPoolClassToSpec is ApplyPoolClass for a pool whose spec is given as
+// unstructured, e.g. from an admission request for a pool not stored yet.
+func ApplyPoolClassToSpec(ctx context.Context, c client.Reader, pool *buildkitv1alpha1.BuildKitPool, spec map[string]interface{}) ([]string, error) {
+	if pool.Spec.ClassName == "" {
+		return nil, nil
+	}
+
+	class := &buildkitv1alpha1.BuildKitPoolClass{}
+	if err := c.Get(ctx, types.NamespacedName{Name: pool.Spec.ClassName}, class); err != nil {
+		return nil, fmt.Errorf("failed to get pool class %s: %w", pool.Spec.ClassName, err)
+	}
+
+	merged, overridden, err := mergePoolClass(spec, class)
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply pool class %s: %w", class.Name, err)
+	}
+	merged.ClassName = pool.Spec.ClassName
+	pool.Spec = *merged
+	return overridden, nil
+}
+
+// mergePoolClass returns the spec with the class's defaults merged under it and
+// its locked fields set, along with the locked fields the spec overrides.
+// Specs are merged as JSON: fields the spec leaves out or sets to null take the
+// class's value, and lists are replaced as a whole.
+func mergePoolClass(spec map[string]interface{}, class *buildkitv1alpha1.BuildKitPoolClass) (*buildkitv1alpha1.BuildKitPoolSpec, []string, error) {
+	defaults, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&class.Spec.Defaults)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to convert class defaults: %w", err)
+	}
+	delete(defaults, "className")
+
+	merged := runtime.DeepCopyJSON(spec)
+	if merged == nil {
+		merged = map[string]interface{}{}
+	}
+	mergeDefaults(merged, defaults)
+
+	var overridden []string
+	for _, field := range class.Spec.LockedFields {
+		path := strings.Split(field, ".")
+		locked, lockedFound, err := unstructured.NestedFieldNoCopy(defaults, path...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid locked field %s: %w", field, err)
+		}
+		if value, found, _ := unstructured.NestedFieldNoCopy(spec, path...); found && value != nil && !sameValue(path, value, locked) {
+			overridden = append(overridden, field)
+		}
+
+		if !lockedFound {
+			unstructured.RemoveNestedField(merged, path...)
+			continue
+		}
+		if err := unstructured.SetNestedField(merged, runtime.DeepCopyJSONValue(locked), path...); err != nil {
+			return nil, nil, fmt.Errorf("invalid locked field %s: %w", field, err)
+		}
+	}
+
+	result := &buildkitv1alpha1.BuildKitPoolSpec{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(merged, result); err != nil {
+		return nil, nil, fmt.Errorf("failed to convert merged pool spec: %w", err)
+	}
+	return result, overridden, nil
+}
+
+// mergeDefaults sets every field of defaults that values leaves out, merging
+// nested objects field by field.
+func mergeDefaults(values, defaults map[string]interface{}) {
+	for key, def := range defaults {
+		value, ok := values[key]
+		if !ok || value == nil {
+			values[key] = runtime.DeepCopyJSONValue(def)
+			continue
+		}
+		nested, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if nestedDefaults, ok := def.(map[string]interface{}); ok {
+			mergeDefaults(nested, nestedDefaults)
+		}
+	}
+}
+
+// sameValue reports whether two values of a spec field decode to the same
+// value, so e.g. quantities or numbers written differently compare equal.
+func sameValue(path []string, a, b interface{}) bool {
+	normalized := make([]interface{}, 0, 2)
+	for _, value := range []interface{}{a, b} {
+		object := map[string]interface{}{}
+		if err := unstructured.SetNestedField(object, runtime.DeepCopyJSONValue(value), path...); err != nil {
+			return reflect.DeepEqual(a, b)
+		}
+		spec := &buildkitv1alpha1.BuildKitPoolSpec{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(object, spec); err != nil {
+			return reflect.DeepEqual(a, b)
+		}
+		decoded, err := runtime.DefaultUnstructuredConverter.ToUnstructured(spec)
+		if err != nil {
+			return reflect.DeepEqual(a, b)
+		}
+		field, _, _ := unstructured.NestedFieldNoCopy(decoded, path...)
+		normalized = append(normalized, field)
+	}
+	return reflect.DeepEqual(normalized[0], normalized[1])
+}
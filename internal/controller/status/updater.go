@@ -11,6 +11,7 @@ import (
 
 	buildkitv1alpha1 "github.com/smrt-devops/buildkit-controller/api/v1alpha1"
 	"github.com/smrt-devops/buildkit-controller/internal/controller/shared"
+	"github.com/smrt-devops/buildkit-controller/internal/metrics"
 	"github.com/smrt-devops/buildkit-controller/internal/resources"
 	"github.com/smrt-devops/buildkit-controller/internal/utils"
 )
@@ -36,6 +37,9 @@ func (r *Updater) updateStatus(ctx context.Context, pool *buildkitv1alpha1.Build
 	if err := r.client.Get(ctx, types.NamespacedName{Name: pool.Name, Namespace: namespace}, latestPool); err != nil {
 		return fmt.Errorf("failed to fetch latest pool: %w", err)
 	}
+	if _, err := shared.ApplyPoolClass(ctx, r.client, latestPool); err != nil {
+		return err
+	}
 
 	r.initializeStatusFields(latestPool)
 	originalStatus := latestPool.Status.DeepCopy()
@@ -227,6 +231,7 @@ func (r *Updater) updateWorkerStatus(ctx context.Context, pool *buildkitv1alpha1
 	}
 
 	r.countWorkersByPhase(workerList, pool)
+	recordWorkerMetrics(pool, namespace)
 
 	if pool.Status.Workers.Allocated > 0 {
 		now := metav1.Now()
@@ -256,6 +261,20 @@ func (r *Updater) countWorkersByPhase(workerList *buildkitv1alpha1.BuildKitWorke
 	}
 }
 
+// recordWorkerMetrics exports the pool's worker counts by status.
+func recordWorkerMetrics(pool *buildkitv1alpha1.BuildKitPool, namespace string) {
+	workers := pool.Status.Workers
+	for status, count := range map[string]int32{
+		"idle":         workers.Idle,
+		"allocated":    workers.Allocated,
+		"running":      workers.Ready - workers.Idle - workers.Allocated,
+		"provisioning": workers.Provisioning,
+		"failed":       workers.Failed,
+	} {
+		metrics.WorkersTotal.WithLabelValues(pool.Name, namespace, status).Set(float64(count))
+	}
+}
+
 func (r *Updater) updateEndpoint(pool *buildkitv1alpha1.BuildKitPool, namespace string) {
 	port := shared.DefaultGatewayPort
 	if pool.Spec.Gateway.Port != nil {
@@ -1,6 +1,7 @@
 package tls
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"net"
@@ -16,6 +17,7 @@ import (
 	buildkitv1alpha1 "github.com/smrt-devops/buildkit-controller/api/v1alpha1"
 	"github.com/smrt-devops/buildkit-controller/internal/certs"
 	"github.com/smrt-devops/buildkit-controller/internal/controller/shared"
+	"github.com/smrt-devops/buildkit-controller/internal/metrics"
 	"github.com/smrt-devops/buildkit-controller/internal/utils"
 )
 
@@ -76,6 +78,48 @@ func (r *Manager) reconcileTLS(ctx context.Context, pool *buildkitv1alpha1.Build
 		}
 	}
 
+	if err := r.reconcileCRL(ctx, pool, namespace); err != nil {
+		return fmt.Errorf("failed to publish CRL: %w", err)
+	}
+
+	return nil
+}
+
+// reconcileCRL publishes the client certificate revocation list for the pool's
+// gateway, and keeps the CA certificate the gateway verifies it with current.
+func (r *Manager) reconcileCRL(ctx context.Context, pool *buildkitv1alpha1.BuildKitPool, namespace string) error {
+	crlName := shared.GenerateResourceName(pool.Name, "crl")
+	if err := r.certManager.PublishCRL(ctx, crlName, namespace, utils.DefaultLabels("crl", pool.Name)); err != nil {
+		return err
+	}
+
+	configMap := &corev1.ConfigMap{}
+	if err := r.client.Get(ctx, types.NamespacedName{Name: crlName, Namespace: namespace}, configMap); err == nil {
+		if err := utils.SetOwnerReference(ctx, r.client, pool, configMap, r.scheme); err != nil {
+			return err
+		}
+	}
+
+	// CAs created before CRL support are re-signed with CRL signing, which the
+	// gateway needs to find in its CA certificate to verify the CRL
+	caCertPEM, err := r.caManager.GetCACertPEM(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get CA cert: %w", err)
+	}
+	secret := &corev1.Secret{}
+	secretName := shared.GenerateResourceName(pool.Name, "tls")
+	if err := r.client.Get(ctx, types.NamespacedName{Name: secretName, Namespace: namespace}, secret); err != nil {
+		return clientutil.IgnoreNotFound(err)
+	}
+	if bytes.Equal(secret.Data["ca.crt"], caCertPEM) {
+		return nil
+	}
+	patch := clientutil.MergeFrom(secret.DeepCopy())
+	secret.Data["ca.crt"] = caCertPEM
+	if err := r.client.Patch(ctx, secret, patch); err != nil {
+		return fmt.Errorf("failed to update CA certificate in %s: %w", secretName, err)
+	}
+	r.log.Info("Updated CA certificate", "secret", secretName)
 	return nil
 }
 
@@ -91,6 +135,7 @@ func (r *Manager) updateStatusFromExistingCert(ctx context.Context, pool *buildk
 		NotAfter:    &metav1.Time{Time: existingInfo.NotAfter},
 		RenewalTime: &metav1.Time{Time: existingInfo.RenewalTime},
 	}
+	metrics.CertificateExpirations.WithLabelValues(pool.Name, "server").Set(float64(existingInfo.NotAfter.Unix()))
 }
 
 func (r *Manager) setOwnerReference(ctx context.Context, secretName, namespace string, owner client.Object) error {
@@ -159,6 +204,7 @@ func (r *Manager) issueServerCertificate(ctx context.Context, pool *buildkitv1al
 		NotAfter:    &metav1.Time{Time: certInfo.NotAfter},
 		RenewalTime: &metav1.Time{Time: certInfo.RenewalTime},
 	}
+	metrics.CertificateExpirations.WithLabelValues(pool.Name, "server").Set(float64(certInfo.NotAfter.Unix()))
 
 	r.log.Info("Issued server certificate", "secret", secretName)
 	return nil
@@ -168,7 +214,7 @@ func (r *Manager) issueClientCertificate(ctx context.Context, pool *buildkitv1al
 	clientSecretName := shared.GenerateResourceName(pool.Name, "client-certs")
 	duration := GetCertDuration(pool)
 
-	clientCertPEM, clientKeyPEM, _, err := r.certManager.IssueCertificate(ctx, &certs.CertificateRequest{
+	clientCertPEM, clientKeyPEM, certInfo, err := r.certManager.IssueCertificate(ctx, &certs.CertificateRequest{
 		CommonName:   shared.GenerateClientCertCommonName(pool.Name),
 		Organization: "BuildKit Client",
 		Duration:     duration,
@@ -182,6 +228,8 @@ func (r *Manager) issueClientCertificate(ctx context.Context, pool *buildkitv1al
 		return err
 	}
 
+	metrics.CertificateExpirations.WithLabelValues(pool.Name, "client").Set(float64(certInfo.NotAfter.Unix()))
+
 	r.log.Info("Issued client certificate", "secret", clientSecretName)
 	return nil
 }
@@ -213,6 +261,8 @@ func (r *Manager) issueWorkerServerCertificate(ctx context.Context, pool *buildk
 		return err
 	}
 
+	metrics.CertificateExpirations.WithLabelValues(pool.Name, "worker").Set(float64(certInfo.NotAfter.Unix()))
+
 	r.log.Info("Issued worker server certificate", "secret", workerSecretName, "expires", certInfo.NotAfter.Format(time.RFC3339))
 	return nil
 }
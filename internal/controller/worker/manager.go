@@ -12,6 +12,8 @@ import (
 
 	buildkitv1alpha1 "github.com/smrt-devops/buildkit-controller/api/v1alpha1"
 	"github.com/smrt-devops/buildkit-controller/internal/controller/shared"
+	"github.com/smrt-devops/buildkit-controller/internal/metrics"
+	"github.com/smrt-devops/buildkit-controller/internal/resources"
 	"github.com/smrt-devops/buildkit-controller/internal/utils"
 )
 
@@ -48,10 +50,61 @@ func (r *Manager) reconcileWorkers(ctx context.Context, pool *buildkitv1alpha1.B
 	r.cleanupStuckWorkers(ctx, categories.StuckWorkers)
 
 	if shouldScaleToZero {
-		return r.scaleDownToZero(ctx, categories.IdleWorkers)
+		return r.scaleDownToZero(ctx, pool, categories.IdleWorkers)
 	}
 
-	return r.ensureMinimumWorkers(ctx, pool, namespace, categories, provisioningWorkers)
+	if resources.HasWarmSizes(pool) {
+		return r.ensureMinimumWorkersPerSize(ctx, pool, namespace, workerList, categories)
+	}
+
+	minIdleWorkers := int32(0)
+	if pool.Spec.Scaling.Min != nil {
+		minIdleWorkers = *pool.Spec.Scaling.Min
+	}
+	size, _ := resources.FindWorkerSize(pool, "")
+	return r.ensureMinimumWorkers(ctx, pool, namespace, categories.IdleWorkers, provisioningWorkers, categories.AllocatedWorkers, minIdleWorkers, size)
+}
+
+// ensureMinimumWorkersPerSize keeps the warm workers of each size that sets min.
+func (r *Manager) ensureMinimumWorkersPerSize(ctx context.Context, pool *buildkitv1alpha1.BuildKitPool, namespace string, workerList *buildkitv1alpha1.BuildKitWorkerList, categories shared.WorkerCategories) error {
+	stuck := make(map[string]bool, len(categories.StuckWorkers))
+	for _, worker := range categories.StuckWorkers {
+		stuck[worker.Name] = true
+	}
+
+	for i := range pool.Spec.Sizes {
+		size := &pool.Spec.Sizes[i]
+		if size.Min == nil {
+			continue
+		}
+
+		var idleWorkers []*buildkitv1alpha1.BuildKitWorker
+		for _, worker := range categories.IdleWorkers {
+			if worker.Spec.Size == size.Name {
+				idleWorkers = append(idleWorkers, worker)
+			}
+		}
+		provisioningWorkers, allocatedWorkers := int32(0), int32(0)
+		for j := range workerList.Items {
+			worker := &workerList.Items[j]
+			if worker.Spec.Size != size.Name {
+				continue
+			}
+			switch worker.Status.Phase {
+			case buildkitv1alpha1.WorkerPhasePending, buildkitv1alpha1.WorkerPhaseProvisioning:
+				if !stuck[worker.Name] {
+					provisioningWorkers++
+				}
+			case buildkitv1alpha1.WorkerPhaseAllocated:
+				allocatedWorkers++
+			}
+		}
+
+		if err := r.ensureMinimumWorkers(ctx, pool, namespace, idleWorkers, provisioningWorkers, allocatedWorkers, *size.Min, size); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (r *Manager) checkScaleDownSchedule(pool *buildkitv1alpha1.BuildKitPool) bool {
@@ -88,25 +141,25 @@ func (r *Manager) cleanupStuckWorkers(ctx context.Context, stuckWorkers []*build
 	shared.DeleteWorkers(ctx, r.client, stuckWorkers, r.log, "Cleaning up stuck worker, will be recreated")
 }
 
-func (r *Manager) scaleDownToZero(ctx context.Context, idleWorkers []*buildkitv1alpha1.BuildKitWorker) error {
+func (r *Manager) scaleDownToZero(ctx context.Context, pool *buildkitv1alpha1.BuildKitPool, idleWorkers []*buildkitv1alpha1.BuildKitWorker) error {
+	if len(idleWorkers) == 0 {
+		return nil
+	}
 	shared.DeleteWorkers(ctx, r.client, idleWorkers, r.log, "Deleting idle worker due to scale-down schedule")
+	metrics.ScaleOperationsTotal.WithLabelValues(pool.Name, "scale_to_zero").Inc()
 	return nil
 }
 
-func (r *Manager) ensureMinimumWorkers(ctx context.Context, pool *buildkitv1alpha1.BuildKitPool, namespace string, categories shared.WorkerCategories, provisioningWorkers int32) error {
-	minIdleWorkers := int32(0)
-	if pool.Spec.Scaling.Min != nil {
-		minIdleWorkers = *pool.Spec.Scaling.Min
-	}
-
+// ensureMinimumWorkers keeps minIdleWorkers idle workers, creating new ones with the given size.
+func (r *Manager) ensureMinimumWorkers(ctx context.Context, pool *buildkitv1alpha1.BuildKitPool, namespace string, idleWorkers []*buildkitv1alpha1.BuildKitWorker, provisioningWorkers, allocatedWorkers, minIdleWorkers int32, size *buildkitv1alpha1.WorkerSize) error {
 	if minIdleWorkers == 0 {
 		return nil
 	}
 
-	idleCount := int32(len(categories.IdleWorkers))
+	idleCount := int32(len(idleWorkers))
 	idleWorkersToKeep := minIdleWorkers
 	if idleCount > idleWorkersToKeep {
-		if err := r.scaleDownExcessIdleWorkers(ctx, pool, categories.IdleWorkers, idleCount-idleWorkersToKeep); err != nil {
+		if err := r.scaleDownExcessIdleWorkers(ctx, pool, idleWorkers, idleCount-idleWorkersToKeep); err != nil {
 			return err
 		}
 		idleCount = idleWorkersToKeep
@@ -115,7 +168,7 @@ func (r *Manager) ensureMinimumWorkers(ctx context.Context, pool *buildkitv1alph
 	currentIdlePlusProvisioning := idleCount + provisioningWorkers
 	workersToCreate := minIdleWorkers - currentIdlePlusProvisioning
 	if workersToCreate > 0 {
-		return r.createWorkers(ctx, pool, namespace, workersToCreate, idleCount, provisioningWorkers, categories.AllocatedWorkers)
+		return r.createWorkers(ctx, pool, namespace, workersToCreate, idleCount, provisioningWorkers, allocatedWorkers, minIdleWorkers, size)
 	}
 
 	return nil
@@ -145,6 +198,7 @@ func (r *Manager) scaleDownExcessIdleWorkers(ctx context.Context, pool *buildkit
 			r.log.Error(err, "Failed to delete excess worker", "worker", worker.Name)
 		}
 	}
+	metrics.ScaleOperationsTotal.WithLabelValues(pool.Name, "scale_down").Inc()
 
 	return nil
 }
@@ -161,15 +215,19 @@ func (r *Manager) createWorkerWithOwner(ctx context.Context, pool *buildkitv1alp
 	return nil
 }
 
-func (r *Manager) createWorkers(ctx context.Context, pool *buildkitv1alpha1.BuildKitPool, namespace string, workersToCreate, idleCount, provisioningWorkers, allocatedWorkers int32) error {
+func (r *Manager) createWorkers(ctx context.Context, pool *buildkitv1alpha1.BuildKitPool, namespace string, workersToCreate, idleCount, provisioningWorkers, allocatedWorkers, minIdleWorkers int32, size *buildkitv1alpha1.WorkerSize) error {
 	r.log.Info("Creating workers to maintain minimum idle workers",
 		"pool", pool.Name,
-		"minIdle", *pool.Spec.Scaling.Min,
+		"size", resources.WorkerSizeName(size),
+		"minIdle", minIdleWorkers,
 		"currentIdle", idleCount,
 		"provisioning", provisioningWorkers,
 		"allocated", allocatedWorkers,
 		"toCreate", workersToCreate)
 
+	// Spread warm workers across the pool's worker groups
+	groups := resources.PoolWorkerGroups(pool)
+
 	for i := int32(0); i < workersToCreate; i++ {
 		worker := &buildkitv1alpha1.BuildKitWorker{
 			ObjectMeta: metav1.ObjectMeta{
@@ -184,6 +242,11 @@ func (r *Manager) createWorkers(ctx context.Context, pool *buildkitv1alpha1.Buil
 				},
 			},
 		}
+		if len(groups) > 0 {
+			group := groups[int(idleCount+provisioningWorkers+i)%len(groups)]
+			resources.ApplyWorkerGroup(worker, &group)
+		}
+		resources.ApplyWorkerSize(worker, size)
 
 		if err := r.createWorkerWithOwner(ctx, pool, worker); err != nil {
 			return err
@@ -191,6 +254,7 @@ func (r *Manager) createWorkers(ctx context.Context, pool *buildkitv1alpha1.Buil
 
 		r.log.Info("Created worker for minimum pool size", "worker", worker.Name, "pool", pool.Name)
 	}
+	metrics.ScaleOperationsTotal.WithLabelValues(pool.Name, "scale_up").Inc()
 
 	return nil
 }
@@ -16,8 +16,10 @@ import (
 
 	buildkitv1alpha1 "github.com/smrt-devops/buildkit-controller/api/v1alpha1"
 	"github.com/smrt-devops/buildkit-controller/internal/controller/shared"
+	"github.com/smrt-devops/buildkit-controller/internal/metrics"
 	"github.com/smrt-devops/buildkit-controller/internal/resources"
 	"github.com/smrt-devops/buildkit-controller/internal/utils"
+	"github.com/smrt-devops/buildkit-controller/internal/webhooks"
 )
 
 const (
@@ -28,6 +30,8 @@ type BuildKitWorkerReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
 	Log    utils.Logger
+	// Webhooks receives worker lifecycle events; nil discards them.
+	Webhooks *webhooks.Dispatcher
 }
 
 //+kubebuilder:rbac:groups=buildkit.smrt-devops.net,resources=buildkitworkers,verbs=get;list;watch;create;update;patch;delete
@@ -35,7 +39,10 @@ type BuildKitWorkerReconciler struct {
 //+kubebuilder:rbac:groups=buildkit.smrt-devops.net,resources=buildkitworkers/finalizers,verbs=update
 //+kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch;create;update;patch;delete
 
-func (r *BuildKitWorkerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+func (r *BuildKitWorkerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
+	start := time.Now()
+	defer func() { metrics.ObserveReconcile("buildkitworker", start, result, err) }()
+
 	log := r.Log.WithValues("worker", req.NamespacedName)
 
 	worker := &buildkitv1alpha1.BuildKitWorker{}
@@ -67,6 +74,9 @@ func (r *BuildKitWorkerReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 		log.Error(err, "Failed to get parent pool")
 		return r.updateStatus(ctx, worker, buildkitv1alpha1.WorkerPhaseFailed, "Parent pool not found", log)
 	}
+	if _, err := shared.ApplyPoolClass(ctx, r.Client, pool); err != nil {
+		return ctrl.Result{}, err
+	}
 
 	switch worker.Status.Phase {
 	case "", buildkitv1alpha1.WorkerPhasePending:
@@ -144,6 +154,7 @@ func (r *BuildKitWorkerReconciler) reconcileProvisioning(ctx context.Context, wo
 		if err := r.Status().Update(ctx, worker); err != nil {
 			return ctrl.Result{}, err
 		}
+		r.Webhooks.Emit(workerEvent(webhooks.EventWorkerReady, worker))
 
 		return ctrl.Result{}, nil
 	}
@@ -196,9 +207,12 @@ func (r *BuildKitWorkerReconciler) calculateRequeueInterval(worker *buildkitv1al
 func (r *BuildKitWorkerReconciler) reconcileRunning(ctx context.Context, worker *buildkitv1alpha1.BuildKitWorker, log utils.Logger) (ctrl.Result, error) {
 	if r.isAllocationExpired(worker) {
 		log.Info("Worker allocation expired, deleting", "worker", worker.Name, "expiresAt", worker.Spec.Allocation.ExpiresAt.Time)
-		if err := r.Delete(ctx, worker); err != nil && !apierrors.IsNotFound(err) {
-			return ctrl.Result{}, err
+		if err := r.Delete(ctx, worker); err != nil {
+			return ctrl.Result{}, client.IgnoreNotFound(err)
 		}
+		event := workerEvent(webhooks.EventWorkerExpired, worker)
+		event.Message = "Allocation expired"
+		r.Webhooks.Emit(event)
 		return ctrl.Result{}, nil
 	}
 
@@ -270,6 +284,7 @@ func (r *BuildKitWorkerReconciler) reconcileDelete(ctx context.Context, worker *
 }
 
 func (r *BuildKitWorkerReconciler) updateStatus(ctx context.Context, worker *buildkitv1alpha1.BuildKitWorker, phase buildkitv1alpha1.WorkerPhase, message string, log utils.Logger) (ctrl.Result, error) {
+	previousPhase := worker.Status.Phase
 	worker.Status.Phase = phase
 	worker.Status.Message = message
 
@@ -278,9 +293,30 @@ func (r *BuildKitWorkerReconciler) updateStatus(ctx context.Context, worker *bui
 		return ctrl.Result{}, err
 	}
 
+	if phase == buildkitv1alpha1.WorkerPhaseFailed && previousPhase != buildkitv1alpha1.WorkerPhaseFailed {
+		r.Webhooks.Emit(workerEvent(webhooks.EventWorkerFailed, worker))
+	}
+
 	return ctrl.Result{Requeue: true}, nil
 }
 
+// workerEvent returns a lifecycle event about a worker and its allocation.
+func workerEvent(eventType webhooks.EventType, worker *buildkitv1alpha1.BuildKitWorker) webhooks.Event {
+	event := webhooks.Event{
+		Type:      eventType,
+		Pool:      worker.Spec.PoolRef.Name,
+		Namespace: worker.Namespace,
+		Worker:    worker.Name,
+		Phase:     string(worker.Status.Phase),
+		Message:   worker.Status.Message,
+	}
+	if alloc := worker.Spec.Allocation; alloc != nil {
+		event.JobID = alloc.JobID
+		event.RequestedBy = alloc.RequestedBy
+	}
+	return event
+}
+
 func (r *BuildKitWorkerReconciler) buildWorkerPod(worker *buildkitv1alpha1.BuildKitWorker, pool *buildkitv1alpha1.BuildKitPool) *corev1.Pod {
 	buildkitImage := resources.GetBuildkitImage(pool, "")
 	configMapName := resources.GetConfigMapName(pool.Name)
@@ -302,12 +338,24 @@ func (r *BuildKitWorkerReconciler) buildWorkerPod(worker *buildkitv1alpha1.Build
 		ConfigMapName:    configMapName,
 		SecretName:       workerTLSSecretName,
 		TLSEnabled:       true,
-		Resources:        pool.Spec.Resources.Buildkit,
+		Resources:        resources.WorkerResources(pool, worker),
 		DefaultResources: "md",
+		Platforms:        worker.Spec.Platforms,
 	})
 
 	volumes := resources.BuildVolumes(configMapName, workerTLSSecretName, true)
 
+	// Schedule the worker on nodes of its native platform
+	var nodeSelector map[string]string
+	var tolerations []corev1.Toleration
+	if len(worker.Spec.Platforms) > 0 {
+		nodeSelector = resources.PlatformNodeSelector(worker.Spec.Platforms[0])
+	}
+	if group := resources.GetWorkerGroup(pool, worker.Spec.WorkerGroup); group != nil {
+		nodeSelector = utils.MergeLabels(nodeSelector, group.NodeSelector)
+		tolerations = group.Tolerations
+	}
+
 	return &corev1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      worker.Name,
@@ -318,6 +366,8 @@ func (r *BuildKitWorkerReconciler) buildWorkerPod(worker *buildkitv1alpha1.Build
 			Containers:    []corev1.Container{buildkitdContainer},
 			Volumes:       volumes,
 			RestartPolicy: corev1.RestartPolicyNever,
+			NodeSelector:  nodeSelector,
+			Tolerations:   tolerations,
 		},
 	}
 }
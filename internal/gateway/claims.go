@@ -0,0 +1,78 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+const (
+	// TokenIssuer is the issuer of allocation tokens.
+	TokenIssuer = "buildkit-controller"
+
+	// tokenClockSkew is the leeway allowed when checking token times.
+	tokenClockSkew = 30 * time.Second
+)
+
+var (
+	// ErrUnknownSigningKey is returned when a token is signed with a key that is not in the key set.
+	ErrUnknownSigningKey = errors.New("unknown token signing key")
+	// ErrTokenRevoked is returned when a token is on the deny list.
+	ErrTokenRevoked = errors.New("token revoked")
+)
+
+// AllocationClaims are the claims carried by a signed allocation token.
+// They contain everything the gateway needs to route a connection, so it can
+// verify tokens without calling the controller.
+type AllocationClaims struct {
+	jwt.Claims
+	Pool           string `json:"pool"`
+	Namespace      string `json:"namespace"`
+	Worker         string `json:"worker"`
+	WorkerEndpoint string `json:"workerEndpoint"`
+	JobID          string `json:"jobId,omitempty"`
+}
+
+// RevokedToken is an entry in the token deny list.
+// Entries are kept until the token would have expired anyway.
+type RevokedToken struct {
+	ID        string    `json:"id"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// RevocationList is the deny list published by the controller.
+type RevocationList struct {
+	Revoked     []RevokedToken `json:"revoked"`
+	GeneratedAt time.Time      `json:"generatedAt"`
+}
+
+// VerifyAllocationToken verifies the signature and expiry of an allocation token
+// against a key set and returns its claims.
+func VerifyAllocationToken(token string, keys *jose.JSONWebKeySet, now time.Time) (*AllocationClaims, error) {
+	parsed, err := jwt.ParseSigned(token, []jose.SignatureAlgorithm{jose.ES256})
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse token: %w", err)
+	}
+	if len(parsed.Headers) == 0 {
+		return nil, fmt.Errorf("token has no signature header")
+	}
+
+	matching := keys.Key(parsed.Headers[0].KeyID)
+	if len(matching) == 0 {
+		return nil, ErrUnknownSigningKey
+	}
+
+	claims := &AllocationClaims{}
+	if err := parsed.Claims(matching[0].Key, claims); err != nil {
+		return nil, fmt.Errorf("invalid token signature: %w", err)
+	}
+
+	if err := claims.ValidateWithLeeway(jwt.Expected{Issuer: TokenIssuer, Time: now}, tokenClockSkew); err != nil {
+		return nil, fmt.Errorf("invalid token: %w", err)
+	}
+
+	return claims, nil
+}
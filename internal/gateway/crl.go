@@ -0,0 +1,148 @@
+package gateway
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/smrt-devops/buildkit-controller/internal/utils"
+)
+
+// DefaultCRLReloadInterval is how often the CRL checker re-reads the mounted CRL.
+const DefaultCRLReloadInterval = 30 * time.Second
+
+// CRLChecker rejects client certificates revoked by the controller's CRL.
+// The CRL is read from a file, normally a ConfigMap volume the kubelet keeps in
+// sync, and verified against the CA certificate. Until a valid CRL has been
+// loaded no certificate is rejected; once loaded, the last valid CRL stays in
+// effect if the file is later missing or invalid.
+type CRLChecker struct {
+	crlPath string
+	caPath  string
+	logger  utils.Logger
+
+	mu        sync.RWMutex
+	revoked   map[string]struct{}
+	crlNumber string
+}
+
+// NewCRLChecker creates a CRL checker for the CRL and CA certificate at the given paths.
+func NewCRLChecker(crlPath, caPath string, logger utils.Logger) *CRLChecker {
+	return &CRLChecker{
+		crlPath: crlPath,
+		caPath:  caPath,
+		logger:  logger,
+		revoked: make(map[string]struct{}),
+	}
+}
+
+// Run reloads the CRL until the context is canceled.
+func (c *CRLChecker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.Load(); err != nil {
+				c.logger.Error(err, "Failed to reload CRL, keeping the previous one")
+			}
+		}
+	}
+}
+
+// Load reads and verifies the CRL. A missing CRL file is not an error, as the
+// controller may not have published one yet.
+func (c *CRLChecker) Load() error {
+	crlPEM, err := os.ReadFile(c.crlPath)
+	if errors.Is(err, os.ErrNotExist) {
+		c.logger.V(1).Info("No CRL published yet", "path", c.crlPath)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read CRL: %w", err)
+	}
+
+	block, _ := pem.Decode(crlPEM)
+	if block == nil {
+		return fmt.Errorf("failed to decode CRL PEM")
+	}
+	crl, err := x509.ParseRevocationList(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse CRL: %w", err)
+	}
+
+	ca, err := loadCACert(c.caPath)
+	if err != nil {
+		return err
+	}
+	if err := crl.CheckSignatureFrom(ca); err != nil {
+		return fmt.Errorf("CRL not signed by trusted CA: %w", err)
+	}
+
+	if time.Now().After(crl.NextUpdate) {
+		// Still enforce it, a stale CRL lists every certificate revoked before it
+		c.logger.Info("CRL is past its next update, is the controller publishing it?", "nextUpdate", crl.NextUpdate)
+	}
+
+	revoked := make(map[string]struct{}, len(crl.RevokedCertificateEntries))
+	for _, entry := range crl.RevokedCertificateEntries {
+		revoked[entry.SerialNumber.Text(16)] = struct{}{}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	number := crl.Number.String()
+	if number != c.crlNumber {
+		c.logger.Info("Loaded CRL", "number", number, "revoked", len(revoked), "nextUpdate", crl.NextUpdate)
+	}
+	c.revoked = revoked
+	c.crlNumber = number
+	return nil
+}
+
+// VerifyPeerCertificate rejects a client certificate whose serial number is on
+// the CRL. It is meant for tls.Config.VerifyPeerCertificate and runs after the
+// chain has been verified.
+func (c *CRLChecker) VerifyPeerCertificate(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	if len(rawCerts) == 0 {
+		return nil
+	}
+	cert, err := x509.ParseCertificate(rawCerts[0])
+	if err != nil {
+		return fmt.Errorf("failed to parse client certificate: %w", err)
+	}
+
+	serial := cert.SerialNumber.Text(16)
+	c.mu.RLock()
+	_, revoked := c.revoked[serial]
+	c.mu.RUnlock()
+	if revoked {
+		return fmt.Errorf("client certificate %s has been revoked", serial)
+	}
+	return nil
+}
+
+// loadCACert reads the first certificate from a PEM file.
+func loadCACert(path string) (*x509.Certificate, error) {
+	caPEM, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA cert: %w", err)
+	}
+	block, _ := pem.Decode(caPEM)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode CA cert PEM")
+	}
+	ca, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA cert: %w", err)
+	}
+	return ca, nil
+}
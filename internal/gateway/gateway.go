@@ -62,6 +62,17 @@ type Gateway struct {
 	listener net.Listener
 	mu       sync.RWMutex
 	running  bool
+
+	revalidateInterval time.Duration
+	connsMu            sync.Mutex
+	conns              map[*activeConn]struct{}
+}
+
+// activeConn is a proxied connection and the token it was routed with.
+type activeConn struct {
+	token  string
+	client net.Conn
+	worker net.Conn
 }
 
 // Config holds gateway configuration.
@@ -72,6 +83,9 @@ type Config struct {
 	WorkerTLS    *tls.Config // mTLS for worker connections
 	WorkerLookup WorkerLookup
 	Logger       utils.Logger
+	// RevalidateInterval is how often the tokens of active connections are looked
+	// up again; connections whose token was revoked are closed. Zero disables it.
+	RevalidateInterval time.Duration
 }
 
 // New creates a new Gateway.
@@ -83,6 +97,9 @@ func New(cfg Config) *Gateway {
 		workerTLS:    cfg.WorkerTLS,
 		workerLookup: cfg.WorkerLookup,
 		logger:       cfg.Logger,
+
+		revalidateInterval: cfg.RevalidateInterval,
+		conns:              make(map[*activeConn]struct{}),
 	}
 }
 
@@ -110,6 +127,10 @@ func (g *Gateway) Start(ctx context.Context) error {
 		g.Stop()
 	}()
 
+	if g.revalidateInterval > 0 {
+		go g.revalidateConnections(ctx)
+	}
+
 	for {
 		conn, err := g.listener.Accept()
 		if err != nil {
@@ -185,9 +206,76 @@ func (g *Gateway) handleConnection(ctx context.Context, conn net.Conn) {
 	connectionsTotal.WithLabelValues(g.poolName, "success").Inc()
 	g.logger.V(1).Info("Routing connection to worker", "endpoint", workerEndpoint, "dial_address", dialAddress, "token", maskToken(token))
 
+	active := g.track(token, conn, workerConn)
+	defer g.untrack(active)
+
 	g.proxy(tlsConn, workerConn)
 }
 
+func (g *Gateway) track(token string, client, worker net.Conn) *activeConn {
+	active := &activeConn{token: token, client: client, worker: worker}
+	g.connsMu.Lock()
+	g.conns[active] = struct{}{}
+	g.connsMu.Unlock()
+	return active
+}
+
+func (g *Gateway) untrack(active *activeConn) {
+	g.connsMu.Lock()
+	delete(g.conns, active)
+	g.connsMu.Unlock()
+}
+
+// revalidateConnections periodically closes connections whose token was revoked,
+// e.g. because an admin revoked the allocation or its lease lapsed.
+func (g *Gateway) revalidateConnections(ctx context.Context) {
+	ticker := time.NewTicker(g.revalidateInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if closed := g.closeRevoked(ctx); closed > 0 {
+				g.logger.Info("Closed connections of revoked allocations", "pool", g.poolName, "count", closed)
+			}
+		}
+	}
+}
+
+// closeRevoked looks up the token of every active connection and closes the
+// connections whose token is revoked or no longer known. Other lookup errors,
+// e.g. an unreachable controller, leave the connection open.
+func (g *Gateway) closeRevoked(ctx context.Context) int {
+	g.connsMu.Lock()
+	active := make([]*activeConn, 0, len(g.conns))
+	for conn := range g.conns {
+		active = append(active, conn)
+	}
+	g.connsMu.Unlock()
+
+	revoked := make(map[string]bool)
+	closed := 0
+	for _, conn := range active {
+		isRevoked, checked := revoked[conn.token]
+		if !checked {
+			_, err := g.workerLookup(ctx, conn.token)
+			isRevoked = errors.Is(err, ErrTokenRevoked) || errors.Is(err, ErrTokenNotFound)
+			revoked[conn.token] = isRevoked
+		}
+		if !isRevoked {
+			continue
+		}
+
+		conn.client.Close()
+		conn.worker.Close()
+		connectionsTotal.WithLabelValues(g.poolName, "revoked").Inc()
+		closed++
+	}
+	return closed
+}
+
 func (g *Gateway) handleTLSConnection(conn net.Conn) (*tls.Conn, string, bool) {
 	if g.tlsConfig == nil {
 		return nil, "", true
@@ -248,17 +336,19 @@ func (g *Gateway) proxy(client net.Conn, worker net.Conn) {
 	wg.Wait()
 }
 
+// extractTokenFromCert returns the allocation token embedded in a client certificate.
+// Signed tokens are too long for the CN, so the URI SAN takes precedence.
 func extractTokenFromCert(cert *x509.Certificate) string {
-	if strings.HasPrefix(cert.Subject.CommonName, "alloc:") {
-		return strings.TrimPrefix(cert.Subject.CommonName, "alloc:")
-	}
-
 	for _, uri := range cert.URIs {
-		if uri.Scheme == "buildkit" && uri.Host == "allocation" {
+		if uri.Scheme == "buildkit" && uri.Host == "allocation" && len(uri.Path) > 1 {
 			return uri.Path[1:]
 		}
 	}
 
+	if strings.HasPrefix(cert.Subject.CommonName, "alloc:") {
+		return strings.TrimPrefix(cert.Subject.CommonName, "alloc:")
+	}
+
 	if cert.Subject.CommonName != "" {
 		return cert.Subject.CommonName
 	}
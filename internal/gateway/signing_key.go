@@ -0,0 +1,119 @@
+package gateway
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// DefaultSigningKeySecretName is the default name of the token signing key secret.
+	DefaultSigningKeySecretName = "buildkit-token-signing-key"
+	// DefaultSigningKeyNamespace is the namespace of the token signing key secret
+	// when neither a namespace nor POD_NAMESPACE is set.
+	DefaultSigningKeyNamespace = "buildkit-system"
+	// SigningKeySecretKey is the data key holding the PEM encoded signing key in the secret.
+	SigningKeySecretKey = "signing.key"
+)
+
+// EnsureSigningKey loads the token signing key from a secret, creating the secret
+// with a new ECDSA P-256 key if it does not exist yet or holds an invalid key.
+// All controller replicas share the same key so tokens stay valid across restarts
+// and leader changes.
+func EnsureSigningKey(ctx context.Context, k8sClient client.Client, name, namespace string) (*ecdsa.PrivateKey, error) {
+	if name == "" {
+		name = DefaultSigningKeySecretName
+	}
+	if namespace == "" {
+		namespace = os.Getenv("POD_NAMESPACE")
+	}
+	if namespace == "" {
+		namespace = DefaultSigningKeyNamespace
+	}
+
+	secret := &corev1.Secret{}
+	err := k8sClient.Get(ctx, client.ObjectKey{Name: name, Namespace: namespace}, secret)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to get signing key secret: %w", err)
+	}
+	exists := err == nil
+	if exists {
+		if key, parseErr := parseSigningKey(secret.Data[SigningKeySecretKey]); parseErr == nil {
+			return key, nil
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal signing key: %w", err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "EC PRIVATE KEY",
+		Bytes: keyDER,
+	})
+
+	if exists {
+		// Secret holds an unusable key, replace it
+		secret.Data = map[string][]byte{SigningKeySecretKey: keyPEM}
+		if err := k8sClient.Update(ctx, secret); err != nil {
+			return nil, fmt.Errorf("failed to update signing key secret: %w", err)
+		}
+		return key, nil
+	}
+
+	secret = &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels: map[string]string{
+				"app.kubernetes.io/name":       "buildkit-controller",
+				"app.kubernetes.io/component":  "token-signing-key",
+				"app.kubernetes.io/managed-by": "buildkit-controller",
+			},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{
+			SigningKeySecretKey: keyPEM,
+		},
+	}
+
+	if err := k8sClient.Create(ctx, secret); err != nil {
+		if !apierrors.IsAlreadyExists(err) {
+			return nil, fmt.Errorf("failed to create signing key secret: %w", err)
+		}
+		// Another replica created it first, use theirs
+		existing := &corev1.Secret{}
+		if err := k8sClient.Get(ctx, client.ObjectKey{Name: name, Namespace: namespace}, existing); err != nil {
+			return nil, fmt.Errorf("failed to get signing key secret: %w", err)
+		}
+		return parseSigningKey(existing.Data[SigningKeySecretKey])
+	}
+
+	return key, nil
+}
+
+func parseSigningKey(keyPEM []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode signing key PEM")
+	}
+	key, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing key: %w", err)
+	}
+	return key, nil
+}
@@ -0,0 +1,332 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	buildkitv1alpha1 "github.com/smrt-devops/buildkit-controller/api/v1alpha1"
+)
+
+var (
+	// ErrTokenNotFound is returned when a token is not known to the manager or its store.
+	ErrTokenNotFound = errors.New("token not found")
+	// ErrWorkerUnavailable is returned when a worker is already allocated to another
+	// token or is being deleted, so it cannot be claimed.
+	ErrWorkerUnavailable = errors.New("worker unavailable")
+)
+
+// TokenStore persists allocation tokens so they survive controller restarts.
+// The TokenManager keeps an in-memory cache in front of the store; a nil store
+// means tokens only live in memory.
+type TokenStore interface {
+	// Get returns the token data for a token, or ErrTokenNotFound.
+	Get(ctx context.Context, token string) (*TokenData, error)
+	// List returns all persisted tokens.
+	List(ctx context.Context) ([]*TokenData, error)
+	// Save creates or updates the persisted token data. Saving a new token claims
+	// the worker; it fails with ErrWorkerUnavailable if the worker is held by
+	// another token, so no two tokens are ever recorded for one worker.
+	Save(ctx context.Context, data *TokenData) error
+	// Delete removes the persisted token data. Deleting an unknown token is not an error.
+	Delete(ctx context.Context, data *TokenData) error
+}
+
+// RevocationStore persists the token deny list, so revoked and lapsed tokens
+// stay denied after a controller restart until their signed expiry.
+type RevocationStore interface {
+	// Load returns the persisted deny list.
+	Load(ctx context.Context) ([]RevokedToken, error)
+	// Save merges the entries into the persisted deny list. Persisted entries
+	// are kept until they expire, so replicas never drop each other's entries.
+	Save(ctx context.Context, revoked []RevokedToken) error
+}
+
+const (
+	// DefaultRevocationsConfigMapName is the default name of the ConfigMap holding the deny list.
+	DefaultRevocationsConfigMapName = "buildkit-token-revocations"
+	// RevocationsConfigMapKey is the data key holding the JSON encoded deny list in the ConfigMap.
+	RevocationsConfigMapKey = "revoked.json"
+)
+
+// ConfigMapRevocationStore stores the token deny list in a ConfigMap. Entries
+// only hold token IDs and expiries, so the list needs no Secret.
+type ConfigMapRevocationStore struct {
+	client client.Client
+	key    types.NamespacedName
+}
+
+// NewConfigMapRevocationStore creates a revocation store backed by the named
+// ConfigMap. An empty namespace uses POD_NAMESPACE, like the signing key.
+func NewConfigMapRevocationStore(k8sClient client.Client, name, namespace string) *ConfigMapRevocationStore {
+	if name == "" {
+		name = DefaultRevocationsConfigMapName
+	}
+	if namespace == "" {
+		namespace = os.Getenv("POD_NAMESPACE")
+	}
+	if namespace == "" {
+		namespace = DefaultSigningKeyNamespace
+	}
+	return &ConfigMapRevocationStore{client: k8sClient, key: types.NamespacedName{Name: name, Namespace: namespace}}
+}
+
+// Load reads the deny list. A missing ConfigMap is an empty list.
+func (s *ConfigMapRevocationStore) Load(ctx context.Context) ([]RevokedToken, error) {
+	configMap := &corev1.ConfigMap{}
+	if err := s.client.Get(ctx, s.key, configMap); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get deny list %s: %w", s.key, err)
+	}
+
+	data, ok := configMap.Data[RevocationsConfigMapKey]
+	if !ok {
+		return nil, nil
+	}
+	var revoked []RevokedToken
+	if err := json.Unmarshal([]byte(data), &revoked); err != nil {
+		return nil, fmt.Errorf("failed to decode deny list %s: %w", s.key, err)
+	}
+	return revoked, nil
+}
+
+// Save merges the entries into the deny list, creating the ConfigMap if it
+// does not exist yet. The merge is retried on conflict, so concurrent saves by
+// other replicas are never overwritten.
+func (s *ConfigMapRevocationStore) Save(ctx context.Context, revoked []RevokedToken) error {
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		configMap := &corev1.ConfigMap{}
+		err := s.client.Get(ctx, s.key, configMap)
+		if apierrors.IsNotFound(err) {
+			encoded, err := encodeDenyList(nil, revoked)
+			if err != nil {
+				return err
+			}
+			configMap = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      s.key.Name,
+					Namespace: s.key.Namespace,
+					Labels: map[string]string{
+						"app.kubernetes.io/name":       "buildkit-controller",
+						"app.kubernetes.io/component":  "token-revocations",
+						"app.kubernetes.io/managed-by": "buildkit-controller",
+					},
+				},
+				Data: map[string]string{RevocationsConfigMapKey: encoded},
+			}
+			err = s.client.Create(ctx, configMap)
+			if apierrors.IsAlreadyExists(err) {
+				// Created concurrently, retry as an update
+				return apierrors.NewConflict(corev1.Resource("configmaps"), s.key.Name, err)
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		var stored []RevokedToken
+		if data, ok := configMap.Data[RevocationsConfigMapKey]; ok {
+			if err := json.Unmarshal([]byte(data), &stored); err != nil {
+				return fmt.Errorf("failed to decode deny list: %w", err)
+			}
+		}
+		encoded, err := encodeDenyList(stored, revoked)
+		if err != nil {
+			return err
+		}
+
+		// The update carries the read resourceVersion, so a concurrent save
+		// conflicts and the merge is redone on top of it
+		if configMap.Data == nil {
+			configMap.Data = make(map[string]string)
+		}
+		configMap.Data[RevocationsConfigMapKey] = encoded
+		return s.client.Update(ctx, configMap)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save deny list %s: %w", s.key, err)
+	}
+	return nil
+}
+
+// encodeDenyList merges two deny lists, dropping expired entries and keeping
+// the latest expiry of each token ID, and encodes the result.
+func encodeDenyList(stored, revoked []RevokedToken) (string, error) {
+	now := time.Now()
+	expiries := make(map[string]time.Time, len(stored)+len(revoked))
+	for _, entry := range slices.Concat(stored, revoked) {
+		if !now.Before(entry.ExpiresAt) {
+			continue
+		}
+		if current, ok := expiries[entry.ID]; !ok || entry.ExpiresAt.After(current) {
+			expiries[entry.ID] = entry.ExpiresAt
+		}
+	}
+
+	merged := make([]RevokedToken, 0, len(expiries))
+	for id, expiresAt := range expiries {
+		merged = append(merged, RevokedToken{ID: id, ExpiresAt: expiresAt})
+	}
+	// Sorted, so an unchanged list encodes the same
+	slices.SortFunc(merged, func(a, b RevokedToken) int { return strings.Compare(a.ID, b.ID) })
+
+	encoded, err := json.Marshal(merged)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode deny list: %w", err)
+	}
+	return string(encoded), nil
+}
+
+// WorkerTokenStore stores allocation tokens on BuildKitWorker.Spec.Allocation.
+// The worker already records the allocation for the worker controller, so it is
+// the source of truth for which token maps to which worker.
+type WorkerTokenStore struct {
+	client client.Client
+}
+
+// NewWorkerTokenStore creates a token store backed by BuildKitWorker resources.
+func NewWorkerTokenStore(k8sClient client.Client) *WorkerTokenStore {
+	return &WorkerTokenStore{client: k8sClient}
+}
+
+// Get finds the worker holding the given token.
+func (s *WorkerTokenStore) Get(ctx context.Context, token string) (*TokenData, error) {
+	workers, err := s.listWorkers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range workers.Items {
+		worker := &workers.Items[i]
+		if worker.Spec.Allocation != nil && worker.Spec.Allocation.Token == token {
+			return tokenDataFromWorker(worker), nil
+		}
+	}
+
+	return nil, ErrTokenNotFound
+}
+
+// List returns token data for every allocated worker.
+func (s *WorkerTokenStore) List(ctx context.Context) ([]*TokenData, error) {
+	workers, err := s.listWorkers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*TokenData, 0, len(workers.Items))
+	for i := range workers.Items {
+		worker := &workers.Items[i]
+		if worker.Spec.Allocation == nil || worker.Spec.Allocation.Token == "" {
+			continue
+		}
+		result = append(result, tokenDataFromWorker(worker))
+	}
+	return result, nil
+}
+
+// Save records the allocation on the worker referenced by the token data.
+// The patch is conditional on the worker's resourceVersion, so of two concurrent
+// claims on an unallocated worker only one succeeds; the other sees the new
+// allocation on retry and fails with ErrWorkerUnavailable.
+func (s *WorkerTokenStore) Save(ctx context.Context, data *TokenData) error {
+	key := types.NamespacedName{Name: data.WorkerName, Namespace: data.Namespace}
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		worker := &buildkitv1alpha1.BuildKitWorker{}
+		if err := s.client.Get(ctx, key, worker); err != nil {
+			return err
+		}
+
+		if !worker.DeletionTimestamp.IsZero() {
+			return fmt.Errorf("%w: %s is being deleted", ErrWorkerUnavailable, key)
+		}
+		if alloc := worker.Spec.Allocation; alloc != nil && alloc.Token != data.Token {
+			return fmt.Errorf("%w: %s is allocated to job %s", ErrWorkerUnavailable, key, alloc.JobID)
+		}
+
+		patch := client.MergeFromWithOptions(worker.DeepCopy(), client.MergeFromWithOptimisticLock{})
+		worker.Spec.Allocation = &buildkitv1alpha1.WorkerAllocation{
+			JobID:       data.JobID,
+			Token:       data.Token,
+			RequestedBy: data.RequestedBy,
+			AllocatedAt: metav1.NewTime(data.IssuedAt),
+			ExpiresAt:   &metav1.Time{Time: data.ExpiresAt},
+			Metadata:    data.Metadata,
+			Quotas:      data.Quotas,
+		}
+		return s.client.Patch(ctx, worker, patch)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record allocation on worker %s: %w", key, err)
+	}
+	return nil
+}
+
+// Delete clears the allocation from the worker if it still holds the token.
+// The patch is conditional, so it never clears an allocation made by a later claim.
+func (s *WorkerTokenStore) Delete(ctx context.Context, data *TokenData) error {
+	key := types.NamespacedName{Name: data.WorkerName, Namespace: data.Namespace}
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		worker := &buildkitv1alpha1.BuildKitWorker{}
+		if err := s.client.Get(ctx, key, worker); err != nil {
+			return err
+		}
+
+		if worker.Spec.Allocation == nil || worker.Spec.Allocation.Token != data.Token {
+			return nil
+		}
+
+		patch := client.MergeFromWithOptions(worker.DeepCopy(), client.MergeFromWithOptimisticLock{})
+		worker.Spec.Allocation = nil
+		return s.client.Patch(ctx, worker, patch)
+	})
+	if err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	return nil
+}
+
+func (s *WorkerTokenStore) listWorkers(ctx context.Context) (*buildkitv1alpha1.BuildKitWorkerList, error) {
+	workers := &buildkitv1alpha1.BuildKitWorkerList{}
+	if err := s.client.List(ctx, workers, client.MatchingLabels{"buildkit.smrt-devops.net/worker": "true"}); err != nil {
+		return nil, fmt.Errorf("failed to list workers: %w", err)
+	}
+	return workers, nil
+}
+
+// tokenDataFromWorker rebuilds token data from a worker's allocation.
+func tokenDataFromWorker(worker *buildkitv1alpha1.BuildKitWorker) *TokenData {
+	alloc := worker.Spec.Allocation
+	data := &TokenData{
+		Token:          alloc.Token,
+		PoolName:       worker.Spec.PoolRef.Name,
+		Namespace:      worker.Namespace,
+		WorkerName:     worker.Name,
+		WorkerEndpoint: worker.Status.Endpoint,
+		JobID:          alloc.JobID,
+		RequestedBy:    alloc.RequestedBy,
+		IssuedAt:       alloc.AllocatedAt.Time,
+		Metadata:       alloc.Metadata,
+		Quotas:         alloc.Quotas,
+	}
+	if alloc.ExpiresAt != nil {
+		data.ExpiresAt = alloc.ExpiresAt.Time
+	}
+	return data
+}
@@ -1,52 +1,84 @@
 package gateway
 
 import (
-	"crypto/hmac"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
-	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
 )
 
 // TokenManager manages allocation tokens.
+// Tokens are ES256 signed JWTs carrying the routing information for an allocation,
+// so gateways can verify them against the published key set without a lookup.
 type TokenManager struct {
-	secret     []byte
-	tokens     map[string]*TokenData
-	mu         sync.RWMutex
-	defaultTTL time.Duration
-	maxTTL     time.Duration
+	signer      jose.Signer
+	keys        jose.JSONWebKeySet
+	tokens      map[string]*TokenData
+	revoked     map[string]time.Time   // token ID -> token expiry
+	timers      map[string]*time.Timer // token -> lapse of its lease
+	store       TokenStore
+	revocations RevocationStore
+	mu          sync.RWMutex
+	defaultTTL  time.Duration
+	maxTTL      time.Duration
+	// lapsed is signaled when a lease lapses and the deny list must be persisted.
+	lapsed chan struct{}
+	// saveMu serializes writes of the deny list to the revocation store.
+	saveMu sync.Mutex
 }
 
 // TokenData contains token metadata.
 type TokenData struct {
-	Token          string            `json:"token"`
-	PoolName       string            `json:"poolName"`
-	Namespace      string            `json:"namespace"`
-	WorkerName     string            `json:"workerName"`
-	WorkerEndpoint string            `json:"workerEndpoint"`
-	JobID          string            `json:"jobId,omitempty"`
-	RequestedBy    string            `json:"requestedBy,omitempty"`
-	IssuedAt       time.Time         `json:"issuedAt"`
-	ExpiresAt      time.Time         `json:"expiresAt"`
-	Metadata       map[string]string `json:"metadata,omitempty"`
+	Token          string    `json:"token"`
+	ID             string    `json:"id"`
+	PoolName       string    `json:"poolName"`
+	Namespace      string    `json:"namespace"`
+	WorkerName     string    `json:"workerName"`
+	WorkerEndpoint string    `json:"workerEndpoint"`
+	JobID          string    `json:"jobId,omitempty"`
+	RequestedBy    string    `json:"requestedBy,omitempty"`
+	IssuedAt       time.Time `json:"issuedAt"`
+	// ExpiresAt is when the allocation lease ends unless it is renewed.
+	ExpiresAt time.Time `json:"expiresAt"`
+	// MaxExpiresAt is the expiry of the signed token, the limit leases can be renewed to.
+	MaxExpiresAt time.Time         `json:"maxExpiresAt"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+	// Quotas maps the names of the pool quotas the allocation counts against to
+	// the subject it is counted for.
+	Quotas map[string]string `json:"quotas,omitempty"`
 }
 
 // TokenManagerConfig configures the token manager.
 type TokenManagerConfig struct {
-	Secret     []byte
+	// SigningKey signs tokens. If nil, a random key is generated.
+	SigningKey *ecdsa.PrivateKey
 	DefaultTTL time.Duration
 	MaxTTL     time.Duration
+	// Store persists tokens. If nil, tokens are only kept in memory.
+	Store TokenStore
+	// Revocations persists the deny list. If nil, it is only kept in memory.
+	Revocations RevocationStore
 }
 
 // NewTokenManager creates a new token manager.
-func NewTokenManager(cfg TokenManagerConfig) *TokenManager {
-	if len(cfg.Secret) == 0 {
-		// Generate random secret if not provided
-		cfg.Secret = make([]byte, 32)
-		rand.Read(cfg.Secret)
+func NewTokenManager(cfg TokenManagerConfig) (*TokenManager, error) {
+	if cfg.SigningKey == nil {
+		// Generate random key if not provided
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate signing key: %w", err)
+		}
+		cfg.SigningKey = key
 	}
 	if cfg.DefaultTTL == 0 {
 		cfg.DefaultTTL = 1 * time.Hour
@@ -55,122 +87,435 @@ func NewTokenManager(cfg TokenManagerConfig) *TokenManager {
 		cfg.MaxTTL = 24 * time.Hour
 	}
 
-	return &TokenManager{
-		secret:     cfg.Secret,
-		tokens:     make(map[string]*TokenData),
-		defaultTTL: cfg.DefaultTTL,
-		maxTTL:     cfg.MaxTTL,
+	tm := &TokenManager{
+		tokens:      make(map[string]*TokenData),
+		revoked:     make(map[string]time.Time),
+		timers:      make(map[string]*time.Timer),
+		store:       cfg.Store,
+		revocations: cfg.Revocations,
+		defaultTTL:  cfg.DefaultTTL,
+		maxTTL:      cfg.MaxTTL,
+		lapsed:      make(chan struct{}, 1),
+	}
+	if err := tm.SetSigningKey(cfg.SigningKey); err != nil {
+		return nil, err
+	}
+
+	return tm, nil
+}
+
+// SetSigningKey replaces the key used to sign and verify tokens.
+// It must be called before any tokens are issued, typically with a key
+// loaded from EnsureSigningKey.
+func (tm *TokenManager) SetSigningKey(key *ecdsa.PrivateKey) error {
+	publicJWK := jose.JSONWebKey{
+		Key:       &key.PublicKey,
+		Algorithm: string(jose.ES256),
+		Use:       "sig",
+	}
+	thumbprint, err := publicJWK.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return fmt.Errorf("failed to compute signing key ID: %w", err)
 	}
+	publicJWK.KeyID = base64.RawURLEncoding.EncodeToString(thumbprint)
+
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.ES256, Key: key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader(jose.HeaderKey("kid"), publicJWK.KeyID),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create token signer: %w", err)
+	}
+
+	tm.mu.Lock()
+	tm.signer = signer
+	tm.keys = jose.JSONWebKeySet{Keys: []jose.JSONWebKey{publicJWK}}
+	tm.mu.Unlock()
+
+	return nil
+}
+
+// KeySet returns the public keys gateways use to verify tokens.
+func (tm *TokenManager) KeySet() jose.JSONWebKeySet {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+
+	keys := make([]jose.JSONWebKey, len(tm.keys.Keys))
+	copy(keys, tm.keys.Keys)
+	return jose.JSONWebKeySet{Keys: keys}
+}
+
+// Restore loads the persisted deny list and all unexpired tokens from the
+// stores into memory. Restored tokens whose lease lapsed while the controller
+// was down are denied right away. It returns the number of tokens restored.
+func (tm *TokenManager) Restore(ctx context.Context) (int, error) {
+	if tm.revocations != nil {
+		revoked, err := tm.revocations.Load(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("failed to load deny list: %w", err)
+		}
+		now := time.Now()
+		tm.mu.Lock()
+		for _, entry := range revoked {
+			if now.Before(entry.ExpiresAt) {
+				tm.revoked[entry.ID] = entry.ExpiresAt
+			}
+		}
+		tm.mu.Unlock()
+	}
+
+	if tm.store == nil {
+		return 0, nil
+	}
+
+	persisted, err := tm.store.List(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list persisted tokens: %w", err)
+	}
+
+	restored := 0
+	for _, data := range persisted {
+		claims, err := tm.verify(data.Token)
+		if err != nil {
+			continue
+		}
+		data.ID = claims.ID
+		data.MaxExpiresAt = claims.Expiry.Time()
+
+		tm.mu.Lock()
+		tm.tokens[data.Token] = data
+		tm.scheduleLapse(data)
+		tm.mu.Unlock()
+		restored++
+	}
+
+	return restored, nil
 }
 
 // IssueToken creates a new allocation token.
-func (tm *TokenManager) IssueToken(poolName, namespace, workerName, workerEndpoint, jobID, requestedBy string, ttl time.Duration, metadata map[string]string) (*TokenData, error) {
+// The allocation lease ends after ttl and can be renewed up to maxTTL after
+// issuance, which is when the signed token itself expires. A zero maxTTL uses
+// the manager's maximum. quotas records which pool quotas the allocation counts
+// against. If a store is configured, the token is persisted before it is returned.
+func (tm *TokenManager) IssueToken(ctx context.Context, poolName, namespace, workerName, workerEndpoint, jobID, requestedBy string, ttl, maxTTL time.Duration, metadata, quotas map[string]string) (*TokenData, error) {
+	if maxTTL == 0 {
+		maxTTL = tm.maxTTL
+	}
 	if ttl == 0 {
 		ttl = tm.defaultTTL
 	}
-	if ttl > tm.maxTTL {
-		ttl = tm.maxTTL
+	if ttl > maxTTL {
+		ttl = maxTTL
 	}
 
-	// Generate random token
-	tokenBytes := make([]byte, 32)
-	if _, err := rand.Read(tokenBytes); err != nil {
-		return nil, fmt.Errorf("failed to generate token: %w", err)
+	// Generate random token ID
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, fmt.Errorf("failed to generate token ID: %w", err)
 	}
 
-	// Add HMAC signature
-	token := tm.signToken(tokenBytes)
-
 	now := time.Now()
+	claims := AllocationClaims{
+		Claims: jwt.Claims{
+			ID:       base64.RawURLEncoding.EncodeToString(idBytes),
+			Issuer:   TokenIssuer,
+			Subject:  requestedBy,
+			IssuedAt: jwt.NewNumericDate(now),
+			Expiry:   jwt.NewNumericDate(now.Add(maxTTL)),
+		},
+		Pool:           poolName,
+		Namespace:      namespace,
+		Worker:         workerName,
+		WorkerEndpoint: workerEndpoint,
+		JobID:          jobID,
+	}
+
+	tm.mu.RLock()
+	signer := tm.signer
+	tm.mu.RUnlock()
+
+	token, err := jwt.Signed(signer).Claims(claims).Serialize()
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign token: %w", err)
+	}
+
 	data := &TokenData{
 		Token:          token,
+		ID:             claims.ID,
 		PoolName:       poolName,
 		Namespace:      namespace,
 		WorkerName:     workerName,
 		WorkerEndpoint: workerEndpoint,
 		JobID:          jobID,
 		RequestedBy:    requestedBy,
-		IssuedAt:       now,
+		IssuedAt:       claims.IssuedAt.Time(),
 		ExpiresAt:      now.Add(ttl),
+		MaxExpiresAt:   claims.Expiry.Time(),
 		Metadata:       metadata,
+		Quotas:         quotas,
+	}
+
+	if tm.store != nil {
+		if err := tm.store.Save(ctx, data); err != nil {
+			return nil, fmt.Errorf("failed to persist token: %w", err)
+		}
 	}
 
 	tm.mu.Lock()
 	tm.tokens[token] = data
+	tm.scheduleLapse(data)
 	tm.mu.Unlock()
 
 	return data, nil
 }
 
 // ValidateToken validates a token and returns its data.
-func (tm *TokenManager) ValidateToken(token string) (*TokenData, error) {
+// Tokens missing from memory are looked up in the store, so tokens issued by
+// another replica or before a restart are still accepted.
+func (tm *TokenManager) ValidateToken(ctx context.Context, token string) (*TokenData, error) {
+	claims, err := tm.verify(token)
+	if err != nil {
+		return nil, err
+	}
+
 	tm.mu.RLock()
 	data, exists := tm.tokens[token]
+	_, revoked := tm.revoked[claims.ID]
 	tm.mu.RUnlock()
 
+	if revoked {
+		return nil, ErrTokenRevoked
+	}
+
 	if !exists {
-		return nil, fmt.Errorf("token not found")
+		data, err = tm.loadToken(ctx, token, claims)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	if time.Now().After(data.ExpiresAt) {
-		// Clean up expired token
-		tm.RevokeToken(token)
+		// The lease lapsed, so gateways must stop accepting the token too
+		tm.expire(token, data)
 		return nil, fmt.Errorf("token expired")
 	}
 
 	return data, nil
 }
 
-// RevokeToken revokes a token.
-func (tm *TokenManager) RevokeToken(token string) {
-	tm.mu.Lock()
-	delete(tm.tokens, token)
-	tm.mu.Unlock()
+// verify checks a token's signature and expiry against the current key set.
+func (tm *TokenManager) verify(token string) (*AllocationClaims, error) {
+	tm.mu.RLock()
+	keys := tm.keys
+	tm.mu.RUnlock()
+
+	return VerifyAllocationToken(token, &keys, time.Now())
 }
 
-// GetWorkerEndpoint returns the worker endpoint for a token.
-func (tm *TokenManager) GetWorkerEndpoint(token string) (string, error) {
-	data, err := tm.ValidateToken(token)
+// loadToken fetches a token from the store and caches it in memory.
+func (tm *TokenManager) loadToken(ctx context.Context, token string, claims *AllocationClaims) (*TokenData, error) {
+	if tm.store == nil {
+		return nil, ErrTokenNotFound
+	}
+
+	data, err := tm.store.Get(ctx, token)
 	if err != nil {
-		return "", err
+		if errors.Is(err, ErrTokenNotFound) {
+			return nil, ErrTokenNotFound
+		}
+		return nil, fmt.Errorf("failed to load token: %w", err)
 	}
-	return data.WorkerEndpoint, nil
+	data.ID = claims.ID
+	data.MaxExpiresAt = claims.Expiry.Time()
+
+	tm.mu.Lock()
+	tm.tokens[token] = data
+	tm.scheduleLapse(data)
+	tm.mu.Unlock()
+
+	return data, nil
 }
 
-// UpdateWorkerEndpoint updates the worker endpoint for a token.
-func (tm *TokenManager) UpdateWorkerEndpoint(token, endpoint string) error {
+// expire drops a token whose lease lapsed from memory and adds it to the deny
+// list. Unlike RevokeToken it leaves the persisted allocation in place, so the
+// worker controller deletes the expired worker instead of reusing it.
+func (tm *TokenManager) expire(token string, data *TokenData) {
 	tm.mu.Lock()
-	defer tm.mu.Unlock()
+	tm.expireLocked(token, data)
+	tm.mu.Unlock()
+	tm.signalLapsed()
+}
 
-	data, exists := tm.tokens[token]
-	if !exists {
-		return fmt.Errorf("token not found")
+// expireLocked drops a lapsed token and denies it. tm.mu must be held.
+func (tm *TokenManager) expireLocked(token string, data *TokenData) {
+	delete(tm.tokens, token)
+	if timer, exists := tm.timers[token]; exists {
+		timer.Stop()
+		delete(tm.timers, token)
 	}
+	if data.ID != "" && time.Now().Before(data.MaxExpiresAt) {
+		tm.revoked[data.ID] = data.MaxExpiresAt
+	}
+}
+
+// scheduleLapse denies a token as soon as its lease lapses, replacing any
+// earlier schedule. tm.mu must be held.
+func (tm *TokenManager) scheduleLapse(data *TokenData) {
+	token := data.Token
+	if timer, exists := tm.timers[token]; exists {
+		timer.Stop()
+	}
+	tm.timers[token] = time.AfterFunc(time.Until(data.ExpiresAt), func() {
+		tm.mu.Lock()
+		current, exists := tm.tokens[token]
+		if !exists || time.Now().Before(current.ExpiresAt) {
+			// Released, or renewed and rescheduled
+			tm.mu.Unlock()
+			return
+		}
+		tm.expireLocked(token, current)
+		tm.mu.Unlock()
+		tm.signalLapsed()
+	})
+}
+
+// signalLapsed notifies Lapsed listeners without blocking.
+func (tm *TokenManager) signalLapsed() {
+	select {
+	case tm.lapsed <- struct{}{}:
+	default:
+	}
+}
 
-	data.WorkerEndpoint = endpoint
+// Lapsed is signaled when leases lapse and their tokens are added to the deny
+// list, so the caller can persist it with PersistRevocations.
+func (tm *TokenManager) Lapsed() <-chan struct{} {
+	return tm.lapsed
+}
+
+// PersistRevocations adds the current deny list to the revocation store, which
+// keeps the entries persisted by other replicas.
+func (tm *TokenManager) PersistRevocations(ctx context.Context) error {
+	if tm.revocations == nil {
+		return nil
+	}
+
+	tm.saveMu.Lock()
+	defer tm.saveMu.Unlock()
+	if err := tm.revocations.Save(ctx, tm.RevokedTokens()); err != nil {
+		return fmt.Errorf("failed to persist deny list: %w", err)
+	}
 	return nil
 }
 
-// RefreshToken extends the expiry of a token.
-func (tm *TokenManager) RefreshToken(token string, extension time.Duration) error {
+// RevokeToken revokes a token and adds it to the deny list published to gateways.
+// Tokens missing from memory, issued by another replica or before a restart,
+// are denied by the claims they carry. The deny list is persisted before the
+// allocation is deleted from the store.
+func (tm *TokenManager) RevokeToken(ctx context.Context, token string) error {
 	tm.mu.Lock()
-	defer tm.mu.Unlock()
-
 	data, exists := tm.tokens[token]
+	delete(tm.tokens, token)
+	if timer, scheduled := tm.timers[token]; scheduled {
+		timer.Stop()
+		delete(tm.timers, token)
+	}
+	if exists && data.ID != "" {
+		tm.revoked[data.ID] = data.MaxExpiresAt
+	}
+	tm.mu.Unlock()
+
 	if !exists {
-		return fmt.Errorf("token not found")
+		claims, err := tm.verify(token)
+		if err != nil {
+			// Gateways reject tokens that fail verification already
+			return nil
+		}
+		data = &TokenData{
+			Token:        token,
+			ID:           claims.ID,
+			PoolName:     claims.Pool,
+			Namespace:    claims.Namespace,
+			WorkerName:   claims.Worker,
+			MaxExpiresAt: claims.Expiry.Time(),
+		}
+		tm.mu.Lock()
+		tm.revoked[data.ID] = data.MaxExpiresAt
+		tm.mu.Unlock()
 	}
 
-	newExpiry := time.Now().Add(extension)
-	if newExpiry.Sub(data.IssuedAt) > tm.maxTTL {
-		newExpiry = data.IssuedAt.Add(tm.maxTTL)
+	if err := tm.PersistRevocations(ctx); err != nil {
+		return err
+	}
+	if tm.store == nil {
+		return nil
 	}
-	data.ExpiresAt = newExpiry
 
+	if err := tm.store.Delete(ctx, data); err != nil {
+		return fmt.Errorf("failed to delete persisted token: %w", err)
+	}
 	return nil
 }
 
-// CleanupExpired removes all expired tokens.
+// RevokedTokens returns the deny list of revoked, not yet expired tokens.
+func (tm *TokenManager) RevokedTokens() []RevokedToken {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+
+	now := time.Now()
+	result := make([]RevokedToken, 0, len(tm.revoked))
+	for id, expiresAt := range tm.revoked {
+		if now.After(expiresAt) {
+			continue
+		}
+		result = append(result, RevokedToken{ID: id, ExpiresAt: expiresAt})
+	}
+	return result
+}
+
+// GetWorkerEndpoint returns the worker endpoint for a token.
+func (tm *TokenManager) GetWorkerEndpoint(ctx context.Context, token string) (string, error) {
+	data, err := tm.ValidateToken(ctx, token)
+	if err != nil {
+		return "", err
+	}
+	return data.WorkerEndpoint, nil
+}
+
+// RefreshToken renews the lease of a token to extension from now, capped at the
+// expiry of the signed token. The renewed lease is persisted before it is returned.
+func (tm *TokenManager) RefreshToken(ctx context.Context, token string, extension time.Duration) (*TokenData, error) {
+	data, err := tm.ValidateToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	renewed := *data
+	renewed.ExpiresAt = time.Now().Add(extension)
+	if renewed.ExpiresAt.After(renewed.MaxExpiresAt) {
+		renewed.ExpiresAt = renewed.MaxExpiresAt
+	}
+
+	if tm.store != nil {
+		if err := tm.store.Save(ctx, &renewed); err != nil {
+			return nil, fmt.Errorf("failed to persist token: %w", err)
+		}
+	}
+
+	tm.mu.Lock()
+	if _, exists := tm.tokens[token]; exists {
+		tm.tokens[token] = &renewed
+		tm.scheduleLapse(&renewed)
+	}
+	tm.mu.Unlock()
+
+	return &renewed, nil
+}
+
+// CleanupExpired removes all expired tokens and deny list entries from memory.
+// Tokens whose lease lapsed before the signed token expired are added to the
+// deny list; normally their lapse already did so. Persisted allocations are
+// cleaned up by the worker controller when they expire.
 func (tm *TokenManager) CleanupExpired() int {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
@@ -180,11 +525,17 @@ func (tm *TokenManager) CleanupExpired() int {
 
 	for token, data := range tm.tokens {
 		if now.After(data.ExpiresAt) {
-			delete(tm.tokens, token)
+			tm.expireLocked(token, data)
 			expired++
 		}
 	}
 
+	for id, expiresAt := range tm.revoked {
+		if now.After(expiresAt) {
+			delete(tm.revoked, id)
+		}
+	}
+
 	return expired
 }
 
@@ -200,15 +551,17 @@ func (tm *TokenManager) ListTokens() []*TokenData {
 	return result
 }
 
-// signToken creates an HMAC-signed token string.
-func (tm *TokenManager) signToken(tokenBytes []byte) string {
-	mac := hmac.New(sha256.New, tm.secret)
-	mac.Write(tokenBytes)
-	signature := mac.Sum(nil)
+// GetTokenByID returns the active token with the given ID.
+func (tm *TokenManager) GetTokenByID(id string) (*TokenData, bool) {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
 
-	// Combine token and signature
-	combined := append(tokenBytes, signature...)
-	return base64.RawURLEncoding.EncodeToString(combined)
+	for _, data := range tm.tokens {
+		if data.ID == id {
+			return data, true
+		}
+	}
+	return nil, false
 }
 
 // Encode encodes token data to JSON for storage.
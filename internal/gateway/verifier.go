@@ -0,0 +1,206 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+
+	"github.com/smrt-devops/buildkit-controller/internal/utils"
+)
+
+const (
+	// DefaultVerifierSyncInterval is how often the verifier refreshes keys and the deny list.
+	DefaultVerifierSyncInterval = 15 * time.Second
+
+	// minKeyRefreshInterval limits refreshes triggered by unknown key IDs.
+	minKeyRefreshInterval = 5 * time.Second
+)
+
+// TokenVerifier verifies allocation tokens locally in the gateway.
+// It periodically syncs the controller's published key set and deny list, and
+// keeps using the last known state when the controller is unreachable.
+type TokenVerifier struct {
+	controllerEndpoint string
+	poolName           string
+	poolNamespace      string
+	httpClient         *http.Client
+	syncInterval       time.Duration
+	logger             utils.Logger
+
+	mu       sync.RWMutex
+	keys     jose.JSONWebKeySet
+	revoked  map[string]time.Time
+	lastSync time.Time
+}
+
+// TokenVerifierConfig configures a TokenVerifier.
+type TokenVerifierConfig struct {
+	ControllerEndpoint string
+	PoolName           string
+	PoolNamespace      string
+	HTTPClient         *http.Client
+	SyncInterval       time.Duration
+	Logger             utils.Logger
+}
+
+// NewTokenVerifier creates a new token verifier.
+func NewTokenVerifier(cfg TokenVerifierConfig) *TokenVerifier {
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	if cfg.SyncInterval == 0 {
+		cfg.SyncInterval = DefaultVerifierSyncInterval
+	}
+	return &TokenVerifier{
+		controllerEndpoint: cfg.ControllerEndpoint,
+		poolName:           cfg.PoolName,
+		poolNamespace:      cfg.PoolNamespace,
+		httpClient:         cfg.HTTPClient,
+		syncInterval:       cfg.SyncInterval,
+		logger:             cfg.Logger,
+		revoked:            make(map[string]time.Time),
+	}
+}
+
+// Run syncs the key set and deny list until the context is canceled.
+func (v *TokenVerifier) Run(ctx context.Context) {
+	if err := v.Sync(ctx); err != nil {
+		v.logger.Error(err, "Initial token verifier sync failed")
+	}
+
+	ticker := time.NewTicker(v.syncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := v.Sync(ctx); err != nil {
+				v.logger.Info("Token verifier sync failed, using cached state", "error", err)
+			}
+		}
+	}
+}
+
+// Sync fetches the key set and deny list from the controller.
+func (v *TokenVerifier) Sync(ctx context.Context) error {
+	var keys jose.JSONWebKeySet
+	if err := v.fetchJSON(ctx, "/api/v1/tokens/jwks", &keys); err != nil {
+		return fmt.Errorf("failed to fetch key set: %w", err)
+	}
+
+	var revocations RevocationList
+	if err := v.fetchJSON(ctx, "/api/v1/tokens/revoked", &revocations); err != nil {
+		return fmt.Errorf("failed to fetch deny list: %w", err)
+	}
+
+	now := time.Now()
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if len(keys.Keys) > 0 {
+		v.keys = keys
+	}
+
+	// Merge rather than replace, so entries survive a controller restart
+	for _, entry := range revocations.Revoked {
+		v.revoked[entry.ID] = entry.ExpiresAt
+	}
+	for id, expiresAt := range v.revoked {
+		if now.After(expiresAt.Add(tokenClockSkew)) {
+			delete(v.revoked, id)
+		}
+	}
+	v.lastSync = now
+
+	return nil
+}
+
+// Verify verifies a token and checks it belongs to this gateway's pool and
+// namespace and is not revoked.
+func (v *TokenVerifier) Verify(ctx context.Context, token string) (*AllocationClaims, error) {
+	v.mu.RLock()
+	keys := v.keys
+	v.mu.RUnlock()
+
+	claims, err := VerifyAllocationToken(token, &keys, time.Now())
+	if errors.Is(err, ErrUnknownSigningKey) && v.refreshAllowed() {
+		// The controller may have rotated its key since the last sync
+		if syncErr := v.Sync(ctx); syncErr != nil {
+			return nil, fmt.Errorf("%w (refresh failed: %v)", err, syncErr)
+		}
+		v.mu.RLock()
+		keys = v.keys
+		v.mu.RUnlock()
+		claims, err = VerifyAllocationToken(token, &keys, time.Now())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if v.poolName != "" && claims.Pool != v.poolName {
+		return nil, fmt.Errorf("token issued for pool %q, not %q", claims.Pool, v.poolName)
+	}
+	if v.poolNamespace != "" && claims.Namespace != v.poolNamespace {
+		return nil, fmt.Errorf("token issued for namespace %q, not %q", claims.Namespace, v.poolNamespace)
+	}
+
+	v.mu.RLock()
+	_, revoked := v.revoked[claims.ID]
+	v.mu.RUnlock()
+	if revoked {
+		return nil, ErrTokenRevoked
+	}
+
+	return claims, nil
+}
+
+// Lookup resolves a token to its worker endpoint. It satisfies WorkerLookup.
+func (v *TokenVerifier) Lookup(ctx context.Context, token string) (string, error) {
+	claims, err := v.Verify(ctx, token)
+	if err != nil {
+		return "", err
+	}
+	if claims.WorkerEndpoint == "" {
+		return "", fmt.Errorf("empty worker endpoint")
+	}
+	return claims.WorkerEndpoint, nil
+}
+
+func (v *TokenVerifier) refreshAllowed() bool {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return time.Since(v.lastSync) > minKeyRefreshInterval
+}
+
+func (v *TokenVerifier) fetchJSON(ctx context.Context, path string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.controllerEndpoint+path, http.NoBody)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := v.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("status %d, body: %s", resp.StatusCode, string(body))
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
@@ -1,70 +1,111 @@
 package metrics
 
 import (
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
+// factory registers metrics with the controller-runtime registry, which is what
+// the manager's metrics endpoint serves.
+var factory = promauto.With(ctrlmetrics.Registry)
+
 var (
 	// PoolsTotal is the total number of pools.
-	PoolsTotal = promauto.NewGauge(prometheus.GaugeOpts{
+	PoolsTotal = factory.NewGauge(prometheus.GaugeOpts{
 		Name: "buildkit_controller_pools_total",
 		Help: "Total number of BuildKit pools",
 	})
 
 	// WorkersTotal is the total number of workers.
-	WorkersTotal = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	WorkersTotal = factory.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "buildkit_controller_workers_total",
 		Help: "Total number of BuildKit workers",
 	}, []string{"pool", "namespace", "status"})
 
 	// CertificatesIssued is the total number of certificates issued.
-	CertificatesIssued = promauto.NewCounterVec(prometheus.CounterOpts{
+	CertificatesIssued = factory.NewCounterVec(prometheus.CounterOpts{
 		Name: "buildkit_controller_certificates_issued_total",
 		Help: "Total number of certificates issued",
 	}, []string{"type"})
 
 	// CertificateExpirations tracks certificate expiration times.
-	CertificateExpirations = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	CertificateExpirations = factory.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "buildkit_controller_certificate_expiry_seconds",
 		Help: "Certificate expiry time in seconds since epoch",
 	}, []string{"pool", "type"})
 
 	// APIRequestsTotal is the total number of API requests.
-	APIRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	APIRequestsTotal = factory.NewCounterVec(prometheus.CounterOpts{
 		Name: "buildkit_controller_api_requests_total",
 		Help: "Total number of API requests",
 	}, []string{"endpoint", "method", "status"})
 
 	// APIRequestDuration is the duration of API requests.
-	APIRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	APIRequestDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
 		Name:    "buildkit_controller_api_request_duration_seconds",
 		Help:    "Duration of API requests in seconds",
 		Buckets: prometheus.DefBuckets,
 	}, []string{"endpoint", "method"})
 
 	// OIDCVerificationsTotal is the total number of OIDC verifications.
-	OIDCVerificationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	OIDCVerificationsTotal = factory.NewCounterVec(prometheus.CounterOpts{
 		Name: "buildkit_controller_oidc_verifications_total",
 		Help: "Total number of OIDC token verifications",
 	}, []string{"issuer", "result"})
 
 	// ScaleOperationsTotal is the total number of scale operations.
-	ScaleOperationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	ScaleOperationsTotal = factory.NewCounterVec(prometheus.CounterOpts{
 		Name: "buildkit_controller_scale_operations_total",
 		Help: "Total number of scaling operations",
 	}, []string{"pool", "operation"})
 
 	// ReconciliationsTotal is the total number of reconciliations.
-	ReconciliationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	ReconciliationsTotal = factory.NewCounterVec(prometheus.CounterOpts{
 		Name: "buildkit_controller_reconciliations_total",
 		Help: "Total number of reconciliation loops",
 	}, []string{"controller", "result"})
 
 	// ReconciliationDuration is the duration of reconciliation loops.
-	ReconciliationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	ReconciliationDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
 		Name:    "buildkit_controller_reconciliation_duration_seconds",
 		Help:    "Duration of reconciliation loops in seconds",
 		Buckets: prometheus.DefBuckets,
 	}, []string{"controller"})
+
+	// AllocationQueueDepth is the number of worker allocations waiting in a pool's queue.
+	AllocationQueueDepth = factory.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "buildkit_controller_allocation_queue_depth",
+		Help: "Number of worker allocation requests waiting in the pool queue",
+	}, []string{"pool", "namespace"})
+
+	// AllocationQueueWait is the time worker allocations spent in a pool's queue.
+	AllocationQueueWait = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "buildkit_controller_allocation_queue_wait_seconds",
+		Help:    "Time worker allocation requests spent waiting in the pool queue in seconds",
+		Buckets: prometheus.ExponentialBuckets(0.5, 2, 12), // 0.5s to ~17m
+	}, []string{"pool", "namespace", "result"})
+
+	// WebhookDeliveriesTotal is the total number of lifecycle events delivered to webhooks.
+	WebhookDeliveriesTotal = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "buildkit_controller_webhook_deliveries_total",
+		Help: "Total number of lifecycle events delivered to webhooks",
+	}, []string{"webhook", "result"})
 )
+
+// ObserveReconcile records the result and duration of a reconciliation that
+// started at start. The result is "error", "requeue" or "success".
+func ObserveReconcile(controller string, start time.Time, result reconcile.Result, err error) {
+	outcome := "success"
+	switch {
+	case err != nil:
+		outcome = "error"
+	case result.Requeue || result.RequeueAfter > 0:
+		outcome = "requeue"
+	}
+	ReconciliationsTotal.WithLabelValues(controller, outcome).Inc()
+	ReconciliationDuration.WithLabelValues(controller).Observe(time.Since(start).Seconds())
+}
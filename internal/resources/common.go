@@ -46,6 +46,12 @@ func GetConfigMapName(poolName string) string {
 	return fmt.Sprintf("%s-config", poolName)
 }
 
+// GetCRLConfigMapName returns the name of the configmap holding the client
+// certificate revocation list for a pool's gateway.
+func GetCRLConfigMapName(poolName string) string {
+	return fmt.Sprintf("%s-crl", poolName)
+}
+
 // GetClientSecretName returns the client certificate secret name for a pool.
 func GetClientSecretName(poolName string) string {
 	return fmt.Sprintf("%s-client-certs", poolName)
@@ -25,6 +25,8 @@ type BuildkitdContainerSpec struct {
 	TLSEnabled       bool
 	Resources        corev1.ResourceRequirements
 	DefaultResources string
+	// Platforms overrides the platforms the OCI worker advertises, native platform first.
+	Platforms []string
 }
 
 // NewBuildkitdContainer creates a buildkitd container specification.
@@ -36,6 +38,10 @@ func NewBuildkitdContainer(spec *BuildkitdContainerSpec) corev1.Container {
 		"--oci-worker-no-process-sandbox",
 	}
 
+	for _, platform := range spec.Platforms {
+		args = append(args, "--oci-worker-platform", platform)
+	}
+
 	// Add TLS configuration if enabled
 	if spec.TLSEnabled {
 		args = append(args,
@@ -13,6 +13,8 @@ import (
 	gatewayapiv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
 
 	buildkitv1alpha1 "github.com/smrt-devops/buildkit-controller/api/v1alpha1"
+	"github.com/smrt-devops/buildkit-controller/internal/certs"
+	"github.com/smrt-devops/buildkit-controller/internal/utils"
 )
 
 const (
@@ -20,6 +22,20 @@ const (
 	GatewayPort = 1235
 	// GatewayMetricsPort is the metrics port
 	GatewayMetricsPort = 9090
+	// GatewayControllerTokenAudience is the audience of the projected ServiceAccount
+	// token the gateway uses to authenticate to the controller API. It differs from
+	// the client audiences, so gateway tokens are never accepted as client tokens
+	// and client tokens never as gateway tokens.
+	GatewayControllerTokenAudience = "buildkit-controller-gateway"
+	// GatewayControllerTokenDir is where the projected controller token is mounted.
+	GatewayControllerTokenDir = "/var/run/secrets/buildkit-controller"
+	// GatewayControllerTokenFile is the file name of the projected controller token.
+	GatewayControllerTokenFile = "token"
+	// GatewayCRLDir is where the client certificate revocation list is mounted.
+	GatewayCRLDir = "/etc/gateway/crl"
+
+	// gatewayControllerTokenExpiration is the requested lifetime of the projected token.
+	gatewayControllerTokenExpiration = int64(3600)
 )
 
 // GetGatewayDeploymentName returns the gateway deployment name for a pool.
@@ -27,6 +43,35 @@ func GetGatewayDeploymentName(poolName string) string {
 	return fmt.Sprintf("%s-gateway", poolName)
 }
 
+// GetGatewayServiceAccountName returns the gateway ServiceAccount name for a pool.
+// Each pool gateway gets its own ServiceAccount so the controller can tell which
+// pool a gateway request comes from.
+func GetGatewayServiceAccountName(poolName string) string {
+	return fmt.Sprintf("%s-gateway", poolName)
+}
+
+// GetGatewayServiceAccountUsername returns the Kubernetes username of a pool's gateway.
+func GetGatewayServiceAccountUsername(poolName, namespace string) string {
+	return fmt.Sprintf("system:serviceaccount:%s:%s", namespace, GetGatewayServiceAccountName(poolName))
+}
+
+// NewGatewayServiceAccount creates the ServiceAccount used by a pool's gateway.
+func NewGatewayServiceAccount(pool *buildkitv1alpha1.BuildKitPool) *corev1.ServiceAccount {
+	return &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      GetGatewayServiceAccountName(pool.Name),
+			Namespace: pool.Namespace,
+			Labels: map[string]string{
+				"app.kubernetes.io/name":           "buildkit-gateway",
+				"app.kubernetes.io/instance":       pool.Name,
+				"app.kubernetes.io/managed-by":     "buildkit-controller",
+				"buildkit.smrt-devops.net/pool":    pool.Name,
+				"buildkit.smrt-devops.net/purpose": "gateway",
+			},
+		},
+	}
+}
+
 // GetGatewayServiceName returns the gateway service name for a pool.
 func GetGatewayServiceName(poolName string) string {
 	return poolName // Pool name is the service name
@@ -64,6 +109,8 @@ func NewGatewayDeployment(pool *buildkitv1alpha1.BuildKitPool, gatewayImage stri
 	serverTLSSecret := GetSecretName(pool.Name)
 	workerTLSSecret := fmt.Sprintf("%s-client-certs", pool.Name)
 
+	tokenExpiration := gatewayControllerTokenExpiration
+
 	return &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      deploymentName,
@@ -80,6 +127,9 @@ func NewGatewayDeployment(pool *buildkitv1alpha1.BuildKitPool, gatewayImage stri
 					Labels: labels,
 				},
 				Spec: corev1.PodSpec{
+					ServiceAccountName: GetGatewayServiceAccountName(pool.Name),
+					// The gateway does not talk to the Kubernetes API, only to the controller
+					AutomountServiceAccountToken: utils.BoolPtr(false),
 					Containers: []corev1.Container{
 						{
 							Name:  "gateway",
@@ -89,7 +139,9 @@ func NewGatewayDeployment(pool *buildkitv1alpha1.BuildKitPool, gatewayImage stri
 								"--pool-namespace", pool.Namespace,
 								"--listen-addr", fmt.Sprintf("0.0.0.0:%d", GatewayPort),
 								"--controller-endpoint", controllerEndpoint,
+								"--controller-token-file", fmt.Sprintf("%s/%s", GatewayControllerTokenDir, GatewayControllerTokenFile),
 								"--metrics-addr", fmt.Sprintf("0.0.0.0:%d", GatewayMetricsPort),
+								"--crl-file", fmt.Sprintf("%s/%s", GatewayCRLDir, certs.CRLKey),
 								// mTLS to workers is automatic and internal (mandatory, no flags needed)
 							},
 							Ports: []corev1.ContainerPort{
@@ -115,6 +167,16 @@ func NewGatewayDeployment(pool *buildkitv1alpha1.BuildKitPool, gatewayImage stri
 									MountPath: "/etc/gateway/worker-tls",
 									ReadOnly:  true,
 								},
+								{
+									Name:      "controller-token",
+									MountPath: GatewayControllerTokenDir,
+									ReadOnly:  true,
+								},
+								{
+									Name:      "crl",
+									MountPath: GatewayCRLDir,
+									ReadOnly:  true,
+								},
 							},
 							Resources: corev1.ResourceRequirements{
 								Limits: corev1.ResourceList{
@@ -165,6 +227,35 @@ func NewGatewayDeployment(pool *buildkitv1alpha1.BuildKitPool, gatewayImage stri
 								},
 							},
 						},
+						{
+							// Published by the controller; optional so the gateway starts before the first CRL
+							Name: "crl",
+							VolumeSource: corev1.VolumeSource{
+								ConfigMap: &corev1.ConfigMapVolumeSource{
+									LocalObjectReference: corev1.LocalObjectReference{
+										Name: GetCRLConfigMapName(pool.Name),
+									},
+									Optional: utils.BoolPtr(true),
+								},
+							},
+						},
+						{
+							// Audience-bound token identifying this gateway to the controller API
+							Name: "controller-token",
+							VolumeSource: corev1.VolumeSource{
+								Projected: &corev1.ProjectedVolumeSource{
+									Sources: []corev1.VolumeProjection{
+										{
+											ServiceAccountToken: &corev1.ServiceAccountTokenProjection{
+												Audience:          GatewayControllerTokenAudience,
+												ExpirationSeconds: &tokenExpiration,
+												Path:              GatewayControllerTokenFile,
+											},
+										},
+									},
+								},
+							},
+						},
 					},
 				},
 			},
@@ -0,0 +1,130 @@
+package resources
+
+import (
+	"fmt"
+	"strings"
+
+	buildkitv1alpha1 "github.com/smrt-devops/buildkit-controller/api/v1alpha1"
+)
+
+const (
+	// DefaultWorkerGroupName is the name of the worker group of a pool that
+	// declares platforms without worker groups.
+	DefaultWorkerGroupName = "default"
+
+	// WorkerGroupLabel is the label holding the worker group of a worker.
+	WorkerGroupLabel = "buildkit.smrt-devops.net/worker-group"
+)
+
+// PoolWorkerGroups returns the worker groups of a pool. A pool with platforms
+// but no worker groups has a single default group; a pool with neither has no
+// groups, and its workers run on any node for the node's platform.
+func PoolWorkerGroups(pool *buildkitv1alpha1.BuildKitPool) []buildkitv1alpha1.WorkerGroup {
+	if len(pool.Spec.WorkerGroups) > 0 {
+		return pool.Spec.WorkerGroups
+	}
+	if len(pool.Spec.Platforms) > 0 {
+		return []buildkitv1alpha1.WorkerGroup{{
+			Name:      DefaultWorkerGroupName,
+			Platforms: pool.Spec.Platforms,
+		}}
+	}
+	return nil
+}
+
+// FindWorkerGroup returns the first worker group of a pool that supports every
+// requested platform. It returns nil and true when no platforms are requested
+// and the pool has no worker groups.
+func FindWorkerGroup(pool *buildkitv1alpha1.BuildKitPool, platforms []string) (*buildkitv1alpha1.WorkerGroup, bool) {
+	groups := PoolWorkerGroups(pool)
+	if len(groups) == 0 {
+		return nil, len(platforms) == 0
+	}
+	for i := range groups {
+		if SupportsPlatforms(groups[i].Platforms, platforms) {
+			return &groups[i], true
+		}
+	}
+	return nil, false
+}
+
+// GetWorkerGroup returns a pool's worker group by name.
+func GetWorkerGroup(pool *buildkitv1alpha1.BuildKitPool, name string) *buildkitv1alpha1.WorkerGroup {
+	groups := PoolWorkerGroups(pool)
+	for i := range groups {
+		if groups[i].Name == name {
+			return &groups[i]
+		}
+	}
+	return nil
+}
+
+// SupportsPlatforms reports whether a set of platforms includes every requested one.
+func SupportsPlatforms(supported, requested []string) bool {
+	for _, want := range requested {
+		found := false
+		for _, have := range supported {
+			if NormalizePlatform(have) == NormalizePlatform(want) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// NormalizePlatform lowercases a platform and drops the default variants of
+// amd64 and arm64, so linux/arm64/v8 matches linux/arm64.
+func NormalizePlatform(platform string) string {
+	platform = strings.ToLower(strings.TrimSpace(platform))
+	for _, suffix := range []string{"/amd64/v1", "/arm64/v8"} {
+		if strings.HasSuffix(platform, suffix) {
+			return strings.TrimSuffix(platform, suffix[strings.LastIndex(suffix, "/"):])
+		}
+	}
+	return platform
+}
+
+// ValidatePlatform checks that a platform has the form os/arch[/variant].
+func ValidatePlatform(platform string) error {
+	parts := strings.Split(platform, "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return fmt.Errorf("invalid platform %q, expected os/arch[/variant]", platform)
+	}
+	for _, part := range parts {
+		if part == "" {
+			return fmt.Errorf("invalid platform %q, expected os/arch[/variant]", platform)
+		}
+	}
+	return nil
+}
+
+// PlatformNodeSelector returns the node selector for workers of a native
+// platform, from the well-known kubernetes.io/os and kubernetes.io/arch labels.
+func PlatformNodeSelector(platform string) map[string]string {
+	parts := strings.Split(NormalizePlatform(platform), "/")
+	if len(parts) < 2 {
+		return nil
+	}
+	return map[string]string{
+		"kubernetes.io/os":   parts[0],
+		"kubernetes.io/arch": parts[1],
+	}
+}
+
+// ApplyWorkerGroup assigns a new worker to a worker group. A nil group leaves
+// the worker without platforms.
+func ApplyWorkerGroup(worker *buildkitv1alpha1.BuildKitWorker, group *buildkitv1alpha1.WorkerGroup) {
+	if group == nil {
+		return
+	}
+	worker.Spec.WorkerGroup = group.Name
+	worker.Spec.Platforms = append([]string(nil), group.Platforms...)
+	if worker.Labels == nil {
+		worker.Labels = make(map[string]string)
+	}
+	worker.Labels[WorkerGroupLabel] = group.Name
+}
@@ -3,8 +3,13 @@ package resources
 import (
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
+
+	buildkitv1alpha1 "github.com/smrt-devops/buildkit-controller/api/v1alpha1"
 )
 
+// WorkerSizeLabel is the label holding the size of a worker.
+const WorkerSizeLabel = "buildkit.smrt-devops.net/size"
+
 // NodeSizeResources defines resource requirements for different node sizes.
 type NodeSizeResources struct {
 	CPURequest    resource.Quantity
@@ -63,3 +68,66 @@ func GetResourceRequirements(nodeSize string) corev1.ResourceRequirements {
 		},
 	}
 }
+
+// FindWorkerSize returns the size of a pool for a requested size name. An empty
+// name selects the pool's first size. It returns nil and true when the pool
+// offers no sizes and none is requested.
+func FindWorkerSize(pool *buildkitv1alpha1.BuildKitPool, name string) (*buildkitv1alpha1.WorkerSize, bool) {
+	if len(pool.Spec.Sizes) == 0 {
+		return nil, name == ""
+	}
+	if name == "" {
+		return &pool.Spec.Sizes[0], true
+	}
+	for i := range pool.Spec.Sizes {
+		if pool.Spec.Sizes[i].Name == name {
+			return &pool.Spec.Sizes[i], true
+		}
+	}
+	return nil, false
+}
+
+// WorkerSizeName returns the name of a size, or "" for nil.
+func WorkerSizeName(size *buildkitv1alpha1.WorkerSize) string {
+	if size == nil {
+		return ""
+	}
+	return size.Name
+}
+
+// HasWarmSizes reports whether a pool keeps warm workers per size.
+func HasWarmSizes(pool *buildkitv1alpha1.BuildKitPool) bool {
+	for i := range pool.Spec.Sizes {
+		if pool.Spec.Sizes[i].Min != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// WorkerResources returns the buildkitd resources of a worker: its size's
+// resources if it has a size, else the pool's resources.buildkit.
+func WorkerResources(pool *buildkitv1alpha1.BuildKitPool, worker *buildkitv1alpha1.BuildKitWorker) corev1.ResourceRequirements {
+	if worker.Spec.Size == "" {
+		return pool.Spec.Resources.Buildkit
+	}
+	for i := range pool.Spec.Sizes {
+		if size := &pool.Spec.Sizes[i]; size.Name == worker.Spec.Size && size.Resources != nil {
+			return *size.Resources
+		}
+	}
+	return GetResourceRequirements(worker.Spec.Size)
+}
+
+// ApplyWorkerSize gives a new worker a pool worker size. A nil size leaves the
+// worker with the pool's resources.
+func ApplyWorkerSize(worker *buildkitv1alpha1.BuildKitWorker, size *buildkitv1alpha1.WorkerSize) {
+	if size == nil {
+		return
+	}
+	worker.Spec.Size = size.Name
+	if worker.Labels == nil {
+		worker.Labels = make(map[string]string)
+	}
+	worker.Labels[WorkerSizeLabel] = size.Name
+}
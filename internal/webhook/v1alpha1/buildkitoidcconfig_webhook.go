@@ -0,0 +1,126 @@
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	buildkitv1alpha1 "github.com/smrt-devops/buildkit-controller/api/v1alpha1"
+)
+
+const (
+	// defaultUserClaim is the claim identifying the user when claimsMapping.user is unset.
+	defaultUserClaim = "sub"
+	// defaultClientSecretKey is the key of the client secret when clientSecretRef.key is unset.
+	defaultClientSecretKey = "client-secret"
+)
+
+// SetupBuildKitOIDCConfigWebhookWithManager registers the BuildKitOIDCConfig webhooks with the manager.
+func SetupBuildKitOIDCConfigWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&buildkitv1alpha1.BuildKitOIDCConfig{}).
+		WithDefaulter(&BuildKitOIDCConfigCustomDefaulter{}).
+		WithValidator(&BuildKitOIDCConfigCustomValidator{}).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-buildkit-smrt-devops-net-v1alpha1-buildkitoidcconfig,mutating=true,failurePolicy=fail,sideEffects=None,groups=buildkit.smrt-devops.net,resources=buildkitoidcconfigs,verbs=create;update,versions=v1alpha1,name=mbuildkitoidcconfig.buildkit.smrt-devops.net,admissionReviewVersions=v1
+
+// BuildKitOIDCConfigCustomDefaulter persists the defaults of BuildKitOIDCConfigs.
+type BuildKitOIDCConfigCustomDefaulter struct{}
+
+var _ webhook.CustomDefaulter = &BuildKitOIDCConfigCustomDefaulter{}
+
+// Default implements webhook.CustomDefaulter.
+func (d *BuildKitOIDCConfigCustomDefaulter) Default(_ context.Context, obj runtime.Object) error {
+	config, ok := obj.(*buildkitv1alpha1.BuildKitOIDCConfig)
+	if !ok {
+		return fmt.Errorf("expected a BuildKitOIDCConfig but got %T", obj)
+	}
+
+	if config.Spec.ClaimsMapping.User == "" {
+		config.Spec.ClaimsMapping.User = defaultUserClaim
+	}
+	if ref := config.Spec.ClientSecretRef; ref != nil {
+		if ref.Namespace == "" {
+			ref.Namespace = config.Namespace
+		}
+		if ref.Key == "" {
+			ref.Key = defaultClientSecretKey
+		}
+	}
+	return nil
+}
+
+//+kubebuilder:webhook:path=/validate-buildkit-smrt-devops-net-v1alpha1-buildkitoidcconfig,mutating=false,failurePolicy=fail,sideEffects=None,groups=buildkit.smrt-devops.net,resources=buildkitoidcconfigs,verbs=create;update,versions=v1alpha1,name=vbuildkitoidcconfig.buildkit.smrt-devops.net,admissionReviewVersions=v1
+
+// BuildKitOIDCConfigCustomValidator rejects invalid BuildKitOIDCConfigs.
+type BuildKitOIDCConfigCustomValidator struct{}
+
+var _ webhook.CustomValidator = &BuildKitOIDCConfigCustomValidator{}
+
+// ValidateCreate implements webhook.CustomValidator.
+func (v *BuildKitOIDCConfigCustomValidator) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	config, ok := obj.(*buildkitv1alpha1.BuildKitOIDCConfig)
+	if !ok {
+		return nil, fmt.Errorf("expected a BuildKitOIDCConfig but got %T", obj)
+	}
+	return v.validate(config)
+}
+
+// ValidateUpdate implements webhook.CustomValidator.
+func (v *BuildKitOIDCConfigCustomValidator) ValidateUpdate(_ context.Context, _, newObj runtime.Object) (admission.Warnings, error) {
+	config, ok := newObj.(*buildkitv1alpha1.BuildKitOIDCConfig)
+	if !ok {
+		return nil, fmt.Errorf("expected a BuildKitOIDCConfig but got %T", newObj)
+	}
+	return v.validate(config)
+}
+
+// ValidateDelete implements webhook.CustomValidator.
+func (v *BuildKitOIDCConfigCustomValidator) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *BuildKitOIDCConfigCustomValidator) validate(config *buildkitv1alpha1.BuildKitOIDCConfig) (admission.Warnings, error) {
+	var warnings admission.Warnings
+	var errs field.ErrorList
+	specPath := field.NewPath("spec")
+
+	issuerPath := specPath.Child("issuer")
+	issuer, err := url.Parse(config.Spec.Issuer)
+	switch {
+	case err != nil:
+		errs = append(errs, field.Invalid(issuerPath, config.Spec.Issuer, err.Error()))
+	case issuer.Scheme != "https" && issuer.Scheme != "http", issuer.Host == "":
+		errs = append(errs, field.Invalid(issuerPath, config.Spec.Issuer, "must be an absolute https URL"))
+	case issuer.RawQuery != "" || issuer.Fragment != "":
+		errs = append(errs, field.Invalid(issuerPath, config.Spec.Issuer, "must not have a query or fragment"))
+	case issuer.Scheme == "http":
+		warnings = append(warnings, "issuer uses plain http, only use it for local testing")
+	}
+
+	if config.Spec.Audience == "" {
+		errs = append(errs, field.Required(specPath.Child("audience"), ""))
+	}
+	if ref := config.Spec.ClientSecretRef; ref != nil {
+		if ref.Name == "" {
+			errs = append(errs, field.Required(specPath.Child("clientSecretRef", "name"), ""))
+		}
+		if config.Spec.ClientID == "" {
+			errs = append(errs, field.Required(specPath.Child("clientID"), "required when clientSecretRef is set"))
+		}
+	}
+
+	if len(errs) > 0 {
+		return warnings, apierrors.NewInvalid(buildkitv1alpha1.GroupVersion.WithKind("BuildKitOIDCConfig").GroupKind(), config.Name, errs)
+	}
+	return warnings, nil
+}
@@ -0,0 +1,290 @@
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	cron "github.com/robfig/cron/v3"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	buildkitv1alpha1 "github.com/smrt-devops/buildkit-controller/api/v1alpha1"
+	"github.com/smrt-devops/buildkit-controller/internal/controller/shared"
+)
+
+// SetupBuildKitPoolWebhookWithManager registers the BuildKitPool webhooks with the manager.
+// Pools using an ingress type not in allowedIngressTypes are rejected.
+func SetupBuildKitPoolWebhookWithManager(mgr ctrl.Manager, allowedIngressTypes []string) error {
+	allowed := make(map[string]bool)
+	for _, t := range allowedIngressTypes {
+		allowed[strings.ToLower(t)] = true
+	}
+
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&buildkitv1alpha1.BuildKitPool{}).
+		WithDefaulter(&BuildKitPoolCustomDefaulter{}).
+		WithValidator(&BuildKitPoolCustomValidator{Client: mgr.GetClient(), AllowedIngressTypes: allowed}).
+		Complete()
+}
+
+// SetupBuildKitPoolConversionWebhookWithManager registers only the conversion
+// webhook for BuildKitPool, for when the admission webhooks are disabled.
+func SetupBuildKitPoolConversionWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&buildkitv1alpha1.BuildKitPool{}).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-buildkit-smrt-devops-net-v1alpha1-buildkitpool,mutating=true,failurePolicy=fail,sideEffects=None,groups=buildkit.smrt-devops.net,resources=buildkitpools,verbs=create;update,versions=v1alpha1,name=mbuildkitpool.buildkit.smrt-devops.net,admissionReviewVersions=v1
+
+// BuildKitPoolCustomDefaulter persists the defaults of BuildKitPools.
+type BuildKitPoolCustomDefaulter struct{}
+
+var _ webhook.CustomDefaulter = &BuildKitPoolCustomDefaulter{}
+
+// Default implements webhook.CustomDefaulter. Pools referencing a
+// BuildKitPoolClass only get gateway.enabled; the rest is left unset so the
+// class defaults apply.
+func (d *BuildKitPoolCustomDefaulter) Default(ctx context.Context, obj runtime.Object) error {
+	pool, ok := obj.(*buildkitv1alpha1.BuildKitPool)
+	if !ok {
+		return fmt.Errorf("expected a BuildKitPool but got %T", obj)
+	}
+
+	// The gateway is enabled unless the pool turns it off explicitly
+	if !fieldSet(ctx, "spec", "gateway", "enabled") {
+		pool.Spec.Gateway.Enabled = true
+	}
+	if pool.Spec.ClassName != "" {
+		return nil
+	}
+
+	if pool.Spec.TLS.Mode == "" {
+		pool.Spec.TLS.Mode = buildkitv1alpha1.TLSModeAuto
+	}
+	pool.Spec.TLS.Enabled = true
+
+	if pool.Spec.Networking.ServiceType == "" {
+		pool.Spec.Networking.ServiceType = buildkitv1alpha1.ServiceTypeClusterIP
+	}
+	if pool.Spec.Networking.Port == nil {
+		port := shared.DefaultGatewayPort
+		pool.Spec.Networking.Port = &port
+	}
+	if pool.Spec.Gateway.Replicas == nil {
+		replicas := int32(1)
+		pool.Spec.Gateway.Replicas = &replicas
+	}
+	return nil
+}
+
+//+kubebuilder:webhook:path=/validate-buildkit-smrt-devops-net-v1alpha1-buildkitpool,mutating=false,failurePolicy=fail,sideEffects=None,groups=buildkit.smrt-devops.net,resources=buildkitpools,verbs=create;update,versions=v1alpha1,name=vbuildkitpool.buildkit.smrt-devops.net,admissionReviewVersions=v1
+
+// BuildKitPoolCustomValidator rejects invalid BuildKitPools. Pools referencing a
+// BuildKitPoolClass are validated with the class applied and may not override
+// the fields it locks.
+type BuildKitPoolCustomValidator struct {
+	Client              client.Reader
+	AllowedIngressTypes map[string]bool
+}
+
+var _ webhook.CustomValidator = &BuildKitPoolCustomValidator{}
+
+// ValidateCreate implements webhook.CustomValidator.
+func (v *BuildKitPoolCustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	pool, ok := obj.(*buildkitv1alpha1.BuildKitPool)
+	if !ok {
+		return nil, fmt.Errorf("expected a BuildKitPool but got %T", obj)
+	}
+	return v.validate(ctx, pool)
+}
+
+// ValidateUpdate implements webhook.CustomValidator.
+func (v *BuildKitPoolCustomValidator) ValidateUpdate(ctx context.Context, _, newObj runtime.Object) (admission.Warnings, error) {
+	pool, ok := newObj.(*buildkitv1alpha1.BuildKitPool)
+	if !ok {
+		return nil, fmt.Errorf("expected a BuildKitPool but got %T", newObj)
+	}
+	return v.validate(ctx, pool)
+}
+
+// ValidateDelete implements webhook.CustomValidator.
+func (v *BuildKitPoolCustomValidator) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *BuildKitPoolCustomValidator) validate(ctx context.Context, pool *buildkitv1alpha1.BuildKitPool) (admission.Warnings, error) {
+	var warnings admission.Warnings
+	var errs field.ErrorList
+	specPath := field.NewPath("spec")
+
+	effective := pool.DeepCopy()
+	if pool.Spec.ClassName != "" {
+		spec, err := requestSpec(ctx)
+		if err != nil {
+			return nil, err
+		}
+		overridden, err := shared.ApplyPoolClassToSpec(ctx, v.Client, effective, spec)
+		switch {
+		case apierrors.IsNotFound(err):
+			warnings = append(warnings, fmt.Sprintf("pool class %q not found, the pool is not reconciled until it exists", pool.Spec.ClassName))
+			effective = pool.DeepCopy()
+		case err != nil:
+			return nil, err
+		}
+		for _, locked := range overridden {
+			errs = append(errs, field.Forbidden(specPath.Child(locked),
+				fmt.Sprintf("locked by pool class %q", pool.Spec.ClassName)))
+		}
+	}
+
+	errs = append(errs, v.validateSpec(&effective.Spec, specPath)...)
+	if len(errs) > 0 {
+		return warnings, apierrors.NewInvalid(buildkitv1alpha1.GroupVersion.WithKind("BuildKitPool").GroupKind(), pool.Name, errs)
+	}
+	return warnings, nil
+}
+
+func (v *BuildKitPoolCustomValidator) validateSpec(spec *buildkitv1alpha1.BuildKitPoolSpec, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	// Scaling
+	scalingPath := path.Child("scaling")
+	scaling := spec.Scaling
+	if scaling.Min != nil && scaling.Max != nil && *scaling.Min > *scaling.Max {
+		errs = append(errs, field.Invalid(scalingPath.Child("min"), *scaling.Min, "must not be greater than scaling.max"))
+	}
+	if scaling.ScaleDownSchedule != "" {
+		parser := cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
+		if _, err := parser.Parse(scaling.ScaleDownSchedule); err != nil {
+			errs = append(errs, field.Invalid(scalingPath.Child("scaleDownSchedule"), scaling.ScaleDownSchedule, err.Error()))
+		}
+	}
+	validateDuration(scalingPath.Child("scaleDownDelay"), scaling.ScaleDownDelay, &errs)
+
+	sizeNames := make(map[string]bool)
+	for i, size := range spec.Sizes {
+		sizePath := path.Child("sizes").Index(i)
+		if sizeNames[size.Name] {
+			errs = append(errs, field.Duplicate(sizePath.Child("name"), size.Name))
+		}
+		sizeNames[size.Name] = true
+		if size.Min != nil && size.Max != nil && *size.Min > *size.Max {
+			errs = append(errs, field.Invalid(sizePath.Child("min"), *size.Min, "must not be greater than max"))
+		}
+	}
+
+	groupNames := make(map[string]bool)
+	for i, group := range spec.WorkerGroups {
+		if groupNames[group.Name] {
+			errs = append(errs, field.Duplicate(path.Child("workerGroups").Index(i).Child("name"), group.Name))
+		}
+		groupNames[group.Name] = true
+	}
+
+	// Cache
+	for i, backend := range spec.Cache.Backends {
+		backendPath := path.Child("cache", "backends").Index(i)
+		switch {
+		case backend.Type == "registry" && backend.Registry == nil:
+			errs = append(errs, field.Required(backendPath.Child("registry"), "required when type is registry"))
+		case backend.Type == "s3" && backend.S3 == nil:
+			errs = append(errs, field.Required(backendPath.Child("s3"), "required when type is s3"))
+		case backend.Type == "local" && backend.Local == nil:
+			errs = append(errs, field.Required(backendPath.Child("local"), "required when type is local"))
+		}
+	}
+
+	// TLS
+	tlsPath := path.Child("tls")
+	if spec.TLS.Mode == buildkitv1alpha1.TLSModeManual {
+		if spec.TLS.Manual == nil {
+			errs = append(errs, field.Required(tlsPath.Child("manual"), "required when mode is manual"))
+		} else {
+			if spec.TLS.Manual.ServerCertSecret == "" {
+				errs = append(errs, field.Required(tlsPath.Child("manual", "serverCertSecret"), "required when mode is manual"))
+			}
+			if spec.TLS.Manual.CASecret == "" {
+				errs = append(errs, field.Required(tlsPath.Child("manual", "caSecret"), "required when mode is manual"))
+			}
+		}
+	}
+	if spec.TLS.Auto != nil {
+		certDuration := validateDuration(tlsPath.Child("auto", "serverCertDuration"), spec.TLS.Auto.ServerCertDuration, &errs)
+		rotateBefore := validateDuration(tlsPath.Child("auto", "rotateBeforeExpiry"), spec.TLS.Auto.RotateBeforeExpiry, &errs)
+		if certDuration > 0 && rotateBefore >= certDuration {
+			errs = append(errs, field.Invalid(tlsPath.Child("auto", "rotateBeforeExpiry"), spec.TLS.Auto.RotateBeforeExpiry, "must be shorter than serverCertDuration"))
+		}
+	}
+
+	// Auth
+	for i, method := range spec.Auth.Methods {
+		methodPath := path.Child("auth", "methods").Index(i)
+		switch method.Type {
+		case buildkitv1alpha1.AuthMethodToken:
+			if method.Token == nil || method.Token.SecretRef == "" {
+				errs = append(errs, field.Required(methodPath.Child("token", "secretRef"), "required when type is token"))
+			}
+		case buildkitv1alpha1.AuthMethodOIDC:
+			if method.OIDC == nil && method.OIDCConfigRef == nil {
+				errs = append(errs, field.Required(methodPath.Child("oidc"), "oidc or oidcConfigRef is required when type is oidc"))
+			}
+			if ref := method.OIDCConfigRef; ref != nil && ref.Name == "" {
+				errs = append(errs, field.Required(methodPath.Child("oidcConfigRef", "name"), ""))
+			}
+		}
+	}
+
+	// Gateway
+	gatewayPath := path.Child("gateway")
+	tokenTTL := validateDuration(gatewayPath.Child("tokenTTL"), spec.Gateway.TokenTTL, &errs)
+	maxTokenTTL := validateDuration(gatewayPath.Child("maxTokenTTL"), spec.Gateway.MaxTokenTTL, &errs)
+	if tokenTTL > 0 && maxTokenTTL > 0 && tokenTTL > maxTokenTTL {
+		errs = append(errs, field.Invalid(gatewayPath.Child("tokenTTL"), spec.Gateway.TokenTTL, "must not be longer than maxTokenTTL"))
+	}
+	validateDuration(gatewayPath.Child("idleLeaseTimeout"), spec.Gateway.IdleLeaseTimeout, &errs)
+
+	if ingress := spec.Gateway.Ingress; ingress != nil && ingress.Enabled {
+		ingressPath := gatewayPath.Child("ingress")
+		if !v.AllowedIngressTypes["ingress"] {
+			errs = append(errs, field.Forbidden(ingressPath.Child("enabled"), "Kubernetes Ingress is not enabled for this controller"))
+		}
+		if ingress.Hostname == "" {
+			errs = append(errs, field.Required(ingressPath.Child("hostname"), "required when enabled"))
+		}
+		if ingress.TLS != nil && ingress.TLS.Enabled && ingress.TLS.SecretName == "" {
+			errs = append(errs, field.Required(ingressPath.Child("tls", "secretName"), "required when TLS is enabled"))
+		}
+	}
+	if gatewayAPI := spec.Gateway.GatewayAPI; gatewayAPI != nil && gatewayAPI.Enabled {
+		gatewayAPIPath := gatewayPath.Child("gatewayAPI")
+		if !v.AllowedIngressTypes["gatewayapi"] {
+			errs = append(errs, field.Forbidden(gatewayAPIPath.Child("enabled"), "Gateway API is not enabled for this controller"))
+		}
+		if gatewayAPI.Hostname == "" {
+			errs = append(errs, field.Required(gatewayAPIPath.Child("hostname"), "required when enabled"))
+		}
+	}
+
+	// Quotas
+	quotaNames := make(map[string]bool)
+	for i, quota := range spec.Quotas {
+		quotaPath := path.Child("quotas").Index(i)
+		if quotaNames[quota.Name] {
+			errs = append(errs, field.Duplicate(quotaPath.Child("name"), quota.Name))
+		}
+		quotaNames[quota.Name] = true
+		if quota.Scope == buildkitv1alpha1.QuotaScopeClaim && quota.Claim == "" {
+			errs = append(errs, field.Required(quotaPath.Child("claim"), "required when scope is Claim"))
+		}
+		validateDuration(quotaPath.Child("maxTTL"), quota.MaxTTL, &errs)
+	}
+
+	return errs
+}
@@ -0,0 +1,129 @@
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	buildkitv1alpha1 "github.com/smrt-devops/buildkit-controller/api/v1alpha1"
+)
+
+// SetupBuildKitWorkerWebhookWithManager registers the BuildKitWorker webhooks with the manager.
+func SetupBuildKitWorkerWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&buildkitv1alpha1.BuildKitWorker{}).
+		WithDefaulter(&BuildKitWorkerCustomDefaulter{}).
+		WithValidator(&BuildKitWorkerCustomValidator{}).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-buildkit-smrt-devops-net-v1alpha1-buildkitworker,mutating=true,failurePolicy=fail,sideEffects=None,groups=buildkit.smrt-devops.net,resources=buildkitworkers,verbs=create;update,versions=v1alpha1,name=mbuildkitworker.buildkit.smrt-devops.net,admissionReviewVersions=v1
+
+// BuildKitWorkerCustomDefaulter persists the defaults of BuildKitWorkers.
+type BuildKitWorkerCustomDefaulter struct{}
+
+var _ webhook.CustomDefaulter = &BuildKitWorkerCustomDefaulter{}
+
+// Default implements webhook.CustomDefaulter.
+func (d *BuildKitWorkerCustomDefaulter) Default(_ context.Context, obj runtime.Object) error {
+	worker, ok := obj.(*buildkitv1alpha1.BuildKitWorker)
+	if !ok {
+		return fmt.Errorf("expected a BuildKitWorker but got %T", obj)
+	}
+
+	if worker.Spec.PoolRef.Namespace == "" {
+		worker.Spec.PoolRef.Namespace = worker.Namespace
+	}
+	return nil
+}
+
+//+kubebuilder:webhook:path=/validate-buildkit-smrt-devops-net-v1alpha1-buildkitworker,mutating=false,failurePolicy=fail,sideEffects=None,groups=buildkit.smrt-devops.net,resources=buildkitworkers,verbs=create;update,versions=v1alpha1,name=vbuildkitworker.buildkit.smrt-devops.net,admissionReviewVersions=v1
+
+// BuildKitWorkerCustomValidator rejects invalid BuildKitWorkers. A worker's pool,
+// worker group, platforms and size are fixed when it is created.
+type BuildKitWorkerCustomValidator struct{}
+
+var _ webhook.CustomValidator = &BuildKitWorkerCustomValidator{}
+
+// ValidateCreate implements webhook.CustomValidator.
+func (v *BuildKitWorkerCustomValidator) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	worker, ok := obj.(*buildkitv1alpha1.BuildKitWorker)
+	if !ok {
+		return nil, fmt.Errorf("expected a BuildKitWorker but got %T", obj)
+	}
+	return nil, invalidWorker(worker, validateWorkerAllocation(worker))
+}
+
+// ValidateUpdate implements webhook.CustomValidator.
+func (v *BuildKitWorkerCustomValidator) ValidateUpdate(_ context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	oldWorker, ok := oldObj.(*buildkitv1alpha1.BuildKitWorker)
+	if !ok {
+		return nil, fmt.Errorf("expected a BuildKitWorker but got %T", oldObj)
+	}
+	worker, ok := newObj.(*buildkitv1alpha1.BuildKitWorker)
+	if !ok {
+		return nil, fmt.Errorf("expected a BuildKitWorker but got %T", newObj)
+	}
+
+	errs := validateWorkerAllocation(worker)
+	specPath := field.NewPath("spec")
+	// Workers admitted before the defaulter may still leave the pool namespace unset
+	oldPoolRef := oldWorker.Spec.PoolRef
+	if oldPoolRef.Namespace == "" {
+		oldPoolRef.Namespace = oldWorker.Namespace
+	}
+	if worker.Spec.PoolRef != oldPoolRef {
+		errs = append(errs, field.Forbidden(specPath.Child("poolRef"), "cannot be changed"))
+	}
+	if worker.Spec.WorkerGroup != oldWorker.Spec.WorkerGroup {
+		errs = append(errs, field.Forbidden(specPath.Child("workerGroup"), "cannot be changed"))
+	}
+	if !apiequality.Semantic.DeepEqual(worker.Spec.Platforms, oldWorker.Spec.Platforms) {
+		errs = append(errs, field.Forbidden(specPath.Child("platforms"), "cannot be changed"))
+	}
+	if worker.Spec.Size != oldWorker.Spec.Size {
+		errs = append(errs, field.Forbidden(specPath.Child("size"), "cannot be changed"))
+	}
+	return nil, invalidWorker(worker, errs)
+}
+
+// ValidateDelete implements webhook.CustomValidator.
+func (v *BuildKitWorkerCustomValidator) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// validateWorkerAllocation checks the allocation of a worker, if it has one.
+func validateWorkerAllocation(worker *buildkitv1alpha1.BuildKitWorker) field.ErrorList {
+	allocation := worker.Spec.Allocation
+	if allocation == nil {
+		return nil
+	}
+
+	var errs field.ErrorList
+	allocationPath := field.NewPath("spec", "allocation")
+	if allocation.JobID == "" {
+		errs = append(errs, field.Required(allocationPath.Child("jobId"), ""))
+	}
+	if allocation.Token == "" {
+		errs = append(errs, field.Required(allocationPath.Child("token"), ""))
+	}
+	if allocation.ExpiresAt != nil && allocation.ExpiresAt.Before(&allocation.AllocatedAt) {
+		errs = append(errs, field.Invalid(allocationPath.Child("expiresAt"), allocation.ExpiresAt, "must not be before allocatedAt"))
+	}
+	return errs
+}
+
+// invalidWorker returns the Invalid error for a worker's validation errors, or nil.
+func invalidWorker(worker *buildkitv1alpha1.BuildKitWorker, errs field.ErrorList) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(buildkitv1alpha1.GroupVersion.WithKind("BuildKitWorker").GroupKind(), worker.Name, errs)
+}
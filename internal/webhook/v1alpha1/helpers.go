@@ -0,0 +1,71 @@
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utiljson "k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// fieldSet reports whether the object in the admission request sets a field.
+// Defaulters use it for fields whose zero value is valid, such as bools
+// defaulting to true, which the decoded object cannot tell apart from unset.
+// Without a request the field is assumed to be set, leaving it as is.
+func fieldSet(ctx context.Context, path ...string) bool {
+	object, ok := requestObject(ctx)
+	if !ok {
+		return true
+	}
+	_, found, err := unstructured.NestedFieldNoCopy(object, path...)
+	return found || err != nil
+}
+
+// requestSpec returns the spec of the object in the admission request as
+// unstructured, with only the fields the request sets.
+func requestSpec(ctx context.Context) (map[string]interface{}, error) {
+	object, ok := requestObject(ctx)
+	if !ok {
+		return nil, fmt.Errorf("no admission request object")
+	}
+	spec, _, err := unstructured.NestedMap(object, "spec")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spec: %w", err)
+	}
+	return spec, nil
+}
+
+// requestObject decodes the object in the admission request.
+func requestObject(ctx context.Context) (map[string]interface{}, bool) {
+	req, err := admission.RequestFromContext(ctx)
+	if err != nil || len(req.Object.Raw) == 0 {
+		return nil, false
+	}
+
+	var object map[string]interface{}
+	if err := utiljson.Unmarshal(req.Object.Raw, &object); err != nil {
+		return nil, false
+	}
+	return object, true
+}
+
+// validateDuration checks that an optional duration parses and is positive.
+// It returns the parsed duration, or 0 if it is unset or invalid.
+func validateDuration(path *field.Path, value string, errs *field.ErrorList) time.Duration {
+	if value == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		*errs = append(*errs, field.Invalid(path, value, "must be a duration such as 30m or 24h"))
+		return 0
+	}
+	if d <= 0 {
+		*errs = append(*errs, field.Invalid(path, value, "must be positive"))
+		return 0
+	}
+	return d
+}
@@ -0,0 +1,130 @@
+// Package webhooks sends worker allocation lifecycle events to outbound
+// webhooks as CloudEvents.
+package webhooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+)
+
+// EventType is the kind of lifecycle event. Webhooks filter on these values; the
+// CloudEvents type is the event type prefixed with TypePrefix.
+type EventType string
+
+const (
+	// EventWorkerAllocated is sent when a worker is allocated to a job.
+	EventWorkerAllocated EventType = "worker.allocated"
+	// EventWorkerReady is sent when a worker pod becomes ready.
+	EventWorkerReady EventType = "worker.ready"
+	// EventWorkerExpired is sent when an allocation expires and its worker is deleted.
+	EventWorkerExpired EventType = "worker.expired"
+	// EventWorkerFailed is sent when a worker fails.
+	EventWorkerFailed EventType = "worker.failed"
+	// EventWorkerReleased is sent when a worker is released by its owner or revoked by an admin.
+	EventWorkerReleased EventType = "worker.released"
+
+	// TypePrefix is the reverse-DNS prefix of CloudEvents types.
+	TypePrefix = "net.smrt-devops.buildkit."
+)
+
+// EventTypes lists every event type.
+var EventTypes = []EventType{
+	EventWorkerAllocated,
+	EventWorkerReady,
+	EventWorkerExpired,
+	EventWorkerFailed,
+	EventWorkerReleased,
+}
+
+// Config is the webhook configuration file.
+type Config struct {
+	Webhooks []Endpoint `json:"webhooks"`
+}
+
+// Endpoint is an outbound webhook.
+type Endpoint struct {
+	// Name identifies the webhook in logs and metrics.
+	Name string `json:"name"`
+	// URL receives events as HTTP POST requests.
+	URL string `json:"url"`
+	// Secret is the HMAC-SHA256 key events are signed with. Optional, but
+	// without it receivers cannot tell events from forgeries.
+	Secret string `json:"secret,omitempty"`
+	// Pools limits the webhook to pools matching one of these patterns, either
+	// "name" or "namespace/name", with an optional trailing "*". Empty matches
+	// every pool.
+	Pools []string `json:"pools,omitempty"`
+	// Events limits the webhook to these event types. Empty sends every event.
+	Events []EventType `json:"events,omitempty"`
+}
+
+// LoadConfig reads and validates a JSON webhook configuration file.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read webhook config: %w", err)
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse webhook config: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// Validate checks that every webhook has a unique name, a valid URL and known event types.
+func (c *Config) Validate() error {
+	names := make(map[string]bool, len(c.Webhooks))
+	for _, endpoint := range c.Webhooks {
+		if endpoint.Name == "" {
+			return fmt.Errorf("webhook with URL %q has no name", endpoint.URL)
+		}
+		if names[endpoint.Name] {
+			return fmt.Errorf("duplicate webhook name %q", endpoint.Name)
+		}
+		names[endpoint.Name] = true
+
+		u, err := url.Parse(endpoint.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("webhook %q: invalid URL %q", endpoint.Name, endpoint.URL)
+		}
+		for _, eventType := range endpoint.Events {
+			if !slices.Contains(EventTypes, eventType) {
+				return fmt.Errorf("webhook %q: unknown event type %q", endpoint.Name, eventType)
+			}
+		}
+	}
+	return nil
+}
+
+// matches reports whether the webhook wants an event.
+func (e *Endpoint) matches(event *Event) bool {
+	if len(e.Events) > 0 && !slices.Contains(e.Events, event.Type) {
+		return false
+	}
+	if len(e.Pools) == 0 {
+		return true
+	}
+	qualified := event.Namespace + "/" + event.Pool
+	for _, pattern := range e.Pools {
+		if matchPattern(event.Pool, pattern) || matchPattern(qualified, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPattern matches a value against an exact pattern, "*", or a "prefix*".
+func matchPattern(value, pattern string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(value, prefix)
+	}
+	return value == pattern
+}
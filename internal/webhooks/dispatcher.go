@@ -0,0 +1,230 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/smrt-devops/buildkit-controller/internal/metrics"
+	"github.com/smrt-devops/buildkit-controller/internal/utils"
+)
+
+const (
+	// SignatureHeader carries the hex HMAC-SHA256 of the request body, keyed
+	// with the webhook secret, as "sha256=<hex>".
+	SignatureHeader = "X-BuildKit-Signature-256"
+
+	// queueSize is how many events may wait per webhook before new events are dropped.
+	queueSize = 256
+	// maxAttempts is how often an event is sent before it is dropped.
+	maxAttempts = 5
+	// initialBackoff is the wait before the first retry; it doubles per attempt.
+	initialBackoff = 1 * time.Second
+	// maxBackoff caps the wait between retries.
+	maxBackoff = 30 * time.Second
+)
+
+// Event is a worker lifecycle event.
+type Event struct {
+	Type      EventType
+	Pool      string
+	Namespace string
+	Worker    string
+	// Allocation details, when the worker is allocated.
+	JobID        string
+	AllocationID string
+	RequestedBy  string
+	// Phase is the worker phase after the event.
+	Phase   string
+	Message string
+}
+
+// EventData is the data of a CloudEvent.
+type EventData struct {
+	Pool         string `json:"pool"`
+	Namespace    string `json:"namespace"`
+	Worker       string `json:"worker,omitempty"`
+	JobID        string `json:"jobId,omitempty"`
+	AllocationID string `json:"allocationId,omitempty"`
+	RequestedBy  string `json:"requestedBy,omitempty"`
+	Phase        string `json:"phase,omitempty"`
+	Message      string `json:"message,omitempty"`
+}
+
+// CloudEvent is a CloudEvents 1.0 event in structured JSON mode.
+type CloudEvent struct {
+	SpecVersion     string    `json:"specversion"`
+	ID              string    `json:"id"`
+	Source          string    `json:"source"`
+	Type            string    `json:"type"`
+	Subject         string    `json:"subject,omitempty"`
+	Time            time.Time `json:"time"`
+	DataContentType string    `json:"datacontenttype"`
+	Data            EventData `json:"data"`
+}
+
+// newCloudEvent wraps an event in a CloudEvent with a new ID.
+func newCloudEvent(event *Event) *CloudEvent {
+	return &CloudEvent{
+		SpecVersion:     "1.0",
+		ID:              uuid.New().String(),
+		Source:          fmt.Sprintf("/buildkit-controller/namespaces/%s/pools/%s", event.Namespace, event.Pool),
+		Type:            TypePrefix + string(event.Type),
+		Subject:         event.Worker,
+		Time:            time.Now().UTC(),
+		DataContentType: "application/json",
+		Data: EventData{
+			Pool:         event.Pool,
+			Namespace:    event.Namespace,
+			Worker:       event.Worker,
+			JobID:        event.JobID,
+			AllocationID: event.AllocationID,
+			RequestedBy:  event.RequestedBy,
+			Phase:        event.Phase,
+			Message:      event.Message,
+		},
+	}
+}
+
+// Dispatcher delivers events to the configured webhooks. Each webhook has its
+// own queue and delivery goroutine, so a slow or failing webhook does not delay
+// the others, and Emit never blocks. A nil Dispatcher discards events.
+type Dispatcher struct {
+	webhooks []*webhook
+	log      utils.Logger
+}
+
+type webhook struct {
+	Endpoint
+	queue chan *CloudEvent
+}
+
+// NewDispatcher creates a dispatcher for the configured webhooks. Events are
+// queued until Start is called.
+func NewDispatcher(cfg *Config, log utils.Logger) *Dispatcher {
+	d := &Dispatcher{log: log}
+	for _, endpoint := range cfg.Webhooks {
+		d.webhooks = append(d.webhooks, &webhook{
+			Endpoint: endpoint,
+			queue:    make(chan *CloudEvent, queueSize),
+		})
+	}
+	return d
+}
+
+// Emit queues an event for every webhook that wants it.
+func (d *Dispatcher) Emit(event Event) {
+	if d == nil {
+		return
+	}
+
+	var cloudEvent *CloudEvent
+	for _, wh := range d.webhooks {
+		if !wh.matches(&event) {
+			continue
+		}
+		if cloudEvent == nil {
+			cloudEvent = newCloudEvent(&event)
+		}
+		select {
+		case wh.queue <- cloudEvent:
+		default:
+			metrics.WebhookDeliveriesTotal.WithLabelValues(wh.Name, "dropped").Inc()
+			d.log.Info("Webhook queue is full, dropping event", "webhook", wh.Name, "type", event.Type, "worker", event.Worker)
+		}
+	}
+}
+
+// Start delivers queued events until the context is canceled. It implements
+// manager.Runnable.
+func (d *Dispatcher) Start(ctx context.Context) error {
+	client := &http.Client{Timeout: 10 * time.Second}
+	for _, wh := range d.webhooks {
+		go d.deliverLoop(ctx, client, wh)
+	}
+	d.log.Info("Started webhook dispatcher", "webhooks", len(d.webhooks))
+	<-ctx.Done()
+	return nil
+}
+
+func (d *Dispatcher) deliverLoop(ctx context.Context, client *http.Client, wh *webhook) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-wh.queue:
+			d.deliver(ctx, client, wh, event)
+		}
+	}
+}
+
+// deliver sends an event, retrying failed attempts with exponential backoff.
+func (d *Dispatcher) deliver(ctx context.Context, client *http.Client, wh *webhook, event *CloudEvent) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		d.log.Error(err, "Failed to encode event", "webhook", wh.Name, "type", event.Type)
+		return
+	}
+
+	backoff := initialBackoff
+	for attempt := 1; ; attempt++ {
+		err = post(ctx, client, &wh.Endpoint, body)
+		if err == nil {
+			metrics.WebhookDeliveriesTotal.WithLabelValues(wh.Name, "success").Inc()
+			return
+		}
+		if attempt == maxAttempts {
+			metrics.WebhookDeliveriesTotal.WithLabelValues(wh.Name, "failure").Inc()
+			d.log.Error(err, "Failed to deliver event, dropping it", "webhook", wh.Name, "type", event.Type, "id", event.ID, "attempts", attempt)
+			return
+		}
+
+		d.log.V(1).Info("Webhook delivery failed, retrying", "webhook", wh.Name, "id", event.ID, "attempt", attempt, "error", err.Error())
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// post sends one delivery attempt.
+func post(ctx context.Context, client *http.Client, endpoint *Endpoint, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/cloudevents+json")
+	if endpoint.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign([]byte(endpoint.Secret), body))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Sign returns the signature header value for a request body.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}